@@ -0,0 +1,38 @@
+package bme280
+
+import (
+	"os"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"tinygo.org/x/drivers"
+	"tinygo.org/x/drivers/tester"
+)
+
+func TestConfigureRead(t *testing.T) {
+	c := qt.New(t)
+	f, err := os.Open("testdata/configure.txt")
+	c.Assert(err, qt.IsNil)
+	defer f.Close()
+	bus := tester.NewI2CReplay(c, f)
+
+	d := New(bus)
+	c.Assert(d.Connected(), qt.IsTrue)
+	d.Configure()
+
+	temp, err := d.ReadTemperature()
+	c.Assert(err, qt.IsNil)
+	c.Assert(temp, qt.Equals, int32(25080))
+
+	pressure, err := d.ReadPressure()
+	c.Assert(err, qt.IsNil)
+	c.Assert(pressure, qt.Equals, int32(100653000))
+
+	humidity, err := d.ReadHumidity()
+	c.Assert(err, qt.IsNil)
+	c.Assert(humidity, qt.Equals, int32(3793))
+
+	_, err = d.ReadTemperature()
+	c.Assert(err, qt.Equals, drivers.ErrNack)
+	bus.Done()
+}
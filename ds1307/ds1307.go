@@ -19,6 +19,8 @@ type Device struct {
 	AddressSRAM uint8
 }
 
+var _ drivers.RTC = (*Device)(nil)
+
 // New creates a new DS1307 connection. I2C bus must be already configured.
 func New(bus drivers.I2C) Device {
 	return Device{bus: bus,
@@ -19,6 +19,8 @@ type Device struct {
 	Address uint16
 }
 
+var _ drivers.RTC = (*Device)(nil)
+
 // New creates a new DS3231 connection. The I2C bus must already be
 // configured.
 //
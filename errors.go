@@ -0,0 +1,19 @@
+package drivers
+
+import "errors"
+
+// Errors for drivers to check with errors.Is.  They are returned by the
+// buses of this repository, the i2csoft bus and the mock buses of the tester
+// package.  The hardware I2C buses of the machine package are not wrapped:
+// their errors differ between targets and are mostly unexported, so a
+// driver can't tell a missing device from another bus error on them.
+var (
+	// ErrNack is returned by the i2csoft bus when an I2C device doesn't
+	// acknowledge its address or a byte, such as a missing or busy device.
+	ErrNack = errors.New("i2c: no acknowledge")
+
+	// ErrTimeout is for a transaction that doesn't complete in time, such
+	// as when a device stretches the clock for too long.  No bus returns it
+	// yet, it can be injected in the tester mock buses.
+	ErrTimeout = errors.New("bus timeout")
+)
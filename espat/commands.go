@@ -38,6 +38,9 @@ const (
 	// List available AP's
 	ListAP = "+CWLAP"
 
+	// Configure the properties shown when listing AP's
+	ListAPOptions = "+CWLAPOPT"
+
 	// Disconnect from the current AP
 	Disconnect = "+CWQAP"
 
@@ -66,6 +69,9 @@ const (
 	// Set IP address of ESP8266/ESP32 station
 	SetStationIP = "+CIPSTA"
 
+	// Set host name of ESP8266/ESP32 station
+	SetStationHostname = "+CWHOSTNAME"
+
 	// Set IP address of ESP8266/ESP32 when acting as access point.
 	// On the ESP8266 the IP address will not be saved in flash memory, so it will be forgotten on next reset.
 	// On the ESP32 the IP address WILL be saved in flash memory, so it will be used on next reset.
@@ -108,4 +114,7 @@ const (
 
 	// Set timeout when ESP8266/ESP32 runs as TCP server
 	SetServerTimeout = "+CIPSTO"
+
+	// Get/set DNS servers
+	DNSServers = "+CIPDNS"
 )
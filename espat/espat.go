@@ -21,8 +21,10 @@
 package espat // import "tinygo.org/x/drivers/espat"
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"machine"
 	"net"
 	"net/netip"
@@ -42,28 +44,95 @@ type Config struct {
 	Rx   machine.Pin
 }
 
+// ErrDataLost is returned by Recv once data was received on a TCP or TLS
+// socket faster than it was read, and some had to be dropped
+var ErrDataLost = errors.New("socket data lost, receive buffer full")
+
+const (
+	// Number of links (connections) in multiple connection mode
+	maxLinks = 5
+	// Maximum number of sockets, including listening sockets
+	maxSockets = maxLinks + 1
+	noLink     = -1
+	// Maximum number of bytes received and not read yet on a link, or in
+	// single connection mode. UDP datagrams that don't fit are dropped, TCP
+	// data that doesn't fit breaks the connection.
+	maxLinkData = 4096
+	// Maximum number of bytes read from the UART and not processed yet, an
+	// +IPD header and its data
+	maxRx = maxLinkData + 64
+)
+
 type socket struct {
-	inUse    bool
-	protocol int
-	laddr    netip.AddrPort
+	protocol  int
+	laddr     netip.AddrPort
+	raddr     netip.AddrPort
+	link      int
+	listening bool
+	// The link was closed by the remote end
+	closed bool
+	// data received on the link, or datagrams received on an UDP link
+	data      []byte
+	datagrams [][]byte
+	// data received on the link was dropped
+	lost bool
+}
+
+// receive queues the data of an +IPD, as a datagram on UDP sockets.
+// Datagrams that don't fit in maxLinkData are dropped, and so is the stream
+// data beyond it, which loses the connection.
+func (s *socket) receive(data []byte) {
+	if s.protocol == netdev.IPPROTO_UDP {
+		queued := len(data)
+		for _, dgram := range s.datagrams {
+			queued += len(dgram)
+		}
+		if queued <= maxLinkData {
+			s.datagrams = append(s.datagrams, append([]byte(nil), data...))
+		}
+		return
+	}
+	if s.lost {
+		return
+	}
+	if len(s.data)+len(data) > maxLinkData {
+		s.lost = true
+	}
+	s.data = appendData(s.data, data)
 }
 
 type Device struct {
 	cfg  *Config
 	uart *machine.UART
-	// command responses that come back from the ESP8266/ESP32
+	// bytes read from the UART and not processed yet
+	rx []byte
+	// command responses that come back from the ESP8266/ESP32, and the
+	// start of the bytes read last
 	response []byte
+	lastRead int
 	// data received from a TCP/UDP connection forwarded by the ESP8266/ESP32
-	data   []byte
-	socket socket
-	mu     sync.Mutex
+	// in single connection mode
+	data []byte
+	mu   sync.Mutex
+
+	// sockets keyed by sockfd, and the sockets using each link
+	sockets map[int]*socket
+	links   [maxLinks]*socket
+	// links of the incoming connections not accepted yet
+	incoming []int
+
+	notifyCb func(netlink.Event)
+	// Last IP address assigned
+	ip netip.Addr
 }
 
 func NewDevice(cfg *Config) *Device {
 	return &Device{
 		cfg:      cfg,
-		response: make([]byte, 1500),
+		rx:       make([]byte, 0, 1500),
+		response: make([]byte, 0, 1500),
 		data:     make([]byte, 0, 1500),
+		sockets:  make(map[int]*socket),
 	}
 }
 
@@ -73,6 +142,16 @@ func (d *Device) NetConnect(params *netlink.ConnectParams) error {
 		return netlink.ErrMissingSSID
 	}
 
+	for _, ip := range append([]netip.Addr{params.Addr, params.Netmask, params.Gateway}, params.DNS...) {
+		if ip.IsValid() && !ip.Is4() {
+			return netlink.ErrNotSupported
+		}
+	}
+	// The firmware takes up to 3 DNS servers
+	if len(params.DNS) > 3 {
+		return netlink.ErrNotSupported
+	}
+
 	d.uart = d.cfg.Uart
 	d.uart.Configure(machine.UARTConfig{TX: d.cfg.Tx, RX: d.cfg.Rx})
 
@@ -95,37 +174,204 @@ func (d *Device) NetConnect(params *netlink.ConnectParams) error {
 
 	// Connect to Wifi AP
 	fmt.Printf("Connecting to Wifi SSID '%s'...", params.Ssid)
+	d.notify(netlink.EventConnecting)
 
 	d.SetWifiMode(WifiModeClient)
 
+	if err := d.setIPConfig(params); err != nil {
+		fmt.Printf("FAILED\r\n")
+		return err
+	}
+
 	err := d.ConnectToAP(params.Ssid, params.Passphrase, 10 /* secs */)
 	if err != nil {
 		fmt.Printf("FAILED\r\n")
+		switch connectErrorCode(err) {
+		case 2: // wrong password
+			d.notify(netlink.EventAuthFailure)
+		case 3: // cannot find the target AP
+			d.notify(netlink.EventNoAP)
+		}
 		return err
 	}
 
 	fmt.Printf("CONNECTED\r\n")
 
+	// Multiple connection mode, for multiple sockets
+	if err := d.SetMux(TCPMuxMultiple); err != nil {
+		return err
+	}
+
 	ip, err := d.Addr()
 	if err != nil {
 		return err
 	}
-	fmt.Printf("DHCP-assigned IP: %s\r\n", ip)
+	if params.Addr.IsValid() {
+		fmt.Printf("Static IP: %s\r\n", ip)
+	} else {
+		fmt.Printf("DHCP-assigned IP: %s\r\n", ip)
+	}
 	fmt.Printf("\r\n")
 
+	if !params.Addr.IsValid() {
+		d.notify(netlink.EventDHCPBound)
+	}
+	if d.ip.IsValid() && d.ip != ip {
+		d.notify(netlink.EventIPChanged)
+	}
+	d.ip = ip
+	d.notify(netlink.EventNetUp)
+
 	return nil
 }
 
+// setIPConfig applies the hostname, static IP and DNS configuration
+func (d *Device) setIPConfig(params *netlink.ConnectParams) error {
+	if params.Hostname != "" {
+		if err := d.SetClientHostname(params.Hostname); err != nil {
+			return err
+		}
+	}
+
+	if params.Addr.IsValid() {
+		gateway, netmask := params.Gateway, params.Netmask
+		if !gateway.IsValid() {
+			gateway = netip.IPv4Unspecified()
+		}
+		if !netmask.IsValid() {
+			netmask = netip.AddrFrom4([4]byte{255, 255, 255, 0})
+		}
+		err := d.SetClientIPConfig(params.Addr.String(), gateway.String(), netmask.String())
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(params.DNS) > 0 {
+		servers := make([]string, len(params.DNS))
+		for i, dns := range params.DNS {
+			servers[i] = dns.String()
+		}
+		return d.SetDNSServers(servers...)
+	}
+	return nil
+}
+
+// connectErrorCode returns the <error code> of a failed AT+CWJAP command
+// response, "+CWJAP:<error code>", or 0 if not found
+func connectErrorCode(err error) int {
+	prefix := ConnectAP + ":"
+	msg := err.Error()
+	i := strings.Index(msg, prefix)
+	if i < 0 || i+len(prefix) >= len(msg) {
+		return 0
+	}
+	code, _ := strconv.Atoi(msg[i+len(prefix) : i+len(prefix)+1])
+	return code
+}
+
 func (d *Device) NetDisconnect() {
 	d.DisconnectFromAP()
 	fmt.Printf("\r\nDisconnected from Wifi\r\n\r\n")
+	d.notify(netlink.EventNetDown)
 }
 
 func (d *Device) NetNotify(cb func(netlink.Event)) {
-	// Not supported
+	d.notifyCb = cb
+}
+
+func (d *Device) notify(event netlink.Event) {
+	if d.notifyCb != nil {
+		d.notifyCb(event)
+	}
+}
+
+func (d *Device) NetScan() ([]netlink.ScanResult, error) {
+	if d.uart == nil {
+		d.uart = d.cfg.Uart
+		d.uart.Configure(machine.UARTConfig{TX: d.cfg.Tx, RX: d.cfg.Rx})
+	}
+
+	resp, err := d.ListAPs()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []netlink.ScanResult{}
+	for _, line := range strings.Split(resp, "\n") {
+		if result, ok := parseAP(strings.TrimSpace(line)); ok {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// parseAP parses a +CWLAP:(<ecn>,"<ssid>",<rssi>,"<mac>",<channel>) line.
+// The fields are parsed from both ends as the SSID may contain commas.
+func parseAP(line string) (netlink.ScanResult, bool) {
+	prefix := ListAP + ":("
+	if !strings.HasPrefix(line, prefix) || !strings.HasSuffix(line, ")") {
+		return netlink.ScanResult{}, false
+	}
+	line = line[len(prefix) : len(line)-1]
+
+	first := strings.Index(line, ",")
+	if first < 0 {
+		return netlink.ScanResult{}, false
+	}
+	ecn, err := strconv.Atoi(line[:first])
+	if err != nil {
+		return netlink.ScanResult{}, false
+	}
+
+	var fields [3]string
+	rest := line[first+1:]
+	for i := len(fields) - 1; i >= 0; i-- {
+		last := strings.LastIndex(rest, ",")
+		if last < 0 {
+			return netlink.ScanResult{}, false
+		}
+		fields[i] = rest[last+1:]
+		rest = rest[:last]
+	}
+
+	rssi, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return netlink.ScanResult{}, false
+	}
+	bssid, _ := net.ParseMAC(strings.Trim(fields[1], "\""))
+	channel, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return netlink.ScanResult{}, false
+	}
+
+	var authType netlink.AuthType
+	switch ecn {
+	case 0: // OPEN
+		authType = netlink.AuthTypeOpen
+	case 1: // WEP
+		authType = netlink.AuthTypeWEP
+	case 2: // WPA_PSK
+		authType = netlink.AuthTypeWPA
+	case 4: // WPA_WPA2_PSK
+		authType = netlink.AuthTypeWPA2Mixed
+	default:
+		authType = netlink.AuthTypeWPA2
+	}
+
+	return netlink.ScanResult{
+		Ssid:     strings.TrimSuffix(strings.TrimPrefix(rest, "\""), "\""),
+		Bssid:    bssid,
+		Rssi:     rssi,
+		Channel:  channel,
+		AuthType: authType,
+	}, true
 }
 
 func (d *Device) GetHostByName(name string) (netip.Addr, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	ip, err := d.GetDNS(name)
 	if err != nil {
 		return netip.Addr{}, err
@@ -137,6 +383,100 @@ func (d *Device) GetHardwareAddr() (net.HardwareAddr, error) {
 	return net.HardwareAddr{}, netlink.ErrNotSupported
 }
 
+func (d *Device) GetLinkStatus() (netlink.LinkStatus, error) {
+	var status netlink.LinkStatus
+
+	// +CWJAP:<ssid>,<bssid>,<channel>,<rssi>,...
+	resp, err := d.GetConnectedAP()
+	if err != nil {
+		return status, err
+	}
+	if !parseConnectedAP(string(resp), &status) {
+		return status, netlink.ErrNotConnected
+	}
+
+	// +CIPSTA:ip:<ip>, +CIPSTA:gateway:<gateway>, +CIPSTA:netmask:<netmask>
+	ipconfig, err := d.GetClientIP()
+	if err != nil {
+		return status, err
+	}
+	for _, line := range strings.Split(ipconfig, "\n") {
+		addrs := quotedAddrs(line)
+		if len(addrs) == 0 {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, SetStationIP+":ip:"):
+			status.Addr = addrs[0]
+		case strings.HasPrefix(line, SetStationIP+":gateway:"):
+			status.Gateway = addrs[0]
+		case strings.HasPrefix(line, SetStationIP+":netmask:"):
+			status.Netmask = addrs[0]
+		}
+	}
+
+	// +CIPDNS:<enable>,<dns1>,<dns2>,<dns3>, not supported by all firmware
+	if dns, err := d.GetDNSServers(); err == nil {
+		for _, line := range strings.Split(dns, "\n") {
+			if strings.HasPrefix(line, DNSServers) {
+				status.DNS = append(status.DNS, quotedAddrs(line)...)
+			}
+		}
+	}
+
+	return status, nil
+}
+
+// parseConnectedAP parses the +CWJAP:"<ssid>","<bssid>",<channel>,<rssi>
+// AT+CWJAP? response line.  The BSSID is searched for after the SSID as the
+// SSID may contain commas or quotes.
+func parseConnectedAP(resp string, status *netlink.LinkStatus) bool {
+	prefix := ConnectAP + ":\""
+	start := strings.Index(resp, prefix)
+	if start < 0 {
+		return false
+	}
+	line := resp[start+len(prefix):]
+	if end := strings.Index(line, "\r"); end >= 0 {
+		line = line[:end]
+	}
+
+	const macLen = len("00:00:00:00:00:00")
+	for i := strings.Index(line, "\",\""); i >= 0; {
+		rest := line[i+3:]
+		if len(rest) > macLen && rest[macLen] == '"' {
+			if bssid, err := net.ParseMAC(rest[:macLen]); err == nil {
+				fields := strings.Split(rest[macLen+1:], ",")
+				if len(fields) < 3 {
+					return false
+				}
+				status.Bssid = bssid
+				status.Channel, _ = strconv.Atoi(fields[1])
+				status.Rssi, _ = strconv.Atoi(fields[2])
+				return true
+			}
+		}
+		next := strings.Index(rest, "\",\"")
+		if next < 0 {
+			break
+		}
+		i += 3 + next
+	}
+	return false
+}
+
+// quotedAddrs returns the quoted IP addresses found in a response line
+func quotedAddrs(line string) []netip.Addr {
+	var addrs []netip.Addr
+	fields := strings.Split(line, "\"")
+	for i := 1; i < len(fields); i += 2 {
+		if addr, err := netip.ParseAddr(fields[i]); err == nil {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
 func (d *Device) Addr() (netip.Addr, error) {
 	resp, err := d.GetClientIP()
 	if err != nil {
@@ -168,68 +508,205 @@ func (d *Device) Socket(domain int, stype int, protocol int) (int, error) {
 		return -1, netdev.ErrProtocolNotSupported
 	}
 
-	// Only supporting single connection mode, so only one socket at a time
-	if d.socket.inUse {
-		return -1, netdev.ErrNoMoreSockets
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.newSocket(&socket{protocol: protocol, link: noLink})
+}
+
+// newSocket returns the lowest free sockfd for the socket
+func (d *Device) newSocket(s *socket) (int, error) {
+	for sockfd := 0; sockfd < maxSockets; sockfd++ {
+		if _, ok := d.sockets[sockfd]; !ok {
+			d.sockets[sockfd] = s
+			return sockfd, nil
+		}
 	}
-	d.socket.inUse = true
-	d.socket.protocol = protocol
+	return -1, netdev.ErrNoMoreSockets
+}
 
-	return 0, nil
+// freeLink returns the lowest link not in use, including by incoming
+// connections not accepted yet
+func (d *Device) freeLink() int {
+	for link, s := range d.links {
+		if s == nil {
+			return link
+		}
+	}
+	return noLink
 }
 
 func (d *Device) Bind(sockfd int, ip netip.AddrPort) error {
-	d.socket.laddr = ip
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.sockets[sockfd]
+	if !ok {
+		return netdev.ErrInvalidSocketFd
+	}
+	s.laddr = ip
 	return nil
 }
 
 func (d *Device) Connect(sockfd int, host string, ip netip.AddrPort) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.sockets[sockfd]
+	if !ok {
+		return netdev.ErrInvalidSocketFd
+	}
+
+	link := d.freeLink()
+	if link == noLink {
+		return netdev.ErrNoMoreSockets
+	}
+
 	var err error
 	var addr = ip.Addr().String()
 	var rport = strconv.Itoa(int(ip.Port()))
-	var lport = strconv.Itoa(int(d.socket.laddr.Port()))
 
-	switch d.socket.protocol {
+	// Reserve the link, data may be received as soon as connected
+	d.links[link] = s
+	switch s.protocol {
 	case netdev.IPPROTO_TCP:
-		err = d.ConnectTCPSocket(addr, rport)
+		err = d.OpenLink(link, "TCP", addr, rport, "120")
 	case netdev.IPPROTO_UDP:
-		err = d.ConnectUDPSocket(addr, rport, lport)
+		if lport := s.laddr.Port(); lport != 0 {
+			err = d.OpenLink(link, "UDP", addr, rport, strconv.Itoa(int(lport)), "0")
+		} else {
+			err = d.OpenLink(link, "UDP", addr, rport)
+		}
 	case netdev.IPPROTO_TLS:
-		err = d.ConnectSSLSocket(host, rport)
+		err = d.OpenLink(link, "SSL", host, rport, "120")
 	}
 
 	if err != nil {
+		d.links[link] = nil
 		if host == "" {
-			return fmt.Errorf("Connect to %s timed out", ip)
-		} else {
-			return fmt.Errorf("Connect to %s:%d timed out", host, ip.Port())
+			return fmt.Errorf("Connect to %s failed: %w", ip, err)
 		}
+		return fmt.Errorf("Connect to %s:%d failed: %w", host, ip.Port(), err)
 	}
 
+	s.link = link
+	s.raddr = ip
 	return nil
 }
 
 func (d *Device) Listen(sockfd int, backlog int) error {
-	switch d.socket.protocol {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.sockets[sockfd]
+	if !ok {
+		return netdev.ErrInvalidSocketFd
+	}
+	lport := strconv.Itoa(int(s.laddr.Port()))
+
+	switch s.protocol {
+	case netdev.IPPROTO_TCP:
+		// The firmware runs a single TCP server
+		for _, other := range d.sockets {
+			if other.listening && other.protocol == netdev.IPPROTO_TCP {
+				return netdev.ErrNoMoreSockets
+			}
+		}
+		if err := d.StartServer(lport); err != nil {
+			return err
+		}
 	case netdev.IPPROTO_UDP:
+		link := d.freeLink()
+		if link == noLink {
+			return netdev.ErrNoMoreSockets
+		}
+		d.links[link] = s
+		// Mode 2: the remote end changes to the last datagram sender
+		if err := d.OpenLink(link, "UDP", "0.0.0.0", "0", lport, "2"); err != nil {
+			d.links[link] = nil
+			return err
+		}
+		s.link = link
 	default:
 		return netdev.ErrProtocolNotSupported
 	}
+
+	s.listening = true
 	return nil
 }
 
 func (d *Device) Accept(sockfd int) (int, netip.AddrPort, error) {
-	return -1, netip.AddrPort{}, netdev.ErrNotSupported
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.sockets[sockfd]
+	if !ok {
+		return -1, netip.AddrPort{}, netdev.ErrInvalidSocketFd
+	}
+	if !s.listening || s.protocol != netdev.IPPROTO_TCP {
+		return -1, netip.AddrPort{}, netdev.ErrNotSupported
+	}
+
+	for {
+		d.poll()
+
+		if len(d.incoming) > 0 {
+			link := d.incoming[0]
+			client := d.links[link]
+			fd, err := d.newSocket(client)
+			if err != nil {
+				// Try again once a socket is closed
+				return -1, netip.AddrPort{}, err
+			}
+			d.incoming = d.incoming[1:]
+			client.raddr = d.remoteAddr(link)
+			return fd, client.raddr, nil
+		}
+
+		// Unlock while we sleep, so others can make progress
+		d.mu.Unlock()
+		time.Sleep(100 * time.Millisecond)
+		d.mu.Lock()
+
+		if _, ok := d.sockets[sockfd]; !ok {
+			return -1, netip.AddrPort{}, netdev.ErrInvalidSocketFd
+		}
+	}
+}
+
+// remoteAddr returns the remote address of a link from the connection status
+func (d *Device) remoteAddr(link int) netip.AddrPort {
+	status, err := d.GetConnectionStatus()
+	if err != nil {
+		return netip.AddrPort{}
+	}
+	prefix := TCPStatus + ":" + strconv.Itoa(link) + ","
+	for _, line := range strings.Split(status, "\n") {
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		// <link>,<type>,<remote ip>,<remote port>,...
+		fields := strings.Split(strings.TrimSpace(line[len(prefix):]), ",")
+		if len(fields) < 3 {
+			break
+		}
+		addrs := quotedAddrs(fields[1])
+		port, _ := strconv.Atoi(fields[2])
+		if len(addrs) > 0 {
+			return netip.AddrPortFrom(addrs[0], uint16(port))
+		}
+	}
+	return netip.AddrPort{}
 }
 
-func (d *Device) sendChunk(sockfd int, buf []byte, deadline time.Time) (int, error) {
+func (d *Device) sendChunk(link int, buf []byte, deadline time.Time) (int, error) {
 	// Check if we've timed out
 	if !deadline.IsZero() {
 		if time.Now().After(deadline) {
 			return -1, netdev.ErrTimeout
 		}
 	}
-	err := d.StartSocketSend(len(buf))
+	err := d.StartLinkSend(link, len(buf))
 	if err != nil {
 		return -1, err
 	}
@@ -249,6 +726,17 @@ func (d *Device) Send(sockfd int, buf []byte, flags int, deadline time.Time) (in
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
+	s, ok := d.sockets[sockfd]
+	if !ok {
+		return -1, netdev.ErrInvalidSocketFd
+	}
+	if s.link == noLink {
+		return -1, netdev.ErrNotSupported
+	}
+	if s.closed {
+		return -1, io.EOF
+	}
+
 	// Break large bufs into chunks so we don't overrun the hw queue
 
 	chunkSize := 1436
@@ -257,7 +745,7 @@ func (d *Device) Send(sockfd int, buf []byte, flags int, deadline time.Time) (in
 		if end > len(buf) {
 			end = len(buf)
 		}
-		_, err := d.sendChunk(sockfd, buf[i:end], deadline)
+		_, err := d.sendChunk(s.link, buf[i:end], deadline)
 		if err != nil {
 			return -1, err
 		}
@@ -271,14 +759,36 @@ func (d *Device) Recv(sockfd int, buf []byte, flags int, deadline time.Time) (in
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	var length = len(buf)
+	for {
+		s, ok := d.sockets[sockfd]
+		if !ok {
+			return -1, netdev.ErrInvalidSocketFd
+		}
 
-	// Limit length read size to chunk large read requests
-	if length > 1436 {
-		length = 1436
-	}
+		d.poll()
+
+		// Each read returns a single datagram, truncated to buf
+		if len(s.datagrams) > 0 {
+			n := copy(buf, s.datagrams[0])
+			s.datagrams = s.datagrams[1:]
+			return n, nil
+		}
+
+		if len(s.data) > 0 {
+			n := copy(buf, s.data)
+			s.data = s.data[n:]
+			return n, nil
+		}
+
+		// The data received before the loss was read
+		if s.lost {
+			return -1, ErrDataLost
+		}
+
+		if s.closed {
+			return -1, io.EOF
+		}
 
-	for {
 		// Check if we've timed out
 		if !deadline.IsZero() {
 			if time.Now().After(deadline) {
@@ -286,18 +796,10 @@ func (d *Device) Recv(sockfd int, buf []byte, flags int, deadline time.Time) (in
 			}
 		}
 
-		n, err := d.ReadSocket(buf[:length])
-		if err != nil {
-			return -1, err
-		}
-		if n == 0 {
-			d.mu.Unlock()
-			time.Sleep(100 * time.Millisecond)
-			d.mu.Lock()
-			continue
-		}
-
-		return n, nil
+		// Unlock while we sleep, so others can make progress
+		d.mu.Unlock()
+		time.Sleep(100 * time.Millisecond)
+		d.mu.Lock()
 	}
 }
 
@@ -305,8 +807,23 @@ func (d *Device) Close(sockfd int) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	d.socket.inUse = false
-	return d.DisconnectSocket()
+	s, ok := d.sockets[sockfd]
+	if !ok {
+		return netdev.ErrInvalidSocketFd
+	}
+	delete(d.sockets, sockfd)
+
+	var err error
+	if s.listening && s.protocol == netdev.IPPROTO_TCP {
+		err = d.StopServer()
+	}
+	if s.link != noLink {
+		if !s.closed {
+			err = d.CloseLink(s.link)
+		}
+		d.links[s.link] = nil
+	}
+	return err
 }
 
 func (d *Device) SetSockOpt(sockfd int, level int, opt int, value interface{}) error {
@@ -359,7 +876,7 @@ func (d Device) Set(cmd, params string) error {
 }
 
 // Version returns the ESP8266/ESP32 firmware version info.
-func (d Device) Version() []byte {
+func (d *Device) Version() []byte {
 	d.Execute(Version)
 	r, err := d.Response(2000)
 	if err != nil {
@@ -370,7 +887,7 @@ func (d Device) Version() []byte {
 }
 
 // Echo sets the ESP8266/ESP32 echo setting.
-func (d Device) Echo(set bool) {
+func (d *Device) Echo(set bool) {
 	if set {
 		d.Execute(EchoConfigOn)
 	} else {
@@ -383,12 +900,13 @@ func (d Device) Echo(set bool) {
 // Reset restarts the ESP8266/ESP32 firmware. Due to how the baud rate changes,
 // this messes up communication with the ESP8266/ESP32 module. So make sure you know
 // what you are doing when you call this.
-func (d Device) Reset() {
+func (d *Device) Reset() {
 	d.Execute(Restart)
 	d.Response(100)
 }
 
-// ReadSocket returns the data that has already been read in from the responses.
+// ReadSocket returns the data that has already been read in from the responses,
+// in single connection mode.
 func (d *Device) ReadSocket(b []byte) (n int, err error) {
 	// make sure no data in buffer
 	d.Response(300)
@@ -409,73 +927,194 @@ func (d *Device) ReadSocket(b []byte) (n int, err error) {
 	return count, nil
 }
 
-// Response gets the next response bytes from the ESP8266/ESP32.
+// Response gets the next response bytes from the ESP8266/ESP32: the bytes
+// received by the last read, holding the "OK" or "ERROR" status.
 // The call will retry for up to timeout milliseconds before returning nothing.
+// Socket data and connection notifications received meanwhile are dispatched
+// to the sockets.
 func (d *Device) Response(timeout int) ([]byte, error) {
-	// read data
-	var size int
-	var start, end int
+	resp, err := d.responseUntil(timeout)
+	if resp == nil {
+		return nil, err
+	}
+	last := resp[d.lastRead:]
+	if err != nil {
+		err = errors.New("response error:" + string(last))
+	}
+	return last, err
+}
+
+// FullResponse is Response returning all the bytes received until the "OK"
+// or "ERROR" status, such as the lines of a multi-line response.
+func (d *Device) FullResponse(timeout int) ([]byte, error) {
+	return d.responseUntil(timeout)
+}
+
+// responseUntil is FullResponse also returning once one of the markers is
+// received
+func (d *Device) responseUntil(timeout int, markers ...string) ([]byte, error) {
 	pause := 100 // pause to wait for 100 ms
 	retries := timeout / pause
 
+	d.response = d.response[:0]
+	d.lastRead = 0
 	for {
-		size = d.uart.Buffered()
-
-		if size > 0 {
-			end += size
-			d.uart.Read(d.response[start:end])
+		n := len(d.response)
+		d.poll()
+		if len(d.response) > n {
+			d.lastRead = n
+		}
+		resp := string(d.response)
 
-			// if "+IPD" then read socket data
-			if strings.Contains(string(d.response[:end]), "+IPD") {
-				// handle socket data
-				return nil, d.parseIPD(end)
-			}
+		// if "OK" then the command worked
+		if strings.Contains(resp, "OK") {
+			return d.response, nil
+		}
 
-			// if "OK" then the command worked
-			if strings.Contains(string(d.response[:end]), "OK") {
-				return d.response[start:end], nil
-			}
+		// if "Error" then the command failed
+		if strings.Contains(resp, "ERROR") || strings.Contains(resp, "FAIL") {
+			return d.response, errors.New("response error:" + resp)
+		}
 
-			// if "Error" then the command failed
-			if strings.Contains(string(d.response[:end]), "ERROR") {
-				return d.response[start:end], errors.New("response error:" + string(d.response[start:end]))
+		for _, marker := range markers {
+			if strings.Contains(resp, marker) {
+				return d.response, nil
 			}
-
-			// if anything else, then keep reading data in?
-			start = end
 		}
 
 		// wait longer?
 		retries--
-		if retries == 0 {
-			return nil, errors.New("response timeout error:" + string(d.response[start:end]))
+		if retries <= 0 {
+			return nil, errors.New("response timeout error:" + resp)
 		}
 
 		time.Sleep(time.Duration(pause) * time.Millisecond)
 	}
 }
 
-func (d *Device) parseIPD(end int) error {
-	// find the "+IPD," to get length
-	s := strings.Index(string(d.response[:end]), "+IPD,")
+// poll reads the bytes received from the ESP8266/ESP32 and processes them
+func (d *Device) poll() {
+	var buf [64]byte
+	for d.uart.Buffered() > 0 {
+		n, _ := d.uart.Read(buf[:])
+		if n == 0 {
+			break
+		}
+		d.rx = append(d.rx, buf[:n]...)
+		if len(d.rx) >= maxRx {
+			d.process()
+			if len(d.rx) >= maxRx {
+				// not a response nor an +IPD, nothing to keep
+				d.rx = d.rx[:0]
+			}
+		}
+	}
+	d.process()
+}
+
+// process splits the bytes received into socket data, connection
+// notifications and command responses
+func (d *Device) process() {
+	for len(d.rx) > 0 {
+		// +IPD,<len>:<data> or, in multiple connection mode,
+		// +IPD,<link>,<len>:<data>
+		if bytes.HasPrefix(d.rx, []byte("+IPD,")) {
+			colon := bytes.IndexByte(d.rx, ':')
+			if colon < 0 {
+				// wait for the header
+				return
+			}
+			fields := strings.Split(string(d.rx[5:colon]), ",")
+			link := noLink
+			if len(fields) > 1 {
+				link, _ = strconv.Atoi(fields[0])
+				fields = fields[1:]
+			}
+			length, err := strconv.Atoi(fields[0])
+			if err != nil || length < 0 || length > maxLinkData {
+				// not expected data here, skip the header
+				d.rx = d.rx[colon+1:]
+				continue
+			}
+			if len(d.rx) < colon+1+length {
+				// wait for the data
+				return
+			}
+			data := d.rx[colon+1 : colon+1+length]
+			if link == noLink {
+				d.data = appendData(d.data, data)
+			} else if link >= 0 && link < maxLinks && d.links[link] != nil {
+				d.links[link].receive(data)
+			}
+			d.rx = d.rx[colon+1+length:]
+			continue
+		}
 
-	// find the ":"
-	e := strings.Index(string(d.response[:end]), ":")
+		// ">" prompt when ready to receive socket data
+		if d.rx[0] == '>' {
+			d.response = append(d.response, '>')
+			d.rx = d.rx[1:]
+			continue
+		}
 
-	// find the data length
-	val := string(d.response[s+5 : e])
+		eol := bytes.Index(d.rx, []byte("\r\n"))
+		if eol < 0 {
+			// wait for the end of the line, unless it could be the
+			// start of a +IPD
+			return
+		}
+		line := string(d.rx[:eol])
+		d.rx = d.rx[eol+2:]
+		if !d.linkNotification(line) {
+			d.response = append(d.response, line...)
+			d.response = append(d.response, "\r\n"...)
+		}
+	}
+}
 
-	// TODO: verify count
-	v, err := strconv.Atoi(val)
-	if err != nil {
-		// not expected data here. what to do?
-		return err
+// appendData appends the data received to buf, dropping what doesn't fit
+// in maxLinkData
+func appendData(buf, data []byte) []byte {
+	if room := maxLinkData - len(buf); len(data) > room {
+		data = data[:room]
 	}
+	return append(buf, data...)
+}
 
-	// load up the socket data
-	//d.data = append(d.data, d.response[e+1:end]...)
-	d.data = append(d.data, d.response[e+1:e+1+v]...)
-	return nil
+// linkNotification handles the <link>,CONNECT and <link>,CLOSED
+// notifications in multiple connection mode
+func (d *Device) linkNotification(line string) bool {
+	if len(line) < 3 || line[1] != ',' || line[0] < '0' || line[0] >= '0'+maxLinks {
+		return false
+	}
+	link := int(line[0] - '0')
+
+	switch line[2:] {
+	case "CONNECT":
+		if d.links[link] == nil {
+			// incoming connection
+			d.links[link] = &socket{protocol: netdev.IPPROTO_TCP, link: link}
+			d.incoming = append(d.incoming, link)
+		}
+	case "CLOSED":
+		s := d.links[link]
+		if s == nil {
+			break
+		}
+		s.closed = true
+		for i, l := range d.incoming {
+			if l == link {
+				// never accepted
+				d.incoming = append(d.incoming[:i], d.incoming[i+1:]...)
+				d.links[link] = nil
+				break
+			}
+		}
+	case "CONNECT FAIL":
+	default:
+		return false
+	}
+	return true
 }
 
 // IsSocketDataAvailable returns of there is socket data available
@@ -17,7 +17,7 @@ const (
 // GetDNS returns the IP address for a domain name.
 func (d *Device) GetDNS(domain string) (string, error) {
 	d.Set(TCPDNSLookup, "\""+domain+"\"")
-	resp, err := d.Response(1000)
+	resp, err := d.FullResponse(1000)
 	if err != nil {
 		return "", err
 	}
@@ -90,6 +90,74 @@ func (d *Device) DisconnectSocket() error {
 	return nil
 }
 
+// OpenLink creates a new TCP, UDP or SSL connection on a link when the
+// ESP8266/ESP32 is in multiple connection mode (TCPMuxMultiple). params are
+// the optional protocol specific parameters, such as the UDP local port and mode.
+func (d *Device) OpenLink(link int, protocol, addr, port string, params ...string) error {
+	val := strconv.Itoa(link) + ",\"" + protocol + "\",\"" + addr + "\"," + port
+	for _, p := range params {
+		val += "," + p
+	}
+	d.Set(TCPConnect, val)
+	timeout := 3000
+	if protocol == "SSL" {
+		// this operation takes longer, so wait up to 6 seconds to complete.
+		timeout = 6000
+	}
+	// the whole response, "DNS Fail" or "ALREADY CONNECTED" come before
+	// the "ERROR" status
+	_, err := d.FullResponse(timeout)
+	return err
+}
+
+// CloseLink closes the connection on a link in multiple connection mode.
+func (d *Device) CloseLink(link int) error {
+	d.Set(TCPClose, strconv.Itoa(link))
+	_, err := d.Response(1000)
+	return err
+}
+
+// StartLinkSend gets the ESP8266/ESP32 ready to receive socket data for a
+// link in multiple connection mode.
+func (d *Device) StartLinkSend(link int, size int) error {
+	d.Set(TCPSend, strconv.Itoa(link)+","+strconv.Itoa(size))
+
+	// when ">" is received, it indicates
+	// ready to receive data
+	r, err := d.responseUntil(2000, ">")
+	if err != nil {
+		return err
+	}
+	if strings.Contains(string(r), ">") {
+		return nil
+	}
+	return errors.New("StartLinkSend error:" + string(r))
+}
+
+// StartServer starts a TCP server listening on port in multiple connection
+// mode.  Incoming connections are assigned a link.
+func (d *Device) StartServer(port string) error {
+	d.Set(ServerConfig, "1,"+port)
+	_, err := d.Response(1000)
+	return err
+}
+
+// StopServer stops the TCP server.
+func (d *Device) StopServer() error {
+	d.Set(ServerConfig, "0")
+	_, err := d.Response(1000)
+	return err
+}
+
+// GetConnectionStatus returns the ESP8266/ESP32 connections status, one
+// "+CIPSTATUS:<link>,<type>,<remote ip>,<remote port>,<local port>,<tetype>"
+// line per link.
+func (d *Device) GetConnectionStatus() (string, error) {
+	d.Execute(TCPStatus)
+	r, err := d.FullResponse(1000)
+	return string(r), err
+}
+
 // SetMux sets the ESP8266/ESP32 current client TCP/UDP configuration for concurrent connections
 // either single TCPMuxSingle or multiple TCPMuxMultiple (up to 4).
 func (d *Device) SetMux(mode int) error {
@@ -34,7 +34,14 @@ func (d *Device) SetWifiMode(mode int) error {
 // GetConnectedAP returns the ESP8266/ESP32 is currently connected to as a client.
 func (d *Device) GetConnectedAP() ([]byte, error) {
 	d.Query(ConnectAP)
-	return d.Response(100)
+	return d.FullResponse(100)
+}
+
+// GetDNSServers returns the ESP8266/ESP32 DNS server configuration.
+func (d *Device) GetDNSServers() (string, error) {
+	d.Query(DNSServers)
+	r, err := d.FullResponse(1000)
+	return string(r), err
 }
 
 // ConnectToAP connects the ESP8266/ESP32 to an access point.
@@ -47,6 +54,18 @@ func (d *Device) ConnectToAP(ssid, pwd string, ws int) error {
 	return err
 }
 
+// ListAPs returns the access points found by the ESP8266/ESP32, sorted by
+// RSSI, one "+CWLAP:(<ecn>,<ssid>,<rssi>,<mac>,<channel>)" line per access point.
+func (d *Device) ListAPs() (string, error) {
+	d.Set(ListAPOptions, "1,31")
+	if _, err := d.Response(pause); err != nil {
+		return "", err
+	}
+	d.Execute(ListAP)
+	r, err := d.FullResponse(10000)
+	return string(r), err
+}
+
 // DisconnectFromAP disconnects the ESP8266/ESP32 from the current access point.
 func (d *Device) DisconnectFromAP() error {
 	d.Execute(Disconnect)
@@ -57,14 +76,42 @@ func (d *Device) DisconnectFromAP() error {
 // GetClientIP returns the ESP8266/ESP32 current client IP addess when connected to an Access Point.
 func (d *Device) GetClientIP() (string, error) {
 	d.Query(SetStationIP)
-	r, err := d.Response(1000)
+	r, err := d.FullResponse(1000)
 	return string(r), err
 }
 
 // SetClientIP sets the ESP8266/ESP32 current client IP addess when connected to an Access Point.
 func (d *Device) SetClientIP(ipaddr string) error {
 	val := "\"" + ipaddr + "\""
-	d.Set(ConnectAP, val)
+	d.Set(SetStationIP, val)
+	_, err := d.Response(500)
+	return err
+}
+
+// SetClientIPConfig sets the ESP8266/ESP32 static client IP address, gateway and netmask,
+// disabling DHCP.
+func (d *Device) SetClientIPConfig(ipaddr, gateway, netmask string) error {
+	val := "\"" + ipaddr + "\",\"" + gateway + "\",\"" + netmask + "\""
+	d.Set(SetStationIP, val)
+	_, err := d.Response(500)
+	return err
+}
+
+// SetClientHostname sets the ESP8266/ESP32 host name sent to the DHCP server.
+func (d *Device) SetClientHostname(hostname string) error {
+	val := "\"" + hostname + "\""
+	d.Set(SetStationHostname, val)
+	_, err := d.Response(500)
+	return err
+}
+
+// SetDNSServers sets up to 3 ESP8266/ESP32 DNS servers, replacing the DHCP-assigned ones.
+func (d *Device) SetDNSServers(servers ...string) error {
+	val := "1"
+	for _, server := range servers {
+		val += ",\"" + server + "\""
+	}
+	d.Set(DNSServers, val)
 	_, err := d.Response(500)
 	return err
 }
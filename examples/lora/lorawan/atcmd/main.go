@@ -54,6 +54,14 @@ func main() {
 		lorawan.UseRegionSettings(region.EU868())
 	case "US915":
 		lorawan.UseRegionSettings(region.US915())
+	case "AS923":
+		lorawan.UseRegionSettings(region.AS923())
+	case "KR920":
+		lorawan.UseRegionSettings(region.KR920())
+	case "IN865":
+		lorawan.UseRegionSettings(region.IN865())
+	case "CN470":
+		lorawan.UseRegionSettings(region.CN470())
 	default:
 		lorawan.UseRegionSettings(region.EU868())
 	}
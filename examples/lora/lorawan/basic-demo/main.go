@@ -2,6 +2,7 @@
 package main
 
 import (
+	"encoding/hex"
 	"errors"
 	"strconv"
 	"time"
@@ -77,6 +78,14 @@ func main() {
 		lorawan.UseRegionSettings(region.EU868())
 	case "US915":
 		lorawan.UseRegionSettings(region.US915())
+	case "AS923":
+		lorawan.UseRegionSettings(region.AS923())
+	case "KR920":
+		lorawan.UseRegionSettings(region.KR920())
+	case "IN865":
+		lorawan.UseRegionSettings(region.IN865())
+	case "CN470":
+		lorawan.UseRegionSettings(region.CN470())
 	default:
 		lorawan.UseRegionSettings(region.EU868())
 	}
@@ -107,11 +116,15 @@ func main() {
 	for {
 		payload := "Hello TinyGo #" + strconv.Itoa(upCount)
 
-		if err := lorawan.SendUplink([]byte(payload), session); err != nil {
+		dl, err := lorawan.SendUplink([]byte(payload), session)
+		if err != nil {
 			println("Uplink error:", err)
 		} else {
 			println("Uplink success, msg=", payload)
 		}
+		if dl != nil {
+			println("Downlink received, port=", dl.FPort, "ack=", dl.Ack, "payload=", hex.EncodeToString(dl.Payload))
+		}
 
 		println("Sleeping for", LORAWAN_UPLINK_DELAY_SEC, "sec")
 		time.Sleep(time.Second * LORAWAN_UPLINK_DELAY_SEC)
@@ -36,6 +36,11 @@ func (sr *SimLoraRadio) SetSyncWord(syncWord uint16)    {}
 func (sr *SimLoraRadio) SetTxPower(txPower int8)        {}
 func (sr *SimLoraRadio) LoraConfig(cnf lora.Config)     {}
 
+func (sr *SimLoraRadio) Cad(timeoutMs uint32) (bool, error)            { return false, nil }
+func (sr *SimLoraRadio) LastPacketRSSI() int16                         { return 0 }
+func (sr *SimLoraRadio) LastPacketSNR() int8                           { return 0 }
+func (sr *SimLoraRadio) SetListenBeforeTalk(lbt lora.ListenBeforeTalk) {}
+
 func FirmwareVersion() string {
 	return "simulator " + CurrentVersion()
 }
@@ -0,0 +1,116 @@
+// This example is an MQTT client built with the drivers mqtt package.  It
+// sends machine.CPUFrequency() readings to the broker every second, and
+// prints the messages received on the topic.  The client reconnects to the
+// broker when the network comes back up.
+
+//go:build ninafw || wioterminal || challenger_rp2040 || (pico && w5500)
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"machine"
+	"math/rand"
+	"net"
+	"time"
+
+	"tinygo.org/x/drivers/mqtt"
+	"tinygo.org/x/drivers/netlink"
+	"tinygo.org/x/drivers/netlink/probe"
+)
+
+var (
+	ssid   string
+	pass   string
+	broker string = "test.mosquitto.org:1883"
+	topic  string = "cpu/freq"
+)
+
+func main() {
+	waitSerial()
+
+	link, _ := probe.Probe()
+
+	err := link.NetConnect(&netlink.ConnectParams{
+		Ssid:       ssid,
+		Passphrase: pass,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	clientId := "tinygo-client-" + randomString(10)
+	fmt.Printf("ClientId: %s\n", clientId)
+
+	client := mqtt.New(&mqtt.Config{
+		Dial: func() (net.Conn, error) {
+			return net.Dial("tcp", broker)
+		},
+		ClientID: clientId,
+		Will: &mqtt.Message{
+			Topic:   topic + "/status",
+			Payload: []byte("offline"),
+			QoS:     mqtt.QoS1,
+			Retain:  true,
+		},
+	})
+	link.NetNotify(client.HandleEvent)
+
+	fmt.Printf("Connecting to MQTT broker at %s\n", broker)
+	if err := client.Connect(); err != nil {
+		log.Fatal("failed to connect: ", err)
+	}
+
+	err = client.Subscribe(topic, mqtt.QoS0, func(topic, payload []byte) {
+		fmt.Printf("Message %s received on topic %s\n", payload, topic)
+	})
+	if err != nil {
+		log.Fatal("failed to subscribe to", topic, err)
+	}
+	fmt.Printf("Subscribed to topic %s\n", topic)
+
+	client.Publish(topic+"/status", []byte("online"), mqtt.QoS1, true)
+
+	for {
+		freq := float32(machine.CPUFrequency()) / 1000000
+		payload := fmt.Sprintf("%.02fMhz", freq)
+
+		if err := client.Publish(topic, []byte(payload), mqtt.QoS0, false); err != nil {
+			fmt.Printf("error transmitting message: %v\n", err)
+		}
+
+		// Handle the incoming messages for a second
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+			switch err := client.Poll(100 * time.Millisecond); err {
+			case nil:
+			case mqtt.ErrNotConnected:
+				// Waiting to reconnect
+				time.Sleep(100 * time.Millisecond)
+			default:
+				fmt.Printf("poll: %v\n", err)
+			}
+		}
+	}
+}
+
+// Returns an int >= min, < max
+func randomInt(min, max int) int {
+	return min + rand.Intn(max-min)
+}
+
+// Generate a random string of A-Z chars with len = l
+func randomString(len int) string {
+	bytes := make([]byte, len)
+	for i := 0; i < len; i++ {
+		bytes[i] = byte(randomInt(65, 90))
+	}
+	return string(bytes)
+}
+
+// Wait for user to open serial console
+func waitSerial() {
+	for !machine.Serial.DTR() {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
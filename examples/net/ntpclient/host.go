@@ -0,0 +1,10 @@
+//go:build !tinygo
+
+package main
+
+import "time"
+
+func waitSerial() {}
+
+// adjustTime leaves the system time of the host alone
+func adjustTime(offset time.Duration) {}
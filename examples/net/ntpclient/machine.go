@@ -0,0 +1,21 @@
+//go:build tinygo && (ninafw || wioterminal || challenger_rp2040 || (pico && w5500))
+
+package main
+
+import (
+	"machine"
+	"runtime"
+	"time"
+)
+
+// Wait for user to open serial console
+func waitSerial() {
+	for !machine.Serial.DTR() {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// adjustTime sets the system time to NTP time
+func adjustTime(offset time.Duration) {
+	runtime.AdjustTimeOffset(int64(offset))
+}
@@ -0,0 +1,55 @@
+// This example scans for nearby Wifi access points and lists them.
+
+//go:build ninafw || wioterminal || challenger_rp2040
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"machine"
+	"time"
+
+	"tinygo.org/x/drivers/netlink"
+	"tinygo.org/x/drivers/netlink/probe"
+)
+
+var authTypes = map[netlink.AuthType]string{
+	netlink.AuthTypeWPA2:      "WPA2",
+	netlink.AuthTypeOpen:      "Open",
+	netlink.AuthTypeWPA:       "WPA",
+	netlink.AuthTypeWPA2Mixed: "WPA2/WPA",
+	netlink.AuthTypeWEP:       "WEP",
+}
+
+func main() {
+
+	waitSerial()
+
+	link, _ := probe.Probe()
+
+	scanner, ok := link.(netlink.Scanner)
+	if !ok {
+		log.Fatal("netlink: scanning not supported")
+	}
+
+	for {
+		results, err := scanner.NetScan()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%-32s %-17s %4s %3s %s\r\n", "SSID", "BSSID", "RSSI", "CH", "AUTH")
+		for _, r := range results {
+			fmt.Printf("%-32s %-17s %4d %3d %s\r\n", r.Ssid, r.Bssid, r.Rssi, r.Channel, authTypes[r.AuthType])
+		}
+		fmt.Printf("\r\n")
+		time.Sleep(10 * time.Second)
+	}
+}
+
+// Wait for user to open serial console
+func waitSerial() {
+	for !machine.Serial.DTR() {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
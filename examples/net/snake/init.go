@@ -1,4 +1,4 @@
-//go:build ninafw || wioterminal
+//go:build ninafw || wioterminal || (pico && w5500)
 
 package main
 
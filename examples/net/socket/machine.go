@@ -0,0 +1,15 @@
+//go:build tinygo && (ninafw || wioterminal || challenger_rp2040 || (pico && w5500))
+
+package main
+
+import (
+	"machine"
+	"time"
+)
+
+// Wait for user to open serial console
+func waitSerial() {
+	for !machine.Serial.DTR() {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
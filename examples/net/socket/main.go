@@ -3,8 +3,11 @@
 // You can open a server to accept connections from this program using:
 //
 // nc -lk 8080
+//
+// On the host, "go run ." connects through the netdevtest fake, bridged to
+// the host's sockets.
 
-//go:build ninafw || wioterminal || challenger_rp2040
+//go:build ninafw || wioterminal || challenger_rp2040 || (pico && w5500) || !tinygo
 
 package main
 
@@ -12,7 +15,6 @@ import (
 	"bytes"
 	"fmt"
 	"log"
-	"machine"
 	"net/netip"
 	"time"
 
@@ -99,10 +101,3 @@ func sendBatch() {
 func message(msg string) {
 	println(msg, "\r")
 }
-
-// Wait for user to open serial console
-func waitSerial() {
-	for !machine.Serial.DTR() {
-		time.Sleep(100 * time.Millisecond)
-	}
-}
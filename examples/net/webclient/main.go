@@ -17,7 +17,7 @@
 // }
 // ---------------------------------------------------------------------------
 
-//go:build ninafw || wioterminal
+//go:build ninafw || wioterminal || (pico && w5500)
 
 package main
 
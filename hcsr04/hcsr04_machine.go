@@ -0,0 +1,14 @@
+//go:build tinygo
+
+package hcsr04
+
+import (
+	"machine"
+
+	"tinygo.org/x/drivers/pin"
+)
+
+// New returns a new ultrasonic driver given 2 pins
+func New(trigger, echo machine.Pin) Device {
+	return NewPins(pin.Pin(trigger), pin.Pin(echo))
+}
@@ -0,0 +1,39 @@
+package hcsr04
+
+import (
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"tinygo.org/x/drivers/tester"
+)
+
+func TestReadPulse(t *testing.T) {
+	c := qt.New(t)
+	trigger := tester.NewPin(c)
+	echo := tester.NewPin(c)
+	d := NewPins(trigger, echo)
+	d.Configure()
+
+	echo.Play(
+		tester.Pulse{High: false, Duration: time.Millisecond},
+		tester.Pulse{High: true, Duration: 5 * time.Millisecond},
+		tester.Pulse{High: false},
+	)
+	// The measure is off when the test is descheduled while polling
+	pulse := d.ReadPulse()
+	c.Assert(pulse > 4000 && pulse < 6000, qt.IsTrue, qt.Commentf("pulse %dus", pulse))
+
+	// Trigger pulse of 10us
+	c.Assert(trigger.Levels(), qt.DeepEquals, []bool{true, false})
+	width := trigger.Log[1].Time.Sub(trigger.Log[0].Time)
+	c.Assert(width >= 10*time.Microsecond, qt.IsTrue, qt.Commentf("trigger %v", width))
+}
+
+func TestReadPulseTimeout(t *testing.T) {
+	c := qt.New(t)
+	d := NewPins(tester.NewPin(c), tester.NewPin(c))
+	d.Configure()
+
+	c.Assert(d.ReadPulse(), qt.Equals, int32(0))
+}
@@ -1,10 +1,10 @@
 package i2csoft
 
 import (
-	"errors"
 	"machine"
 	"time"
 
+	"tinygo.org/x/drivers"
 	"tinygo.org/x/drivers/delay"
 )
 
@@ -25,10 +25,6 @@ type I2CConfig struct {
 	SDA       machine.Pin
 }
 
-var (
-	errSI2CAckExpected = errors.New("I2C error: expected ACK not NACK")
-)
-
 // New returns the i2csoft driver. For the arguments, specify the pins to be
 // used as SCL and SDA. As I2C is implemented in software, any GPIO pin can be
 // specified.
@@ -85,7 +81,7 @@ func (i2c *I2C) Tx(addr uint16, w, r []byte) error {
 		// ACK received (0: ACK, 1: NACK)
 		if i2c.nack {
 			i2c.signalStop()
-			return errSI2CAckExpected
+			return drivers.ErrNack
 		}
 
 		// write data
@@ -104,7 +100,7 @@ func (i2c *I2C) Tx(addr uint16, w, r []byte) error {
 		// ACK received (0: ACK, 1: NACK)
 		if i2c.nack {
 			i2c.signalStop()
-			return errSI2CAckExpected
+			return drivers.ErrNack
 		}
 
 		// read first byte
@@ -2,6 +2,7 @@ package drivers
 
 import (
 	"image/color"
+	"time"
 )
 
 // LEDArray is an array of RGB LEDs. It may have any shape, but in general it is
@@ -12,3 +13,11 @@ type LEDArray interface {
 	// correctly-sized slice of colors.
 	WriteColors(buf []color.RGBA) error
 }
+
+// RTC is a real time clock, such as the ds1307, ds3231, pcf8523 and pcf8563.
+type RTC interface {
+	// ReadTime returns the time kept by the clock.
+	ReadTime() (time.Time, error)
+	// SetTime sets the clock to the given time.
+	SetTime(t time.Time) error
+}
@@ -0,0 +1,42 @@
+package lora
+
+import (
+	"math"
+	"time"
+)
+
+// bandwidthHz holds the bandwidth in Hz of the Bandwidth_* constants
+var bandwidthHz = [...]uint32{7800, 10400, 15600, 20800, 31250, 41700, 62500, 125000, 250000, 500000}
+
+// TimeOnAir returns the duration of the transmission of a packet with the
+// given payload length using this configuration, as computed in the
+// SX1276 datasheet section 4.1.1.7
+func (cnf Config) TimeOnAir(payloadLen int) time.Duration {
+	if int(cnf.Bw) >= len(bandwidthHz) {
+		return 0
+	}
+	bw := float64(bandwidthHz[cnf.Bw])
+	sf := float64(cnf.Sf)
+
+	// Symbol duration in seconds
+	tSym := math.Pow(2, sf) / bw
+
+	de := 0.0
+	if cnf.Ldr == LowDataRateOptimizeOn || tSym > 0.016 {
+		de = 1
+	}
+	ih := 0.0
+	if cnf.HeaderType == HeaderImplicit {
+		ih = 1
+	}
+	crc := 0.0
+	if cnf.Crc == CRCOn {
+		crc = 1
+	}
+
+	tPreamble := (float64(cnf.Preamble) + 4.25) * tSym
+	n := math.Ceil((8*float64(payloadLen)-4*sf+28+16*crc-20*ih)/(4*(sf-2*de))) * float64(cnf.Cr+4)
+	nPayload := 8 + math.Max(n, 0)
+
+	return time.Duration((tPreamble + nPayload*tSym) * float64(time.Second))
+}
@@ -0,0 +1,26 @@
+package lora
+
+import (
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestTimeOnAir(t *testing.T) {
+	c := qt.New(t)
+
+	cnf := Config{
+		Sf:         SpreadingFactor7,
+		Bw:         Bandwidth_125_0,
+		Cr:         CodingRate4_5,
+		Preamble:   8,
+		HeaderType: HeaderExplicit,
+		Crc:        CRCOn,
+	}
+	c.Assert(cnf.TimeOnAir(10).Round(10*time.Microsecond), qt.Equals, 41220*time.Microsecond)
+
+	// Low data rate optimization is enabled for symbols longer than 16 ms
+	cnf.Sf = SpreadingFactor12
+	c.Assert(cnf.TimeOnAir(51).Round(10*time.Microsecond), qt.Equals, 2465790*time.Microsecond)
+}
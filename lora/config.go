@@ -78,11 +78,13 @@ const (
 )
 
 const (
-	MHz_868_1 = 868100000
-	MHz_868_5 = 868500000
-	MHz_902_3 = 902300000
-	Mhz_903_0 = 903000000
-	MHZ_915_0 = 915000000
-	MHz_916_8 = 916800000
-	MHz_923_3 = 923300000
+	MHz_868_1   = 868100000
+	MHz_868_3   = 868300000
+	MHz_868_5   = 868500000
+	MHz_869_525 = 869525000
+	MHz_902_3   = 902300000
+	Mhz_903_0   = 903000000
+	MHZ_915_0   = 915000000
+	MHz_916_8   = 916800000
+	MHz_923_3   = 923300000
 )
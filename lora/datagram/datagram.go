@@ -0,0 +1,336 @@
+// Package datagram provides addressed and acknowledged point-to-point
+// messaging between LoRa nodes on top of any lora.Radio, in the spirit of
+// RadioHead's RHReliableDatagram.
+//
+// Each frame starts with a 4 bytes header: destination, source, sequence
+// number and flags. Data frames sent to a node are acknowledged by an ACK
+// frame with the same sequence number, and retransmitted until acknowledged.
+// When a key is set, the payload is encrypted with AES-CTR and the frame is
+// authenticated by a 4 bytes AES-CMAC MIC, preceded by a 32-bit frame counter.
+// Frames whose counter is not above the last one received from their source
+// are rejected as replays. The counter of the frames sent must never repeat
+// with the same key, or the AES-CTR keystream is reused: save FrameCounter in
+// non-volatile memory and restore it with SetFrameCounter after a power
+// cycle. The counters received are kept in RAM too, save PeerCounter and
+// restore it with SetPeerCounter so that frames recorded before a power cycle
+// cannot be replayed after it.
+package datagram
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"tinygo.org/x/drivers/lora"
+	"tinygo.org/x/drivers/lora/lorawan"
+)
+
+const (
+	BROADCAST_ADDRESS = 0xFF
+
+	HEADER_LENGTH  = 4
+	COUNTER_LENGTH = 4
+	MIC_LENGTH     = 4
+	MAX_FRAME_SIZE = 255
+
+	FLAG_ACK       = 0x80
+	FLAG_ENCRYPTED = 0x40
+
+	DEFAULT_RETRIES     = 3
+	DEFAULT_ACK_TIMEOUT = 500 // ms
+	TX_TIMEOUT          = 2000
+	RX_ERROR_BACKOFF    = 10 // ms
+)
+
+var (
+	ErrNoAck              = errors.New("no ACK received")
+	ErrPayloadTooLarge    = errors.New("payload too large")
+	ErrInvalidFrame       = errors.New("invalid frame")
+	ErrInvalidMic         = errors.New("invalid MIC")
+	ErrInvalidKeyLength   = errors.New("invalid key length")
+	ErrInvalidDestination = errors.New("invalid destination address")
+	ErrReplay             = errors.New("replayed frame")
+)
+
+// Node is a LoRa node sending and receiving datagrams
+type Node struct {
+	// Address is the address of the node, frames sent to other addresses
+	// are ignored
+	Address uint8
+	// Retries is the number of retransmissions of unacknowledged frames
+	Retries int
+	// AckTimeout is how long to wait for an ACK in milliseconds. After each
+	// timeout, a random backoff up to AckTimeout << retry is added.
+	AckTimeout uint32
+
+	radio   lora.Radio
+	seq     uint8
+	counter uint32
+	block   cipher.Block
+	key     [16]uint8
+
+	// Last sequence number received from each source, for duplicate
+	// suppression
+	lastSeq  [256]uint8
+	received [256]bool
+
+	// Last frame counter received from each source, for replay protection
+	lastCounter [256]uint32
+	counted     [256]bool
+}
+
+// New returns a node with the given address using the radio, which must
+// already be configured
+func New(radio lora.Radio, address uint8) *Node {
+	return &Node{
+		Address:    address,
+		Retries:    DEFAULT_RETRIES,
+		AckTimeout: DEFAULT_ACK_TIMEOUT,
+		radio:      radio,
+		seq:        uint8(random()),
+	}
+}
+
+// FrameCounter returns the frame counter of the last encrypted frame sent, to
+// be saved in non-volatile memory
+func (n *Node) FrameCounter() uint32 {
+	return n.counter
+}
+
+// SetFrameCounter restores the frame counter saved from FrameCounter, the
+// next encrypted frame sent uses the counter following it. If the counter is
+// not saved after each frame, restore it with a margin above the last value
+// saved.
+func (n *Node) SetFrameCounter(counter uint32) {
+	n.counter = counter
+}
+
+// PeerCounter returns the frame counter of the last encrypted frame received
+// from a source, to be saved in non-volatile memory. It returns false if no
+// frame was received from the source.
+func (n *Node) PeerCounter(from uint8) (uint32, bool) {
+	return n.lastCounter[from], n.counted[from]
+}
+
+// SetPeerCounter restores the frame counter of a source saved from
+// PeerCounter, frames from the source whose counter is not above it are
+// rejected as replays
+func (n *Node) SetPeerCounter(from uint8, counter uint32) {
+	n.lastCounter[from] = counter
+	n.counted[from] = true
+}
+
+// SetKey enables payload encryption and authentication with a 16 bytes
+// AES-128 key shared by all nodes. A nil key disables it.
+func (n *Node) SetKey(key []uint8) error {
+	if key == nil {
+		n.block = nil
+		return nil
+	}
+	if len(key) != 16 {
+		return ErrInvalidKeyLength
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	copy(n.key[:], key)
+	n.block = block
+	return nil
+}
+
+// MaxPayload returns the largest payload a frame can hold
+func (n *Node) MaxPayload() int {
+	if n.block != nil {
+		return MAX_FRAME_SIZE - HEADER_LENGTH - COUNTER_LENGTH - MIC_LENGTH
+	}
+	return MAX_FRAME_SIZE - HEADER_LENGTH
+}
+
+// SendTo sends a payload to the destination node, and retransmits it until
+// the destination acknowledges it, or returns ErrNoAck. Broadcast frames are
+// sent once and not acknowledged.
+func (n *Node) SendTo(to uint8, payload []uint8) error {
+	if to == n.Address {
+		return ErrInvalidDestination
+	}
+	if len(payload) > n.MaxPayload() {
+		return ErrPayloadTooLarge
+	}
+
+	n.seq++
+	if to == BROADCAST_ADDRESS {
+		return n.radio.Tx(n.encode(to, n.seq, 0, payload), TX_TIMEOUT)
+	}
+
+	for i := 0; i <= n.Retries; i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(random()%(n.AckTimeout<<i+1)) * time.Millisecond)
+		}
+		// Retransmissions keep the sequence number but use a new frame
+		// counter, the receiver suppresses them as duplicates
+		if err := n.radio.Tx(n.encode(to, n.seq, 0, payload), TX_TIMEOUT); err != nil {
+			return err
+		}
+		if n.waitAck(to, n.seq) {
+			return nil
+		}
+	}
+	return ErrNoAck
+}
+
+// waitAck listens for the ACK of a frame until AckTimeout expires
+func (n *Node) waitAck(from uint8, seq uint8) bool {
+	deadline := time.Now().Add(time.Duration(n.AckTimeout) * time.Millisecond)
+	for {
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			return false
+		}
+		pkt, err := n.radio.Rx(uint32(timeout / time.Millisecond))
+		if err != nil {
+			// Such as a CRC error, listen again after a while
+			if timeout > RX_ERROR_BACKOFF*time.Millisecond {
+				timeout = RX_ERROR_BACKOFF * time.Millisecond
+			}
+			time.Sleep(timeout)
+			continue
+		}
+		if pkt == nil {
+			return false
+		}
+		f, err := n.decode(pkt)
+		if err == nil && f.flags&FLAG_ACK != 0 && f.from == from && f.seq == seq {
+			return true
+		}
+	}
+}
+
+// ReceiveFrom waits up to timeoutMs for a datagram sent to this node or
+// broadcast, acknowledges it and returns its source and payload. A nil
+// payload is returned on timeout. Duplicates of the last datagram received
+// from a source are acknowledged again but not returned.
+func (n *Node) ReceiveFrom(timeoutMs uint32) (uint8, []uint8, error) {
+	deadline := time.Now().Add(time.Duration(timeoutMs) * time.Millisecond)
+	for {
+		pkt, err := n.radio.Rx(timeoutMs)
+		if err != nil {
+			return 0, nil, err
+		}
+		if pkt == nil {
+			return 0, nil, nil
+		}
+
+		f, err := n.decode(pkt)
+		if err == nil && f.flags&FLAG_ACK == 0 {
+			if f.to != BROADCAST_ADDRESS {
+				if err := n.radio.Tx(n.encode(f.from, f.seq, FLAG_ACK, nil), TX_TIMEOUT); err != nil {
+					return 0, nil, err
+				}
+			}
+			duplicate := n.received[f.from] && n.lastSeq[f.from] == f.seq
+			n.received[f.from] = true
+			n.lastSeq[f.from] = f.seq
+			if !duplicate {
+				return f.from, f.payload, nil
+			}
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return 0, nil, nil
+		}
+		timeoutMs = uint32(remaining / time.Millisecond)
+	}
+}
+
+type frame struct {
+	to      uint8
+	from    uint8
+	seq     uint8
+	flags   uint8
+	payload []uint8
+}
+
+// encode builds a frame from this node, encrypted if a key is set
+func (n *Node) encode(to uint8, seq uint8, flags uint8, payload []uint8) []uint8 {
+	if n.block == nil {
+		buf := []uint8{to, n.Address, seq, flags}
+		return append(buf, payload...)
+	}
+
+	n.counter++
+	buf := []uint8{to, n.Address, seq, flags | FLAG_ENCRYPTED}
+	var c [COUNTER_LENGTH]uint8
+	binary.LittleEndian.PutUint32(c[:], n.counter)
+	buf = append(buf, c[:]...)
+	buf = append(buf, n.crypt(n.Address, n.counter, payload)...)
+	return append(buf, n.mic(buf)...)
+}
+
+// decode parses a frame sent to this node or broadcast, verifying and
+// decrypting it if a key is set
+func (n *Node) decode(pkt []uint8) (*frame, error) {
+	if len(pkt) < HEADER_LENGTH {
+		return nil, ErrInvalidFrame
+	}
+	f := &frame{to: pkt[0], from: pkt[1], seq: pkt[2], flags: pkt[3]}
+	if f.to != n.Address && f.to != BROADCAST_ADDRESS {
+		return nil, ErrInvalidFrame
+	}
+
+	encrypted := f.flags&FLAG_ENCRYPTED != 0
+	if encrypted != (n.block != nil) {
+		return nil, ErrInvalidFrame
+	}
+	if !encrypted {
+		f.payload = pkt[HEADER_LENGTH:]
+		return f, nil
+	}
+
+	if len(pkt) < HEADER_LENGTH+COUNTER_LENGTH+MIC_LENGTH {
+		return nil, ErrInvalidFrame
+	}
+	data, mic := pkt[:len(pkt)-MIC_LENGTH], pkt[len(pkt)-MIC_LENGTH:]
+	if !bytes.Equal(n.mic(data), mic) {
+		return nil, ErrInvalidMic
+	}
+	counter := binary.LittleEndian.Uint32(data[HEADER_LENGTH:])
+	if n.counted[f.from] && counter <= n.lastCounter[f.from] {
+		return nil, ErrReplay
+	}
+	n.counted[f.from] = true
+	n.lastCounter[f.from] = counter
+	f.payload = n.crypt(f.from, counter, data[HEADER_LENGTH+COUNTER_LENGTH:])
+	return f, nil
+}
+
+// crypt encrypts or decrypts a payload with AES-CTR, the counter block being
+// made of the source address and frame counter
+func (n *Node) crypt(from uint8, counter uint32, payload []uint8) []uint8 {
+	var iv [aes.BlockSize]uint8
+	iv[0] = from
+	binary.LittleEndian.PutUint32(iv[1:], counter)
+
+	out := make([]uint8, len(payload))
+	cipher.NewCTR(n.block, iv[:]).XORKeyStream(out, payload)
+	return out
+}
+
+// mic returns the AES-CMAC MIC of a frame
+func (n *Node) mic(data []uint8) []uint8 {
+	h, _ := lorawan.NewCmac(n.key[:])
+	h.Write(data)
+	return h.Sum(nil)[:MIC_LENGTH]
+}
+
+// random returns a random 32-bit number
+func random() uint32 {
+	var b [4]uint8
+	rand.Read(b[:])
+	return binary.LittleEndian.Uint32(b[:])
+}
@@ -0,0 +1,166 @@
+package datagram
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"tinygo.org/x/drivers/lora"
+	"tinygo.org/x/drivers/lora/loratest"
+)
+
+// link connects two simulated radios, node b processing each frame sent by
+// node a as soon as it is transmitted. drop tells whether a frame sent by a
+// is lost.
+func link(c *qt.C, drop func(i int) bool) (a, b *Node, received *[][]uint8) {
+	ra, rb := loratest.NewRadio(), loratest.NewRadio()
+	ra.SetFrequency(lora.MHz_868_1)
+	rb.SetFrequency(lora.MHz_868_1)
+	a, b = New(ra, 1), New(rb, 2)
+	a.AckTimeout, b.AckTimeout = 1, 1
+
+	received = &[][]uint8{}
+	sent := 0
+	ra.OnTx = func(f loratest.Frame) {
+		sent++
+		if drop != nil && drop(sent) {
+			return
+		}
+		rb.QueueRx(f.Payload)
+		from, payload, err := b.ReceiveFrom(0)
+		c.Assert(err, qt.IsNil)
+		if payload != nil {
+			c.Assert(from, qt.Equals, uint8(1))
+			*received = append(*received, payload)
+		}
+	}
+	rb.OnTx = func(f loratest.Frame) {
+		ra.QueueRx(f.Payload)
+	}
+	return a, b, received
+}
+
+func TestSendTo(t *testing.T) {
+	c := qt.New(t)
+	a, _, received := link(c, nil)
+
+	c.Assert(a.SendTo(2, []uint8("ping")), qt.IsNil)
+	c.Assert(*received, qt.DeepEquals, [][]uint8{[]uint8("ping")})
+	c.Assert(a.SendTo(1, []uint8("ping")), qt.Equals, ErrInvalidDestination)
+}
+
+func TestSendToRetries(t *testing.T) {
+	c := qt.New(t)
+
+	// The first transmission is lost
+	a, _, received := link(c, func(i int) bool { return i == 1 })
+	c.Assert(a.SendTo(2, []uint8("retry")), qt.IsNil)
+	c.Assert(*received, qt.HasLen, 1)
+
+	// All transmissions are lost
+	a, _, _ = link(c, func(i int) bool { return true })
+	a.Retries = 2
+	c.Assert(a.SendTo(2, []uint8("lost")), qt.Equals, ErrNoAck)
+	c.Assert(a.radio.(*loratest.Radio).Sent, qt.HasLen, 3)
+}
+
+func TestDuplicateSuppression(t *testing.T) {
+	c := qt.New(t)
+	a, b, received := link(c, nil)
+	ra := a.radio.(*loratest.Radio)
+
+	c.Assert(a.SendTo(2, []uint8("once")), qt.IsNil)
+
+	// The same frame received again, e.g. when the ACK was lost, is
+	// acknowledged again but not delivered twice
+	b.radio.(*loratest.Radio).QueueRx(ra.Sent[0].Payload)
+	_, payload, err := b.ReceiveFrom(0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(payload, qt.IsNil)
+	c.Assert(*received, qt.HasLen, 1)
+	c.Assert(ra.Pending(), qt.Equals, 1)
+}
+
+func TestEncryption(t *testing.T) {
+	c := qt.New(t)
+	a, b, received := link(c, nil)
+	key := []uint8{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	c.Assert(a.SetKey(key), qt.IsNil)
+	c.Assert(b.SetKey(key), qt.IsNil)
+
+	c.Assert(a.SendTo(2, []uint8("secret")), qt.IsNil)
+	c.Assert(*received, qt.DeepEquals, [][]uint8{[]uint8("secret")})
+
+	sent := a.radio.(*loratest.Radio).Sent[0].Payload
+	c.Assert(len(sent), qt.Equals, HEADER_LENGTH+COUNTER_LENGTH+len("secret")+MIC_LENGTH)
+	c.Assert(string(sent[HEADER_LENGTH+COUNTER_LENGTH:]), qt.Not(qt.Contains), "secret")
+
+	// Tampered frames are rejected
+	sent[HEADER_LENGTH+COUNTER_LENGTH] ^= 0x01
+	_, err := b.decode(sent)
+	c.Assert(err, qt.Equals, ErrInvalidMic)
+
+	// Nodes with another key do not understand each other
+	c.Assert(b.SetKey(make([]uint8, 16)), qt.IsNil)
+	a.Retries = 0
+	c.Assert(a.SendTo(2, []uint8("secret")), qt.Equals, ErrNoAck)
+}
+
+func TestReplay(t *testing.T) {
+	c := qt.New(t)
+	a, b, received := link(c, func(i int) bool { return i == 1 })
+	key := []uint8{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	c.Assert(a.SetKey(key), qt.IsNil)
+	c.Assert(b.SetKey(key), qt.IsNil)
+
+	// The retransmission uses a new frame counter
+	c.Assert(a.SendTo(2, []uint8("once")), qt.IsNil)
+	sent := a.radio.(*loratest.Radio).Sent
+	c.Assert(sent, qt.HasLen, 2)
+	c.Assert(sent[1].Payload[:HEADER_LENGTH], qt.DeepEquals, sent[0].Payload[:HEADER_LENGTH])
+	c.Assert(sent[1].Payload[HEADER_LENGTH:HEADER_LENGTH+COUNTER_LENGTH], qt.Not(qt.DeepEquals), sent[0].Payload[HEADER_LENGTH:HEADER_LENGTH+COUNTER_LENGTH])
+	c.Assert(*received, qt.HasLen, 1)
+
+	// Frames are rejected unless their counter is above the last one
+	_, err := b.decode(sent[1].Payload)
+	c.Assert(err, qt.Equals, ErrReplay)
+	_, err = b.decode(sent[0].Payload)
+	c.Assert(err, qt.Equals, ErrReplay)
+
+	// A receiver restarting with the saved counter of the source still
+	// rejects them
+	peer, ok := b.PeerCounter(1)
+	c.Assert(ok, qt.IsTrue)
+	b = New(b.radio, 2)
+	c.Assert(b.SetKey(key), qt.IsNil)
+	_, ok = b.PeerCounter(1)
+	c.Assert(ok, qt.IsFalse)
+	b.SetPeerCounter(1, peer)
+	_, err = b.decode(sent[1].Payload)
+	c.Assert(err, qt.Equals, ErrReplay)
+
+	// A node restarting with its saved counter is accepted
+	counter := a.FrameCounter()
+	a = New(a.radio, 1)
+	c.Assert(a.SetKey(key), qt.IsNil)
+	a.SetFrameCounter(counter)
+	a.radio.(*loratest.Radio).OnTx = nil
+	c.Assert(a.SendTo(2, []uint8("again")), qt.Equals, ErrNoAck)
+	f, err := b.decode(a.radio.(*loratest.Radio).Sent[2].Payload)
+	c.Assert(err, qt.IsNil)
+	c.Assert(f.payload, qt.DeepEquals, []uint8("again"))
+}
+
+func TestWaitAckRxErrors(t *testing.T) {
+	c := qt.New(t)
+	a, _, _ := link(c, func(i int) bool { return true })
+	a.Retries = 0
+	a.AckTimeout = 50
+
+	// Failed receptions do not make the node spin until the ACK timeout
+	ra := a.radio.(*loratest.Radio)
+	for i := 0; i < 1000; i++ {
+		ra.QueueCrcError()
+	}
+	c.Assert(a.SendTo(2, []uint8("crc")), qt.Equals, ErrNoAck)
+	c.Assert(ra.Pending() > 980, qt.IsTrue)
+}
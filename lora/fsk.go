@@ -0,0 +1,58 @@
+package lora
+
+import "errors"
+
+var (
+	ErrInvalidFSKConf = errors.New("invalid FSK configuration")
+)
+
+// FSKConfig holds the (G)FSK configuration parameters
+type FSKConfig struct {
+	Freq          uint32  // Frequency in Hz
+	BitRate       uint32  // Bit rate in bits/s
+	FreqDeviation uint32  // Frequency deviation in Hz
+	RxBandwidth   uint32  // Receiver bandwidth in Hz, the next supported one is used
+	Shaping       uint8   // Gaussian filter: FSKShapingNone, FSKShapingBT0_3...
+	Preamble      uint16  // Preamble length in bytes
+	SyncWord      []uint8 // Sync word, up to 8 bytes
+	Whitening     bool    // Data whitening
+	Crc           uint8   // CRC: FSKCrcOff, FSKCrcCCITT, FSKCrcIBM
+	FixedLength   uint8   // Fixed payload length, 0 for variable length packets
+	TxPowerDBm    int8    // Tx power in Dbm
+}
+
+const (
+	FSKShapingNone = iota
+	FSKShapingBT0_3
+	FSKShapingBT0_5
+	FSKShapingBT1_0
+)
+
+const (
+	FSKCrcOff   = iota
+	FSKCrcCCITT // 2 bytes CRC-16-CCITT, inverted
+	FSKCrcIBM   // 2 bytes CRC-16-IBM
+)
+
+// FSK_MAX_SYNC_WORD_LENGTH is the maximum sync word length in bytes
+const FSK_MAX_SYNC_WORD_LENGTH = 8
+
+// FSKRadio is implemented by radios supporting (G)FSK modulation. FSKConfig
+// sets the configuration used by TxFSK and RxFSK, while Tx and Rx keep using
+// LoRa.
+type FSKRadio interface {
+	FSKConfig(cnf FSKConfig) error
+	TxFSK(pkt []uint8, timeoutMs uint32) error
+	RxFSK(timeoutMs uint32) ([]uint8, error)
+}
+
+// Validate checks the configuration can be used by a radio
+func (cnf FSKConfig) Validate() error {
+	if cnf.Freq == 0 || cnf.BitRate == 0 || len(cnf.SyncWord) > FSK_MAX_SYNC_WORD_LENGTH {
+		return ErrInvalidFSKConf
+	}
+	if cnf.Shaping > FSKShapingBT1_0 || cnf.Crc > FSKCrcIBM {
+		return ErrInvalidFSKConf
+	}
+	return nil
+}
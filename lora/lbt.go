@@ -0,0 +1,48 @@
+package lora
+
+import (
+	"crypto/rand"
+	"errors"
+	"time"
+)
+
+var (
+	ErrChannelBusy = errors.New("channel busy")
+)
+
+// ListenBeforeTalk configures carrier sensing before each transmission, as
+// required by some regional regulations. The channel is considered busy when
+// a LoRa preamble is detected with CAD, or when the RSSI rises above
+// RSSIThresholdDBm during SenseTimeMs.
+type ListenBeforeTalk struct {
+	Enabled          bool
+	UseCAD           bool   // use channel activity detection instead of RSSI
+	RSSIThresholdDBm int16  // RSSI carrier sense threshold, e.g. -80 dBm
+	SenseTimeMs      uint32 // RSSI carrier sense duration, e.g. 5 ms
+	MaxAttempts      int    // carrier senses before giving up, 0 means 1
+	MaxBackoffMs     uint32 // random delay before sensing again
+}
+
+// Wait senses the channel with busy until it is free, waiting a random backoff
+// between attempts. It returns ErrChannelBusy if the channel is still busy
+// after MaxAttempts.
+func (lbt ListenBeforeTalk) Wait(busy func() (bool, error)) error {
+	if !lbt.Enabled {
+		return nil
+	}
+	for i := 0; i < lbt.MaxAttempts || i == 0; i++ {
+		if i > 0 && lbt.MaxBackoffMs > 0 {
+			var b [2]uint8
+			rand.Read(b[:])
+			time.Sleep(time.Duration((uint32(b[0])<<8|uint32(b[1]))%lbt.MaxBackoffMs) * time.Millisecond)
+		}
+		isBusy, err := busy()
+		if err != nil {
+			return err
+		}
+		if !isBusy {
+			return nil
+		}
+	}
+	return ErrChannelBusy
+}
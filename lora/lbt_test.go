@@ -0,0 +1,30 @@
+package lora
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestListenBeforeTalk(t *testing.T) {
+	c := qt.New(t)
+
+	senses := 0
+	busyFor := func(n int) func() (bool, error) {
+		senses = 0
+		return func() (bool, error) {
+			senses++
+			return senses <= n, nil
+		}
+	}
+
+	lbt := ListenBeforeTalk{}
+	c.Assert(lbt.Wait(busyFor(10)), qt.IsNil)
+	c.Assert(senses, qt.Equals, 0)
+
+	lbt = ListenBeforeTalk{Enabled: true, MaxAttempts: 3, MaxBackoffMs: 1}
+	c.Assert(lbt.Wait(busyFor(2)), qt.IsNil)
+	c.Assert(senses, qt.Equals, 3)
+	c.Assert(lbt.Wait(busyFor(3)), qt.Equals, ErrChannelBusy)
+	c.Assert(senses, qt.Equals, 3)
+}
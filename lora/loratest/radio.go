@@ -0,0 +1,397 @@
+// Package loratest provides an in-memory LoRa radio and a minimal LoRaWAN
+// network server, to test code using lora.Radio without hardware.
+package loratest
+
+import (
+	"errors"
+	"sync"
+
+	"tinygo.org/x/drivers/lora"
+)
+
+var (
+	ErrCrc = errors.New("CRC error")
+)
+
+// Frame is a packet transmitted by the radio, with the configuration it was
+// sent with.
+type Frame struct {
+	Payload []uint8
+	Config  lora.Config
+	// FSK is the configuration of a frame sent with FSK, nil with LoRa
+	FSK *lora.FSKConfig
+}
+
+const (
+	receptionPacket = iota
+	receptionTimeout
+	receptionCrcError
+)
+
+type reception struct {
+	kind    int
+	payload []uint8
+}
+
+// Radio is an in-memory lora.Radio. Transmitted frames are recorded in Sent,
+// and each Rx call returns the next reception queued with QueueRx,
+// QueueTimeout or QueueCrcError, or times out when none is queued.
+// Radio also implements lora.ContinuousReceiver: packets queued while it
+// listens continuously are delivered through the radio event channel, and
+// lora.FSKRadio: FSK receptions use the same queue.
+type Radio struct {
+	// Sent holds the transmitted frames, oldest first
+	Sent []Frame
+	// Listened holds the configuration of each reception, oldest first
+	Listened []lora.Config
+	// OnTx is called after each transmission, for instance to queue an answer
+	OnTx func(f Frame)
+	// ChannelBusy is the result of channel activity detection and carrier sense
+	ChannelBusy bool
+	// RSSI and SNR reported for received packets
+	RSSI int16
+	SNR  int8
+
+	mu         sync.Mutex
+	cnf        lora.Config
+	queue      []reception
+	continuous bool
+	received   [][]uint8
+	lbt        lora.ListenBeforeTalk
+	events     chan lora.RadioEvent
+	fsk        *lora.FSKConfig
+}
+
+// NewRadio returns a new simulated radio
+func NewRadio() *Radio {
+	return &Radio{
+		events: make(chan lora.RadioEvent, 10),
+	}
+}
+
+// QueueRx queues a packet to be received
+func (r *Radio) QueueRx(pkt []uint8) {
+	r.push(reception{kind: receptionPacket, payload: append([]uint8(nil), pkt...)})
+}
+
+// QueueTimeout queues a reception timing out without packet
+func (r *Radio) QueueTimeout() {
+	r.push(reception{kind: receptionTimeout})
+}
+
+// QueueCrcError queues a reception failing with a CRC error
+func (r *Radio) QueueCrcError() {
+	r.push(reception{kind: receptionCrcError})
+}
+
+// Pending returns the number of queued receptions
+func (r *Radio) Pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.queue)
+}
+
+func (r *Radio) push(rx reception) {
+	r.mu.Lock()
+	r.queue = append(r.queue, rx)
+	r.mu.Unlock()
+	r.deliver()
+}
+
+// pop returns the next queued reception, a timeout if there is none
+func (r *Radio) pop() reception {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.queue) == 0 {
+		return reception{kind: receptionTimeout}
+	}
+	rx := r.queue[0]
+	r.queue = r.queue[1:]
+	return rx
+}
+
+// deliver signals the queued receptions when listening continuously
+func (r *Radio) deliver() {
+	for {
+		r.mu.Lock()
+		if !r.continuous || len(r.queue) == 0 {
+			r.mu.Unlock()
+			return
+		}
+		rx := r.queue[0]
+		r.queue = r.queue[1:]
+		if rx.kind == receptionPacket {
+			r.received = append(r.received, rx.payload)
+		}
+		r.mu.Unlock()
+
+		switch rx.kind {
+		case receptionPacket:
+			r.events <- lora.NewRadioEvent(lora.RadioEventRxDone, 0, nil)
+		case receptionCrcError:
+			r.events <- lora.NewRadioEvent(lora.RadioEventCrcError, 0, nil)
+		}
+	}
+}
+
+func (r *Radio) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cnf = lora.Config{}
+	r.continuous = false
+}
+
+// Tx records the packet and the current configuration in Sent. With Listen
+// Before Talk enabled, it fails with lora.ErrChannelBusy while ChannelBusy is
+// set.
+func (r *Radio) Tx(pkt []uint8, timeoutMs uint32) error {
+	r.mu.Lock()
+	if r.cnf.Freq == 0 {
+		r.mu.Unlock()
+		return lora.ErrUndefinedLoraConf
+	}
+	lbt := r.lbt
+	r.mu.Unlock()
+
+	// The backoff of Listen Before Talk may sleep, do not hold the lock
+	if err := lbt.Wait(r.channelBusy); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.continuous = false
+	f := Frame{Payload: append([]uint8(nil), pkt...), Config: r.cnf}
+	r.Sent = append(r.Sent, f)
+	r.mu.Unlock()
+
+	if r.OnTx != nil {
+		r.OnTx(f)
+	}
+	return nil
+}
+
+// Rx returns the next queued reception
+func (r *Radio) Rx(timeoutMs uint32) ([]uint8, error) {
+	r.mu.Lock()
+	if r.cnf.Freq == 0 {
+		r.mu.Unlock()
+		return nil, lora.ErrUndefinedLoraConf
+	}
+	r.continuous = false
+	r.Listened = append(r.Listened, r.cnf)
+	r.mu.Unlock()
+
+	rx := r.pop()
+	switch rx.kind {
+	case receptionPacket:
+		return rx.payload, nil
+	case receptionCrcError:
+		return nil, ErrCrc
+	}
+	return nil, nil
+}
+
+// FSKConfig sets the configuration of TxFSK and RxFSK
+func (r *Radio) FSKConfig(cnf lora.FSKConfig) error {
+	if err := cnf.Validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.fsk = &cnf
+	r.mu.Unlock()
+	return nil
+}
+
+// TxFSK records the packet and the FSK configuration in Sent
+func (r *Radio) TxFSK(pkt []uint8, timeoutMs uint32) error {
+	r.mu.Lock()
+	if r.fsk == nil {
+		r.mu.Unlock()
+		return lora.ErrInvalidFSKConf
+	}
+	cnf := *r.fsk
+	r.continuous = false
+	f := Frame{Payload: append([]uint8(nil), pkt...), FSK: &cnf}
+	r.Sent = append(r.Sent, f)
+	r.mu.Unlock()
+
+	if r.OnTx != nil {
+		r.OnTx(f)
+	}
+	return nil
+}
+
+// RxFSK returns the next queued reception
+func (r *Radio) RxFSK(timeoutMs uint32) ([]uint8, error) {
+	r.mu.Lock()
+	if r.fsk == nil {
+		r.mu.Unlock()
+		return nil, lora.ErrInvalidFSKConf
+	}
+	r.continuous = false
+	r.mu.Unlock()
+
+	rx := r.pop()
+	switch rx.kind {
+	case receptionPacket:
+		return rx.payload, nil
+	case receptionCrcError:
+		return nil, ErrCrc
+	}
+	return nil, nil
+}
+
+// StartRxContinuous starts delivering queued packets through the radio
+// event channel
+func (r *Radio) StartRxContinuous() error {
+	r.mu.Lock()
+	if r.cnf.Freq == 0 {
+		r.mu.Unlock()
+		return lora.ErrUndefinedLoraConf
+	}
+	r.continuous = true
+	r.Listened = append(r.Listened, r.cnf)
+	r.mu.Unlock()
+
+	r.deliver()
+	return nil
+}
+
+// StopRxContinuous stops delivering queued packets
+func (r *Radio) StopRxContinuous() {
+	r.mu.Lock()
+	r.continuous = false
+	r.mu.Unlock()
+}
+
+// ReadRxPacket returns the oldest packet delivered in continuous receive
+// mode and not read yet
+func (r *Radio) ReadRxPacket() []uint8 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.received) == 0 {
+		return nil
+	}
+	pkt := r.received[0]
+	r.received = r.received[1:]
+	return pkt
+}
+
+// Cad reports ChannelBusy
+func (r *Radio) Cad(timeoutMs uint32) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cnf.Freq == 0 {
+		return false, lora.ErrUndefinedLoraConf
+	}
+	return r.ChannelBusy, nil
+}
+
+func (r *Radio) channelBusy() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ChannelBusy, nil
+}
+
+func (r *Radio) LastPacketRSSI() int16 {
+	return r.RSSI
+}
+
+func (r *Radio) LastPacketSNR() int8 {
+	return r.SNR
+}
+
+func (r *Radio) SetListenBeforeTalk(lbt lora.ListenBeforeTalk) {
+	r.mu.Lock()
+	r.lbt = lbt
+	r.mu.Unlock()
+}
+
+func (r *Radio) GetRadioEventChan() chan lora.RadioEvent {
+	return r.events
+}
+
+// Config returns the current radio configuration
+func (r *Radio) Config() lora.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cnf
+}
+
+func (r *Radio) SetFrequency(freq uint32) {
+	r.mu.Lock()
+	r.cnf.Freq = freq
+	r.mu.Unlock()
+}
+
+func (r *Radio) SetIqMode(mode uint8) {
+	r.mu.Lock()
+	r.cnf.Iq = mode
+	r.mu.Unlock()
+}
+
+func (r *Radio) SetCodingRate(cr uint8) {
+	r.mu.Lock()
+	r.cnf.Cr = cr
+	r.mu.Unlock()
+}
+
+func (r *Radio) SetBandwidth(bw uint8) {
+	r.mu.Lock()
+	r.cnf.Bw = bw
+	r.mu.Unlock()
+}
+
+func (r *Radio) SetCrc(enable bool) {
+	r.mu.Lock()
+	if enable {
+		r.cnf.Crc = lora.CRCOn
+	} else {
+		r.cnf.Crc = lora.CRCOff
+	}
+	r.mu.Unlock()
+}
+
+func (r *Radio) SetSpreadingFactor(sf uint8) {
+	r.mu.Lock()
+	r.cnf.Sf = sf
+	r.mu.Unlock()
+}
+
+func (r *Radio) SetPreambleLength(plen uint16) {
+	r.mu.Lock()
+	r.cnf.Preamble = plen
+	r.mu.Unlock()
+}
+
+func (r *Radio) SetTxPower(txpow int8) {
+	r.mu.Lock()
+	r.cnf.LoraTxPowerDBm = txpow
+	r.mu.Unlock()
+}
+
+func (r *Radio) SetSyncWord(syncWord uint16) {
+	r.mu.Lock()
+	r.cnf.SyncWord = syncWord
+	r.mu.Unlock()
+}
+
+func (r *Radio) SetPublicNetwork(enable bool) {
+	if enable {
+		r.SetSyncWord(lora.SyncPublic)
+	} else {
+		r.SetSyncWord(lora.SyncPrivate)
+	}
+}
+
+func (r *Radio) SetHeaderType(headerType uint8) {
+	r.mu.Lock()
+	r.cnf.HeaderType = headerType
+	r.mu.Unlock()
+}
+
+func (r *Radio) LoraConfig(cnf lora.Config) {
+	r.mu.Lock()
+	r.cnf = cnf
+	r.mu.Unlock()
+}
@@ -0,0 +1,245 @@
+package loratest
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"errors"
+
+	"tinygo.org/x/drivers/lora/lorawan"
+)
+
+var (
+	ErrNotJoinRequest = errors.New("not a JoinRequest")
+	ErrNotUplink      = errors.New("not a data uplink")
+	ErrInvalidMic     = errors.New("invalid MIC")
+	ErrInvalidLength  = errors.New("invalid packet length")
+)
+
+// Uplink is a data uplink decoded by the NetworkServer
+type Uplink struct {
+	Confirmed bool
+	Ack       bool
+	ADR       bool
+	FCnt      uint32
+	FOpts     []uint8
+	FPort     uint8
+	Payload   []uint8
+}
+
+// NetworkServer is a minimal LoRaWAN 1.0 network server handling a single
+// device: it accepts its JoinRequests, decodes its uplinks and builds
+// downlinks for it. Fields are meant to be set by tests before use.
+type NetworkServer struct {
+	AppKey     [16]uint8
+	AppNonce   [3]uint8
+	NetID      [3]uint8
+	DevAddr    [4]uint8
+	DLSettings uint8
+	RXDelay    uint8
+	// CFList is sent in the JoinAccept when not all zeros
+	CFList [16]uint8
+
+	// Session keys, derived on join or set for ABP devices
+	NwkSKey  [16]uint8
+	AppSKey  [16]uint8
+	FCntUp   uint32
+	FCntDown uint32
+
+	// Uplinks holds the uplinks decoded by the attached radio handler
+	Uplinks []*Uplink
+
+	pending *pendingDownlink
+}
+
+type pendingDownlink struct {
+	fPort   uint8
+	payload []uint8
+}
+
+// Attach makes the server answer the frames transmitted by the radio: a
+// JoinAccept for each valid JoinRequest, and after a data uplink the downlink
+// queued with QueueDownlink, or an empty acknowledgement to a confirmed uplink.
+func (ns *NetworkServer) Attach(r *Radio) {
+	r.OnTx = func(f Frame) {
+		if len(f.Payload) == 0 {
+			return
+		}
+		switch f.Payload[0] >> 5 {
+		case lorawan.MTYPE_JOIN_REQUEST:
+			if resp, err := ns.JoinAccept(f.Payload); err == nil {
+				r.QueueRx(resp)
+			}
+		case lorawan.MTYPE_UNCONFIRMED_DATA_UP, lorawan.MTYPE_CONFIRMED_DATA_UP:
+			up, err := ns.DecodeUplink(f.Payload)
+			if err != nil {
+				return
+			}
+			ns.Uplinks = append(ns.Uplinks, up)
+			if p := ns.pending; p != nil {
+				ns.pending = nil
+				r.QueueRx(ns.Downlink(p.fPort, p.payload, up.Confirmed))
+			} else if up.Confirmed {
+				r.QueueRx(ns.Downlink(0, nil, true))
+			}
+		}
+	}
+}
+
+// QueueDownlink queues an application downlink sent after the next uplink
+func (ns *NetworkServer) QueueDownlink(fPort uint8, payload []uint8) {
+	ns.pending = &pendingDownlink{fPort: fPort, payload: append([]uint8(nil), payload...)}
+}
+
+// JoinAccept verifies a JoinRequest, derives the session keys and returns the
+// encrypted JoinAccept answering it
+func (ns *NetworkServer) JoinAccept(joinRequest []uint8) ([]uint8, error) {
+	if len(joinRequest) != 23 {
+		return nil, ErrInvalidLength
+	}
+	if joinRequest[0]>>5 != lorawan.MTYPE_JOIN_REQUEST {
+		return nil, ErrNotJoinRequest
+	}
+	if !bytes.Equal(cmac(ns.AppKey, joinRequest[:19]), joinRequest[19:]) {
+		return nil, ErrInvalidMic
+	}
+	devNonce := joinRequest[17:19]
+
+	msg := []uint8{lorawan.MTYPE_JOIN_ACCEPT << 5}
+	msg = append(msg, ns.AppNonce[:]...)
+	msg = append(msg, ns.NetID[:]...)
+	msg = append(msg, ns.DevAddr[:]...)
+	msg = append(msg, ns.DLSettings, ns.RXDelay)
+	if ns.CFList != [16]uint8{} {
+		msg = append(msg, ns.CFList[:]...)
+	}
+	msg = append(msg, cmac(ns.AppKey, msg)...)
+
+	// The device encrypts the JoinAccept to decrypt it, so it is decrypted here
+	block, _ := aes.NewCipher(ns.AppKey[:])
+	for i := 1; i < len(msg); i += aes.BlockSize {
+		block.Decrypt(msg[i:], msg[i:])
+	}
+
+	sKey := make([]uint8, aes.BlockSize)
+	copy(sKey[1:], ns.AppNonce[:])
+	copy(sKey[4:], ns.NetID[:])
+	copy(sKey[7:], devNonce)
+	sKey[0] = 0x01
+	block.Encrypt(ns.NwkSKey[:], sKey)
+	sKey[0] = 0x02
+	block.Encrypt(ns.AppSKey[:], sKey)
+	ns.FCntUp = 0
+	ns.FCntDown = 0
+
+	return msg, nil
+}
+
+// DecodeUplink verifies and decrypts a data uplink of the device
+func (ns *NetworkServer) DecodeUplink(pkt []uint8) (*Uplink, error) {
+	if len(pkt) < 12 {
+		return nil, ErrInvalidLength
+	}
+	mType := pkt[0] >> 5
+	if mType != lorawan.MTYPE_UNCONFIRMED_DATA_UP && mType != lorawan.MTYPE_CONFIRMED_DATA_UP {
+		return nil, ErrNotUplink
+	}
+	if !bytes.Equal(pkt[1:5], ns.DevAddr[:]) {
+		return nil, ErrNotUplink
+	}
+
+	fCtrl := pkt[5]
+	fCnt := ns.FCntUp&0xFFFF0000 | uint32(binary.LittleEndian.Uint16(pkt[6:8]))
+	if fCnt < ns.FCntUp {
+		fCnt += 0x10000
+	}
+	msg, mic := pkt[:len(pkt)-4], pkt[len(pkt)-4:]
+	if !bytes.Equal(messageMIC(ns.NwkSKey, 0, ns.DevAddr, fCnt, msg), mic) {
+		return nil, ErrInvalidMic
+	}
+
+	fOptsLen := int(fCtrl & lorawan.FCTRL_FOPTS_MASK)
+	if 8+fOptsLen > len(msg) {
+		return nil, ErrInvalidLength
+	}
+	up := &Uplink{
+		Confirmed: mType == lorawan.MTYPE_CONFIRMED_DATA_UP,
+		Ack:       fCtrl&lorawan.FCTRL_ACK != 0,
+		ADR:       fCtrl&lorawan.FCTRL_ADR != 0,
+		FCnt:      fCnt,
+		FOpts:     append([]uint8(nil), msg[8:8+fOptsLen]...),
+	}
+	if rest := msg[8+fOptsLen:]; len(rest) > 0 {
+		up.FPort = rest[0]
+		key := ns.AppSKey
+		if up.FPort == 0 {
+			key = ns.NwkSKey
+		}
+		up.Payload = encrypt(key, 0, ns.DevAddr, fCnt, rest[1:])
+	}
+	ns.FCntUp = fCnt + 1
+
+	return up, nil
+}
+
+// Downlink builds an unconfirmed downlink for the device. The FPort and
+// payload are omitted if payload is empty.
+func (ns *NetworkServer) Downlink(fPort uint8, payload []uint8, ack bool) []uint8 {
+	fCtrl := uint8(0)
+	if ack {
+		fCtrl |= lorawan.FCTRL_ACK
+	}
+	fCnt := ns.FCntDown
+	ns.FCntDown++
+
+	msg := []uint8{lorawan.MTYPE_UNCONFIRMED_DATA_DOWN << 5}
+	msg = append(msg, ns.DevAddr[:]...)
+	msg = append(msg, fCtrl, uint8(fCnt), uint8(fCnt>>8))
+	if len(payload) > 0 {
+		key := ns.AppSKey
+		if fPort == 0 {
+			key = ns.NwkSKey
+		}
+		msg = append(msg, fPort)
+		msg = append(msg, encrypt(key, 1, ns.DevAddr, fCnt, payload)...)
+	}
+	return append(msg, messageMIC(ns.NwkSKey, 1, ns.DevAddr, fCnt, msg)...)
+}
+
+// cmac returns the 4 bytes AES-CMAC MIC of data
+func cmac(key [16]uint8, data []uint8) []uint8 {
+	h, _ := lorawan.NewCmac(key[:])
+	h.Write(data)
+	return h.Sum(nil)[:4]
+}
+
+// messageMIC returns the MIC of a data message
+func messageMIC(key [16]uint8, dir uint8, devAddr [4]uint8, fCnt uint32, msg []uint8) []uint8 {
+	b0 := make([]uint8, aes.BlockSize, aes.BlockSize+len(msg))
+	b0[0] = 0x49
+	b0[5] = dir
+	copy(b0[6:], devAddr[:])
+	binary.LittleEndian.PutUint32(b0[10:], fCnt)
+	b0[15] = uint8(len(msg))
+	return cmac(key, append(b0, msg...))
+}
+
+// encrypt encrypts or decrypts a FRMPayload
+func encrypt(key [16]uint8, dir uint8, devAddr [4]uint8, fCnt uint32, data []uint8) []uint8 {
+	block, _ := aes.NewCipher(key[:])
+	var a, s [aes.BlockSize]uint8
+	a[0] = 0x01
+	a[5] = dir
+	copy(a[6:], devAddr[:])
+	binary.LittleEndian.PutUint32(a[10:], fCnt)
+
+	out := make([]uint8, len(data))
+	for i := 0; i < len(data); i++ {
+		if i%aes.BlockSize == 0 {
+			a[15] = uint8(i/aes.BlockSize + 1)
+			block.Encrypt(s[:], a[:])
+		}
+		out[i] = data[i] ^ s[i%aes.BlockSize]
+	}
+	return out
+}
@@ -2,35 +2,64 @@ package lorawan
 
 import (
 	"errors"
+	"time"
 
 	"tinygo.org/x/drivers/lora"
 	"tinygo.org/x/drivers/lora/lorawan/region"
 )
 
 var (
-	ErrNoJoinAcceptReceived    = errors.New("no JoinAccept packet received")
-	ErrNoRadioAttached         = errors.New("no LoRa radio attached")
-	ErrInvalidEuiLength        = errors.New("invalid EUI length")
-	ErrInvalidAppKeyLength     = errors.New("invalid AppKey length")
-	ErrInvalidPacketLength     = errors.New("invalid packet length")
-	ErrInvalidDevAddrLength    = errors.New("invalid DevAddr length")
-	ErrInvalidMic              = errors.New("invalid Mic")
-	ErrFrmPayloadTooLarge      = errors.New("FRM payload too large")
-	ErrInvalidNetIDLength      = errors.New("invalid NetID length")
-	ErrInvalidNwkSKeyLength    = errors.New("invalid NwkSKey length")
-	ErrInvalidAppSKeyLength    = errors.New("invalid AppSKey length")
-	ErrUndefinedRegionSettings = errors.New("undefined Regionnal Settings ")
+	ErrNoJoinAcceptReceived     = errors.New("no JoinAccept packet received")
+	ErrNoRadioAttached          = errors.New("no LoRa radio attached")
+	ErrInvalidEuiLength         = errors.New("invalid EUI length")
+	ErrInvalidAppKeyLength      = errors.New("invalid AppKey length")
+	ErrInvalidPacketLength      = errors.New("invalid packet length")
+	ErrInvalidDevAddrLength     = errors.New("invalid DevAddr length")
+	ErrInvalidMic               = errors.New("invalid Mic")
+	ErrFrmPayloadTooLarge       = errors.New("FRM payload too large")
+	ErrInvalidNetIDLength       = errors.New("invalid NetID length")
+	ErrInvalidNwkSKeyLength     = errors.New("invalid NwkSKey length")
+	ErrInvalidAppSKeyLength     = errors.New("invalid AppSKey length")
+	ErrUndefinedRegionSettings  = errors.New("undefined Regionnal Settings ")
+	ErrInvalidMType             = errors.New("invalid MType")
+	ErrInvalidDevAddr           = errors.New("invalid DevAddr")
+	ErrNoAckReceived            = errors.New("no ACK received for confirmed uplink")
+	ErrInvalidPersistedData     = errors.New("invalid persisted data")
+	ErrUnsupportedVersion       = errors.New("unsupported persisted data version")
+	ErrInvalidChecksum          = errors.New("invalid checksum")
+	ErrInvalidChannelPlan       = errors.New("persisted channel plan does not match the region settings")
+	ErrNoChannelAvailable       = errors.New("no channel available for the current data rate")
+	ErrDutyCycleLimited         = errors.New("transmission refused by duty cycle limitation")
+	ErrContinuousRxNotSupported = errors.New("radio does not support continuous receive")
+	ErrFSKNotSupported          = errors.New("radio does not support FSK")
 )
 
 const (
-	LORA_TX_TIMEOUT = 2000
-	LORA_RX_TIMEOUT = 10000
+	LORA_TX_TIMEOUT  = 2000
+	LORA_RX_TIMEOUT  = 10000
+	LORA_RX2_TIMEOUT = 3000
+	// RX2 opens one ReceiveDelay after RX1, stop listening on RX1 a bit
+	// earlier to leave time for radio reconfiguration, in milliseconds for
+	// the one second ReceiveDelay
+	LORA_RX_WINDOW_GUARD = 50
 )
 
 var (
 	ActiveRadio    lora.Radio
-	Retries        = 15
+	Retries        = 15 // Retransmissions of confirmed uplinks
 	regionSettings region.Settings
+
+	// DutyCycleMaxWait is the longest delay accepted before an uplink to
+	// comply with duty cycle limitations, longer delays refuse the uplink
+	DutyCycleMaxWait = 10 * time.Second
+
+	// ReceiveDelay is the delay between the uplink and RX1 for RXDelay 0 or
+	// 1, and between RX1 and RX2. It is one second, tests shorten it.
+	ReceiveDelay = time.Second
+
+	// AckTimeout is ACK_TIMEOUT, the average wait before retransmitting an
+	// unacknowledged confirmed uplink, randomized by +/- 50%
+	AckTimeout = 2 * time.Second
 )
 
 // UseRegionSettings sets current Lorawan Regional parameters
@@ -51,6 +80,22 @@ func SetPublicNetwork(enabled bool) {
 	ActiveRadio.SetPublicNetwork(enabled)
 }
 
+// timeOnAir returns the duration of the transmission of a packet on a channel
+func timeOnAir(ch region.Channel, payloadLen int) time.Duration {
+	if isFSK(ch) {
+		return fskTimeOnAir(payloadLen)
+	}
+	cnf := lora.Config{
+		Sf:         ch.SpreadingFactor(),
+		Bw:         ch.Bandwidth(),
+		Cr:         ch.CodingRate(),
+		Preamble:   ch.PreambleLength(),
+		HeaderType: lora.HeaderExplicit,
+		Crc:        lora.CRCOn,
+	}
+	return cnf.TimeOnAir(payloadLen)
+}
+
 // ApplyChannelConfig sets current Lora modulation according to current regional settings
 func applyChannelConfig(ch region.Channel) {
 	ActiveRadio.SetFrequency(ch.Frequency())
@@ -77,6 +122,7 @@ func Join(otaa *Otaa, session *Session) error {
 	}
 
 	otaa.Init()
+	defer suspendClassC()()
 
 	// Send join packet
 	payload, err := otaa.GenerateJoinRequest()
@@ -89,12 +135,16 @@ func Join(otaa *Otaa, session *Session) error {
 		joinAcceptChannel := regionSettings.JoinAcceptChannel()
 
 		// Prepare radio for Join Tx
+		if err := waitDutyCycle(joinRequestChannel.Frequency()); err != nil {
+			return err
+		}
 		applyChannelConfig(joinRequestChannel)
 		ActiveRadio.SetIqMode(lora.IQStandard)
-		ActiveRadio.Tx(payload, LORA_TX_TIMEOUT)
+		err = ActiveRadio.Tx(payload, LORA_TX_TIMEOUT)
 		if err != nil {
 			return err
 		}
+		regionSettings.TransmitDone(joinRequestChannel.Frequency(), timeOnAir(joinRequestChannel, len(payload)))
 
 		// Wait for JoinAccept
 		if joinAcceptChannel.Frequency() != 0 {
@@ -114,31 +164,276 @@ func Join(otaa *Otaa, session *Session) error {
 	if err != nil {
 		return err
 	}
+	applyRX2DataRate(session)
+	if session.CFList != [16]uint8{} {
+		regionSettings.ApplyCFList(session.CFList)
+	}
 
 	return nil
 }
 
-// SendUplink sends Lorawan Uplink message
-func SendUplink(data []uint8, session *Session) error {
+// ActivateABP activates a session using Activation By Personalization: the
+// DevAddr and session keys are provisioned on the device, no Join is needed.
+// Frame counters are left untouched so that a restored session keeps them.
+func ActivateABP(session *Session, devAddr []uint8, nwkSKey []uint8, appSKey []uint8) error {
+	if err := session.SetDevAddr(devAddr); err != nil {
+		return err
+	}
+	if err := session.SetNwkSKey(nwkSKey); err != nil {
+		return err
+	}
+	return session.SetAppSKey(appSKey)
+}
 
+// SendUplink sends Lorawan Uplink message, then opens the Class A receive
+// windows. It returns the decoded downlink if one was received, nil otherwise.
+// The uplink is transmitted up to NbTrans times until a downlink is received.
+func SendUplink(data []uint8, session *Session) (*Downlink, error) {
 	if regionSettings == nil {
-		return ErrUndefinedRegionSettings
+		return nil, ErrUndefinedRegionSettings
 	}
 
+	// The Class C listener updates the session too, suspend it before
+	// touching the session and until the receive windows are closed
+	defer suspendClassC()()
+
+	adrBackoff(session)
+	if err := checkPayloadSize(data); err != nil {
+		return nil, err
+	}
 	payload, err := session.GenMessage(0, []byte(data))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	applyChannelConfig(regionSettings.UplinkChannel())
-	ActiveRadio.SetIqMode(lora.IQStandard)
-	ActiveRadio.Tx(payload, LORA_TX_TIMEOUT)
+	nbTrans := int(session.NbTrans)
+	if nbTrans == 0 {
+		nbTrans = 1
+	}
+
+	var dl *Downlink
+	for i := 0; i < nbTrans && dl == nil; i++ {
+		dl, err = transmitUplink(payload, session)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dl, nil
+}
+
+// SendConfirmedUplink sends a Lorawan confirmed Uplink message, and
+// retransmits it up to Retries times until the network server acknowledges it.
+// It returns the downlink holding the acknowledgement.
+func SendConfirmedUplink(data []uint8, session *Session) (*Downlink, error) {
+	if regionSettings == nil {
+		return nil, ErrUndefinedRegionSettings
+	}
+
+	// The Class C listener updates the session too, suspend it before
+	// touching the session and until the receive windows are closed
+	resume := suspendClassC()
+	defer func() { resume() }()
+
+	adrBackoff(session)
+	if err := checkPayloadSize(data); err != nil {
+		return nil, err
+	}
+	payload, err := session.GenConfirmedMessage(0, []byte(data))
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	for i := 0; i <= Retries; i++ {
+		if i > 0 {
+			// Wait ACK_TIMEOUT, a random delay between 1 and 3 seconds,
+			// while Class C reception goes on
+			resume()
+			rnd, _ := GetRand16()
+			time.Sleep(AckTimeout/2 + AckTimeout*time.Duration(uint16(rnd[0])<<8|uint16(rnd[1]))/0x10000)
+			resume = suspendClassC()
+		}
+
+		dl, err := transmitUplink(payload, session)
+		if err == ErrNoRadioAttached || err == ErrUndefinedRegionSettings {
+			return nil, err
+		}
+		if err == nil && dl != nil && dl.Ack {
+			return dl, nil
+		}
+	}
+	return nil, ErrNoAckReceived
+}
+
+// checkPayloadSize verifies the application payload fits in an uplink at the
+// current data rate
+func checkPayloadSize(data []uint8) error {
+	dr, ok := currentDataRate()
+	if ok && len(data) > int(regionSettings.MaxPayload(dr)) {
+		return ErrFrmPayloadTooLarge
 	}
 	return nil
 }
 
-func ListenDownlink() error {
+// transmitUplink sends an already built uplink PHYPayload and opens the
+// receive windows following it. Class C reception must be suspended.
+func transmitUplink(payload []uint8, session *Session) (*Downlink, error) {
+	if ActiveRadio == nil {
+		return nil, ErrNoRadioAttached
+	}
+
+	// Hop to a random channel, complying with sub-band and network server
+	// requested duty cycle limitations
+	wait, ok := regionSettings.SelectUplinkChannel()
+	if !ok {
+		return nil, ErrNoChannelAvailable
+	}
+	if aggregated := time.Until(session.dutyCycleUntil); aggregated > wait {
+		wait = aggregated
+	}
+	if wait > DutyCycleMaxWait {
+		return nil, ErrDutyCycleLimited
+	}
+	time.Sleep(wait)
+
+	up := regionSettings.UplinkChannel()
+	if err := transmit(up, payload); err != nil {
+		return nil, err
+	}
+	session.txDone = time.Now()
+
+	airTime := timeOnAir(up, len(payload))
+	regionSettings.TransmitDone(up.Frequency(), airTime)
+	if session.MaxDutyCycle > 0 {
+		session.dutyCycleUntil = session.txDone.Add(airTime * time.Duration(1<<session.MaxDutyCycle-1))
+	}
+
+	return ListenDownlink(session)
+}
+
+// transmit sends a PHYPayload on the channel, with LoRa or FSK modulation
+func transmit(ch region.Channel, payload []uint8) error {
+	if isFSK(ch) {
+		radio, err := fskRadio(ch)
+		if err != nil {
+			return err
+		}
+		return radio.TxFSK(payload, LORA_TX_TIMEOUT)
+	}
+	applyChannelConfig(ch)
+	ActiveRadio.SetIqMode(lora.IQStandard)
+	return ActiveRadio.Tx(payload, LORA_TX_TIMEOUT)
+}
+
+// waitDutyCycle waits until the sub-band of freq allows a transmission, it
+// fails if it would wait longer than DutyCycleMaxWait
+func waitDutyCycle(freq uint32) error {
+	limiter, ok := regionSettings.(region.DutyCycleLimiter)
+	if !ok {
+		return nil
+	}
+	wait := limiter.DutyCycleWait(freq)
+	if wait > DutyCycleMaxWait {
+		return ErrDutyCycleLimited
+	}
+	time.Sleep(wait)
 	return nil
 }
+
+// ListenDownlink opens the RX1 and RX2 receive windows following the last
+// uplink of the session, and returns the decoded downlink if one was received.
+// RX1 opens RXDelay seconds after the end of the uplink, RX2 one second later.
+func ListenDownlink(session *Session) (*Downlink, error) {
+	if ActiveRadio == nil {
+		return nil, ErrNoRadioAttached
+	}
+
+	if regionSettings == nil {
+		return nil, ErrUndefinedRegionSettings
+	}
+
+	// RXDelay 0 and 1 both mean one second
+	delay := time.Duration(session.RXDelay&0x0F) * ReceiveDelay
+	if delay == 0 {
+		delay = ReceiveDelay
+	}
+	rx1Start := session.txDone.Add(delay)
+	rx2Start := rx1Start.Add(ReceiveDelay)
+
+	// Class C devices keep listening on RX2 until RX1 opens
+	if classC != nil {
+		classC.listenUntil(rx1Start.Add(-rxWindowGuard()))
+	}
+
+	rx1 := regionSettings.RX1Channel()
+	applyRX1DROffset(rx1, session)
+
+	// RX2 is only skipped when RX1 received a frame for the device, RX1
+	// errors are reported if RX2 receives nothing either
+	rx1End := rx2Start.Add(-rxWindowGuard())
+	resp, rx1Err := receiveWindow(rx1, rx1Start, rx1End)
+	if rx1Err == nil && resp != nil {
+		dl, err := decodeDownlink(resp, nil, session)
+		if err == nil {
+			return dl, nil
+		}
+		rx1Err = err
+	}
+
+	rx2End := rx2Start.Add(LORA_RX2_TIMEOUT * time.Millisecond)
+	resp, err := receiveWindow(regionSettings.RX2Channel(), rx2Start, rx2End)
+	if err != nil || resp != nil {
+		return decodeDownlink(resp, err, session)
+	}
+	return nil, rx1Err
+}
+
+// rxWindowGuard returns LORA_RX_WINDOW_GUARD, scaled to ReceiveDelay
+func rxWindowGuard() time.Duration {
+	return ReceiveDelay * LORA_RX_WINDOW_GUARD / 1000
+}
+
+// receiveWindow waits for the window start time and listens on the given
+// channel until the window end time
+func receiveWindow(ch region.Channel, start, end time.Time) ([]uint8, error) {
+	var fsk lora.FSKRadio
+	if isFSK(ch) {
+		var err error
+		if fsk, err = fskRadio(ch); err != nil {
+			return nil, err
+		}
+	} else {
+		applyChannelConfig(ch)
+		ActiveRadio.SetIqMode(lora.IQInverted)
+	}
+
+	time.Sleep(time.Until(start))
+	timeout := time.Until(end)
+	if timeout <= 0 {
+		return nil, nil
+	}
+	if fsk != nil {
+		return fsk.RxFSK(uint32(timeout / time.Millisecond))
+	}
+	return ActiveRadio.Rx(uint32(timeout / time.Millisecond))
+}
+
+func decodeDownlink(resp []uint8, err error, session *Session) (*Downlink, error) {
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, nil
+	}
+
+	dl, err := session.DecodeDownlink(resp)
+	if err != nil {
+		return nil, err
+	}
+	session.snr = ActiveRadio.LastPacketSNR()
+
+	processMACCommands(dl.FOpts, session)
+	if dl.HasFPort && dl.FPort == 0 {
+		processMACCommands(dl.Payload, session)
+	}
+	return dl, nil
+}
@@ -0,0 +1,306 @@
+package lorawan_test
+
+import (
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"tinygo.org/x/drivers/lora"
+	"tinygo.org/x/drivers/lora/loratest"
+	"tinygo.org/x/drivers/lora/lorawan"
+	"tinygo.org/x/drivers/lora/lorawan/region"
+)
+
+var testAppKey = [16]uint8{0x2B, 0x7E, 0x15, 0x16, 0x28, 0xAE, 0xD2, 0xA6, 0xAB, 0xF7, 0x15, 0x88, 0x09, 0xCF, 0x4F, 0x3C}
+
+// setupNetwork attaches a simulated radio answered by a fake network server
+func setupNetwork() (*loratest.Radio, *loratest.NetworkServer) {
+	radio := loratest.NewRadio()
+	ns := &loratest.NetworkServer{
+		AppKey:   testAppKey,
+		AppNonce: [3]uint8{0x01, 0x02, 0x03},
+		NetID:    [3]uint8{0x13, 0x00, 0x00},
+		DevAddr:  [4]uint8{0x26, 0x01, 0x1B, 0xDA},
+	}
+	ns.Attach(radio)
+
+	lorawan.ActiveRadio = radio
+	// Shorten the receive windows and retransmissions delays
+	lorawan.ReceiveDelay = 10 * time.Millisecond
+	lorawan.AckTimeout = 20 * time.Millisecond
+	// US915 has no duty cycle limitation delaying uplinks
+	lorawan.UseRegionSettings(region.US915())
+	return radio, ns
+}
+
+func join(c *qt.C, ns *loratest.NetworkServer) *lorawan.Session {
+	otaa := &lorawan.Otaa{}
+	otaa.Set([]uint8{1, 2, 3, 4, 5, 6, 7, 8}, []uint8{8, 7, 6, 5, 4, 3, 2, 1}, testAppKey[:])
+	session := &lorawan.Session{}
+	c.Assert(lorawan.Join(otaa, session), qt.IsNil)
+	c.Assert(session.DevAddr, qt.Equals, ns.DevAddr)
+	c.Assert(session.NwkSKey, qt.Equals, ns.NwkSKey)
+	c.Assert(session.AppSKey, qt.Equals, ns.AppSKey)
+	return session
+}
+
+func TestJoinUplinkDownlink(t *testing.T) {
+	c := qt.New(t)
+	radio, ns := setupNetwork()
+	session := join(c, ns)
+
+	c.Assert(radio.Sent, qt.HasLen, 1)
+	c.Assert(radio.Sent[0].Config.Iq, qt.Equals, uint8(lora.IQStandard))
+	c.Assert(radio.Listened[0].Iq, qt.Equals, uint8(lora.IQInverted))
+
+	ns.QueueDownlink(2, []uint8("on"))
+	start := time.Now()
+	dl, err := lorawan.SendUplink([]uint8("hello"), session)
+	c.Assert(err, qt.IsNil)
+	c.Assert(dl, qt.Not(qt.IsNil))
+	c.Assert(dl.FPort, qt.Equals, uint8(2))
+	c.Assert(dl.Payload, qt.DeepEquals, []uint8("on"))
+	// The downlink is received in RX1, one ReceiveDelay after the uplink
+	c.Assert(time.Since(start) >= lorawan.ReceiveDelay, qt.IsTrue)
+	c.Assert(session.FCntDown, qt.Equals, uint32(1))
+
+	c.Assert(ns.Uplinks, qt.HasLen, 1)
+	c.Assert(ns.Uplinks[0].FCnt, qt.Equals, uint32(0))
+	c.Assert(ns.Uplinks[0].FPort, qt.Equals, uint8(1))
+	c.Assert(ns.Uplinks[0].Payload, qt.DeepEquals, []uint8("hello"))
+
+	// US915 RX1 uses one of the 8 downlink channels, 500 kHz wide
+	rx1 := radio.Listened[1]
+	c.Assert(rx1.Freq >= 923300000 && rx1.Freq <= 927500000, qt.IsTrue)
+	c.Assert(rx1.Bw, qt.Equals, uint8(lora.Bandwidth_500_0))
+}
+
+func TestRX2(t *testing.T) {
+	c := qt.New(t)
+	radio, ns := setupNetwork()
+	session := join(c, ns)
+
+	// RX1 fails with a CRC error, the downlink is received in RX2
+	answer := radio.OnTx
+	radio.OnTx = func(f loratest.Frame) {
+		radio.QueueCrcError()
+		answer(f)
+	}
+	ns.QueueDownlink(2, []uint8("rx2"))
+	listened := len(radio.Listened)
+	dl, err := lorawan.SendUplink([]uint8{0x01}, session)
+	c.Assert(err, qt.IsNil)
+	c.Assert(dl, qt.Not(qt.IsNil))
+	c.Assert(dl.Payload, qt.DeepEquals, []uint8("rx2"))
+	c.Assert(radio.Listened, qt.HasLen, listened+2)
+	c.Assert(radio.Listened[listened+1].Freq, qt.Equals, uint32(lora.MHz_923_3))
+
+	// RX1 receives a frame for another device, the downlink is received
+	// in RX2
+	radio.OnTx = func(f loratest.Frame) {
+		other := ns.Downlink(1, []uint8("other"), false)
+		other[1] ^= 0xFF
+		radio.QueueRx(other)
+		answer(f)
+	}
+	ns.QueueDownlink(3, []uint8("mine"))
+	dl, err = lorawan.SendUplink([]uint8{0x02}, session)
+	c.Assert(err, qt.IsNil)
+	c.Assert(dl, qt.Not(qt.IsNil))
+	c.Assert(dl.FPort, qt.Equals, uint8(3))
+	c.Assert(dl.Payload, qt.DeepEquals, []uint8("mine"))
+
+	// Nothing received in RX2 either, the RX1 error is reported
+	radio.OnTx = func(f loratest.Frame) {
+		radio.QueueCrcError()
+	}
+	_, err = lorawan.SendUplink([]uint8{0x03}, session)
+	c.Assert(err, qt.Equals, loratest.ErrCrc)
+}
+
+func TestConfirmedUplink(t *testing.T) {
+	c := qt.New(t)
+	_, ns := setupNetwork()
+	session := join(c, ns)
+
+	dl, err := lorawan.SendConfirmedUplink([]uint8{0x42}, session)
+	c.Assert(err, qt.IsNil)
+	c.Assert(dl.Ack, qt.IsTrue)
+	c.Assert(ns.Uplinks, qt.HasLen, 1)
+	c.Assert(ns.Uplinks[0].Confirmed, qt.IsTrue)
+}
+
+func TestConfirmedUplinkRetransmission(t *testing.T) {
+	c := qt.New(t)
+	radio, ns := setupNetwork()
+	session := join(c, ns)
+
+	// The acknowledgement of the first transmission is lost
+	answer := radio.OnTx
+	lost := 1
+	radio.OnTx = func(f loratest.Frame) {
+		if lost > 0 {
+			lost--
+			return
+		}
+		answer(f)
+	}
+
+	dl, err := lorawan.SendConfirmedUplink([]uint8{0x42}, session)
+	c.Assert(err, qt.IsNil)
+	c.Assert(dl.Ack, qt.IsTrue)
+	c.Assert(radio.Sent, qt.HasLen, 3)
+	// The same frame is retransmitted, with the same frame counter
+	c.Assert(radio.Sent[2].Payload, qt.DeepEquals, radio.Sent[1].Payload)
+	c.Assert(ns.Uplinks, qt.HasLen, 1)
+	c.Assert(session.FCntUp, qt.Equals, uint32(1))
+}
+
+func TestConfirmedUplinkNoAck(t *testing.T) {
+	c := qt.New(t)
+	radio, ns := setupNetwork()
+	session := join(c, ns)
+
+	retries := lorawan.Retries
+	lorawan.Retries = 1
+	defer func() { lorawan.Retries = retries }()
+	radio.OnTx = nil
+
+	_, err := lorawan.SendConfirmedUplink([]uint8{0x42}, session)
+	c.Assert(err, qt.Equals, lorawan.ErrNoAckReceived)
+	// Sent once, then retransmitted Retries times
+	c.Assert(radio.Sent, qt.HasLen, 3)
+	c.Assert(radio.Sent[2].Payload, qt.DeepEquals, radio.Sent[1].Payload)
+}
+
+func TestNbTrans(t *testing.T) {
+	c := qt.New(t)
+	radio, ns := setupNetwork()
+	session := join(c, ns)
+	session.NbTrans = 2
+
+	// Without downlink, unconfirmed uplinks are transmitted NbTrans times
+	dl, err := lorawan.SendUplink([]uint8{0x01}, session)
+	c.Assert(err, qt.IsNil)
+	c.Assert(dl, qt.IsNil)
+	c.Assert(radio.Sent, qt.HasLen, 3)
+	c.Assert(radio.Sent[2].Payload, qt.DeepEquals, radio.Sent[1].Payload)
+
+	// A downlink stops the repetitions
+	ns.QueueDownlink(1, []uint8{0x02})
+	dl, err = lorawan.SendUplink([]uint8{0x03}, session)
+	c.Assert(err, qt.IsNil)
+	c.Assert(dl, qt.Not(qt.IsNil))
+	c.Assert(radio.Sent, qt.HasLen, 4)
+}
+
+func TestJoinDutyCycle(t *testing.T) {
+	c := qt.New(t)
+	radio, ns := setupNetwork()
+	lorawan.UseRegionSettings(region.EU868())
+	join(c, ns)
+
+	// The JoinRequest sub-band is 1% duty cycle limited, a JoinRequest at
+	// SF9 makes it unavailable for about 20 seconds
+	otaa := &lorawan.Otaa{}
+	otaa.Set([]uint8{1, 2, 3, 4, 5, 6, 7, 8}, []uint8{8, 7, 6, 5, 4, 3, 2, 1}, testAppKey[:])
+	err := lorawan.Join(otaa, &lorawan.Session{})
+	c.Assert(err, qt.Equals, lorawan.ErrDutyCycleLimited)
+	c.Assert(radio.Sent, qt.HasLen, 1)
+}
+
+func TestFSKUplink(t *testing.T) {
+	c := qt.New(t)
+	radio, ns := setupNetwork()
+	rs := region.EU868()
+	lorawan.UseRegionSettings(rs)
+	session := join(c, ns)
+
+	// DR7 on a channel of another sub-band than the JoinRequest
+	c.Assert(rs.SetChannel(3, 868800000, 7, 7), qt.IsTrue)
+	c.Assert(rs.SetChannelMask(0, 0x0008), qt.IsTrue)
+	sf, bw, ok := rs.DataRate(7)
+	c.Assert(ok, qt.IsTrue)
+	rs.UplinkChannel().SetSpreadingFactor(sf)
+	rs.UplinkChannel().SetBandwidth(bw)
+
+	ns.QueueDownlink(2, []uint8("fsk"))
+	dl, err := lorawan.SendUplink([]uint8("hello"), session)
+	c.Assert(err, qt.IsNil)
+	c.Assert(dl, qt.Not(qt.IsNil))
+	c.Assert(dl.Payload, qt.DeepEquals, []uint8("fsk"))
+
+	up := radio.Sent[len(radio.Sent)-1]
+	c.Assert(up.FSK, qt.Not(qt.IsNil))
+	c.Assert(up.FSK.Freq, qt.Equals, uint32(868800000))
+	c.Assert(up.FSK.BitRate, qt.Equals, uint32(50000))
+	c.Assert(ns.Uplinks[0].Payload, qt.DeepEquals, []uint8("hello"))
+}
+
+func TestDownlinkInvalidMic(t *testing.T) {
+	c := qt.New(t)
+	_, ns := setupNetwork()
+	session := join(c, ns)
+
+	pkt := ns.Downlink(1, []uint8{1, 2, 3}, false)
+	pkt[len(pkt)-1] ^= 0xFF
+	_, err := session.DecodeDownlink(pkt)
+	c.Assert(err, qt.Equals, lorawan.ErrInvalidMic)
+}
+
+func TestClassC(t *testing.T) {
+	c := qt.New(t)
+	radio, ns := setupNetwork()
+	session := join(c, ns)
+
+	downlinks := make(chan *lorawan.Downlink, 1)
+	c.Assert(lorawan.StartClassC(session, downlinks), qt.IsNil)
+	defer lorawan.StopClassC()
+
+	radio.QueueRx(ns.Downlink(3, []uint8("off"), false))
+	select {
+	case dl := <-downlinks:
+		c.Assert(dl.FPort, qt.Equals, uint8(3))
+		c.Assert(dl.Payload, qt.DeepEquals, []uint8("off"))
+	case <-time.After(time.Second):
+		c.Fatal("no Class C downlink received")
+	}
+
+	// Continuous reception listens on the RX2 channel
+	rx := radio.Config()
+	c.Assert(rx.Freq, qt.Equals, uint32(lora.MHz_923_3))
+	c.Assert(rx.Iq, qt.Equals, uint8(lora.IQInverted))
+}
+
+func TestClassCUplink(t *testing.T) {
+	c := qt.New(t)
+	radio, ns := setupNetwork()
+	session := join(c, ns)
+
+	downlinks := make(chan *lorawan.Downlink, 1)
+	c.Assert(lorawan.StartClassC(session, downlinks), qt.IsNil)
+	defer lorawan.StopClassC()
+
+	// A Class C downlink sent right after the uplink, before RX1 opens
+	answer := radio.OnTx
+	radio.OnTx = func(f loratest.Frame) {
+		answer(f)
+		radio.QueueRx(ns.Downlink(3, []uint8("gap"), false))
+	}
+	listened := len(radio.Listened)
+	dl, err := lorawan.SendUplink([]uint8{0x01}, session)
+	c.Assert(err, qt.IsNil)
+	c.Assert(dl, qt.IsNil)
+
+	select {
+	case dl := <-downlinks:
+		c.Assert(dl.Payload, qt.DeepEquals, []uint8("gap"))
+	default:
+		c.Fatal("no Class C downlink received before RX1")
+	}
+
+	// The device listens on RX2 from the end of the uplink, like in
+	// continuous reception
+	c.Assert(radio.Listened[listened], qt.Equals, radio.Listened[listened-1])
+	c.Assert(radio.Listened[listened].Freq, qt.Equals, uint32(lora.MHz_923_3))
+}
@@ -0,0 +1,58 @@
+package lorawan
+
+import "tinygo.org/x/drivers/lora/lorawan/region"
+
+// ADR_ACK_LIMIT uplinks without downlink make the device request an answer
+// with ADRACKReq, ADR_ACK_DELAY more uplinks without answer make it lower
+// its data rate to regain connectivity.
+const (
+	ADR_ACK_LIMIT = 64
+	ADR_ACK_DELAY = 32
+)
+
+// adrBackoff steps the uplink channel towards more robust settings when the
+// network server did not answer for ADR_ACK_LIMIT + ADR_ACK_DELAY uplinks, and
+// again every ADR_ACK_DELAY uplinks: first the TX power is restored to its
+// maximum, then the data rate is lowered one step at a time and finally, at the
+// lowest data rate, all default channels are enabled again.
+func adrBackoff(session *Session) {
+	if !session.ADR || session.adrAckCnt < ADR_ACK_LIMIT+ADR_ACK_DELAY {
+		return
+	}
+	session.adrAckCnt = ADR_ACK_LIMIT
+
+	up := regionSettings.UplinkChannel()
+	if maxPower, ok := regionSettings.TxPower(0); ok && up.TxPowerDBm() != maxPower {
+		up.SetTxPowerDBm(maxPower)
+		return
+	}
+
+	dr, ok := currentDataRate()
+	for ok && dr > 0 {
+		dr--
+		if sf, bw, valid := regionSettings.DataRate(dr); valid {
+			up.SetSpreadingFactor(sf)
+			up.SetBandwidth(bw)
+			return
+		}
+	}
+
+	regionSettings.SetChannelMask(6, 0x00FF)
+}
+
+// currentDataRate returns the regional data rate matching the uplink channel
+// modulation
+func currentDataRate() (uint8, bool) {
+	return dataRate(regionSettings.UplinkChannel())
+}
+
+// dataRate returns the regional data rate matching the channel modulation
+func dataRate(ch region.Channel) (uint8, bool) {
+	for dr := uint8(0); dr < 16; dr++ {
+		sf, bw, ok := regionSettings.DataRate(dr)
+		if ok && sf == ch.SpreadingFactor() && bw == ch.Bandwidth() {
+			return dr, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,94 @@
+package lorawan
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"tinygo.org/x/drivers/lora/lorawan/region"
+)
+
+func TestADRAckReq(t *testing.T) {
+	c := qt.New(t)
+	UseRegionSettings(region.EU868())
+
+	s := &Session{ADR: true, adrAckCnt: ADR_ACK_LIMIT - 2}
+	msg, err := s.GenMessage(0, []uint8{1})
+	c.Assert(err, qt.IsNil)
+	c.Assert(msg[5]&FCTRL_ADRACKREQ, qt.Equals, uint8(0))
+
+	// The ADR_ACK_LIMITth uplink without downlink requests an answer
+	msg, err = s.GenMessage(0, []uint8{1})
+	c.Assert(err, qt.IsNil)
+	c.Assert(msg[5]&FCTRL_ADR, qt.Equals, uint8(FCTRL_ADR))
+	c.Assert(msg[5]&FCTRL_ADRACKREQ, qt.Equals, uint8(FCTRL_ADRACKREQ))
+
+	// Any downlink resets the counter
+	s.adrAckCnt = 0
+	msg, err = s.GenMessage(0, []uint8{1})
+	c.Assert(err, qt.IsNil)
+	c.Assert(msg[5]&FCTRL_ADRACKREQ, qt.Equals, uint8(0))
+}
+
+func TestADRBackoff(t *testing.T) {
+	c := qt.New(t)
+	rs := region.EU868()
+	UseRegionSettings(rs)
+
+	// DR2 at 14 dBm on the first default channel only
+	up := rs.UplinkChannel()
+	sf, bw, _ := rs.DataRate(2)
+	up.SetSpreadingFactor(sf)
+	up.SetBandwidth(bw)
+	up.SetTxPowerDBm(14)
+	c.Assert(rs.SetChannelMask(0, 0x0001), qt.IsTrue)
+
+	s := &Session{ADR: true, adrAckCnt: ADR_ACK_LIMIT + ADR_ACK_DELAY - 1}
+	adrBackoff(s)
+	dr, _ := currentDataRate()
+	c.Assert(dr, qt.Equals, uint8(2))
+
+	// ADR_ACK_DELAY uplinks after ADR_ACK_LIMIT, the TX power is restored
+	step := func() {
+		s.adrAckCnt += ADR_ACK_DELAY
+		adrBackoff(s)
+		c.Assert(s.adrAckCnt, qt.Equals, uint32(ADR_ACK_LIMIT))
+	}
+	usedChannels := func() int {
+		used := map[uint32]bool{}
+		for i := 0; i < 30; i++ {
+			_, ok := rs.SelectUplinkChannel()
+			c.Assert(ok, qt.IsTrue)
+			used[up.Frequency()] = true
+		}
+		return len(used)
+	}
+	step()
+	dr, _ = currentDataRate()
+	c.Assert(dr, qt.Equals, uint8(2))
+	c.Assert(up.TxPowerDBm(), qt.Equals, int8(region.EU868_MAX_EIRP_DBM))
+
+	// Then the data rate is lowered one step at a time
+	step()
+	dr, _ = currentDataRate()
+	c.Assert(dr, qt.Equals, uint8(1))
+	step()
+	dr, _ = currentDataRate()
+	c.Assert(dr, qt.Equals, uint8(0))
+	c.Assert(usedChannels(), qt.Equals, 1)
+
+	// At the lowest data rate, the default channels are enabled again
+	step()
+	c.Assert(usedChannels(), qt.Equals, 3)
+}
+
+func TestADRBackoffDisabled(t *testing.T) {
+	c := qt.New(t)
+	rs := region.EU868()
+	UseRegionSettings(rs)
+
+	s := &Session{adrAckCnt: ADR_ACK_LIMIT + ADR_ACK_DELAY}
+	adrBackoff(s)
+	c.Assert(s.adrAckCnt, qt.Equals, uint32(ADR_ACK_LIMIT+ADR_ACK_DELAY))
+	dr, _ := currentDataRate()
+	c.Assert(dr, qt.Equals, uint8(3))
+}
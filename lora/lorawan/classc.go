@@ -0,0 +1,135 @@
+package lorawan
+
+import (
+	"time"
+
+	"tinygo.org/x/drivers/lora"
+)
+
+// Class C devices keep listening on the RX2 channel whenever they are not
+// transmitting, so the network server may send downlinks at any time.
+// Uplinks preempt the continuous reception: the device listens on RX2 from the
+// end of the uplink until RX1 opens, and continuous reception resumes once the
+// RX1 and RX2 windows following the uplink are closed.
+
+type classCListener struct {
+	session   *Session
+	downlinks chan<- *Downlink
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+var classC *classCListener
+
+// StartClassC switches the device to Class C operation. Downlinks received
+// outside of the receive windows of an uplink are decoded and sent on the
+// downlinks channel, they are dropped if the channel is full. The radio must
+// implement lora.ContinuousReceiver.
+// The session is updated by the listener in the background, it should only
+// be accessed by lorawan functions until StopClassC is called.
+func StartClassC(session *Session, downlinks chan<- *Downlink) error {
+	if ActiveRadio == nil {
+		return ErrNoRadioAttached
+	}
+	if regionSettings == nil {
+		return ErrUndefinedRegionSettings
+	}
+	if _, ok := ActiveRadio.(lora.ContinuousReceiver); !ok {
+		return ErrContinuousRxNotSupported
+	}
+
+	StopClassC()
+	classC = &classCListener{session: session, downlinks: downlinks}
+	return classC.resume()
+}
+
+// StopClassC returns to Class A operation
+func StopClassC() {
+	if classC == nil {
+		return
+	}
+	classC.suspend()
+	classC = nil
+}
+
+// suspendClassC stops continuous reception before a transmission, it returns
+// a function resuming it
+func suspendClassC() func() {
+	if classC == nil {
+		return func() {}
+	}
+	l := classC
+	l.suspend()
+	return func() {
+		if classC == l {
+			l.resume()
+		}
+	}
+}
+
+// resume starts listening continuously on the RX2 channel
+func (l *classCListener) resume() error {
+	radio := ActiveRadio.(lora.ContinuousReceiver)
+
+	applyChannelConfig(regionSettings.RX2Channel())
+	ActiveRadio.SetIqMode(lora.IQInverted)
+	if err := radio.StartRxContinuous(); err != nil {
+		return err
+	}
+
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+	go l.listen(radio)
+	return nil
+}
+
+// suspend stops the listener and waits for it to leave the radio alone
+func (l *classCListener) suspend() {
+	if l.stop == nil {
+		return
+	}
+	close(l.stop)
+	<-l.done
+	l.stop = nil
+}
+
+func (l *classCListener) listen(radio lora.ContinuousReceiver) {
+	defer close(l.done)
+	for {
+		select {
+		case <-l.stop:
+			radio.StopRxContinuous()
+			return
+		case msg := <-radio.GetRadioEventChan():
+			if msg.EventType != lora.RadioEventRxDone {
+				continue
+			}
+			l.deliver(radio.ReadRxPacket())
+		}
+	}
+}
+
+// listenUntil listens on the RX2 channel while the listener is suspended,
+// between an uplink and its RX1 window
+func (l *classCListener) listenUntil(end time.Time) {
+	for time.Now().Before(end) {
+		resp, err := receiveWindow(regionSettings.RX2Channel(), time.Now(), end)
+		if err != nil || resp == nil {
+			return
+		}
+		l.deliver(resp)
+	}
+}
+
+// deliver decodes a downlink and sends it on the downlinks channel, it is
+// dropped if the channel is full
+func (l *classCListener) deliver(resp []uint8) {
+	dl, err := decodeDownlink(resp, nil, l.session)
+	if err != nil || dl == nil {
+		return
+	}
+	select {
+	case l.downlinks <- dl:
+	default:
+	}
+}
@@ -0,0 +1,112 @@
+package lorawan
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// MHDR message types
+const (
+	MTYPE_JOIN_REQUEST          = 0b000
+	MTYPE_JOIN_ACCEPT           = 0b001
+	MTYPE_UNCONFIRMED_DATA_UP   = 0b010
+	MTYPE_UNCONFIRMED_DATA_DOWN = 0b011
+	MTYPE_CONFIRMED_DATA_UP     = 0b100
+	MTYPE_CONFIRMED_DATA_DOWN   = 0b101
+)
+
+// FCtrl bits
+const (
+	FCTRL_ADR        = 0x80
+	FCTRL_ADRACKREQ  = 0x40
+	FCTRL_ACK        = 0x20
+	FCTRL_FPENDING   = 0x10
+	FCTRL_FOPTS_MASK = 0x0F
+)
+
+// Downlink holds a decoded LoRaWAN downlink message
+type Downlink struct {
+	Confirmed bool    // Confirmed data down, must be acknowledged
+	Ack       bool    // Acknowledges the last confirmed uplink
+	FPending  bool    // Network server has more data pending
+	ADR       bool    // Network server ADR bit
+	FCnt      uint32  // Downlink frame counter
+	HasFPort  bool    // FPort is present in the message
+	FPort     uint8   // Port, 0 means Payload contains MAC commands
+	FOpts     []uint8 // MAC commands piggybacked in the frame header
+	Payload   []uint8 // Decrypted FRMPayload
+}
+
+// DecodeDownlink verifies and decrypts a data down PHYPayload
+func (s *Session) DecodeDownlink(phyPload []uint8) (*Downlink, error) {
+	// MHDR(1) DevAddr(4) FCtrl(1) FCnt(2) MIC(4)
+	if len(phyPload) < 12 {
+		return nil, ErrInvalidPacketLength
+	}
+
+	mType := phyPload[0] >> 5
+	if mType != MTYPE_UNCONFIRMED_DATA_DOWN && mType != MTYPE_CONFIRMED_DATA_DOWN {
+		return nil, ErrInvalidMType
+	}
+
+	if !bytes.Equal(phyPload[1:5], s.DevAddr[:]) {
+		return nil, ErrInvalidDevAddr
+	}
+
+	fCtrl := phyPload[5]
+	fOptsLen := int(fCtrl & FCTRL_FOPTS_MASK)
+	if len(phyPload) < 12+fOptsLen {
+		return nil, ErrInvalidPacketLength
+	}
+
+	// Rebuild the 32 bits frame counter from the 16 transmitted LSBs
+	fCnt16 := uint32(binary.LittleEndian.Uint16(phyPload[6:8]))
+	fCnt := s.FCntDown&0xFFFF0000 | fCnt16
+	if fCnt < s.FCntDown {
+		fCnt += 0x10000
+	}
+
+	msg := phyPload[:len(phyPload)-4]
+	rxMic := phyPload[len(phyPload)-4:]
+	computedMic := calcMessageMIC(msg, s.NwkSKey, 1, s.DevAddr[:], fCnt, uint8(len(msg)))
+	if !bytes.Equal(computedMic[:], rxMic) {
+		return nil, ErrInvalidMic
+	}
+
+	dl := &Downlink{
+		Confirmed: mType == MTYPE_CONFIRMED_DATA_DOWN,
+		Ack:       fCtrl&FCTRL_ACK != 0,
+		FPending:  fCtrl&FCTRL_FPENDING != 0,
+		ADR:       fCtrl&FCTRL_ADR != 0,
+		FCnt:      fCnt,
+	}
+	if fOptsLen > 0 {
+		dl.FOpts = append([]uint8{}, msg[8:8+fOptsLen]...)
+	}
+
+	if len(msg) > 8+fOptsLen {
+		dl.HasFPort = true
+		dl.FPort = msg[8+fOptsLen]
+
+		// FPort 0 payloads only carry MAC commands, encrypted with NwkSKey
+		key := s.AppSKey
+		if dl.FPort == 0 {
+			key = s.NwkSKey
+		}
+		var err error
+		dl.Payload, err = s.genFRMPayload(key, 1, fCnt, msg[9+fOptsLen:], false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Message is authentic, accept the frame counter
+	s.FCntDown = fCnt + 1
+	s.stickyAnswers = s.stickyAnswers[:0]
+	s.adrAckCnt = 0
+	if dl.Confirmed {
+		s.ackPending = true
+	}
+
+	return dl, nil
+}
@@ -0,0 +1,59 @@
+package lorawan
+
+import (
+	"time"
+
+	"tinygo.org/x/drivers/lora"
+	"tinygo.org/x/drivers/lora/lorawan/region"
+)
+
+// FSK modulation of the regional FSK data rates: 50 kbps GFSK, with a 3 bytes
+// sync word, variable length packets and a CRC.
+const (
+	FSK_BIT_RATE       = 50000
+	FSK_FREQ_DEVIATION = 25000
+	FSK_RX_BANDWIDTH   = 100000
+	FSK_PREAMBLE_LEN   = 5
+)
+
+var fskSyncWord = []uint8{0xC1, 0x94, 0xC1}
+
+// isFSK reports whether the channel uses an FSK data rate
+func isFSK(ch region.Channel) bool {
+	return ch.SpreadingFactor() == region.SF_FSK
+}
+
+// fskConfig returns the FSK configuration of the radio for the channel
+func fskConfig(ch region.Channel) lora.FSKConfig {
+	return lora.FSKConfig{
+		Freq:          ch.Frequency(),
+		BitRate:       FSK_BIT_RATE,
+		FreqDeviation: FSK_FREQ_DEVIATION,
+		RxBandwidth:   FSK_RX_BANDWIDTH,
+		Shaping:       lora.FSKShapingBT1_0,
+		Preamble:      FSK_PREAMBLE_LEN,
+		SyncWord:      fskSyncWord,
+		Whitening:     true,
+		Crc:           lora.FSKCrcCCITT,
+		TxPowerDBm:    ch.TxPowerDBm(),
+	}
+}
+
+// fskRadio configures the radio for FSK on the channel
+func fskRadio(ch region.Channel) (lora.FSKRadio, error) {
+	radio, ok := ActiveRadio.(lora.FSKRadio)
+	if !ok {
+		return nil, ErrFSKNotSupported
+	}
+	if err := radio.FSKConfig(fskConfig(ch)); err != nil {
+		return nil, err
+	}
+	return radio, nil
+}
+
+// fskTimeOnAir returns the duration of the transmission of an FSK packet:
+// preamble, sync word, length byte, payload and CRC
+func fskTimeOnAir(payloadLen int) time.Duration {
+	bits := 8 * (FSK_PREAMBLE_LEN + len(fskSyncWord) + 1 + payloadLen + 2)
+	return time.Duration(bits) * time.Second / FSK_BIT_RATE
+}
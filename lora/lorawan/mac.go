@@ -0,0 +1,295 @@
+package lorawan
+
+import (
+	"tinygo.org/x/drivers/lora"
+	"tinygo.org/x/drivers/lora/lorawan/region"
+)
+
+// MAC command identifiers (LoRaWAN 1.0.x)
+const (
+	CID_LINK_CHECK       = 0x02
+	CID_LINK_ADR         = 0x03
+	CID_DUTY_CYCLE       = 0x04
+	CID_RX_PARAM_SETUP   = 0x05
+	CID_DEV_STATUS       = 0x06
+	CID_NEW_CHANNEL      = 0x07
+	CID_RX_TIMING_SETUP  = 0x08
+	MAC_FOPTS_MAX_LENGTH = 15
+)
+
+// Payload length of the MAC commands sent by the network server
+var macReqLength = map[uint8]int{
+	CID_LINK_CHECK:      2,
+	CID_LINK_ADR:        4,
+	CID_DUTY_CYCLE:      1,
+	CID_RX_PARAM_SETUP:  4,
+	CID_DEV_STATUS:      0,
+	CID_NEW_CHANNEL:     5,
+	CID_RX_TIMING_SETUP: 1,
+}
+
+// BatteryLevel is called to fill the DevStatusAns battery field: 0 means the
+// device is connected to an external power source, 1 to 254 is the battery
+// level, 255 means the level could not be measured. Leave nil if unknown.
+var BatteryLevel func() uint8
+
+// processMACCommands applies the MAC commands received from the network
+// server and queues the matching answers for the next uplink
+func processMACCommands(cmds []uint8, session *Session) {
+	for len(cmds) > 0 {
+		cid := cmds[0]
+		l, ok := macReqLength[cid]
+		if !ok || len(cmds) < 1+l {
+			// Unknown command, the remaining commands cannot be parsed
+			return
+		}
+		payload := cmds[1 : 1+l]
+		cmds = cmds[1+l:]
+
+		switch cid {
+		case CID_LINK_ADR:
+			// A contiguous block of LinkADRReq is applied as a whole, and
+			// each command is answered with the status of the block
+			block := [][]uint8{payload}
+			for len(cmds) >= 1+l && cmds[0] == CID_LINK_ADR {
+				block = append(block, cmds[1:1+l])
+				cmds = cmds[1+l:]
+			}
+			status := linkADR(block, session)
+			for range block {
+				session.macAnswers = append(session.macAnswers, CID_LINK_ADR, status)
+			}
+		case CID_DUTY_CYCLE:
+			session.MaxDutyCycle = payload[0] & 0x0F
+			session.macAnswers = append(session.macAnswers, CID_DUTY_CYCLE)
+		case CID_RX_PARAM_SETUP:
+			session.stickyAnswers = append(session.stickyAnswers, CID_RX_PARAM_SETUP, rxParamSetup(payload, session))
+		case CID_DEV_STATUS:
+			battery := uint8(255)
+			if BatteryLevel != nil {
+				battery = BatteryLevel()
+			}
+			session.macAnswers = append(session.macAnswers, CID_DEV_STATUS, battery, devStatusMargin(session.snr))
+		case CID_NEW_CHANNEL:
+			session.macAnswers = append(session.macAnswers, CID_NEW_CHANNEL, newChannel(payload))
+		case CID_RX_TIMING_SETUP:
+			session.RXDelay = payload[0] & 0x0F
+			session.stickyAnswers = append(session.stickyAnswers, CID_RX_TIMING_SETUP)
+		}
+	}
+}
+
+// linkADR handles a block of contiguous LinkADRReq and returns the LinkADRAns
+// status shared by all of them. The channel masks are applied in order, the
+// data rate, TX power and NbTrans are those of the last command. Nothing is
+// applied unless all are valid.
+func linkADR(block [][]uint8, session *Session) uint8 {
+	last := block[len(block)-1]
+	dr := last[0] >> 4
+	txPower := last[0] & 0x0F
+
+	up := regionSettings.UplinkChannel()
+
+	// 0xF means keep the current value
+	sf, bw, drOK := up.SpreadingFactor(), up.Bandwidth(), true
+	if dr != 0x0F {
+		sf, bw, drOK = regionSettings.DataRate(dr)
+	}
+	dBm, powerOK := up.TxPowerDBm(), true
+	if txPower != 0x0F {
+		dBm, powerOK = regionSettings.TxPower(txPower)
+	}
+
+	masks := make([]region.ChannelMask, len(block))
+	for i, payload := range block {
+		masks[i].Ctrl = (payload[3] >> 4) & 0x07
+		masks[i].Mask = uint16(payload[1]) | uint16(payload[2])<<8
+	}
+	if !drOK || !powerOK {
+		return ansStatus(powerOK, drOK, checkChannelMasks(masks))
+	}
+	if !setChannelMasks(masks) {
+		return ansStatus(true, true, false)
+	}
+	up.SetSpreadingFactor(sf)
+	up.SetBandwidth(bw)
+	up.SetTxPowerDBm(dBm)
+	session.NbTrans = last[3] & 0x0F
+
+	return ansStatus(true, true, true)
+}
+
+// setChannelMasks applies the channel masks of a LinkADRReq block, one after
+// the other if the region cannot apply them as a whole
+func setChannelMasks(masks []region.ChannelMask) bool {
+	if masker, ok := regionSettings.(region.ChannelMasker); ok {
+		return masker.SetChannelMasks(masks)
+	}
+	for _, m := range masks {
+		if !regionSettings.SetChannelMask(m.Ctrl, m.Mask) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkChannelMasks tells whether the channel masks of a LinkADRReq block
+// would be accepted, without applying them. The channel plan is restored after
+// a trial, regions without a channel plan cannot be checked and accept them.
+func checkChannelMasks(masks []region.ChannelMask) bool {
+	plan, ok := regionSettings.(region.ChannelPlan)
+	if !ok {
+		return true
+	}
+	saved := plan.MarshalChannelPlan()
+	ok = setChannelMasks(masks)
+	plan.UnmarshalChannelPlan(saved)
+	return ok
+}
+
+// validFrequency checks freq against the regional band, when the region tells
+func validFrequency(freq uint32) bool {
+	if checker, ok := regionSettings.(region.FrequencyChecker); ok {
+		return checker.ValidFrequency(freq)
+	}
+	return freq != 0
+}
+
+// rxParamSetup handles a RXParamSetupReq and returns the RXParamSetupAns status
+func rxParamSetup(payload []uint8, session *Session) uint8 {
+	rx1DROffset := (payload[0] >> 4) & 0x07
+	rx2DR := payload[0] & 0x0F
+	freq := (uint32(payload[1]) | uint32(payload[2])<<8 | uint32(payload[3])<<16) * 100
+
+	offsetOK := rx1DROffset <= 5
+	sf, bw, drOK := regionSettings.DataRate(rx2DR)
+	freqOK := validFrequency(freq)
+	if !offsetOK || !drOK || !freqOK {
+		return ansStatus(offsetOK, drOK, freqOK)
+	}
+
+	session.DLSettings = payload[0] & 0x7F
+	rx2 := regionSettings.RX2Channel()
+	rx2.SetFrequency(freq)
+	rx2.SetSpreadingFactor(sf)
+	rx2.SetBandwidth(bw)
+
+	return ansStatus(true, true, true)
+}
+
+// newChannel handles a NewChannelReq and returns the NewChannelAns status
+func newChannel(payload []uint8) uint8 {
+	index := payload[0]
+	freq := (uint32(payload[1]) | uint32(payload[2])<<8 | uint32(payload[3])<<16) * 100
+	minDR := payload[4] & 0x0F
+	maxDR := payload[4] >> 4
+
+	// Disabling a channel (freq 0) leaves the data rate range unchecked
+	drOK, freqOK := true, true
+	if freq != 0 {
+		_, _, minOK := regionSettings.DataRate(minDR)
+		_, _, maxOK := regionSettings.DataRate(maxDR)
+		drOK = minOK && maxOK && minDR <= maxDR
+		freqOK = validFrequency(freq)
+	}
+	if !drOK || !freqOK {
+		return ansStatus(false, drOK, freqOK)
+	}
+	if !regionSettings.SetChannel(index, freq, minDR, maxDR) {
+		return 0
+	}
+	return 0b011
+}
+
+// applyRX2DataRate configures the RX2 channel with the data rate from
+// DLSettings, as received in the JoinAccept
+func applyRX2DataRate(session *Session) {
+	sf, bw, ok := regionSettings.DataRate(session.DLSettings & 0x0F)
+	if !ok {
+		return
+	}
+	rx2 := regionSettings.RX2Channel()
+	rx2.SetSpreadingFactor(sf)
+	rx2.SetBandwidth(bw)
+}
+
+// applyRX1DROffset lowers the RX1 data rate by the RX1DROffset from DLSettings
+func applyRX1DROffset(ch region.Channel, session *Session) {
+	offset := (session.DLSettings >> 4) & 0x07
+	if offset == 0 {
+		return
+	}
+	if isFSK(ch) {
+		// Step down the regional data rates, from FSK to the fastest LoRa
+		// data rates
+		dr, ok := dataRate(ch)
+		for ok && dr > 0 && offset > 0 {
+			dr--
+			if sf, bw, valid := regionSettings.DataRate(dr); valid {
+				ch.SetSpreadingFactor(sf)
+				ch.SetBandwidth(bw)
+				offset--
+			}
+		}
+		return
+	}
+	sf := ch.SpreadingFactor() + offset
+	if sf > lora.SpreadingFactor12 {
+		sf = lora.SpreadingFactor12
+	}
+	ch.SetSpreadingFactor(sf)
+}
+
+// devStatusMargin returns the DevStatusAns margin field, the SNR of the last
+// downlink rounded to a signed 6 bits value
+func devStatusMargin(snr int8) uint8 {
+	switch {
+	case snr < -32:
+		snr = -32
+	case snr > 31:
+		snr = 31
+	}
+	return uint8(snr) & 0x3F
+}
+
+// ansStatus builds the status bits of LinkADRAns, RXParamSetupAns and
+// NewChannelAns
+func ansStatus(bit2, bit1, bit0 bool) uint8 {
+	var status uint8
+	if bit2 {
+		status |= 0b100
+	}
+	if bit1 {
+		status |= 0b010
+	}
+	if bit0 {
+		status |= 0b001
+	}
+	return status
+}
+
+// macFOpts returns the queued MAC answers fitting in the uplink FOpts field
+func (s *Session) macFOpts() []uint8 {
+	fOpts := make([]uint8, 0, MAC_FOPTS_MAX_LENGTH)
+	fOpts = append(fOpts, s.stickyAnswers...)
+
+	// Answers are 1 to 3 bytes long, never split one
+	n := 0
+	for n < len(s.macAnswers) {
+		l := 1
+		switch s.macAnswers[n] {
+		case CID_LINK_ADR, CID_RX_PARAM_SETUP, CID_NEW_CHANNEL:
+			l = 2
+		case CID_DEV_STATUS:
+			l = 3
+		}
+		if len(fOpts)+l > MAC_FOPTS_MAX_LENGTH {
+			break
+		}
+		fOpts = append(fOpts, s.macAnswers[n:n+l]...)
+		n += l
+	}
+	s.macAnswers = s.macAnswers[n:]
+
+	return fOpts
+}
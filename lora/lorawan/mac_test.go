@@ -0,0 +1,169 @@
+package lorawan_test
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"tinygo.org/x/drivers/lora"
+	"tinygo.org/x/drivers/lora/loratest"
+	"tinygo.org/x/drivers/lora/lorawan"
+	"tinygo.org/x/drivers/lora/lorawan/region"
+)
+
+// sendMACCommands sends the MAC commands in a downlink answering an uplink,
+// and returns the FOpts of the next uplink holding the answers
+func sendMACCommands(c *qt.C, ns *loratest.NetworkServer, session *lorawan.Session, cmds []uint8) []uint8 {
+	ns.QueueDownlink(0, cmds)
+	dl, err := lorawan.SendUplink([]uint8{0x01}, session)
+	c.Assert(err, qt.IsNil)
+	c.Assert(dl, qt.Not(qt.IsNil))
+	c.Assert(dl.FPort, qt.Equals, uint8(0))
+
+	_, err = lorawan.SendUplink([]uint8{0x02}, session)
+	c.Assert(err, qt.IsNil)
+	return ns.Uplinks[len(ns.Uplinks)-1].FOpts
+}
+
+func TestMACCommands(t *testing.T) {
+	c := qt.New(t)
+	radio, ns := setupNetwork()
+	session := join(c, ns)
+	radio.SNR = -7
+
+	fOpts := sendMACCommands(c, ns, session, []uint8{
+		// LinkADRReq block: DR3, TX power 2, all channels off then
+		// channels 8-15 (sub-band 2), NbTrans 1
+		lorawan.CID_LINK_ADR, 0x32, 0x00, 0x00, 0x70,
+		lorawan.CID_LINK_ADR, 0x32, 0x00, 0xFF, 0x01,
+		// DutyCycleReq: 1/2
+		lorawan.CID_DUTY_CYCLE, 0x01,
+		// RXParamSetupReq: RX1DROffset 1, RX2 DR8 on 923.3 MHz
+		lorawan.CID_RX_PARAM_SETUP, 0x18, 0x28, 0xE2, 0x8C,
+		// DevStatusReq
+		lorawan.CID_DEV_STATUS,
+	})
+	c.Assert(fOpts, qt.DeepEquals, []uint8{
+		lorawan.CID_RX_PARAM_SETUP, 0x07,
+		lorawan.CID_LINK_ADR, 0x07,
+		lorawan.CID_LINK_ADR, 0x07,
+		lorawan.CID_DUTY_CYCLE,
+		// Battery level unknown, margin -7 dB
+		lorawan.CID_DEV_STATUS, 0xFF, 0x39,
+	})
+	c.Assert(session.NbTrans, qt.Equals, uint8(1))
+	c.Assert(session.MaxDutyCycle, qt.Equals, uint8(1))
+	c.Assert(session.DLSettings, qt.Equals, uint8(0x18))
+
+	up := radio.Sent[len(radio.Sent)-1].Config
+	c.Assert(up.Freq >= 903900000 && up.Freq <= 905300000, qt.IsTrue)
+	c.Assert(up.Sf, qt.Equals, uint8(lora.SpreadingFactor7))
+	c.Assert(up.Bw, qt.Equals, uint8(lora.Bandwidth_125_0))
+	c.Assert(up.LoraTxPowerDBm, qt.Equals, int8(region.US915_MAX_EIRP_DBM-4))
+}
+
+func TestLinkADRBlockRefused(t *testing.T) {
+	c := qt.New(t)
+	radio, ns := setupNetwork()
+	session := join(c, ns)
+
+	// All channels off, then an invalid ChMaskCntl: no mask is applied
+	fOpts := sendMACCommands(c, ns, session, []uint8{
+		lorawan.CID_LINK_ADR, 0x32, 0x00, 0x00, 0x70,
+		lorawan.CID_LINK_ADR, 0x32, 0x00, 0xFF, 0x51,
+	})
+	c.Assert(fOpts, qt.DeepEquals, []uint8{
+		lorawan.CID_LINK_ADR, 0x06,
+		lorawan.CID_LINK_ADR, 0x06,
+	})
+	c.Assert(session.NbTrans, qt.Equals, uint8(0))
+
+	// The uplinks still use the 500 kHz channels at DR4
+	up := radio.Sent[len(radio.Sent)-1].Config
+	c.Assert(up.Bw, qt.Equals, uint8(lora.Bandwidth_500_0))
+	c.Assert(up.Sf, qt.Equals, uint8(lora.SpreadingFactor8))
+}
+
+func TestMACCommandsStatusBits(t *testing.T) {
+	c := qt.New(t)
+	_, ns := setupNetwork()
+	session := join(c, ns)
+
+	fOpts := sendMACCommands(c, ns, session, []uint8{
+		// DR14 is not defined, the channel masks are still checked
+		lorawan.CID_LINK_ADR, 0xE2, 0x00, 0x00, 0x70,
+		lorawan.CID_LINK_ADR, 0xE2, 0x00, 0xFF, 0x01,
+		// RX2 on 868.1 MHz, outside of the US915 band
+		lorawan.CID_RX_PARAM_SETUP, 0x08, 0x28, 0x76, 0x84,
+	})
+	c.Assert(fOpts, qt.DeepEquals, []uint8{
+		lorawan.CID_RX_PARAM_SETUP, 0x06,
+		lorawan.CID_LINK_ADR, 0x05,
+		lorawan.CID_LINK_ADR, 0x05,
+	})
+
+	fOpts = sendMACCommands(c, ns, session, []uint8{
+		// DR14 and an invalid ChMaskCntl
+		lorawan.CID_LINK_ADR, 0xE2, 0x00, 0xFF, 0x51,
+	})
+	c.Assert(fOpts, qt.DeepEquals, []uint8{
+		lorawan.CID_LINK_ADR, 0x04,
+	})
+	c.Assert(session.DLSettings, qt.Equals, uint8(0))
+}
+
+func TestNewChannel(t *testing.T) {
+	c := qt.New(t)
+	radio, ns := setupNetwork()
+	// AS923 has no duty cycle limitation and accepts new channels
+	lorawan.UseRegionSettings(region.AS923())
+	session := join(c, ns)
+
+	fOpts := sendMACCommands(c, ns, session, []uint8{
+		// Channel 2 on 923.6 MHz, DR0 to DR5
+		lorawan.CID_NEW_CHANNEL, 0x02, 0x20, 0xEE, 0x8C, 0x50,
+		// Default channels cannot be modified
+		lorawan.CID_NEW_CHANNEL, 0x00, 0x20, 0xEE, 0x8C, 0x50,
+		// 868.1 MHz is outside of the AS923 band
+		lorawan.CID_NEW_CHANNEL, 0x03, 0x28, 0x76, 0x84, 0x50,
+		// DR5 to DR0 is not a data rate range
+		lorawan.CID_NEW_CHANNEL, 0x03, 0x20, 0xEE, 0x8C, 0x05,
+		// Only channel 2 enabled
+		lorawan.CID_LINK_ADR, 0xFF, 0x04, 0x00, 0x00,
+	})
+	c.Assert(fOpts, qt.DeepEquals, []uint8{
+		lorawan.CID_NEW_CHANNEL, 0x03,
+		lorawan.CID_NEW_CHANNEL, 0x00,
+		lorawan.CID_NEW_CHANNEL, 0x02,
+		lorawan.CID_NEW_CHANNEL, 0x01,
+		lorawan.CID_LINK_ADR, 0x07,
+	})
+	c.Assert(radio.Sent[len(radio.Sent)-1].Config.Freq, qt.Equals, uint32(923600000))
+}
+
+func TestRejoinResetsMAC(t *testing.T) {
+	c := qt.New(t)
+	_, ns := setupNetwork()
+	session := join(c, ns)
+
+	ns.QueueDownlink(0, []uint8{
+		lorawan.CID_LINK_ADR, 0xFF, 0x00, 0xFF, 0x03,
+		lorawan.CID_DUTY_CYCLE, 0x02,
+		lorawan.CID_DEV_STATUS,
+	})
+	_, err := lorawan.SendUplink([]uint8{0x01}, session)
+	c.Assert(err, qt.IsNil)
+	c.Assert(session.NbTrans, qt.Equals, uint8(3))
+	c.Assert(session.MaxDutyCycle, qt.Equals, uint8(2))
+
+	// The answers of the previous session are dropped
+	otaa := &lorawan.Otaa{}
+	otaa.Set([]uint8{1, 2, 3, 4, 5, 6, 7, 8}, []uint8{8, 7, 6, 5, 4, 3, 2, 1}, testAppKey[:])
+	c.Assert(lorawan.Join(otaa, session), qt.IsNil)
+	c.Assert(session.NbTrans, qt.Equals, uint8(0))
+	c.Assert(session.MaxDutyCycle, qt.Equals, uint8(0))
+
+	ns.QueueDownlink(1, []uint8{0x02})
+	_, err = lorawan.SendUplink([]uint8{0x01}, session)
+	c.Assert(err, qt.IsNil)
+	c.Assert(ns.Uplinks[len(ns.Uplinks)-1].FOpts, qt.HasLen, 0)
+}
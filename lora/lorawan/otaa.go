@@ -17,10 +17,14 @@ type Otaa struct {
 	buf      []uint8
 }
 
-// Initialize DevNonce
+// Initialize DevNonce. A random DevNonce is only generated the first time,
+// afterwards it is incremented on each JoinRequest so that a DevNonce restored
+// with UnmarshalBinary is never reused.
 func (o *Otaa) Init() {
 	o.buf = make([]uint8, 0)
-	o.generateDevNonce()
+	if o.devNonce == [2]uint8{} {
+		o.generateDevNonce()
+	}
 }
 
 func (o *Otaa) generateDevNonce() {
@@ -141,7 +145,9 @@ func (o *Otaa) DecodeJoinAccept(phyPload []uint8, s *Session) error {
 	s.DLSettings = buf[10]
 	s.RXDelay = buf[11]
 
-	if len(buf) > 16 {
+	hasCFList := len(buf) > 16
+	s.CFList = [16]uint8{}
+	if hasCFList {
 		copy(s.CFList[:], buf[12:28])
 	}
 	rxMic := buf[len(buf)-4:]
@@ -153,7 +159,9 @@ func (o *Otaa) DecodeJoinAccept(phyPload []uint8, s *Session) error {
 	dataMic = append(dataMic, s.DevAddr[:]...)
 	dataMic = append(dataMic, s.DLSettings)
 	dataMic = append(dataMic, s.RXDelay)
-	dataMic = append(dataMic, s.CFList[:]...)
+	if hasCFList {
+		dataMic = append(dataMic, s.CFList[:]...)
+	}
 	computedMic := genPayloadMIC(dataMic[:], o.AppKey)
 	if !bytes.Equal(computedMic[:], rxMic[:]) {
 		return ErrInvalidMic
@@ -177,9 +185,11 @@ func (o *Otaa) DecodeJoinAccept(phyPload []uint8, s *Session) error {
 	block.Encrypt(buf, sKey)
 	copy(s.AppSKey[:], buf[0:16])
 
-	// Reset counters
+	// Reset counters, and the settings requested by the network server in
+	// the previous session
 	s.FCntDown = 0
 	s.FCntUp = 0
+	s.resetMAC()
 
 	return nil
 }
@@ -0,0 +1,180 @@
+package lorawan
+
+import (
+	"encoding"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+
+	"tinygo.org/x/drivers/lora/lorawan/region"
+)
+
+// Binary encoding of Session and Otaa, used to keep frame counters, session
+// keys, DevNonce and the channel plan across power cycles. The layout is:
+//
+//	magic (1) | version (1) | fields | CRC32 of the previous bytes (4)
+const (
+	SESSION_MAGIC          = 'S'
+	SESSION_VERSION        = 1
+	SESSION_BINARY_LENGTH  = 2 + 16 + 16 + 4 + 4 + 4 + 16 + 1 + 1 + 1 + 1 + 1 + 4 + region.CHANNEL_PLAN_LENGTH + 4
+	OTAA_MAGIC             = 'O'
+	OTAA_VERSION           = 1
+	OTAA_BINARY_LENGTH     = 2 + 8 + 8 + 16 + 2 + 3 + 3 + 4
+	persistChecksumLength  = 4
+	persistHeaderLength    = 2
+	persistMaxBinaryLength = SESSION_BINARY_LENGTH
+)
+
+// MarshalBinary encodes the session state, including frame counters. The
+// channel plan of the regional settings in use, with the channels, channel
+// mask and RX2 channel set by the network server, is saved along.
+func (s *Session) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, SESSION_BINARY_LENGTH)
+	buf = append(buf, SESSION_MAGIC, SESSION_VERSION)
+	buf = append(buf, s.NwkSKey[:]...)
+	buf = append(buf, s.AppSKey[:]...)
+	buf = append(buf, s.DevAddr[:]...)
+	buf = appendUint32(buf, s.FCntDown)
+	buf = appendUint32(buf, s.FCntUp)
+	buf = append(buf, s.CFList[:]...)
+	buf = append(buf, s.RXDelay, s.DLSettings, boolToUint8(s.ADR), s.MaxDutyCycle, s.NbTrans)
+	buf = appendUint32(buf, s.adrAckCnt)
+	var plan [region.CHANNEL_PLAN_LENGTH]uint8
+	if p, ok := regionSettings.(region.ChannelPlan); ok {
+		plan = p.MarshalChannelPlan()
+	}
+	buf = append(buf, plan[:]...)
+
+	return appendChecksum(buf), nil
+}
+
+// UnmarshalBinary restores a session encoded by MarshalBinary. The channel
+// plan is restored in the regional settings in use, call UseRegionSettings
+// first. It returns ErrInvalidChannelPlan if the plan cannot be restored, such
+// as a plan saved from another region.
+func (s *Session) UnmarshalBinary(data []byte) error {
+	data, err := checkPersisted(data, SESSION_MAGIC, SESSION_VERSION, SESSION_BINARY_LENGTH)
+	if err != nil {
+		return err
+	}
+	if p, ok := regionSettings.(region.ChannelPlan); ok {
+		var plan [region.CHANNEL_PLAN_LENGTH]uint8
+		copy(plan[:], data[69:])
+		if !p.UnmarshalChannelPlan(plan) {
+			return ErrInvalidChannelPlan
+		}
+	}
+
+	copy(s.NwkSKey[:], data[0:16])
+	copy(s.AppSKey[:], data[16:32])
+	copy(s.DevAddr[:], data[32:36])
+	s.FCntDown = binary.LittleEndian.Uint32(data[36:40])
+	s.FCntUp = binary.LittleEndian.Uint32(data[40:44])
+	copy(s.CFList[:], data[44:60])
+	s.RXDelay = data[60]
+	s.DLSettings = data[61]
+	s.ADR = data[62] != 0
+	s.MaxDutyCycle = data[63]
+	s.NbTrans = data[64]
+	s.adrAckCnt = binary.LittleEndian.Uint32(data[65:69])
+
+	return nil
+}
+
+// MarshalBinary encodes the OTAA identifiers, keys and nonces
+func (o *Otaa) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, OTAA_BINARY_LENGTH)
+	buf = append(buf, OTAA_MAGIC, OTAA_VERSION)
+	buf = append(buf, o.DevEUI[:]...)
+	buf = append(buf, o.AppEUI[:]...)
+	buf = append(buf, o.AppKey[:]...)
+	buf = append(buf, o.devNonce[:]...)
+	buf = append(buf, o.appNonce[:]...)
+	buf = append(buf, o.NetID[:]...)
+
+	return appendChecksum(buf), nil
+}
+
+// UnmarshalBinary restores OTAA data encoded by MarshalBinary
+func (o *Otaa) UnmarshalBinary(data []byte) error {
+	data, err := checkPersisted(data, OTAA_MAGIC, OTAA_VERSION, OTAA_BINARY_LENGTH)
+	if err != nil {
+		return err
+	}
+
+	copy(o.DevEUI[:], data[0:8])
+	copy(o.AppEUI[:], data[8:16])
+	copy(o.AppKey[:], data[16:32])
+	copy(o.devNonce[:], data[32:34])
+	copy(o.appNonce[:], data[34:37])
+	copy(o.NetID[:], data[37:40])
+
+	return nil
+}
+
+// Save writes the encoded value to storage at the given offset, such as a
+// flash.Device (the area must have been erased first) or an at24cx EEPROM
+func Save(w io.WriterAt, offset int64, v encoding.BinaryMarshaler) error {
+	buf, err := v.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = w.WriteAt(buf, offset)
+	return err
+}
+
+// LoadSession reads a session written by Save from storage at the given offset
+func LoadSession(r io.ReaderAt, offset int64, s *Session) error {
+	return load(r, offset, SESSION_BINARY_LENGTH, s.UnmarshalBinary)
+}
+
+// LoadOtaa reads OTAA data written by Save from storage at the given offset
+func LoadOtaa(r io.ReaderAt, offset int64, o *Otaa) error {
+	return load(r, offset, OTAA_BINARY_LENGTH, o.UnmarshalBinary)
+}
+
+func load(r io.ReaderAt, offset int64, length int, unmarshal func([]byte) error) error {
+	var buf [persistMaxBinaryLength]byte
+	if _, err := r.ReadAt(buf[:length], offset); err != nil {
+		return err
+	}
+	return unmarshal(buf[:length])
+}
+
+// checkPersisted validates header and checksum, and returns the fields
+func checkPersisted(data []byte, magic uint8, version uint8, length int) ([]byte, error) {
+	if len(data) < length {
+		return nil, ErrInvalidPersistedData
+	}
+	data = data[:length]
+	if data[0] != magic {
+		return nil, ErrInvalidPersistedData
+	}
+	if data[1] != version {
+		return nil, ErrUnsupportedVersion
+	}
+
+	sum := binary.LittleEndian.Uint32(data[length-persistChecksumLength:])
+	if crc32.ChecksumIEEE(data[:length-persistChecksumLength]) != sum {
+		return nil, ErrInvalidChecksum
+	}
+
+	return data[persistHeaderLength : length-persistChecksumLength], nil
+}
+
+func appendChecksum(buf []byte) []byte {
+	return appendUint32(buf, crc32.ChecksumIEEE(buf))
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	return append(buf, b[:]...)
+}
+
+func boolToUint8(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,114 @@
+package lorawan
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"tinygo.org/x/drivers/lora/lorawan/region"
+)
+
+// memStorage is an in-memory io.ReaderAt/io.WriterAt, like an EEPROM
+type memStorage [256]byte
+
+func (m *memStorage) ReadAt(buf []byte, off int64) (int, error) {
+	return copy(buf, m[off:]), nil
+}
+
+func (m *memStorage) WriteAt(buf []byte, off int64) (int, error) {
+	return copy(m[off:], buf), nil
+}
+
+func TestSessionMarshalBinary(t *testing.T) {
+	c := qt.New(t)
+
+	s := &Session{}
+	err := ActivateABP(s, []uint8{0x26, 0x01, 0x1B, 0xDA},
+		[]uint8{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+		[]uint8{15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0})
+	c.Assert(err, qt.IsNil)
+	s.FCntUp = 1234
+	s.FCntDown = 56
+	s.RXDelay = 5
+	s.ADR = true
+	s.adrAckCnt = 70
+
+	data, err := s.MarshalBinary()
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(data), qt.Equals, SESSION_BINARY_LENGTH)
+
+	restored := &Session{}
+	c.Assert(restored.UnmarshalBinary(data), qt.IsNil)
+	c.Assert(restored.GetDevAddr(), qt.Equals, "26011bda")
+	c.Assert(restored.NwkSKey, qt.Equals, s.NwkSKey)
+	c.Assert(restored.AppSKey, qt.Equals, s.AppSKey)
+	c.Assert(restored.FCntUp, qt.Equals, uint32(1234))
+	c.Assert(restored.FCntDown, qt.Equals, uint32(56))
+	c.Assert(restored.RXDelay, qt.Equals, uint8(5))
+	c.Assert(restored.ADR, qt.IsTrue)
+	c.Assert(restored.adrAckCnt, qt.Equals, uint32(70))
+
+	data[10] ^= 0x01
+	c.Assert(restored.UnmarshalBinary(data), qt.Equals, ErrInvalidChecksum)
+
+	data, _ = s.MarshalBinary()
+	data[1] = SESSION_VERSION + 1
+	c.Assert(restored.UnmarshalBinary(data), qt.Equals, ErrUnsupportedVersion)
+
+	c.Assert(restored.UnmarshalBinary(data[:10]), qt.Equals, ErrInvalidPersistedData)
+}
+
+func TestSessionChannelPlan(t *testing.T) {
+	c := qt.New(t)
+
+	// Channels added by NewChannelReq, masked by LinkADRReq, and RX2 moved
+	// by RXParamSetupReq
+	rs := region.EU868()
+	UseRegionSettings(rs)
+	c.Assert(rs.SetChannel(3, 867100000, 0, 5), qt.IsTrue)
+	c.Assert(rs.SetChannelMask(0, 0x0009), qt.IsTrue)
+	rs.RX2Channel().SetFrequency(869100000)
+
+	s := &Session{}
+	var storage memStorage
+	c.Assert(Save(&storage, 0, s), qt.IsNil)
+
+	restored := region.EU868()
+	UseRegionSettings(restored)
+	c.Assert(LoadSession(&storage, 0, &Session{}), qt.IsNil)
+	c.Assert(restored.RX2Channel().Frequency(), qt.Equals, uint32(869100000))
+	for i := 0; i < 20; i++ {
+		_, ok := restored.SelectUplinkChannel()
+		c.Assert(ok, qt.IsTrue)
+		freq := restored.UplinkChannel().Frequency()
+		c.Assert(freq == 868100000 || freq == 867100000, qt.IsTrue)
+	}
+
+	// A plan saved from another region is refused
+	UseRegionSettings(region.IN865())
+	c.Assert(LoadSession(&storage, 0, &Session{}), qt.Equals, ErrInvalidChannelPlan)
+}
+
+func TestOtaaSaveLoad(t *testing.T) {
+	c := qt.New(t)
+
+	o := &Otaa{}
+	o.Set([]uint8{1, 2, 3, 4, 5, 6, 7, 8}, []uint8{8, 7, 6, 5, 4, 3, 2, 1},
+		[]uint8{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15})
+	o.Init()
+	nonce := o.devNonce
+
+	var storage memStorage
+	c.Assert(Save(&storage, 16, o), qt.IsNil)
+
+	restored := &Otaa{}
+	c.Assert(LoadOtaa(&storage, 16, restored), qt.IsNil)
+	c.Assert(restored.GetAppEUI(), qt.Equals, o.GetAppEUI())
+	c.Assert(restored.GetDevEUI(), qt.Equals, o.GetDevEUI())
+	c.Assert(restored.GetAppKey(), qt.Equals, o.GetAppKey())
+
+	// A restored DevNonce is kept by Init, never regenerated
+	restored.Init()
+	c.Assert(restored.devNonce, qt.Equals, nonce)
+
+	c.Assert(LoadSession(&storage, 16, &Session{}), qt.Equals, ErrInvalidPersistedData)
+}
@@ -0,0 +1,102 @@
+package region
+
+import "tinygo.org/x/drivers/lora"
+
+const (
+	AS923_DEFAULT_PREAMBLE_LEN = 8
+	AS923_DEFAULT_TX_POWER_DBM = 16
+	AS923_MAX_EIRP_DBM         = 16 // TX power index 0
+	AS923_MAX_TX_POWER_INDEX   = 7
+	AS923_MIN_FREQUENCY        = 915000000
+	AS923_MAX_FREQUENCY        = 928000000
+	AS923_DEFAULT_CHANNELS     = 2
+	AS923_MAX_CHANNELS         = 16
+	AS923_DEFAULT_DR_RANGE     = 0x50 // DR0 to DR5
+	AS923_RX2_FREQUENCY        = AS923_CHANNEL_1
+	AS923_CHANNEL_1            = 923200000
+	AS923_CHANNEL_2            = 923400000
+)
+
+var dataRatesAS923 = []dataRate{
+	{lora.SpreadingFactor12, lora.Bandwidth_125_0, 51}, // DR0
+	{lora.SpreadingFactor11, lora.Bandwidth_125_0, 51}, // DR1
+	{lora.SpreadingFactor10, lora.Bandwidth_125_0, 51}, // DR2
+	{lora.SpreadingFactor9, lora.Bandwidth_125_0, 115}, // DR3
+	{lora.SpreadingFactor8, lora.Bandwidth_125_0, 242}, // DR4
+	{lora.SpreadingFactor7, lora.Bandwidth_125_0, 242}, // DR5
+	{lora.SpreadingFactor7, lora.Bandwidth_250_0, 242}, // DR6
+	{SF_FSK, 0, 242}, // DR7, FSK 50 kbps
+}
+
+type ChannelAS struct {
+	channel
+}
+
+func (c *ChannelAS) Next() bool {
+	return false
+}
+
+type SettingsAS923 struct {
+	settings
+}
+
+func AS923() *SettingsAS923 {
+	frequencies := make([]uint32, AS923_MAX_CHANNELS)
+	drRanges := make([]uint8, AS923_MAX_CHANNELS)
+	enabled := make([]bool, AS923_MAX_CHANNELS)
+	copy(frequencies, []uint32{AS923_CHANNEL_1, AS923_CHANNEL_2})
+	for i := 0; i < AS923_DEFAULT_CHANNELS; i++ {
+		drRanges[i] = AS923_DEFAULT_DR_RANGE
+		enabled[i] = true
+	}
+
+	return &SettingsAS923{settings: settings{
+		id: REGION_AS923,
+		joinRequestChannel: &ChannelAS{channel: channel{AS923_CHANNEL_1,
+			lora.Bandwidth_125_0,
+			lora.SpreadingFactor9,
+			lora.CodingRate4_5,
+			AS923_DEFAULT_PREAMBLE_LEN,
+			AS923_DEFAULT_TX_POWER_DBM}},
+		joinAcceptChannel: &ChannelAS{channel: channel{AS923_CHANNEL_1,
+			lora.Bandwidth_125_0,
+			lora.SpreadingFactor9,
+			lora.CodingRate4_5,
+			AS923_DEFAULT_PREAMBLE_LEN,
+			AS923_DEFAULT_TX_POWER_DBM}},
+		uplinkChannel: &ChannelAS{channel: channel{AS923_CHANNEL_1,
+			lora.Bandwidth_125_0,
+			lora.SpreadingFactor9,
+			lora.CodingRate4_5,
+			AS923_DEFAULT_PREAMBLE_LEN,
+			AS923_DEFAULT_TX_POWER_DBM}},
+		rx2Channel: &ChannelAS{channel: channel{AS923_RX2_FREQUENCY,
+			lora.Bandwidth_125_0,
+			lora.SpreadingFactor10,
+			lora.CodingRate4_5,
+			AS923_DEFAULT_PREAMBLE_LEN,
+			AS923_DEFAULT_TX_POWER_DBM}},
+		dataRates:       dataRatesAS923,
+		maxEIRPDBm:      AS923_MAX_EIRP_DBM,
+		maxTxPowerIndex: AS923_MAX_TX_POWER_INDEX,
+		minFrequency:    AS923_MIN_FREQUENCY,
+		maxFrequency:    AS923_MAX_FREQUENCY,
+		defaultChannels: AS923_DEFAULT_CHANNELS,
+		defaultDRRange:  AS923_DEFAULT_DR_RANGE,
+		frequencies:     frequencies,
+		drRanges:        drRanges,
+		enabled:         enabled,
+	}}
+}
+
+// RX1Channel returns the first receive window channel, which in AS923 uses
+// the same frequency and data rate as the current uplink channel
+func (r *SettingsAS923) RX1Channel() Channel {
+	up := r.uplinkChannel
+	return &ChannelAS{channel: channel{up.Frequency(),
+		up.Bandwidth(),
+		up.SpreadingFactor(),
+		lora.CodingRate4_5,
+		AS923_DEFAULT_PREAMBLE_LEN,
+		AS923_DEFAULT_TX_POWER_DBM}}
+}
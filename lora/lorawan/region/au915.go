@@ -3,10 +3,41 @@ package region
 import "tinygo.org/x/drivers/lora"
 
 const (
-	AU915_DEFAULT_PREAMBLE_LEN = 8
-	AU915_DEFAULT_TX_POWER_DBM = 20
+	AU915_DEFAULT_PREAMBLE_LEN       = 8
+	AU915_DEFAULT_TX_POWER_DBM       = 20
+	AU915_MAX_EIRP_DBM               = 30      // TX power index 0
+	AU915_FREQUENCY_INCREMENT_DR_0   = 200000  // only for 125 kHz Bandwidth
+	AU915_FREQUENCY_INCREMENT_DR_6   = 1600000 // only for 500 kHz Bandwidth
+	AU915_FREQUENCY_INCREMENT_RX1    = 600000  // downlink channels are 500 kHz wide
+	AU915_RX1_CHANNEL_COUNT          = 8
+	AU915_FIRST_UPLINK_FREQUENCY     = 915200000
+	AU915_FIRST_UPLINK_FREQUENCY_DR6 = 915900000
+	AU915_MAX_TX_POWER_INDEX         = 10
+	AU915_MIN_FREQUENCY              = 915000000
+	AU915_MAX_FREQUENCY              = 928000000
+	AU915_CHANNELS_125               = 64
+	AU915_DR_RANGE_125               = 0x50 // DR0 to DR5
+	AU915_DR_RANGE_500               = 0x66 // DR6
+	AU915_MAX_CHANNELS               = 72
 )
 
+var dataRatesAU915 = []dataRate{
+	{lora.SpreadingFactor12, lora.Bandwidth_125_0, 51}, // DR0
+	{lora.SpreadingFactor11, lora.Bandwidth_125_0, 51}, // DR1
+	{lora.SpreadingFactor10, lora.Bandwidth_125_0, 51}, // DR2
+	{lora.SpreadingFactor9, lora.Bandwidth_125_0, 115}, // DR3
+	{lora.SpreadingFactor8, lora.Bandwidth_125_0, 242}, // DR4
+	{lora.SpreadingFactor7, lora.Bandwidth_125_0, 242}, // DR5
+	{lora.SpreadingFactor8, lora.Bandwidth_500_0, 242}, // DR6
+	{}, // DR7 RFU
+	{lora.SpreadingFactor12, lora.Bandwidth_500_0, 53},  // DR8
+	{lora.SpreadingFactor11, lora.Bandwidth_500_0, 129}, // DR9
+	{lora.SpreadingFactor10, lora.Bandwidth_500_0, 242}, // DR10
+	{lora.SpreadingFactor9, lora.Bandwidth_500_0, 242},  // DR11
+	{lora.SpreadingFactor8, lora.Bandwidth_500_0, 242},  // DR12
+	{lora.SpreadingFactor7, lora.Bandwidth_500_0, 242},  // DR13
+}
+
 type ChannelAU struct {
 	channel
 }
@@ -20,7 +51,22 @@ type SettingsAU915 struct {
 }
 
 func AU915() *SettingsAU915 {
+	frequencies := make([]uint32, AU915_MAX_CHANNELS)
+	drRanges := make([]uint8, AU915_MAX_CHANNELS)
+	enabled := make([]bool, AU915_MAX_CHANNELS)
+	for i := range frequencies {
+		if i < AU915_CHANNELS_125 {
+			drRanges[i] = AU915_DR_RANGE_125
+			frequencies[i] = AU915_FIRST_UPLINK_FREQUENCY + uint32(i)*AU915_FREQUENCY_INCREMENT_DR_0
+		} else {
+			drRanges[i] = AU915_DR_RANGE_500
+			frequencies[i] = AU915_FIRST_UPLINK_FREQUENCY_DR6 + uint32(i-AU915_CHANNELS_125)*AU915_FREQUENCY_INCREMENT_DR_6
+		}
+		enabled[i] = true
+	}
+
 	return &SettingsAU915{settings: settings{
+		id: REGION_AU915,
 		joinRequestChannel: &ChannelAU{channel: channel{lora.MHz_916_8,
 			lora.Bandwidth_125_0,
 			lora.SpreadingFactor9,
@@ -39,9 +85,108 @@ func AU915() *SettingsAU915 {
 			lora.CodingRate4_5,
 			AU915_DEFAULT_PREAMBLE_LEN,
 			AU915_DEFAULT_TX_POWER_DBM}},
+		rx2Channel: &ChannelAU{channel: channel{lora.MHz_923_3,
+			lora.Bandwidth_500_0,
+			lora.SpreadingFactor12,
+			lora.CodingRate4_5,
+			AU915_DEFAULT_PREAMBLE_LEN,
+			AU915_DEFAULT_TX_POWER_DBM}},
+		dataRates:       dataRatesAU915,
+		maxEIRPDBm:      AU915_MAX_EIRP_DBM,
+		maxTxPowerIndex: AU915_MAX_TX_POWER_INDEX,
+		minFrequency:    AU915_MIN_FREQUENCY,
+		maxFrequency:    AU915_MAX_FREQUENCY,
+		defaultChannels: AU915_MAX_CHANNELS, // NewChannelReq is not supported
+		frequencies:     frequencies,
+		drRanges:        drRanges,
+		enabled:         enabled,
 	}}
 }
 
+// SetChannelMask enables uplink channels as requested by a LinkADRReq, where
+// ctrl selects a bank of 16 channels (0-4), or turns all 125 kHz channels
+// on (6) or off (7) while mask applies to the 500 kHz channels.
+func (r *SettingsAU915) SetChannelMask(ctrl uint8, mask uint16) bool {
+	return r.SetChannelMasks([]ChannelMask{{ctrl, mask}})
+}
+
+// SetChannelMasks applies the channel masks of a block of LinkADRReq as a
+// whole, such as all channels off (7) followed by the bank of a sub-band.
+func (r *SettingsAU915) SetChannelMasks(masks []ChannelMask) bool {
+	if !r.setChannelMasks(masks, r.channelMask) {
+		return false
+	}
+
+	// 125 kHz and 500 kHz channels are interleaved, follow the bandwidth
+	for i, freq := range r.frequencies {
+		if freq != r.uplinkChannel.Frequency() {
+			continue
+		}
+		if i < AU915_CHANNELS_125 {
+			r.uplinkChannel.SetBandwidth(lora.Bandwidth_125_0)
+		} else {
+			r.uplinkChannel.SetBandwidth(lora.Bandwidth_500_0)
+		}
+		break
+	}
+	return true
+}
+
+// ApplyCFList applies the channel mask CFList of the JoinAccept like a block
+// of LinkADRReq, banks 0-3 for the 125 kHz channels and bank 4 for the 500 kHz
+// channels. Channel frequencies cannot be changed.
+func (r *SettingsAU915) ApplyCFList(cfList [16]uint8) bool {
+	if cfList[15] != CFLIST_TYPE_CHANNEL_MASK {
+		return false
+	}
+	return r.SetChannelMasks(cfListChannelMasks(cfList, 5))
+}
+
+// channelMask updates enabled with a LinkADRReq channel mask
+func (r *SettingsAU915) channelMask(enabled []bool, ctrl uint8, mask uint16) bool {
+	switch ctrl {
+	case 0, 1, 2, 3, 4:
+		for i := 0; i < 16 && int(ctrl)*16+i < len(enabled); i++ {
+			enabled[int(ctrl)*16+i] = mask&(1<<i) != 0
+		}
+	case 6, 7:
+		for i := range enabled {
+			if i < AU915_CHANNELS_125 {
+				enabled[i] = ctrl == 6
+			} else {
+				enabled[i] = mask&(1<<(i-AU915_CHANNELS_125)) != 0
+			}
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// RX1Channel returns the first receive window channel derived from the
+// current uplink channel: one of the 8 downlink channels starting at 923.3 MHz,
+// always using 500 kHz bandwidth.
+func (r *SettingsAU915) RX1Channel() Channel {
+	up := r.uplinkChannel
+
+	var ch uint32
+	sf := up.SpreadingFactor()
+	switch up.Bandwidth() {
+	case lora.Bandwidth_500_0:
+		ch = 64 + (up.Frequency()-AU915_FIRST_UPLINK_FREQUENCY_DR6)/AU915_FREQUENCY_INCREMENT_DR_6
+		sf = lora.SpreadingFactor7 // DR6 maps to DR13
+	default:
+		ch = (up.Frequency() - AU915_FIRST_UPLINK_FREQUENCY) / AU915_FREQUENCY_INCREMENT_DR_0
+	}
+
+	return &ChannelAU{channel: channel{lora.MHz_923_3 + (ch%AU915_RX1_CHANNEL_COUNT)*AU915_FREQUENCY_INCREMENT_RX1,
+		lora.Bandwidth_500_0,
+		sf,
+		lora.CodingRate4_5,
+		AU915_DEFAULT_PREAMBLE_LEN,
+		AU915_DEFAULT_TX_POWER_DBM}}
+}
+
 func Next(c *ChannelAU) bool {
 	return false
 }
@@ -0,0 +1,141 @@
+package region
+
+import "tinygo.org/x/drivers/lora"
+
+const (
+	CN470_DEFAULT_PREAMBLE_LEN   = 8
+	CN470_DEFAULT_TX_POWER_DBM   = 19
+	CN470_MAX_EIRP_DBM           = 19 // TX power index 0
+	CN470_MAX_TX_POWER_INDEX     = 7
+	CN470_MIN_FREQUENCY          = 470000000
+	CN470_MAX_FREQUENCY          = 510000000
+	CN470_FIRST_UPLINK_FREQUENCY = 470300000
+	CN470_FIRST_RX1_FREQUENCY    = 500300000
+	CN470_FREQUENCY_INCREMENT    = 200000
+	CN470_RX1_CHANNEL_COUNT      = 48
+	CN470_RX2_FREQUENCY          = 505300000
+	CN470_DR_RANGE               = 0x50 // DR0 to DR5
+	CN470_MAX_CHANNELS           = 96
+)
+
+var dataRatesCN470 = []dataRate{
+	{lora.SpreadingFactor12, lora.Bandwidth_125_0, 51}, // DR0
+	{lora.SpreadingFactor11, lora.Bandwidth_125_0, 51}, // DR1
+	{lora.SpreadingFactor10, lora.Bandwidth_125_0, 51}, // DR2
+	{lora.SpreadingFactor9, lora.Bandwidth_125_0, 115}, // DR3
+	{lora.SpreadingFactor8, lora.Bandwidth_125_0, 242}, // DR4
+	{lora.SpreadingFactor7, lora.Bandwidth_125_0, 242}, // DR5
+}
+
+type ChannelCN struct {
+	channel
+}
+
+func (c *ChannelCN) Next() bool {
+	return false
+}
+
+type SettingsCN470 struct {
+	settings
+}
+
+func CN470() *SettingsCN470 {
+	frequencies := make([]uint32, CN470_MAX_CHANNELS)
+	drRanges := make([]uint8, CN470_MAX_CHANNELS)
+	enabled := make([]bool, CN470_MAX_CHANNELS)
+	for i := range frequencies {
+		frequencies[i] = CN470_FIRST_UPLINK_FREQUENCY + uint32(i)*CN470_FREQUENCY_INCREMENT
+		drRanges[i] = CN470_DR_RANGE
+		enabled[i] = true
+	}
+
+	return &SettingsCN470{settings: settings{
+		id: REGION_CN470,
+		joinRequestChannel: &ChannelCN{channel: channel{CN470_FIRST_UPLINK_FREQUENCY,
+			lora.Bandwidth_125_0,
+			lora.SpreadingFactor9,
+			lora.CodingRate4_5,
+			CN470_DEFAULT_PREAMBLE_LEN,
+			CN470_DEFAULT_TX_POWER_DBM}},
+		joinAcceptChannel: &ChannelCN{channel: channel{CN470_FIRST_RX1_FREQUENCY,
+			lora.Bandwidth_125_0,
+			lora.SpreadingFactor9,
+			lora.CodingRate4_5,
+			CN470_DEFAULT_PREAMBLE_LEN,
+			CN470_DEFAULT_TX_POWER_DBM}},
+		uplinkChannel: &ChannelCN{channel: channel{CN470_FIRST_UPLINK_FREQUENCY,
+			lora.Bandwidth_125_0,
+			lora.SpreadingFactor9,
+			lora.CodingRate4_5,
+			CN470_DEFAULT_PREAMBLE_LEN,
+			CN470_DEFAULT_TX_POWER_DBM}},
+		rx2Channel: &ChannelCN{channel: channel{CN470_RX2_FREQUENCY,
+			lora.Bandwidth_125_0,
+			lora.SpreadingFactor12,
+			lora.CodingRate4_5,
+			CN470_DEFAULT_PREAMBLE_LEN,
+			CN470_DEFAULT_TX_POWER_DBM}},
+		dataRates:       dataRatesCN470,
+		maxEIRPDBm:      CN470_MAX_EIRP_DBM,
+		maxTxPowerIndex: CN470_MAX_TX_POWER_INDEX,
+		minFrequency:    CN470_MIN_FREQUENCY,
+		maxFrequency:    CN470_MAX_FREQUENCY,
+		defaultChannels: CN470_MAX_CHANNELS, // NewChannelReq is not supported
+		frequencies:     frequencies,
+		drRanges:        drRanges,
+		enabled:         enabled,
+	}}
+}
+
+// SetChannelMask enables uplink channels as requested by a LinkADRReq, where
+// ctrl selects a bank of 16 channels (0-5), or turns all channels on (6).
+func (r *SettingsCN470) SetChannelMask(ctrl uint8, mask uint16) bool {
+	return r.SetChannelMasks([]ChannelMask{{ctrl, mask}})
+}
+
+// SetChannelMasks applies the channel masks of a block of LinkADRReq as a
+// whole.
+func (r *SettingsCN470) SetChannelMasks(masks []ChannelMask) bool {
+	return r.setChannelMasks(masks, r.channelMask)
+}
+
+// ApplyCFList applies the channel mask CFList of the JoinAccept like a block
+// of LinkADRReq, with banks 0-5. Channel frequencies cannot be changed.
+func (r *SettingsCN470) ApplyCFList(cfList [16]uint8) bool {
+	if cfList[15] != CFLIST_TYPE_CHANNEL_MASK {
+		return false
+	}
+	return r.SetChannelMasks(cfListChannelMasks(cfList, 6))
+}
+
+// channelMask updates enabled with a LinkADRReq channel mask
+func (r *SettingsCN470) channelMask(enabled []bool, ctrl uint8, mask uint16) bool {
+	switch ctrl {
+	case 0, 1, 2, 3, 4, 5:
+		for i := 0; i < 16; i++ {
+			enabled[int(ctrl)*16+i] = mask&(1<<i) != 0
+		}
+	case 6:
+		for i := range enabled {
+			enabled[i] = true
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// RX1Channel returns the first receive window channel derived from the
+// current uplink channel: one of the 48 downlink channels starting at
+// 500.3 MHz, using the same data rate as the uplink.
+func (r *SettingsCN470) RX1Channel() Channel {
+	up := r.uplinkChannel
+	ch := (up.Frequency() - CN470_FIRST_UPLINK_FREQUENCY) / CN470_FREQUENCY_INCREMENT
+
+	return &ChannelCN{channel: channel{CN470_FIRST_RX1_FREQUENCY + (ch%CN470_RX1_CHANNEL_COUNT)*CN470_FREQUENCY_INCREMENT,
+		lora.Bandwidth_125_0,
+		up.SpreadingFactor(),
+		lora.CodingRate4_5,
+		CN470_DEFAULT_PREAMBLE_LEN,
+		CN470_DEFAULT_TX_POWER_DBM}}
+}
@@ -5,8 +5,38 @@ import "tinygo.org/x/drivers/lora"
 const (
 	EU868_DEFAULT_PREAMBLE_LEN = 8
 	EU868_DEFAULT_TX_POWER_DBM = 20
+	EU868_MAX_EIRP_DBM         = 16 // TX power index 0
+	EU868_MAX_TX_POWER_INDEX   = 7
+	EU868_MIN_FREQUENCY        = 863000000
+	EU868_MAX_FREQUENCY        = 870000000
+	EU868_DEFAULT_CHANNELS     = 3
+	EU868_MAX_CHANNELS         = 16
+	EU868_DEFAULT_DR_RANGE     = 0x50 // DR0 to DR5
 )
 
+var dataRatesEU868 = []dataRate{
+	{lora.SpreadingFactor12, lora.Bandwidth_125_0, 51}, // DR0
+	{lora.SpreadingFactor11, lora.Bandwidth_125_0, 51}, // DR1
+	{lora.SpreadingFactor10, lora.Bandwidth_125_0, 51}, // DR2
+	{lora.SpreadingFactor9, lora.Bandwidth_125_0, 115}, // DR3
+	{lora.SpreadingFactor8, lora.Bandwidth_125_0, 242}, // DR4
+	{lora.SpreadingFactor7, lora.Bandwidth_125_0, 242}, // DR5
+	{lora.SpreadingFactor7, lora.Bandwidth_250_0, 242}, // DR6
+	{SF_FSK, 0, 242}, // DR7, FSK 50 kbps
+}
+
+// ETSI sub-bands, transmissions are limited to 1/dutyCycle of the time
+func bandsEU868() []band {
+	return []band{
+		{minFrequency: 863000000, maxFrequency: 865000000, dutyCycle: 1000},
+		{minFrequency: 865000000, maxFrequency: 868000000, dutyCycle: 100},
+		{minFrequency: 868000000, maxFrequency: 868600000, dutyCycle: 100},
+		{minFrequency: 868700000, maxFrequency: 869200000, dutyCycle: 1000},
+		{minFrequency: 869400000, maxFrequency: 869650000, dutyCycle: 10},
+		{minFrequency: 869700000, maxFrequency: 870000000, dutyCycle: 100},
+	}
+}
+
 type ChannelEU struct {
 	channel
 }
@@ -20,7 +50,17 @@ type SettingsEU868 struct {
 }
 
 func EU868() *SettingsEU868 {
+	frequencies := make([]uint32, EU868_MAX_CHANNELS)
+	drRanges := make([]uint8, EU868_MAX_CHANNELS)
+	enabled := make([]bool, EU868_MAX_CHANNELS)
+	copy(frequencies, []uint32{lora.MHz_868_1, lora.MHz_868_3, lora.MHz_868_5})
+	for i := 0; i < EU868_DEFAULT_CHANNELS; i++ {
+		drRanges[i] = EU868_DEFAULT_DR_RANGE
+		enabled[i] = true
+	}
+
 	return &SettingsEU868{settings: settings{
+		id: REGION_EU868,
 		joinRequestChannel: &ChannelEU{channel: channel{lora.MHz_868_1,
 			lora.Bandwidth_125_0,
 			lora.SpreadingFactor9,
@@ -39,5 +79,34 @@ func EU868() *SettingsEU868 {
 			lora.CodingRate4_7,
 			EU868_DEFAULT_PREAMBLE_LEN,
 			EU868_DEFAULT_TX_POWER_DBM}},
+		rx2Channel: &ChannelEU{channel: channel{lora.MHz_869_525,
+			lora.Bandwidth_125_0,
+			lora.SpreadingFactor12,
+			lora.CodingRate4_5,
+			EU868_DEFAULT_PREAMBLE_LEN,
+			EU868_DEFAULT_TX_POWER_DBM}},
+		dataRates:       dataRatesEU868,
+		maxEIRPDBm:      EU868_MAX_EIRP_DBM,
+		maxTxPowerIndex: EU868_MAX_TX_POWER_INDEX,
+		minFrequency:    EU868_MIN_FREQUENCY,
+		maxFrequency:    EU868_MAX_FREQUENCY,
+		defaultChannels: EU868_DEFAULT_CHANNELS,
+		defaultDRRange:  EU868_DEFAULT_DR_RANGE,
+		frequencies:     frequencies,
+		drRanges:        drRanges,
+		enabled:         enabled,
+		bands:           bandsEU868(),
 	}}
 }
+
+// RX1Channel returns the first receive window channel, which in EU868 uses
+// the same frequency and data rate as the current uplink channel
+func (r *SettingsEU868) RX1Channel() Channel {
+	up := r.uplinkChannel
+	return &ChannelEU{channel: channel{up.Frequency(),
+		up.Bandwidth(),
+		up.SpreadingFactor(),
+		lora.CodingRate4_5,
+		EU868_DEFAULT_PREAMBLE_LEN,
+		EU868_DEFAULT_TX_POWER_DBM}}
+}
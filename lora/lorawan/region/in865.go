@@ -0,0 +1,103 @@
+package region
+
+import "tinygo.org/x/drivers/lora"
+
+const (
+	IN865_DEFAULT_PREAMBLE_LEN = 8
+	IN865_DEFAULT_TX_POWER_DBM = 30
+	IN865_MAX_EIRP_DBM         = 30 // TX power index 0
+	IN865_MAX_TX_POWER_INDEX   = 10
+	IN865_MIN_FREQUENCY        = 865000000
+	IN865_MAX_FREQUENCY        = 867000000
+	IN865_DEFAULT_CHANNELS     = 3
+	IN865_MAX_CHANNELS         = 16
+	IN865_DEFAULT_DR_RANGE     = 0x50 // DR0 to DR5
+	IN865_RX2_FREQUENCY        = 866550000
+	IN865_CHANNEL_1            = 865062500
+	IN865_CHANNEL_2            = 865402500
+	IN865_CHANNEL_3            = 865985000
+)
+
+var dataRatesIN865 = []dataRate{
+	{lora.SpreadingFactor12, lora.Bandwidth_125_0, 51}, // DR0
+	{lora.SpreadingFactor11, lora.Bandwidth_125_0, 51}, // DR1
+	{lora.SpreadingFactor10, lora.Bandwidth_125_0, 51}, // DR2
+	{lora.SpreadingFactor9, lora.Bandwidth_125_0, 115}, // DR3
+	{lora.SpreadingFactor8, lora.Bandwidth_125_0, 242}, // DR4
+	{lora.SpreadingFactor7, lora.Bandwidth_125_0, 242}, // DR5
+	{},               // DR6 RFU
+	{SF_FSK, 0, 242}, // DR7, FSK 50 kbps
+}
+
+type ChannelIN struct {
+	channel
+}
+
+func (c *ChannelIN) Next() bool {
+	return false
+}
+
+type SettingsIN865 struct {
+	settings
+}
+
+func IN865() *SettingsIN865 {
+	frequencies := make([]uint32, IN865_MAX_CHANNELS)
+	drRanges := make([]uint8, IN865_MAX_CHANNELS)
+	enabled := make([]bool, IN865_MAX_CHANNELS)
+	copy(frequencies, []uint32{IN865_CHANNEL_1, IN865_CHANNEL_2, IN865_CHANNEL_3})
+	for i := 0; i < IN865_DEFAULT_CHANNELS; i++ {
+		drRanges[i] = IN865_DEFAULT_DR_RANGE
+		enabled[i] = true
+	}
+
+	return &SettingsIN865{settings: settings{
+		id: REGION_IN865,
+		joinRequestChannel: &ChannelIN{channel: channel{IN865_CHANNEL_1,
+			lora.Bandwidth_125_0,
+			lora.SpreadingFactor9,
+			lora.CodingRate4_5,
+			IN865_DEFAULT_PREAMBLE_LEN,
+			IN865_DEFAULT_TX_POWER_DBM}},
+		joinAcceptChannel: &ChannelIN{channel: channel{IN865_CHANNEL_1,
+			lora.Bandwidth_125_0,
+			lora.SpreadingFactor9,
+			lora.CodingRate4_5,
+			IN865_DEFAULT_PREAMBLE_LEN,
+			IN865_DEFAULT_TX_POWER_DBM}},
+		uplinkChannel: &ChannelIN{channel: channel{IN865_CHANNEL_1,
+			lora.Bandwidth_125_0,
+			lora.SpreadingFactor9,
+			lora.CodingRate4_5,
+			IN865_DEFAULT_PREAMBLE_LEN,
+			IN865_DEFAULT_TX_POWER_DBM}},
+		rx2Channel: &ChannelIN{channel: channel{IN865_RX2_FREQUENCY,
+			lora.Bandwidth_125_0,
+			lora.SpreadingFactor10,
+			lora.CodingRate4_5,
+			IN865_DEFAULT_PREAMBLE_LEN,
+			IN865_DEFAULT_TX_POWER_DBM}},
+		dataRates:       dataRatesIN865,
+		maxEIRPDBm:      IN865_MAX_EIRP_DBM,
+		maxTxPowerIndex: IN865_MAX_TX_POWER_INDEX,
+		minFrequency:    IN865_MIN_FREQUENCY,
+		maxFrequency:    IN865_MAX_FREQUENCY,
+		defaultChannels: IN865_DEFAULT_CHANNELS,
+		defaultDRRange:  IN865_DEFAULT_DR_RANGE,
+		frequencies:     frequencies,
+		drRanges:        drRanges,
+		enabled:         enabled,
+	}}
+}
+
+// RX1Channel returns the first receive window channel, which in IN865 uses
+// the same frequency and data rate as the current uplink channel
+func (r *SettingsIN865) RX1Channel() Channel {
+	up := r.uplinkChannel
+	return &ChannelIN{channel: channel{up.Frequency(),
+		up.Bandwidth(),
+		up.SpreadingFactor(),
+		lora.CodingRate4_5,
+		IN865_DEFAULT_PREAMBLE_LEN,
+		IN865_DEFAULT_TX_POWER_DBM}}
+}
@@ -0,0 +1,101 @@
+package region
+
+import "tinygo.org/x/drivers/lora"
+
+const (
+	KR920_DEFAULT_PREAMBLE_LEN = 8
+	KR920_DEFAULT_TX_POWER_DBM = 14
+	KR920_MAX_EIRP_DBM         = 14 // TX power index 0
+	KR920_MAX_TX_POWER_INDEX   = 7
+	KR920_MIN_FREQUENCY        = 920900000
+	KR920_MAX_FREQUENCY        = 923300000
+	KR920_DEFAULT_CHANNELS     = 3
+	KR920_MAX_CHANNELS         = 16
+	KR920_DEFAULT_DR_RANGE     = 0x50 // DR0 to DR5
+	KR920_RX2_FREQUENCY        = 921900000
+	KR920_CHANNEL_1            = 922100000
+	KR920_CHANNEL_2            = 922300000
+	KR920_CHANNEL_3            = 922500000
+)
+
+var dataRatesKR920 = []dataRate{
+	{lora.SpreadingFactor12, lora.Bandwidth_125_0, 51}, // DR0
+	{lora.SpreadingFactor11, lora.Bandwidth_125_0, 51}, // DR1
+	{lora.SpreadingFactor10, lora.Bandwidth_125_0, 51}, // DR2
+	{lora.SpreadingFactor9, lora.Bandwidth_125_0, 115}, // DR3
+	{lora.SpreadingFactor8, lora.Bandwidth_125_0, 242}, // DR4
+	{lora.SpreadingFactor7, lora.Bandwidth_125_0, 242}, // DR5
+}
+
+type ChannelKR struct {
+	channel
+}
+
+func (c *ChannelKR) Next() bool {
+	return false
+}
+
+type SettingsKR920 struct {
+	settings
+}
+
+func KR920() *SettingsKR920 {
+	frequencies := make([]uint32, KR920_MAX_CHANNELS)
+	drRanges := make([]uint8, KR920_MAX_CHANNELS)
+	enabled := make([]bool, KR920_MAX_CHANNELS)
+	copy(frequencies, []uint32{KR920_CHANNEL_1, KR920_CHANNEL_2, KR920_CHANNEL_3})
+	for i := 0; i < KR920_DEFAULT_CHANNELS; i++ {
+		drRanges[i] = KR920_DEFAULT_DR_RANGE
+		enabled[i] = true
+	}
+
+	return &SettingsKR920{settings: settings{
+		id: REGION_KR920,
+		joinRequestChannel: &ChannelKR{channel: channel{KR920_CHANNEL_1,
+			lora.Bandwidth_125_0,
+			lora.SpreadingFactor9,
+			lora.CodingRate4_5,
+			KR920_DEFAULT_PREAMBLE_LEN,
+			KR920_DEFAULT_TX_POWER_DBM}},
+		joinAcceptChannel: &ChannelKR{channel: channel{KR920_CHANNEL_1,
+			lora.Bandwidth_125_0,
+			lora.SpreadingFactor9,
+			lora.CodingRate4_5,
+			KR920_DEFAULT_PREAMBLE_LEN,
+			KR920_DEFAULT_TX_POWER_DBM}},
+		uplinkChannel: &ChannelKR{channel: channel{KR920_CHANNEL_1,
+			lora.Bandwidth_125_0,
+			lora.SpreadingFactor9,
+			lora.CodingRate4_5,
+			KR920_DEFAULT_PREAMBLE_LEN,
+			KR920_DEFAULT_TX_POWER_DBM}},
+		rx2Channel: &ChannelKR{channel: channel{KR920_RX2_FREQUENCY,
+			lora.Bandwidth_125_0,
+			lora.SpreadingFactor12,
+			lora.CodingRate4_5,
+			KR920_DEFAULT_PREAMBLE_LEN,
+			KR920_DEFAULT_TX_POWER_DBM}},
+		dataRates:       dataRatesKR920,
+		maxEIRPDBm:      KR920_MAX_EIRP_DBM,
+		maxTxPowerIndex: KR920_MAX_TX_POWER_INDEX,
+		minFrequency:    KR920_MIN_FREQUENCY,
+		maxFrequency:    KR920_MAX_FREQUENCY,
+		defaultChannels: KR920_DEFAULT_CHANNELS,
+		defaultDRRange:  KR920_DEFAULT_DR_RANGE,
+		frequencies:     frequencies,
+		drRanges:        drRanges,
+		enabled:         enabled,
+	}}
+}
+
+// RX1Channel returns the first receive window channel, which in KR920 uses
+// the same frequency and data rate as the current uplink channel
+func (r *SettingsKR920) RX1Channel() Channel {
+	up := r.uplinkChannel
+	return &ChannelKR{channel: channel{up.Frequency(),
+		up.Bandwidth(),
+		up.SpreadingFactor(),
+		lora.CodingRate4_5,
+		KR920_DEFAULT_PREAMBLE_LEN,
+		KR920_DEFAULT_TX_POWER_DBM}}
+}
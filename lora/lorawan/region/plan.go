@@ -0,0 +1,120 @@
+package region
+
+// CHANNEL_PLAN_LENGTH is the length of an encoded channel plan:
+//
+//	region (1) | channel mask (12) | channels 0-15 frequency and DR range (16 * 4) |
+//	RX2 frequency, spreading factor and bandwidth (5) |
+//	uplink frequency, spreading factor, bandwidth and TX power (6)
+//
+// Frequencies are encoded on 3 bytes in units of 100 Hz, like in MAC commands.
+const (
+	CHANNEL_PLAN_LENGTH   = 1 + channelPlanMaskLength + channelPlanChannels*4 + 5 + 6
+	channelPlanMaskLength = 12 // up to 96 channels
+	channelPlanChannels   = 16 // channels the network server may define
+)
+
+// Region identifiers, saved in the channel plans so that a plan is only
+// restored in the settings of the region it was saved from
+const (
+	REGION_AS923 = iota + 1
+	REGION_AU915
+	REGION_CN470
+	REGION_EU868
+	REGION_IN865
+	REGION_KR920
+	REGION_US915
+)
+
+// ChannelPlan is implemented by the regional settings whose channels, as
+// changed by the network server with MAC commands, can be saved and restored.
+type ChannelPlan interface {
+	MarshalChannelPlan() [CHANNEL_PLAN_LENGTH]uint8
+	UnmarshalChannelPlan(data [CHANNEL_PLAN_LENGTH]uint8) bool
+}
+
+// MarshalChannelPlan encodes the region, the channel mask, the channels that
+// can be defined by the network server, the RX2 channel and the uplink channel
+func (r *settings) MarshalChannelPlan() [CHANNEL_PLAN_LENGTH]uint8 {
+	var data [CHANNEL_PLAN_LENGTH]uint8
+	data[0] = r.id
+	mask := data[1:]
+	for i, enabled := range r.enabled {
+		if enabled && i/8 < channelPlanMaskLength {
+			mask[i/8] |= 1 << (i % 8)
+		}
+	}
+
+	b := mask[channelPlanMaskLength:]
+	for i := 0; i < channelPlanChannels && i < len(r.frequencies); i++ {
+		putFrequency(b[4*i:], r.frequencies[i])
+		b[4*i+3] = r.drRanges[i]
+	}
+
+	b = b[channelPlanChannels*4:]
+	putFrequency(b, r.rx2Channel.Frequency())
+	b[3] = r.rx2Channel.SpreadingFactor()
+	b[4] = r.rx2Channel.Bandwidth()
+
+	b = b[5:]
+	putFrequency(b, r.uplinkChannel.Frequency())
+	b[3] = r.uplinkChannel.SpreadingFactor()
+	b[4] = r.uplinkChannel.Bandwidth()
+	b[5] = uint8(r.uplinkChannel.TxPowerDBm())
+
+	return data
+}
+
+// UnmarshalChannelPlan restores a channel plan encoded by MarshalChannelPlan.
+// The default channels of the region are kept. It returns false, leaving the
+// channels unchanged, if the plan was saved from another region or enables no
+// channel.
+func (r *settings) UnmarshalChannelPlan(data [CHANNEL_PLAN_LENGTH]uint8) bool {
+	if data[0] != r.id {
+		return false
+	}
+	mask := data[1:]
+	enabled := make([]bool, len(r.enabled))
+	ok := false
+	for i := range enabled {
+		if i/8 < channelPlanMaskLength {
+			enabled[i] = mask[i/8]&(1<<(i%8)) != 0
+			ok = ok || enabled[i]
+		}
+	}
+	if !ok {
+		return false
+	}
+
+	b := mask[channelPlanMaskLength:]
+	for i := r.defaultChannels; i < channelPlanChannels && i < len(r.frequencies); i++ {
+		r.frequencies[i] = frequency(b[4*i:])
+		r.drRanges[i] = b[4*i+3]
+	}
+	copy(r.enabled, enabled)
+
+	b = b[channelPlanChannels*4:]
+	r.rx2Channel.SetFrequency(frequency(b))
+	r.rx2Channel.SetSpreadingFactor(b[3])
+	r.rx2Channel.SetBandwidth(b[4])
+
+	b = b[5:]
+	r.uplinkChannel.SetFrequency(frequency(b))
+	r.uplinkChannel.SetSpreadingFactor(b[3])
+	r.uplinkChannel.SetBandwidth(b[4])
+	r.uplinkChannel.SetTxPowerDBm(int8(b[5]))
+
+	return true
+}
+
+// putFrequency encodes a frequency on 3 bytes, in units of 100 Hz
+func putFrequency(b []uint8, freq uint32) {
+	freq /= 100
+	b[0] = uint8(freq)
+	b[1] = uint8(freq >> 8)
+	b[2] = uint8(freq >> 16)
+}
+
+// frequency decodes a frequency encoded by putFrequency
+func frequency(b []uint8) uint32 {
+	return (uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16) * 100
+}
@@ -1,15 +1,99 @@
 package region
 
+import (
+	"crypto/rand"
+	"time"
+)
+
 type Settings interface {
 	JoinRequestChannel() Channel
 	JoinAcceptChannel() Channel
 	UplinkChannel() Channel
+	RX1Channel() Channel
+	RX2Channel() Channel
+	DataRate(dr uint8) (spreadingFactor uint8, bandwidth uint8, ok bool)
+	MaxPayload(dr uint8) uint8
+	TxPower(index uint8) (dbm int8, ok bool)
+	SetChannelMask(ctrl uint8, mask uint16) bool
+	SetChannel(index uint8, freq uint32, minDR uint8, maxDR uint8) bool
+	ApplyCFList(cfList [16]uint8) bool
+	SelectUplinkChannel() (wait time.Duration, ok bool)
+	TransmitDone(freq uint32, airTime time.Duration)
+}
+
+// ChannelMask is the channel mask of a LinkADRReq, with its ChMaskCntl field
+type ChannelMask struct {
+	Ctrl uint8
+	Mask uint16
+}
+
+// ChannelMasker is implemented by the regional settings able to apply the
+// channel masks of a block of contiguous LinkADRReq as a whole, where the
+// intermediate masks may disable all channels.
+type ChannelMasker interface {
+	SetChannelMasks(masks []ChannelMask) bool
+}
+
+// FrequencyChecker is implemented by the regional settings able to tell
+// whether a frequency is in the regional band, such as the RX2 frequency of a
+// RXParamSetupReq.
+type FrequencyChecker interface {
+	ValidFrequency(freq uint32) bool
 }
 
+// SF_FSK is the spreading factor of the FSK data rates, using 50 kbps GFSK
+// instead of LoRa. Their bandwidth is unused.
+const SF_FSK = 0xFF
+
+// DutyCycleLimiter is implemented by the regional settings limiting the duty
+// cycle of sub-bands, to delay the transmissions on a fixed channel such as
+// JoinRequests.
+type DutyCycleLimiter interface {
+	// DutyCycleWait returns how long to wait before transmitting on freq
+	DutyCycleWait(freq uint32) time.Duration
+}
+
+// dataRate holds the LoRa modulation of a regional data rate and the maximum
+// application payload size. A zero spreading factor marks a data rate that is
+// not supported.
+type dataRate struct {
+	spreadingFactor uint8
+	bandwidth       uint8
+	maxPayload      uint8
+}
+
+// band is a frequency sub-band subject to a duty cycle limitation
+type band struct {
+	minFrequency uint32
+	maxFrequency uint32
+	dutyCycle    uint16    // transmissions may use 1/dutyCycle of the time
+	available    time.Time // next time a transmission is allowed
+}
+
+// CFList types sent in the JoinAccept
+const (
+	CFLIST_TYPE_FREQUENCIES  = 0
+	CFLIST_TYPE_CHANNEL_MASK = 1
+)
+
 type settings struct {
+	id                 uint8 // REGION_* identifier, saved in the channel plan
 	joinRequestChannel Channel
 	joinAcceptChannel  Channel
 	uplinkChannel      Channel
+	rx2Channel         Channel
+
+	dataRates       []dataRate
+	maxEIRPDBm      int8 // regional Max EIRP, TX power index 0
+	maxTxPowerIndex uint8
+	minFrequency    uint32
+	maxFrequency    uint32
+	defaultChannels int      // channels that cannot be modified by the network
+	defaultDRRange  uint8    // MaxDR<<4 | MinDR of channels added by CFList
+	frequencies     []uint32 // uplink channel frequencies, 0 when undefined
+	drRanges        []uint8  // MaxDR<<4 | MinDR of each uplink channel
+	enabled         []bool   // uplink channel mask
+	bands           []band   // duty cycle limited sub-bands
 }
 
 func (r *settings) JoinRequestChannel() Channel {
@@ -23,3 +107,268 @@ func (r *settings) JoinAcceptChannel() Channel {
 func (r *settings) UplinkChannel() Channel {
 	return r.uplinkChannel
 }
+
+// RX2Channel returns the fixed channel used for the second receive window
+func (r *settings) RX2Channel() Channel {
+	return r.rx2Channel
+}
+
+// DataRate returns the spreading factor and bandwidth of a regional data rate
+func (r *settings) DataRate(dr uint8) (uint8, uint8, bool) {
+	if int(dr) >= len(r.dataRates) || r.dataRates[dr].spreadingFactor == 0 {
+		return 0, 0, false
+	}
+	return r.dataRates[dr].spreadingFactor, r.dataRates[dr].bandwidth, true
+}
+
+// MaxPayload returns the maximum application payload size at a data rate
+func (r *settings) MaxPayload(dr uint8) uint8 {
+	if int(dr) >= len(r.dataRates) {
+		return 0
+	}
+	return r.dataRates[dr].maxPayload
+}
+
+// TxPower returns the output power in dBm of a regional TX power index,
+// each step lowering the power by 2 dB from the regional Max EIRP
+func (r *settings) TxPower(index uint8) (int8, bool) {
+	if index > r.maxTxPowerIndex {
+		return 0, false
+	}
+	return r.maxEIRPDBm - 2*int8(index), true
+}
+
+// ValidFrequency reports whether freq is in the regional band
+func (r *settings) ValidFrequency(freq uint32) bool {
+	return freq >= r.minFrequency && freq <= r.maxFrequency
+}
+
+// SetChannelMask enables uplink channels as requested by a LinkADRReq, where
+// ctrl is the ChMaskCntl field. It returns false if the mask is refused.
+func (r *settings) SetChannelMask(ctrl uint8, mask uint16) bool {
+	return r.SetChannelMasks([]ChannelMask{{ctrl, mask}})
+}
+
+// SetChannelMasks applies the channel masks of a block of LinkADRReq as a
+// whole. It returns false, leaving the channel mask unchanged, if one of them
+// is refused.
+func (r *settings) SetChannelMasks(masks []ChannelMask) bool {
+	return r.setChannelMasks(masks, r.channelMask)
+}
+
+// channelMask updates enabled with a LinkADRReq channel mask
+func (r *settings) channelMask(enabled []bool, ctrl uint8, mask uint16) bool {
+	switch ctrl {
+	case 0:
+		for i := range enabled {
+			enabled[i] = false
+		}
+		for i := 0; i < 16; i++ {
+			if mask&(1<<i) == 0 {
+				continue
+			}
+			if i >= len(r.frequencies) || r.frequencies[i] == 0 {
+				return false
+			}
+			enabled[i] = true
+		}
+	case 6:
+		for i := range r.frequencies {
+			enabled[i] = r.frequencies[i] != 0
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// setChannelMasks applies the masks one after the other with the regional
+// channelMask function, then replaces the channel mask with the result
+func (r *settings) setChannelMasks(masks []ChannelMask, channelMask func(enabled []bool, ctrl uint8, mask uint16) bool) bool {
+	enabled := append([]bool(nil), r.enabled...)
+	for _, m := range masks {
+		if !channelMask(enabled, m.Ctrl, m.Mask) {
+			return false
+		}
+	}
+	return r.applyChannelMask(enabled)
+}
+
+// SetChannel creates, modifies or disables (freq 0) an uplink channel as
+// requested by a NewChannelReq. It returns false if the channel is refused.
+func (r *settings) SetChannel(index uint8, freq uint32, minDR uint8, maxDR uint8) bool {
+	if int(index) < r.defaultChannels || int(index) >= len(r.frequencies) {
+		return false
+	}
+	if freq != 0 {
+		if !r.ValidFrequency(freq) {
+			return false
+		}
+		if _, _, ok := r.DataRate(minDR); !ok || minDR > maxDR {
+			return false
+		}
+		if _, _, ok := r.DataRate(maxDR); !ok {
+			return false
+		}
+	}
+
+	r.frequencies[index] = freq
+	r.drRanges[index] = maxDR<<4 | minDR
+	r.enabled[index] = freq != 0
+	return true
+}
+
+// ApplyCFList configures the uplink channels from the optional CFList of the
+// JoinAccept: either up to 5 additional channel frequencies, or a channel mask
+// for regions with a fixed channel plan. It returns false if it is refused.
+func (r *settings) ApplyCFList(cfList [16]uint8) bool {
+	switch cfList[15] {
+	case CFLIST_TYPE_FREQUENCIES:
+		ok := true
+		for i := 0; i < 5; i++ {
+			freq := (uint32(cfList[3*i]) | uint32(cfList[3*i+1])<<8 | uint32(cfList[3*i+2])<<16) * 100
+			if freq == 0 {
+				continue
+			}
+			index := uint8(r.defaultChannels + i)
+			ok = r.SetChannel(index, freq, r.defaultDRRange&0x0F, r.defaultDRRange>>4) && ok
+		}
+		return ok
+	case CFLIST_TYPE_CHANNEL_MASK:
+		if r.defaultChannels != len(r.frequencies) {
+			return false
+		}
+		enabled := make([]bool, len(r.frequencies))
+		for i := range enabled {
+			if i/8 < 15 {
+				enabled[i] = cfList[i/8]&(1<<(i%8)) != 0
+			}
+		}
+		return r.applyChannelMask(enabled)
+	}
+	return false
+}
+
+// SelectUplinkChannel moves the uplink channel to a random enabled channel
+// supporting its current data rate, preferring channels whose sub-band duty
+// cycle allows an immediate transmission. It returns how long to wait before
+// transmitting, and false if no channel supports the data rate.
+func (r *settings) SelectUplinkChannel() (time.Duration, bool) {
+	dr, ok := r.currentDataRate()
+	if !ok {
+		return 0, false
+	}
+
+	now := time.Now()
+	var candidates, free []int
+	for i, freq := range r.frequencies {
+		if freq == 0 || !r.enabled[i] || dr < r.drRanges[i]&0x0F || dr > r.drRanges[i]>>4 {
+			continue
+		}
+		candidates = append(candidates, i)
+		if !r.bandAvailable(freq).After(now) {
+			free = append(free, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return 0, false
+	}
+
+	if len(free) > 0 {
+		r.uplinkChannel.SetFrequency(r.frequencies[free[random(len(free))]])
+		return 0, true
+	}
+
+	// All sub-bands are busy, use the one available first
+	best := candidates[0]
+	for _, i := range candidates[1:] {
+		if r.bandAvailable(r.frequencies[i]).Before(r.bandAvailable(r.frequencies[best])) {
+			best = i
+		}
+	}
+	r.uplinkChannel.SetFrequency(r.frequencies[best])
+	return r.bandAvailable(r.frequencies[best]).Sub(now), true
+}
+
+// TransmitDone accounts a transmission that just ended in the duty cycle of
+// the sub-band of the given frequency
+func (r *settings) TransmitDone(freq uint32, airTime time.Duration) {
+	for i := range r.bands {
+		b := &r.bands[i]
+		if freq >= b.minFrequency && freq < b.maxFrequency {
+			b.available = time.Now().Add(airTime * time.Duration(b.dutyCycle-1))
+			return
+		}
+	}
+}
+
+// DutyCycleWait returns how long to wait before the sub-band of freq allows a
+// transmission
+func (r *settings) DutyCycleWait(freq uint32) time.Duration {
+	if wait := time.Until(r.bandAvailable(freq)); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// bandAvailable returns the next time a transmission on the frequency is allowed
+func (r *settings) bandAvailable(freq uint32) time.Time {
+	for i := range r.bands {
+		if freq >= r.bands[i].minFrequency && freq < r.bands[i].maxFrequency {
+			return r.bands[i].available
+		}
+	}
+	return time.Time{}
+}
+
+// currentDataRate returns the data rate matching the uplink channel modulation
+func (r *settings) currentDataRate() (uint8, bool) {
+	for dr := range r.dataRates {
+		d := r.dataRates[dr]
+		if d.spreadingFactor != 0 && d.spreadingFactor == r.uplinkChannel.SpreadingFactor() && d.bandwidth == r.uplinkChannel.Bandwidth() {
+			return uint8(dr), true
+		}
+	}
+	return 0, false
+}
+
+// applyChannelMask replaces the channel mask if at least one channel is
+// enabled, and moves the uplink channel to an enabled channel if needed
+func (r *settings) applyChannelMask(enabled []bool) bool {
+	first := -1
+	for i := range enabled {
+		if enabled[i] {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return false
+	}
+	copy(r.enabled, enabled)
+
+	for i, freq := range r.frequencies {
+		if freq == r.uplinkChannel.Frequency() && r.enabled[i] {
+			return true
+		}
+	}
+	r.uplinkChannel.SetFrequency(r.frequencies[first])
+	return true
+}
+
+// cfListChannelMasks returns the channel mask CFList as the channel masks of
+// a LinkADRReq block, one for each bank of 16 channels
+func cfListChannelMasks(cfList [16]uint8, banks int) []ChannelMask {
+	masks := make([]ChannelMask, banks)
+	for i := range masks {
+		masks[i] = ChannelMask{Ctrl: uint8(i), Mask: uint16(cfList[2*i]) | uint16(cfList[2*i+1])<<8}
+	}
+	return masks
+}
+
+// random returns a random number in [0, n)
+func random(n int) int {
+	var b [2]byte
+	rand.Read(b[:])
+	return int(uint16(b[0])<<8|uint16(b[1])) % n
+}
@@ -0,0 +1,164 @@
+package region
+
+import (
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"tinygo.org/x/drivers/lora"
+)
+
+func TestEU868DutyCycle(t *testing.T) {
+	c := qt.New(t)
+	r := EU868()
+
+	// The 3 default channels share the same 1% sub-band
+	wait, ok := r.SelectUplinkChannel()
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(wait, qt.Equals, time.Duration(0))
+	freq := r.UplinkChannel().Frequency()
+	c.Assert(freq == lora.MHz_868_1 || freq == lora.MHz_868_3 || freq == lora.MHz_868_5, qt.IsTrue)
+
+	r.TransmitDone(freq, 100*time.Millisecond)
+	wait, ok = r.SelectUplinkChannel()
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(wait > 9*time.Second && wait <= 9900*time.Millisecond, qt.IsTrue)
+
+	// A channel in another sub-band is free
+	c.Assert(r.SetChannel(3, 867100000, 0, 5), qt.IsTrue)
+	wait, ok = r.SelectUplinkChannel()
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(wait, qt.Equals, time.Duration(0))
+	c.Assert(r.UplinkChannel().Frequency(), qt.Equals, uint32(867100000))
+}
+
+func TestEU868CFList(t *testing.T) {
+	c := qt.New(t)
+	r := EU868()
+
+	// 867.1, 867.3, 867.5, 867.7, 867.9 MHz as sent by most network servers
+	cfList := [16]uint8{0x18, 0x4F, 0x84, 0xE8, 0x56, 0x84, 0xB8, 0x5E, 0x84, 0x88, 0x66, 0x84, 0x58, 0x6E, 0x84, 0x00}
+	c.Assert(r.ApplyCFList(cfList), qt.IsTrue)
+	c.Assert(r.frequencies[3:8], qt.DeepEquals, []uint32{867100000, 867300000, 867500000, 867700000, 867900000})
+	c.Assert(r.enabled[7], qt.IsTrue)
+
+	// Default channels cannot be modified
+	c.Assert(r.SetChannel(0, 867100000, 0, 5), qt.IsFalse)
+	// Channel masks only enable defined channels
+	c.Assert(r.SetChannelMask(0, 0x0100), qt.IsFalse)
+	c.Assert(r.SetChannelMask(0, 0x0018), qt.IsTrue)
+	c.Assert(r.UplinkChannel().Frequency(), qt.Equals, uint32(867100000))
+}
+
+func TestUS915ChannelMask(t *testing.T) {
+	c := qt.New(t)
+	r := US915()
+
+	// Sub-band 2 (channels 8-15) and 500 kHz channel 65, as used by TTN
+	c.Assert(r.SetChannelMask(7, 0x0002), qt.IsTrue)
+	c.Assert(r.SetChannelMask(0, 0xFF00), qt.IsTrue)
+
+	sf, bw, ok := r.DataRate(0)
+	c.Assert(ok, qt.IsTrue)
+	r.UplinkChannel().SetSpreadingFactor(sf)
+	r.UplinkChannel().SetBandwidth(bw)
+	for i := 0; i < 20; i++ {
+		_, ok = r.SelectUplinkChannel()
+		c.Assert(ok, qt.IsTrue)
+		freq := r.UplinkChannel().Frequency()
+		c.Assert(freq >= 903900000 && freq <= 905300000, qt.IsTrue)
+	}
+
+	c.Assert(r.MaxPayload(0), qt.Equals, uint8(11))
+	_, _, ok = r.DataRate(5)
+	c.Assert(ok, qt.IsFalse)
+}
+
+func TestChannelPlan(t *testing.T) {
+	c := qt.New(t)
+	r := US915()
+	c.Assert(r.SetChannelMask(7, 0x0002), qt.IsTrue)
+	c.Assert(r.SetChannelMask(0, 0xFF00), qt.IsTrue)
+	r.RX2Channel().SetSpreadingFactor(lora.SpreadingFactor10)
+	r.UplinkChannel().SetTxPowerDBm(10)
+	plan := r.MarshalChannelPlan()
+
+	restored := US915()
+	c.Assert(restored.UnmarshalChannelPlan(plan), qt.IsTrue)
+	c.Assert(restored.enabled, qt.DeepEquals, r.enabled)
+	c.Assert(*restored.rx2Channel.(*ChannelUS), qt.Equals, *r.rx2Channel.(*ChannelUS))
+	c.Assert(*restored.uplinkChannel.(*ChannelUS), qt.Equals, *r.uplinkChannel.(*ChannelUS))
+
+	// A plan without channel is refused
+	c.Assert(restored.UnmarshalChannelPlan([CHANNEL_PLAN_LENGTH]uint8{}), qt.IsFalse)
+	c.Assert(restored.enabled, qt.DeepEquals, r.enabled)
+}
+
+func TestUS915CFList(t *testing.T) {
+	c := qt.New(t)
+	r := US915()
+
+	// Sub-band 2 and its 500 kHz channel 65: the uplink channel moves from
+	// the disabled 500 kHz channel 64 to channel 8, at 125 kHz
+	cfList := [16]uint8{0x00, 0xFF, 0, 0, 0, 0, 0, 0, 0x02, 0x00, 0, 0, 0, 0, 0, CFLIST_TYPE_CHANNEL_MASK}
+	c.Assert(r.ApplyCFList(cfList), qt.IsTrue)
+	c.Assert(r.UplinkChannel().Frequency(), qt.Equals, uint32(903900000))
+	c.Assert(r.UplinkChannel().Bandwidth(), qt.Equals, uint8(lora.Bandwidth_125_0))
+	c.Assert(r.enabled[7], qt.IsFalse)
+	c.Assert(r.enabled[15], qt.IsTrue)
+	c.Assert(r.enabled[64], qt.IsFalse)
+	c.Assert(r.enabled[65], qt.IsTrue)
+
+	// A CFList of frequencies is refused
+	cfList[15] = CFLIST_TYPE_FREQUENCIES
+	c.Assert(r.ApplyCFList(cfList), qt.IsFalse)
+}
+
+func TestEU868DataRates(t *testing.T) {
+	c := qt.New(t)
+	r := EU868()
+
+	sf, _, ok := r.DataRate(7)
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(sf, qt.Equals, uint8(SF_FSK))
+	c.Assert(r.MaxPayload(7), qt.Equals, uint8(242))
+	_, _, ok = r.DataRate(8)
+	c.Assert(ok, qt.IsFalse)
+
+	// Channels added by the network server may use FSK
+	c.Assert(r.SetChannel(3, 868800000, 7, 7), qt.IsTrue)
+	r.UplinkChannel().SetSpreadingFactor(SF_FSK)
+	r.UplinkChannel().SetBandwidth(0)
+	_, ok = r.SelectUplinkChannel()
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(r.UplinkChannel().Frequency(), qt.Equals, uint32(868800000))
+}
+
+func TestTxPower(t *testing.T) {
+	c := qt.New(t)
+	for _, tt := range []struct {
+		name     string
+		settings Settings
+		maxIndex uint8
+		index0   int8
+	}{
+		{"AS923", AS923(), 7, 16},
+		{"AU915", AU915(), 10, 30},
+		{"CN470", CN470(), 7, 19},
+		{"EU868", EU868(), 7, 16},
+		{"IN865", IN865(), 10, 30},
+		{"KR920", KR920(), 7, 14},
+		{"US915", US915(), 10, 30},
+	} {
+		c.Run(tt.name, func(c *qt.C) {
+			// Index 0 is the regional Max EIRP, each index 2 dB lower
+			for i := uint8(0); i <= tt.maxIndex; i++ {
+				dbm, ok := tt.settings.TxPower(i)
+				c.Assert(ok, qt.IsTrue)
+				c.Assert(dbm, qt.Equals, tt.index0-2*int8(i))
+			}
+			_, ok := tt.settings.TxPower(tt.maxIndex + 1)
+			c.Assert(ok, qt.IsFalse)
+		})
+	}
+}
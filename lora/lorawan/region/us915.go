@@ -5,10 +5,35 @@ import "tinygo.org/x/drivers/lora"
 const (
 	US915_DEFAULT_PREAMBLE_LEN     = 8
 	US915_DEFAULT_TX_POWER_DBM     = 20
+	US915_MAX_EIRP_DBM             = 30      // TX power index 0
 	US915_FREQUENCY_INCREMENT_DR_0 = 200000  // only for 125 kHz Bandwidth
 	US915_FREQUENCY_INCREMENT_DR_4 = 1600000 // only for 500 kHz Bandwidth
+	US915_FREQUENCY_INCREMENT_RX1  = 600000  // downlink channels are 500 kHz wide
+	US915_RX1_CHANNEL_COUNT        = 8
+	US915_MAX_TX_POWER_INDEX       = 10
+	US915_MIN_FREQUENCY            = 902000000
+	US915_MAX_FREQUENCY            = 928000000
+	US915_CHANNELS_125             = 64
+	US915_DR_RANGE_125             = 0x30 // DR0 to DR3
+	US915_DR_RANGE_500             = 0x44 // DR4
+	US915_MAX_CHANNELS             = 72
 )
 
+var dataRatesUS915 = []dataRate{
+	{lora.SpreadingFactor10, lora.Bandwidth_125_0, 11}, // DR0
+	{lora.SpreadingFactor9, lora.Bandwidth_125_0, 53},  // DR1
+	{lora.SpreadingFactor8, lora.Bandwidth_125_0, 125}, // DR2
+	{lora.SpreadingFactor7, lora.Bandwidth_125_0, 242}, // DR3
+	{lora.SpreadingFactor8, lora.Bandwidth_500_0, 242}, // DR4
+	{}, {}, {}, // DR5..DR7 RFU
+	{lora.SpreadingFactor12, lora.Bandwidth_500_0, 53},  // DR8
+	{lora.SpreadingFactor11, lora.Bandwidth_500_0, 129}, // DR9
+	{lora.SpreadingFactor10, lora.Bandwidth_500_0, 242}, // DR10
+	{lora.SpreadingFactor9, lora.Bandwidth_500_0, 242},  // DR11
+	{lora.SpreadingFactor8, lora.Bandwidth_500_0, 242},  // DR12
+	{lora.SpreadingFactor7, lora.Bandwidth_500_0, 242},  // DR13
+}
+
 type ChannelUS struct {
 	channel
 }
@@ -59,7 +84,22 @@ type SettingsUS915 struct {
 }
 
 func US915() *SettingsUS915 {
+	frequencies := make([]uint32, US915_MAX_CHANNELS)
+	drRanges := make([]uint8, US915_MAX_CHANNELS)
+	enabled := make([]bool, US915_MAX_CHANNELS)
+	for i := range frequencies {
+		if i < US915_CHANNELS_125 {
+			drRanges[i] = US915_DR_RANGE_125
+			frequencies[i] = lora.MHz_902_3 + uint32(i)*US915_FREQUENCY_INCREMENT_DR_0
+		} else {
+			drRanges[i] = US915_DR_RANGE_500
+			frequencies[i] = lora.Mhz_903_0 + uint32(i-US915_CHANNELS_125)*US915_FREQUENCY_INCREMENT_DR_4
+		}
+		enabled[i] = true
+	}
+
 	return &SettingsUS915{settings: settings{
+		id: REGION_US915,
 		joinRequestChannel: &ChannelUS{channel: channel{lora.MHz_902_3,
 			lora.Bandwidth_125_0,
 			lora.SpreadingFactor10,
@@ -74,9 +114,108 @@ func US915() *SettingsUS915 {
 			US915_DEFAULT_TX_POWER_DBM}},
 		uplinkChannel: &ChannelUS{channel: channel{lora.Mhz_903_0,
 			lora.Bandwidth_500_0,
-			lora.SpreadingFactor9,
+			lora.SpreadingFactor8,
 			lora.CodingRate4_5,
 			US915_DEFAULT_PREAMBLE_LEN,
 			US915_DEFAULT_TX_POWER_DBM}},
+		rx2Channel: &ChannelUS{channel: channel{lora.MHz_923_3,
+			lora.Bandwidth_500_0,
+			lora.SpreadingFactor12,
+			lora.CodingRate4_5,
+			US915_DEFAULT_PREAMBLE_LEN,
+			US915_DEFAULT_TX_POWER_DBM}},
+		dataRates:       dataRatesUS915,
+		maxEIRPDBm:      US915_MAX_EIRP_DBM,
+		maxTxPowerIndex: US915_MAX_TX_POWER_INDEX,
+		minFrequency:    US915_MIN_FREQUENCY,
+		maxFrequency:    US915_MAX_FREQUENCY,
+		defaultChannels: US915_MAX_CHANNELS, // NewChannelReq is not supported
+		frequencies:     frequencies,
+		drRanges:        drRanges,
+		enabled:         enabled,
 	}}
 }
+
+// SetChannelMask enables uplink channels as requested by a LinkADRReq, where
+// ctrl selects a bank of 16 channels (0-4), or turns all 125 kHz channels
+// on (6) or off (7) while mask applies to the 500 kHz channels.
+func (r *SettingsUS915) SetChannelMask(ctrl uint8, mask uint16) bool {
+	return r.SetChannelMasks([]ChannelMask{{ctrl, mask}})
+}
+
+// SetChannelMasks applies the channel masks of a block of LinkADRReq as a
+// whole, such as all channels off (7) followed by the bank of a sub-band.
+func (r *SettingsUS915) SetChannelMasks(masks []ChannelMask) bool {
+	if !r.setChannelMasks(masks, r.channelMask) {
+		return false
+	}
+
+	// 125 kHz and 500 kHz channels are interleaved, follow the bandwidth
+	for i, freq := range r.frequencies {
+		if freq != r.uplinkChannel.Frequency() {
+			continue
+		}
+		if i < US915_CHANNELS_125 {
+			r.uplinkChannel.SetBandwidth(lora.Bandwidth_125_0)
+		} else {
+			r.uplinkChannel.SetBandwidth(lora.Bandwidth_500_0)
+		}
+		break
+	}
+	return true
+}
+
+// ApplyCFList applies the channel mask CFList of the JoinAccept like a block
+// of LinkADRReq, banks 0-3 for the 125 kHz channels and bank 4 for the 500 kHz
+// channels. Channel frequencies cannot be changed.
+func (r *SettingsUS915) ApplyCFList(cfList [16]uint8) bool {
+	if cfList[15] != CFLIST_TYPE_CHANNEL_MASK {
+		return false
+	}
+	return r.SetChannelMasks(cfListChannelMasks(cfList, 5))
+}
+
+// channelMask updates enabled with a LinkADRReq channel mask
+func (r *SettingsUS915) channelMask(enabled []bool, ctrl uint8, mask uint16) bool {
+	switch ctrl {
+	case 0, 1, 2, 3, 4:
+		for i := 0; i < 16 && int(ctrl)*16+i < len(enabled); i++ {
+			enabled[int(ctrl)*16+i] = mask&(1<<i) != 0
+		}
+	case 6, 7:
+		for i := range enabled {
+			if i < US915_CHANNELS_125 {
+				enabled[i] = ctrl == 6
+			} else {
+				enabled[i] = mask&(1<<(i-US915_CHANNELS_125)) != 0
+			}
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// RX1Channel returns the first receive window channel derived from the
+// current uplink channel: one of the 8 downlink channels starting at 923.3 MHz,
+// always using 500 kHz bandwidth.
+func (r *SettingsUS915) RX1Channel() Channel {
+	up := r.uplinkChannel
+
+	var ch uint32
+	sf := up.SpreadingFactor()
+	switch up.Bandwidth() {
+	case lora.Bandwidth_500_0:
+		ch = 64 + (up.Frequency()-lora.Mhz_903_0)/US915_FREQUENCY_INCREMENT_DR_4
+		sf = lora.SpreadingFactor7 // DR4 maps to DR13
+	default:
+		ch = (up.Frequency() - lora.MHz_902_3) / US915_FREQUENCY_INCREMENT_DR_0
+	}
+
+	return &ChannelUS{channel: channel{lora.MHz_923_3 + (ch%US915_RX1_CHANNEL_COUNT)*US915_FREQUENCY_INCREMENT_RX1,
+		lora.Bandwidth_500_0,
+		sf,
+		lora.CodingRate4_5,
+		US915_DEFAULT_PREAMBLE_LEN,
+		US915_DEFAULT_TX_POWER_DBM}}
+}
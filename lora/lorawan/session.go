@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"math"
+	"time"
 )
 
 // Session is used to store session data of a LoRaWAN session
@@ -17,6 +18,31 @@ type Session struct {
 	CFList     [16]uint8
 	RXDelay    uint8
 	DLSettings uint8
+
+	// ADR enables device side Adaptive Data Rate
+	ADR bool
+
+	// MaxDutyCycle is the aggregated duty cycle limit 1/2^MaxDutyCycle
+	// requested by the network server, 0 means no limit
+	MaxDutyCycle uint8
+	// NbTrans is the number of transmissions of each unconfirmed uplink
+	// requested by the network server, 0 means the default of 1
+	NbTrans uint8
+
+	// macAnswers are MAC command answers queued for the next uplink
+	macAnswers []uint8
+	// stickyAnswers are repeated in every uplink until a downlink is received
+	stickyAnswers []uint8
+	// adrAckCnt counts uplinks since the last downlink
+	adrAckCnt uint32
+	// dutyCycleUntil is the end of the aggregated duty cycle off time
+	dutyCycleUntil time.Time
+	// txDone is the time the last uplink finished, used to time RX windows
+	txDone time.Time
+	// ackPending is set when a confirmed downlink must be acknowledged
+	ackPending bool
+	// snr is the SNR of the last downlink, answered in DevStatusAns
+	snr int8
 }
 
 // SetDevAddr configures the Session DevAddr
@@ -67,18 +93,55 @@ func (s *Session) GetAppSKey() string {
 	return hex.EncodeToString(s.AppSKey[:])
 }
 
-// GenMessage generates an uplink message.
+// resetMAC clears the settings requested by the network server with MAC
+// commands, and the answers not sent yet
+func (s *Session) resetMAC() {
+	s.MaxDutyCycle = 0
+	s.NbTrans = 0
+	s.macAnswers = s.macAnswers[:0]
+	s.stickyAnswers = s.stickyAnswers[:0]
+	s.adrAckCnt = 0
+	s.dutyCycleUntil = time.Time{}
+	s.ackPending = false
+}
+
+// GenMessage generates an unconfirmed uplink message.
 func (s *Session) GenMessage(dir uint8, payload []uint8) ([]uint8, error) {
+	return s.genMessage(MTYPE_UNCONFIRMED_DATA_UP, dir, payload)
+}
+
+// GenConfirmedMessage generates a confirmed uplink message.
+func (s *Session) GenConfirmedMessage(dir uint8, payload []uint8) ([]uint8, error) {
+	return s.genMessage(MTYPE_CONFIRMED_DATA_UP, dir, payload)
+}
+
+func (s *Session) genMessage(mType uint8, dir uint8, payload []uint8) ([]uint8, error) {
 	var buf []uint8
-	buf = append(buf, 0b01000000) // FHDR Unconfirmed up
+	buf = append(buf, mType<<5) // MHDR, LoRaWAN R1
 	buf = append(buf, s.DevAddr[:]...)
 
-	// FCtl : No ADR, No RFU, No ACK, No FPending, No FOpt
-	buf = append(buf, 0x00)
+	// FCtl : ADR, ADRACKReq, ACK, MAC answers in FOpts
+	fOpts := s.macFOpts()
+	fCtrl := uint8(len(fOpts))
+	if s.ADR {
+		fCtrl |= FCTRL_ADR
+		s.adrAckCnt++
+		if s.adrAckCnt >= ADR_ACK_LIMIT {
+			fCtrl |= FCTRL_ADRACKREQ
+		}
+	}
+	if s.ackPending {
+		fCtrl |= FCTRL_ACK
+		s.ackPending = false
+	}
+	buf = append(buf, fCtrl)
 
 	// FCnt Up
 	buf = append(buf, uint8(s.FCntUp&0xFF), uint8((s.FCntUp>>8)&0xFF))
 
+	// FOpts
+	buf = append(buf, fOpts...)
+
 	// FPort=1
 	buf = append(buf, 0x01)
 
@@ -89,7 +152,7 @@ func (s *Session) GenMessage(dir uint8, payload []uint8) ([]uint8, error) {
 	} else {
 		fCnt = s.FCntDown
 	}
-	data, err := s.genFRMPayload(dir, fCnt, payload, false)
+	data, err := s.genFRMPayload(s.AppSKey, dir, fCnt, payload, false)
 	if err != nil {
 		return nil, err
 	}
@@ -101,7 +164,7 @@ func (s *Session) GenMessage(dir uint8, payload []uint8) ([]uint8, error) {
 	return buf, nil
 }
 
-func (s *Session) genFRMPayload(dir uint8, fCnt uint32, payload []byte, isFOpts bool) ([]byte, error) {
+func (s *Session) genFRMPayload(key [16]uint8, dir uint8, fCnt uint32, payload []byte, isFOpts bool) ([]byte, error) {
 	k := len(payload) / aes.BlockSize
 	if len(payload)%aes.BlockSize != 0 {
 		k++
@@ -110,7 +173,7 @@ func (s *Session) genFRMPayload(dir uint8, fCnt uint32, payload []byte, isFOpts
 		return nil, ErrFrmPayloadTooLarge
 	}
 	encrypted := make([]byte, 0, k*16)
-	cipher, err := aes.NewCipher(s.AppSKey[:])
+	cipher, err := aes.NewCipher(key[:])
 	if err != nil {
 		panic(err)
 	}
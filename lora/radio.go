@@ -16,4 +16,24 @@ type Radio interface {
 	SetPublicNetwork(enable bool)
 	SetHeaderType(headerType uint8)
 	LoraConfig(cnf Config)
+	// Cad runs a channel activity detection and reports whether a LoRa
+	// preamble was detected
+	Cad(timeoutMs uint32) (bool, error)
+	// LastPacketRSSI returns the RSSI of the last packet received in dBm
+	LastPacketRSSI() int16
+	// LastPacketSNR returns the SNR of the last packet received in dB
+	LastPacketSNR() int8
+	SetListenBeforeTalk(lbt ListenBeforeTalk)
+}
+
+// ContinuousReceiver is implemented by radios able to listen continuously
+// without blocking the caller. StartRxContinuous keeps the radio in receive
+// mode until StopRxContinuous, Tx or Rx is called. Each received packet is
+// signaled by a RadioEventRxDone on the radio event channel, after which
+// ReadRxPacket returns its content.
+type ContinuousReceiver interface {
+	StartRxContinuous() error
+	StopRxContinuous()
+	ReadRxPacket() []uint8
+	GetRadioEventChan() chan RadioEvent
 }
@@ -7,6 +7,8 @@ const (
 	RadioEventWatchdog
 	RadioEventCrcError
 	RadioEventUnhandled
+	RadioEventCadDone
+	RadioEventCadDetected
 )
 
 // RadioEvent are used for communicating in the radio Event Channel
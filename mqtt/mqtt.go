@@ -0,0 +1,632 @@
+// Package mqtt implements a small MQTT 3.1.1 client for TinyGo, running over
+// any net.Conn, such as the ones provided through netdev.
+//
+// The client uses fixed size buffers, allocated once, for the packets sent
+// and received, and for the QoS 1 message waiting for its acknowledgement,
+// which bounds the size of the messages.  It supports QoS 0 and 1, retained
+// messages, the last will, keepalive pings, and reconnects to the broker,
+// resubscribing and publishing again the unacknowledged message, when the
+// connection is lost.  Reconnection follows the network link when the client
+// is given the netlink events.
+//
+// Received messages are handled from Poll, which must be called regularly:
+//
+//	client := mqtt.New(&mqtt.Config{
+//		Dial:     func() (net.Conn, error) { return net.Dial("tcp", broker) },
+//		ClientID: "tinygo",
+//	})
+//	link.NetNotify(client.HandleEvent)
+//	client.Connect()
+//	client.Subscribe("sensors/#", mqtt.QoS1, handler)
+//	for {
+//		client.Poll(100 * time.Millisecond)
+//	}
+//
+// Specification:
+// https://docs.oasis-open.org/mqtt/mqtt/v3.1.1/mqtt-v3.1.1.html
+package mqtt // import "tinygo.org/x/drivers/mqtt"
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"tinygo.org/x/drivers/netlink"
+)
+
+const (
+	DefaultKeepAlive  = 60 * time.Second
+	DefaultTimeout    = 10 * time.Second
+	DefaultBufferSize = 512
+
+	// MaxSubscriptions is the number of topic filters a client can
+	// subscribe to
+	MaxSubscriptions = 8
+
+	reconnectMin = time.Second
+	reconnectMax = time.Minute
+
+	// The keepalive is sent in seconds, on 16 bits
+	maxKeepAlive = 65535 * time.Second
+)
+
+// QoS is the quality of service of a message delivery
+type QoS uint8
+
+const (
+	// At most once
+	QoS0 QoS = 0
+	// At least once
+	QoS1 QoS = 1
+)
+
+var (
+	ErrNotConnected      = errors.New("mqtt: not connected")
+	ErrTimeout           = errors.New("mqtt: timeout waiting for the broker")
+	ErrPacketTooLarge    = errors.New("mqtt: packet too large for the buffer")
+	ErrProtocol          = errors.New("mqtt: protocol error")
+	ErrQoS               = errors.New("mqtt: QoS not supported")
+	ErrTooManySubs       = errors.New("mqtt: too many subscriptions")
+	ErrSubscribeRejected = errors.New("mqtt: subscription rejected by the broker")
+	ErrNoDial            = errors.New("mqtt: Config.Dial not set")
+	ErrPasswordNoUser    = errors.New("mqtt: password without user name")
+	ErrKeepAlive         = errors.New("mqtt: keepalive out of range")
+)
+
+// ConnackError is the reason the broker refused the connection
+type ConnackError uint8
+
+func (err ConnackError) Error() string {
+	switch err {
+	case 1:
+		return "mqtt: connection refused, unacceptable protocol version"
+	case 2:
+		return "mqtt: connection refused, identifier rejected"
+	case 3:
+		return "mqtt: connection refused, server unavailable"
+	case 4:
+		return "mqtt: connection refused, bad user name or password"
+	case 5:
+		return "mqtt: connection refused, not authorized"
+	}
+	return "mqtt: connection refused, code " + strconv.Itoa(int(err))
+}
+
+// Message is an application message
+type Message struct {
+	Topic   string
+	Payload []byte
+	QoS     QoS
+	Retain  bool
+}
+
+// Handler is called for the messages received on a subscription.  The topic
+// and payload are only valid during the call, and the handler must not call
+// the Client.
+type Handler func(topic, payload []byte)
+
+type Config struct {
+	// Dial opens a connection to the broker, for connecting and
+	// reconnecting
+	Dial func() (net.Conn, error)
+
+	ClientID string
+	Username string
+	// Password requires a Username
+	Password string
+
+	// KeepAlive is the longest time without sending anything to the
+	// broker, pinging it if need be, up to 65535 seconds.  Defaults to
+	// DefaultKeepAlive.
+	KeepAlive time.Duration
+	// CleanSession makes the broker discard the previous session
+	CleanSession bool
+	// Will is published by the broker when the client disappears without
+	// disconnecting
+	Will *Message
+
+	// Timeout is the time to wait for the broker's acknowledgements.
+	// Defaults to DefaultTimeout.
+	Timeout time.Duration
+	// BufferSize is the size of the transmit, receive and unacknowledged
+	// message buffers, bounding the packets size.  Defaults to DefaultBufferSize.
+	BufferSize int
+}
+
+type subscription struct {
+	filter  string
+	qos     QoS
+	handler Handler
+}
+
+type Client struct {
+	cfg Config
+	mu  sync.Mutex
+
+	conn      net.Conn
+	connected bool
+	// Disconnect was called, don't reconnect
+	closed bool
+
+	// Network link state from HandleEvent, with its own lock as the events
+	// are sent by network drivers holding their lock
+	linkMu   sync.Mutex
+	linkDown bool
+	linkUp   bool
+
+	reconnectAt time.Time
+	backoff     time.Duration
+
+	lastSent time.Time
+	pingSent time.Time
+	packetID uint16
+
+	tx []byte
+	rx []byte
+
+	// QoS 1 PUBLISH packet not acknowledged yet, with DUP set, published
+	// again when reconnecting
+	inflight   []byte
+	inflightID uint16
+
+	subs [MaxSubscriptions]subscription
+}
+
+// New returns a client configured by cfg, not connected yet
+func New(cfg *Config) *Client {
+	c := Client{cfg: *cfg}
+	if c.cfg.KeepAlive == 0 {
+		c.cfg.KeepAlive = DefaultKeepAlive
+	}
+	if c.cfg.Timeout == 0 {
+		c.cfg.Timeout = DefaultTimeout
+	}
+	if c.cfg.BufferSize == 0 {
+		c.cfg.BufferSize = DefaultBufferSize
+	}
+	c.tx = make([]byte, 0, c.cfg.BufferSize)
+	c.rx = make([]byte, c.cfg.BufferSize)
+	c.inflight = make([]byte, 0, c.cfg.BufferSize)
+	return &c
+}
+
+// Connect connects to the broker and subscribes to the topics subscribed so
+// far
+func (c *Client) Connect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = false
+	if c.connected {
+		return nil
+	}
+	return c.connect()
+}
+
+func (c *Client) connect() error {
+	if c.cfg.Dial == nil {
+		return ErrNoDial
+	}
+
+	conn, err := c.cfg.Dial()
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.pingSent = time.Time{}
+
+	pkt, err := c.connectPacket()
+	if err == nil {
+		err = c.send(pkt)
+	}
+	if err == nil {
+		err = c.waitConnack()
+	}
+	if err != nil {
+		c.lost()
+		return err
+	}
+
+	c.connected = true
+	c.backoff = 0
+
+	// The message may have been received but not acknowledged, it is sent
+	// again as a duplicate, whether the session was kept or not
+	if len(c.inflight) > 0 {
+		if err := c.send(c.inflight); err != nil {
+			return err
+		}
+		if _, err := c.waitAck(packetPuback, c.inflightID); err != nil {
+			return err
+		}
+		c.inflight = c.inflight[:0]
+	}
+
+	for i := range c.subs {
+		s := &c.subs[i]
+		if s.handler == nil {
+			continue
+		}
+		if err := c.subscribe(s.filter, s.qos); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) waitConnack() error {
+	deadline := time.Now().Add(c.cfg.Timeout)
+	for {
+		header, body, err := c.read(deadline)
+		if err != nil {
+			return err
+		}
+		if header>>4 != packetConnack {
+			continue
+		}
+		if len(body) < 2 {
+			return ErrProtocol
+		}
+		if body[1] != 0 {
+			return ConnackError(body[1])
+		}
+		return nil
+	}
+}
+
+// Disconnect disconnects from the broker, cleanly so the will isn't
+// published.  The client doesn't reconnect until Connect is called.
+func (c *Client) Disconnect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	if !c.connected {
+		return nil
+	}
+
+	b, _ := c.begin(packetDisconnect<<4, 0)
+	err := c.send(b)
+	c.lost()
+	return err
+}
+
+// IsConnected reports whether the client is connected to the broker
+func (c *Client) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+// Publish publishes a message.  For QoS 1, Publish waits for the broker to
+// acknowledge it.  If the connection is lost before, Publish returns the
+// error and the message is published again, as a duplicate, once
+// reconnected.
+func (c *Client) Publish(topic string, payload []byte, qos QoS, retain bool) error {
+	if qos > QoS1 {
+		return ErrQoS
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected {
+		return ErrNotConnected
+	}
+
+	id := uint16(0)
+	if qos > QoS0 {
+		id = c.nextID()
+	}
+	pkt, err := c.publishPacket(topic, payload, qos, retain, id)
+	if err != nil {
+		return err
+	}
+	if qos > QoS0 {
+		c.inflight = append(c.inflight[:0], pkt...)
+		c.inflight[0] |= publishDup
+		c.inflightID = id
+	}
+	if err := c.send(pkt); err != nil {
+		return err
+	}
+	if qos > QoS0 {
+		if _, err = c.waitAck(packetPuback, id); err == nil {
+			c.inflight = c.inflight[:0]
+		}
+	}
+	return err
+}
+
+// Subscribe subscribes to the topics matching filter, calling handler for
+// each message received.  Subscribing again to the same filter replaces its
+// handler.  If the client is not connected, the subscription is made when it
+// connects.
+func (c *Client) Subscribe(filter string, qos QoS, handler Handler) error {
+	if qos > QoS1 {
+		return ErrQoS
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var slot *subscription
+	for i := range c.subs {
+		s := &c.subs[i]
+		if s.handler != nil && s.filter == filter {
+			slot = s
+			break
+		}
+		if s.handler == nil && slot == nil {
+			slot = s
+		}
+	}
+	if slot == nil {
+		return ErrTooManySubs
+	}
+	*slot = subscription{filter: filter, qos: qos, handler: handler}
+
+	if !c.connected {
+		return nil
+	}
+	if err := c.subscribe(filter, qos); err != nil {
+		if err == ErrSubscribeRejected {
+			*slot = subscription{}
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *Client) subscribe(filter string, qos QoS) error {
+	id := c.nextID()
+	pkt, err := c.subscribePacket(filter, qos, id)
+	if err != nil {
+		return err
+	}
+	if err := c.send(pkt); err != nil {
+		return err
+	}
+	body, err := c.waitAck(packetSuback, id)
+	if err != nil {
+		return err
+	}
+	if len(body) < 3 || body[2] == subackFailure {
+		return ErrSubscribeRejected
+	}
+	return nil
+}
+
+// Unsubscribe removes the subscription to filter
+func (c *Client) Unsubscribe(filter string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := range c.subs {
+		if c.subs[i].handler != nil && c.subs[i].filter == filter {
+			c.subs[i] = subscription{}
+		}
+	}
+
+	if !c.connected {
+		return nil
+	}
+
+	id := c.nextID()
+	pkt, err := c.unsubscribePacket(filter, id)
+	if err != nil {
+		return err
+	}
+	if err := c.send(pkt); err != nil {
+		return err
+	}
+	_, err = c.waitAck(packetUnsuback, id)
+	return err
+}
+
+// HandleEvent follows the network link state, to reconnect to the broker
+// as soon as the link is back up.  Pass it to netlink.Netlinker.NetNotify,
+// or call it from the NetNotify callback.
+func (c *Client) HandleEvent(event netlink.Event) {
+	c.linkMu.Lock()
+	defer c.linkMu.Unlock()
+
+	switch event {
+	case netlink.EventNetDown:
+		c.linkDown = true
+	case netlink.EventNetUp, netlink.EventWatchdogRecovery:
+		c.linkDown = false
+		c.linkUp = true
+	}
+}
+
+// linkState returns whether the link is down, and whether it came back up
+// since the last call
+func (c *Client) linkState() (down, up bool) {
+	c.linkMu.Lock()
+	defer c.linkMu.Unlock()
+	down, up = c.linkDown, c.linkUp
+	c.linkUp = false
+	return
+}
+
+// Poll waits up to timeout for a message from the broker, calling the
+// subscription handlers.  It also keeps the connection alive, and reconnects
+// when it was lost, backing off between failed attempts.  Poll returns
+// ErrNotConnected while the client is not connected.
+func (c *Client) Poll(timeout time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	linkDown, linkUp := c.linkState()
+	if linkUp {
+		// Reconnect right away
+		c.reconnectAt = time.Time{}
+		c.backoff = 0
+	}
+	if c.connected && linkDown {
+		c.lost()
+	}
+
+	if !c.connected {
+		if c.closed || linkDown || time.Now().Before(c.reconnectAt) {
+			return ErrNotConnected
+		}
+		if err := c.connect(); err != nil {
+			c.retryLater()
+			return err
+		}
+	}
+
+	if err := c.keepAlive(); err != nil {
+		return err
+	}
+
+	header, body, err := c.read(time.Now().Add(timeout))
+	switch err {
+	case nil:
+		return c.handle(header, body)
+	case ErrTimeout:
+		return nil
+	}
+	return err
+}
+
+func (c *Client) keepAlive() error {
+	now := time.Now()
+	if !c.pingSent.IsZero() {
+		if now.Sub(c.pingSent) > c.cfg.Timeout {
+			c.lost()
+			return ErrTimeout
+		}
+		return nil
+	}
+	if now.Sub(c.lastSent) < c.cfg.KeepAlive {
+		return nil
+	}
+	b, _ := c.begin(packetPingreq<<4, 0)
+	if err := c.send(b); err != nil {
+		return err
+	}
+	c.pingSent = now
+	return nil
+}
+
+func (c *Client) retryLater() {
+	if c.backoff == 0 {
+		c.backoff = reconnectMin
+	} else if c.backoff < reconnectMax {
+		c.backoff *= 2
+	}
+	c.reconnectAt = time.Now().Add(c.backoff)
+}
+
+// lost closes the connection to the broker
+func (c *Client) lost() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+	c.connected = false
+}
+
+func (c *Client) nextID() uint16 {
+	c.packetID++
+	if c.packetID == 0 {
+		c.packetID = 1
+	}
+	return c.packetID
+}
+
+func (c *Client) send(pkt []byte) error {
+	c.conn.SetWriteDeadline(time.Now().Add(c.cfg.Timeout))
+	if _, err := c.conn.Write(pkt); err != nil {
+		c.lost()
+		return err
+	}
+	c.lastSent = time.Now()
+	return nil
+}
+
+// read reads the next packet, waiting for it until deadline.  Once a packet
+// started, the rest of it is waited for up to the timeout.
+func (c *Client) read(deadline time.Time) (byte, []byte, error) {
+	for {
+		var header [1]byte
+		c.conn.SetReadDeadline(deadline)
+		if _, err := c.conn.Read(header[:]); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return 0, nil, ErrTimeout
+			}
+			c.lost()
+			return 0, nil, err
+		}
+
+		c.conn.SetReadDeadline(time.Now().Add(c.cfg.Timeout))
+		body, err := c.readPacket()
+		switch err {
+		case nil:
+			return header[0], body, nil
+		case ErrPacketTooLarge:
+			// Skipped
+			continue
+		}
+		c.lost()
+		return 0, nil, err
+	}
+}
+
+// waitAck waits for the acknowledgement of packet id, handling the packets
+// received meanwhile
+func (c *Client) waitAck(ptype byte, id uint16) ([]byte, error) {
+	deadline := time.Now().Add(c.cfg.Timeout)
+	for {
+		header, body, err := c.read(deadline)
+		if err == ErrTimeout {
+			c.lost()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header>>4 == ptype && len(body) >= 2 && binary.BigEndian.Uint16(body) == id {
+			return body, nil
+		}
+		if err := c.handle(header, body); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// handle handles a packet not sent in reply to our requests
+func (c *Client) handle(header byte, body []byte) error {
+	switch header >> 4 {
+	case packetPublish:
+		topic, id, payload, err := parsePublish(header, body)
+		if err != nil {
+			c.lost()
+			return err
+		}
+		qos := QoS(header >> 1 & 0x03)
+		if qos > QoS1 {
+			// We never subscribe with QoS 2
+			c.lost()
+			return ErrProtocol
+		}
+		for i := range c.subs {
+			s := &c.subs[i]
+			if s.handler != nil && match(s.filter, topic) {
+				s.handler(topic, payload)
+			}
+		}
+		if qos == QoS1 {
+			return c.send(c.ackPacket(packetPuback, id))
+		}
+	case packetPingresp:
+		c.pingSent = time.Time{}
+	}
+	return nil
+}
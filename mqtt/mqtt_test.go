@@ -0,0 +1,311 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"tinygo.org/x/drivers/netlink"
+)
+
+// broker is a minimal in-memory MQTT broker, echoing the messages published
+// to the subscribed topics of the same client
+type broker struct {
+	mu       sync.Mutex
+	connects [][]byte // CONNECT packets received
+	subs     []string
+	pings    int
+	conn     net.Conn
+	rc       byte // CONNACK return code
+	// PUBLISH fixed headers received, and the number of PUBACK to skip
+	publishes  []byte
+	skipPuback int
+}
+
+func (b *broker) dial() (net.Conn, error) {
+	client, server := net.Pipe()
+	b.mu.Lock()
+	b.conn = server
+	b.subs = nil
+	b.mu.Unlock()
+	go b.serve(server)
+	return client, nil
+}
+
+// drop closes the connection from the broker side
+func (b *broker) drop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.conn.Close()
+}
+
+func readFrame(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	l, mult := 0, 1
+	for {
+		d, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		l += int(d&0x7F) * mult
+		mult *= 128
+		if d&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, l)
+	_, err = io.ReadFull(r, body)
+	return header, body, err
+}
+
+func frame(header byte, body []byte) []byte {
+	// Test packets are short
+	return append([]byte{header, byte(len(body))}, body...)
+}
+
+func (b *broker) serve(conn net.Conn) {
+	// net.Pipe isn't buffered: write from another goroutine, like a socket
+	// would, so that the broker and the client don't block each other
+	out := make(chan []byte, 16)
+	defer close(out)
+	go func() {
+		for p := range out {
+			conn.Write(p)
+		}
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		header, body, err := readFrame(r)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		b.mu.Lock()
+		switch header >> 4 {
+		case packetConnect:
+			b.connects = append(b.connects, body)
+			out <- frame(packetConnack<<4, []byte{0, b.rc})
+		case packetSubscribe:
+			l := binary.BigEndian.Uint16(body[2:])
+			filter := string(body[4 : 4+l])
+			b.subs = append(b.subs, filter)
+			rc := body[4+l]
+			if filter == "forbidden" {
+				rc = subackFailure
+			}
+			out <- frame(packetSuback<<4, []byte{body[0], body[1], rc})
+		case packetUnsubscribe:
+			out <- frame(packetUnsuback<<4, body[:2])
+		case packetPublish:
+			topic, id, payload, _ := parsePublish(header, body)
+			b.publishes = append(b.publishes, header)
+			for _, f := range b.subs {
+				if match(f, topic) {
+					// Delivered with QoS 1, packet id 100
+					msg := appendBytes(nil, topic)
+					msg = append(appendUint16(msg, 100), payload...)
+					out <- frame(packetPublish<<4|0x02, msg)
+					break
+				}
+			}
+			if header&0x06 != 0 && b.skipPuback > 0 {
+				b.skipPuback--
+			} else if header&0x06 != 0 {
+				out <- frame(packetPuback<<4, appendUint16(nil, id))
+			}
+		case packetPingreq:
+			b.pings++
+			out <- []byte{packetPingresp << 4, 0}
+		case packetDisconnect:
+			conn.Close()
+		}
+		b.mu.Unlock()
+	}
+}
+
+func newClient(c *qt.C, b *broker) *Client {
+	client := New(&Config{
+		Dial:      b.dial,
+		ClientID:  "tinygo",
+		KeepAlive: time.Hour,
+		Timeout:   time.Second,
+		Will:      &Message{Topic: "status", Payload: []byte("gone"), QoS: QoS1, Retain: true},
+	})
+	c.Assert(client.Connect(), qt.IsNil)
+	return client
+}
+
+func TestConnect(t *testing.T) {
+	c := qt.New(t)
+	b := &broker{}
+	newClient(c, b)
+
+	// Protocol name and level, will QoS 1 retained, keepalive, client id,
+	// will topic and message
+	connect := b.connects[0]
+	c.Assert(connect[:7], qt.DeepEquals, []byte{0, 4, 'M', 'Q', 'T', 'T', 4})
+	c.Assert(connect[7], qt.Equals, byte(connectWill|connectWillRetain|1<<3))
+	c.Assert(binary.BigEndian.Uint16(connect[8:]), qt.Equals, uint16(3600))
+	c.Assert(string(connect[12:18]), qt.Equals, "tinygo")
+	c.Assert(string(connect[20:26]), qt.Equals, "status")
+	c.Assert(string(connect[28:]), qt.Equals, "gone")
+
+	b = &broker{rc: 4}
+	client := New(&Config{Dial: b.dial, Timeout: time.Second})
+	c.Assert(client.Connect(), qt.Equals, ConnackError(4))
+	c.Assert(client.IsConnected(), qt.IsFalse)
+
+	// Invalid configurations
+	client = New(&Config{Dial: b.dial, Password: "secret"})
+	c.Assert(client.Connect(), qt.Equals, ErrPasswordNoUser)
+	client = New(&Config{Dial: b.dial, KeepAlive: maxKeepAlive + time.Second})
+	c.Assert(client.Connect(), qt.Equals, ErrKeepAlive)
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	c := qt.New(t)
+	b := &broker{}
+	client := newClient(c, b)
+
+	var got []string
+	handler := func(topic, payload []byte) {
+		got = append(got, string(topic)+"="+string(payload))
+	}
+	c.Assert(client.Subscribe("sensors/+/temp", QoS1, handler), qt.IsNil)
+	c.Assert(client.Subscribe("forbidden", QoS0, handler), qt.Equals, ErrSubscribeRejected)
+
+	// The echo is received while waiting for the PUBACK
+	c.Assert(client.Publish("sensors/kitchen/temp", []byte("21.5"), QoS1, false), qt.IsNil)
+	c.Assert(client.Publish("sensors/kitchen/humidity", []byte("40"), QoS1, false), qt.IsNil)
+
+	// QoS 0 has no PUBACK, the echo is received by Poll
+	c.Assert(client.Publish("sensors/garage/temp", []byte("12"), QoS0, true), qt.IsNil)
+	c.Assert(client.Poll(time.Second), qt.IsNil)
+	c.Assert(got, qt.DeepEquals, []string{"sensors/kitchen/temp=21.5", "sensors/garage/temp=12"})
+
+	c.Assert(client.Unsubscribe("sensors/+/temp"), qt.IsNil)
+	c.Assert(client.Publish("sensors/kitchen/temp", []byte("22"), QoS0, false), qt.IsNil)
+	c.Assert(client.Poll(100*time.Millisecond), qt.IsNil)
+	c.Assert(got, qt.HasLen, 2)
+
+	c.Assert(client.Publish("big", make([]byte, DefaultBufferSize), QoS0, false), qt.Equals, ErrPacketTooLarge)
+	c.Assert(client.Publish("qos2", nil, 2, false), qt.Equals, ErrQoS)
+}
+
+func TestKeepAlive(t *testing.T) {
+	c := qt.New(t)
+	b := &broker{}
+	client := New(&Config{Dial: b.dial, KeepAlive: 50 * time.Millisecond, Timeout: time.Second})
+	c.Assert(client.Connect(), qt.IsNil)
+
+	for i := 0; i < 5; i++ {
+		c.Assert(client.Poll(30*time.Millisecond), qt.IsNil)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c.Assert(b.pings > 0, qt.IsTrue)
+}
+
+func TestReconnect(t *testing.T) {
+	c := qt.New(t)
+	b := &broker{}
+	client := newClient(c, b)
+
+	var got int
+	c.Assert(client.Subscribe("a/#", QoS1, func(topic, payload []byte) { got++ }), qt.IsNil)
+
+	// The link going down drops the connection, and nothing is attempted
+	// until it is back up
+	client.HandleEvent(netlink.EventNetDown)
+	c.Assert(client.Poll(0), qt.Equals, ErrNotConnected)
+	c.Assert(client.IsConnected(), qt.IsFalse)
+	c.Assert(client.Publish("a/b", nil, QoS0, false), qt.Equals, ErrNotConnected)
+
+	client.HandleEvent(netlink.EventNetUp)
+	c.Assert(client.Poll(0), qt.IsNil)
+	c.Assert(client.IsConnected(), qt.IsTrue)
+	c.Assert(b.connects, qt.HasLen, 2)
+
+	// Resubscribed
+	c.Assert(client.Publish("a/b", nil, QoS1, false), qt.IsNil)
+	c.Assert(got, qt.Equals, 1)
+
+	// The broker going away is noticed by Poll, which reconnects, backing
+	// off after failed attempts
+	b.mu.Lock()
+	b.rc = 3
+	b.mu.Unlock()
+	b.drop()
+	c.Assert(client.Poll(time.Second), qt.Not(qt.IsNil))
+	c.Assert(client.Poll(0), qt.Equals, ConnackError(3))
+	c.Assert(client.Poll(0), qt.Equals, ErrNotConnected)
+	b.mu.Lock()
+	b.rc = 0
+	b.mu.Unlock()
+	time.Sleep(reconnectMin)
+	c.Assert(client.Poll(0), qt.IsNil)
+	c.Assert(client.IsConnected(), qt.IsTrue)
+
+	// No reconnection after Disconnect
+	c.Assert(client.Disconnect(), qt.IsNil)
+	client.HandleEvent(netlink.EventNetUp)
+	c.Assert(client.Poll(0), qt.Equals, ErrNotConnected)
+}
+
+func TestRepublish(t *testing.T) {
+	c := qt.New(t)
+	b := &broker{skipPuback: 1}
+	client := newClient(c, b)
+
+	// Not acknowledged, published again as a duplicate once reconnected
+	c.Assert(client.Publish("a/b", []byte("1"), QoS1, false), qt.Equals, ErrTimeout)
+	c.Assert(client.IsConnected(), qt.IsFalse)
+	c.Assert(client.Poll(0), qt.IsNil)
+	c.Assert(client.IsConnected(), qt.IsTrue)
+
+	// Acknowledged, not published again
+	b.drop()
+	c.Assert(client.Poll(time.Second), qt.Not(qt.IsNil))
+	c.Assert(client.Poll(0), qt.IsNil)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c.Assert(b.publishes, qt.DeepEquals, []byte{
+		packetPublish<<4 | 0x02,
+		packetPublish<<4 | 0x02 | publishDup,
+	})
+}
+
+func TestMatch(t *testing.T) {
+	c := qt.New(t)
+	for _, tt := range []struct {
+		filter, topic string
+		match         bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/b", "a/c", false},
+		{"a/b", "a/b/c", false},
+		{"a/+", "a/b", true},
+		{"a/+", "a/", true},
+		{"a/+", "a/b/c", false},
+		{"+/+", "a/b", true},
+		{"a/#", "a", true},
+		{"a/#", "a/b/c", true},
+		{"#", "a/b", true},
+		{"#", "$SYS/uptime", false},
+		{"+/uptime", "$SYS/uptime", false},
+		{"$SYS/#", "$SYS/uptime", true},
+	} {
+		c.Assert(match(tt.filter, []byte(tt.topic)), qt.Equals, tt.match, qt.Commentf("%s %s", tt.filter, tt.topic))
+	}
+}
@@ -0,0 +1,280 @@
+package mqtt
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Control packet types, in the high nibble of the fixed header
+const (
+	packetConnect     = 1
+	packetConnack     = 2
+	packetPublish     = 3
+	packetPuback      = 4
+	packetSubscribe   = 8
+	packetSuback      = 9
+	packetUnsubscribe = 10
+	packetUnsuback    = 11
+	packetPingreq     = 12
+	packetPingresp    = 13
+	packetDisconnect  = 14
+)
+
+const (
+	protocolLevel = 4 // MQTT 3.1.1
+
+	connectUsername     = 0x80
+	connectPassword     = 0x40
+	connectWillRetain   = 0x20
+	connectWill         = 0x04
+	connectCleanSession = 0x02
+
+	publishDup    = 0x08
+	publishRetain = 0x01
+
+	subackFailure = 0x80
+
+	// Largest remaining length encoding
+	maxHeaderLen = 5
+)
+
+// begin starts a packet in the tx buffer with its fixed header, checking it
+// fits
+func (c *Client) begin(header byte, remaining int) ([]byte, error) {
+	if 1+varintLen(remaining)+remaining > cap(c.tx) {
+		return nil, ErrPacketTooLarge
+	}
+	b := append(c.tx[:0], header)
+	for {
+		d := byte(remaining % 128)
+		remaining /= 128
+		if remaining > 0 {
+			d |= 0x80
+		}
+		b = append(b, d)
+		if remaining == 0 {
+			return b, nil
+		}
+	}
+}
+
+func varintLen(n int) int {
+	l := 1
+	for n >= 128 {
+		n /= 128
+		l++
+	}
+	return l
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func appendBytes(b []byte, p []byte) []byte {
+	b = appendUint16(b, uint16(len(p)))
+	return append(b, p...)
+}
+
+func (c *Client) connectPacket() ([]byte, error) {
+	cfg := &c.cfg
+	if cfg.Password != "" && cfg.Username == "" {
+		return nil, ErrPasswordNoUser
+	}
+	if cfg.KeepAlive < 0 || cfg.KeepAlive > maxKeepAlive {
+		return nil, ErrKeepAlive
+	}
+
+	flags := byte(0)
+	remaining := 6 + 1 + 1 + 2 + 2 + len(cfg.ClientID)
+	if cfg.CleanSession {
+		flags |= connectCleanSession
+	}
+	if w := cfg.Will; w != nil {
+		flags |= connectWill | byte(w.QoS)<<3
+		if w.Retain {
+			flags |= connectWillRetain
+		}
+		remaining += 2 + len(w.Topic) + 2 + len(w.Payload)
+	}
+	if cfg.Username != "" {
+		flags |= connectUsername
+		remaining += 2 + len(cfg.Username)
+	}
+	if cfg.Password != "" {
+		flags |= connectPassword
+		remaining += 2 + len(cfg.Password)
+	}
+
+	b, err := c.begin(packetConnect<<4, remaining)
+	if err != nil {
+		return nil, err
+	}
+	b = appendString(b, "MQTT")
+	b = append(b, protocolLevel, flags)
+	b = appendUint16(b, uint16(cfg.KeepAlive.Seconds()))
+	b = appendString(b, cfg.ClientID)
+	if w := cfg.Will; w != nil {
+		b = appendString(b, w.Topic)
+		b = appendBytes(b, w.Payload)
+	}
+	if cfg.Username != "" {
+		b = appendString(b, cfg.Username)
+	}
+	if cfg.Password != "" {
+		b = appendString(b, cfg.Password)
+	}
+	return b, nil
+}
+
+func (c *Client) publishPacket(topic string, payload []byte, qos QoS, retain bool, id uint16) ([]byte, error) {
+	header := byte(packetPublish<<4) | byte(qos)<<1
+	if retain {
+		header |= publishRetain
+	}
+	remaining := 2 + len(topic) + len(payload)
+	if qos > QoS0 {
+		remaining += 2
+	}
+
+	b, err := c.begin(header, remaining)
+	if err != nil {
+		return nil, err
+	}
+	b = appendString(b, topic)
+	if qos > QoS0 {
+		b = appendUint16(b, id)
+	}
+	return append(b, payload...), nil
+}
+
+func (c *Client) subscribePacket(filter string, qos QoS, id uint16) ([]byte, error) {
+	b, err := c.begin(packetSubscribe<<4|0x02, 2+2+len(filter)+1)
+	if err != nil {
+		return nil, err
+	}
+	b = appendUint16(b, id)
+	b = appendString(b, filter)
+	return append(b, byte(qos)), nil
+}
+
+func (c *Client) unsubscribePacket(filter string, id uint16) ([]byte, error) {
+	b, err := c.begin(packetUnsubscribe<<4|0x02, 2+2+len(filter))
+	if err != nil {
+		return nil, err
+	}
+	b = appendUint16(b, id)
+	return appendString(b, filter), nil
+}
+
+func (c *Client) ackPacket(ptype byte, id uint16) []byte {
+	b, _ := c.begin(ptype<<4, 2)
+	return appendUint16(b, id)
+}
+
+// readPacket reads the remaining length and the rest of a packet which
+// fixed header byte has been read, into the rx buffer.  Packets larger than
+// the buffer are skipped, returning ErrPacketTooLarge.
+func (c *Client) readPacket() ([]byte, error) {
+	var one [1]byte
+	remaining, mult := 0, 1
+	for i := 0; ; i++ {
+		if i == maxHeaderLen-1 {
+			return nil, ErrProtocol
+		}
+		if _, err := io.ReadFull(c.conn, one[:]); err != nil {
+			return nil, err
+		}
+		remaining += int(one[0]&0x7F) * mult
+		mult *= 128
+		if one[0]&0x80 == 0 {
+			break
+		}
+	}
+
+	if remaining > len(c.rx) {
+		for remaining > 0 {
+			n := remaining
+			if n > len(c.rx) {
+				n = len(c.rx)
+			}
+			if _, err := io.ReadFull(c.conn, c.rx[:n]); err != nil {
+				return nil, err
+			}
+			remaining -= n
+		}
+		return nil, ErrPacketTooLarge
+	}
+
+	if _, err := io.ReadFull(c.conn, c.rx[:remaining]); err != nil {
+		return nil, err
+	}
+	return c.rx[:remaining], nil
+}
+
+// parsePublish splits the body of a PUBLISH packet
+func parsePublish(header byte, body []byte) (topic []byte, id uint16, payload []byte, err error) {
+	if len(body) < 2 {
+		return nil, 0, nil, ErrProtocol
+	}
+	l := int(binary.BigEndian.Uint16(body))
+	body = body[2:]
+	if len(body) < l {
+		return nil, 0, nil, ErrProtocol
+	}
+	topic, body = body[:l], body[l:]
+	if QoS(header>>1&0x03) > QoS0 {
+		if len(body) < 2 {
+			return nil, 0, nil, ErrProtocol
+		}
+		id, body = binary.BigEndian.Uint16(body), body[2:]
+	}
+	return topic, id, body, nil
+}
+
+// match reports whether topic matches the subscription filter, which may
+// have '+' and '#' wildcards
+func match(filter string, topic []byte) bool {
+	// Wildcards don't match the $SYS-like topics
+	if len(topic) > 0 && topic[0] == '$' && len(filter) > 0 &&
+		(filter[0] == '+' || filter[0] == '#') {
+		return false
+	}
+
+	fi, ti := 0, 0
+	for {
+		fe := fi
+		for fe < len(filter) && filter[fe] != '/' {
+			fe++
+		}
+		level := filter[fi:fe]
+		if level == "#" {
+			return true
+		}
+
+		te := ti
+		for te < len(topic) && topic[te] != '/' {
+			te++
+		}
+		if level != "+" && level != string(topic[ti:te]) {
+			return false
+		}
+
+		filterDone, topicDone := fe == len(filter), te == len(topic)
+		switch {
+		case filterDone && topicDone:
+			return true
+		case topicDone:
+			// "a/#" matches "a"
+			return filter[fe+1:] == "#"
+		case filterDone:
+			return false
+		}
+		fi, ti = fe+1, te+1
+	}
+}
@@ -0,0 +1,234 @@
+package netdevtest
+
+import (
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"tinygo.org/x/drivers/netdev"
+)
+
+const (
+	// Backlog of the sockets listening with Listen
+	listenBacklog = 5
+	// Reads poll the socket, so that a read deadline set while reading,
+	// such as by net/http to abort a read, takes effect
+	readPollInterval = 10 * time.Millisecond
+)
+
+// Conn is a net.Conn over a socket of a netdev.Netdever, made by Dial or
+// accepted by a Listener.  It lets code using the standard library "net"
+// interfaces, such as net/http, run against a Netdever on the host.
+type Conn struct {
+	dev   netdev.Netdever
+	fd    int
+	laddr net.Addr
+	raddr net.Addr
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+// Dial connects to the address on the named network, "tcp" or "udp", with a
+// socket of the Netdever, like net.Dial
+func Dial(dev netdev.Netdever, network, address string) (net.Conn, error) {
+	stype, protocol, err := socketType(network)
+	if err != nil {
+		return nil, err
+	}
+	host, port, err := splitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ip, err := dev.GetHostByName(host)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := dev.Socket(netdev.AF_INET, stype, protocol)
+	if err != nil {
+		return nil, err
+	}
+	raddr := netip.AddrPortFrom(ip, port)
+	if err := dev.Connect(fd, host, raddr); err != nil {
+		dev.Close(fd)
+		return nil, err
+	}
+
+	local, _ := dev.Addr()
+	laddr := netip.AddrPortFrom(local, 0)
+	return &Conn{dev: dev, fd: fd, laddr: sockAddr(stype, laddr), raddr: sockAddr(stype, raddr)}, nil
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	for {
+		c.mu.Lock()
+		deadline := c.readDeadline
+		c.mu.Unlock()
+
+		poll := time.Now().Add(readPollInterval)
+		if !deadline.IsZero() {
+			if !time.Now().Before(deadline) {
+				return 0, netdev.ErrTimeout
+			}
+			if deadline.Before(poll) {
+				poll = deadline
+			}
+		}
+		n, err := c.dev.Recv(c.fd, b, 0, poll)
+		switch {
+		case err == netdev.ErrTimeout:
+			continue
+		case err != nil:
+			return 0, err
+		}
+		return n, nil
+	}
+}
+
+func (c *Conn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	deadline := c.writeDeadline
+	c.mu.Unlock()
+
+	n, err := c.dev.Send(c.fd, b, 0, deadline)
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (c *Conn) Close() error {
+	return c.dev.Close(c.fd)
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	return c.laddr
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	c.writeDeadline = t
+	return nil
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return nil
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeDeadline = t
+	return nil
+}
+
+// Listener is a net.Listener over a listening TCP socket of a
+// netdev.Netdever, made by Listen
+type Listener struct {
+	dev  netdev.Netdever
+	fd   int
+	addr net.Addr
+}
+
+// Listen listens on the address on the named network, which must be "tcp",
+// with a socket of the Netdever, like net.Listen.  An empty host listens on
+// all the addresses of the Netdever.
+func Listen(dev netdev.Netdever, network, address string) (net.Listener, error) {
+	stype, protocol, err := socketType(network)
+	if err != nil {
+		return nil, err
+	}
+	if stype != netdev.SOCK_STREAM {
+		return nil, netdev.ErrProtocolNotSupported
+	}
+	host, port, err := splitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ip := netip.IPv4Unspecified()
+	if host != "" {
+		if ip, err = dev.GetHostByName(host); err != nil {
+			return nil, err
+		}
+	}
+
+	fd, err := dev.Socket(netdev.AF_INET, stype, protocol)
+	if err != nil {
+		return nil, err
+	}
+	laddr := netip.AddrPortFrom(ip, port)
+	if err := dev.Bind(fd, laddr); err != nil {
+		dev.Close(fd)
+		return nil, err
+	}
+	if err := dev.Listen(fd, listenBacklog); err != nil {
+		dev.Close(fd)
+		return nil, err
+	}
+	return &Listener{dev: dev, fd: fd, addr: sockAddr(stype, laddr)}, nil
+}
+
+// Accept waits for the next connection, until the listener is closed
+func (l *Listener) Accept() (net.Conn, error) {
+	fd, raddr, err := l.dev.Accept(l.fd)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{dev: l.dev, fd: fd, laddr: l.addr, raddr: sockAddr(netdev.SOCK_STREAM, raddr)}, nil
+}
+
+func (l *Listener) Close() error {
+	return l.dev.Close(l.fd)
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.addr
+}
+
+// socketType returns the socket type and protocol of a net package network
+func socketType(network string) (int, int, error) {
+	switch network {
+	case "tcp", "tcp4":
+		return netdev.SOCK_STREAM, netdev.IPPROTO_TCP, nil
+	case "udp", "udp4":
+		return netdev.SOCK_DGRAM, netdev.IPPROTO_UDP, nil
+	}
+	return 0, 0, netdev.ErrProtocolNotSupported
+}
+
+// splitHostPort splits a "host:port" address with a numeric port
+func splitHostPort(address string) (string, uint16, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, netdev.ErrMalAddr
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return "", 0, netdev.ErrMalAddr
+	}
+	return host, uint16(p), nil
+}
+
+// sockAddr returns the net.Addr of a socket address
+func sockAddr(stype int, addr netip.AddrPort) net.Addr {
+	if stype == netdev.SOCK_DGRAM {
+		return net.UDPAddrFromAddrPort(addr)
+	}
+	return net.TCPAddrFromAddrPort(addr)
+}
@@ -0,0 +1,86 @@
+package netdevtest
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"tinygo.org/x/drivers/netdev"
+)
+
+func TestHTTP(t *testing.T) {
+	c := qt.New(t)
+	network := NewNetwork()
+	server := NewNetdev(network, netip.MustParseAddr("10.0.0.1"))
+	client := NewNetdev(network, netip.MustParseAddr("10.0.0.2"))
+	network.AddHost("server", netip.MustParseAddr("10.0.0.1"))
+
+	l, err := Listen(server, "tcp", ":80")
+	c.Assert(err, qt.IsNil)
+	served := make(chan error, 1)
+	go func() {
+		served <- http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "hello, "+r.RemoteAddr)
+		}))
+	}()
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return Dial(client, network, addr)
+		},
+	}
+	defer transport.CloseIdleConnections()
+	for i := 0; i < 2; i++ {
+		resp, err := (&http.Client{Transport: transport}).Get("http://server/")
+		c.Assert(err, qt.IsNil)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		c.Assert(err, qt.IsNil)
+		c.Assert(string(body), qt.Matches, `hello, 10\.0\.0\.2:\d+`)
+	}
+
+	c.Assert(l.Close(), qt.IsNil)
+	select {
+	case err := <-served:
+		c.Assert(err, qt.Equals, ErrSocketClosed)
+	case <-time.After(time.Second):
+		c.Fatal("server still accepting")
+	}
+
+	_, err = Dial(client, "tcp", "server:80")
+	c.Assert(err, qt.Equals, ErrConnRefused)
+	_, err = Dial(client, "unix", "/tmp/socket")
+	c.Assert(err, qt.Equals, netdev.ErrProtocolNotSupported)
+}
+
+func TestConnReadDeadline(t *testing.T) {
+	c := qt.New(t)
+	dev := NewNetdev(NewNetwork(), netip.MustParseAddr("10.0.0.1"))
+
+	l, err := Listen(dev, "tcp", ":7")
+	c.Assert(err, qt.IsNil)
+	defer l.Close()
+	conn, err := Dial(dev, "tcp", "10.0.0.1:7")
+	c.Assert(err, qt.IsNil)
+	defer conn.Close()
+
+	// A deadline set while reading aborts the read
+	read := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		read <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	conn.SetReadDeadline(time.Now())
+	select {
+	case err := <-read:
+		c.Assert(err, qt.Equals, netdev.ErrTimeout)
+	case <-time.After(time.Second):
+		c.Fatal("read not aborted")
+	}
+}
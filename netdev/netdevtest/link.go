@@ -0,0 +1,159 @@
+package netdevtest
+
+import (
+	"net"
+	"sync"
+
+	"tinygo.org/x/drivers/netlink"
+)
+
+// Link is an in-memory netlink.Netlinker, whose connection can be brought up
+// and down with LinkUp and LinkDown to simulate network events
+type Link struct {
+	// Networks is returned by NetScan.  When not empty, NetConnect fails
+	// with EventNoAP if the SSID isn't one of them.
+	Networks []netlink.ScanResult
+
+	// Status is returned by GetLinkStatus while connected
+	Status netlink.LinkStatus
+
+	// ConnectErr, when set, is returned by NetConnect.  ErrAuthFailure is
+	// notified as EventAuthFailure.
+	ConnectErr error
+
+	// HardwareAddr is returned by GetHardwareAddr
+	HardwareAddr net.HardwareAddr
+
+	// Ethernet makes the link connect without SSID, like a wired link
+	Ethernet bool
+
+	mu       sync.Mutex
+	params   *netlink.ConnectParams
+	up       bool
+	notifyCb func(netlink.Event)
+}
+
+// NewLink returns a disconnected link
+func NewLink() *Link {
+	return &Link{
+		HardwareAddr: net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01},
+	}
+}
+
+func (l *Link) NetConnect(params *netlink.ConnectParams) error {
+	l.mu.Lock()
+	if l.params != nil {
+		l.mu.Unlock()
+		return netlink.ErrConnected
+	}
+	if len(params.Ssid) == 0 && !l.Ethernet {
+		l.mu.Unlock()
+		return netlink.ErrMissingSSID
+	}
+	found := len(l.Networks) == 0
+	for _, n := range l.Networks {
+		found = found || n.Ssid == params.Ssid
+	}
+	err := l.ConnectErr
+	l.mu.Unlock()
+
+	l.notify(netlink.EventConnecting)
+	switch {
+	case !found:
+		l.notify(netlink.EventNoAP)
+		return netlink.ErrConnectFailed
+	case err == netlink.ErrAuthFailure:
+		l.notify(netlink.EventAuthFailure)
+		return err
+	case err != nil:
+		return err
+	}
+
+	l.mu.Lock()
+	l.params = params
+	l.mu.Unlock()
+	l.LinkUp()
+	return nil
+}
+
+func (l *Link) NetDisconnect() {
+	l.mu.Lock()
+	connected := l.params != nil
+	l.params = nil
+	l.mu.Unlock()
+
+	if connected {
+		l.LinkDown()
+	}
+}
+
+func (l *Link) NetNotify(cb func(netlink.Event)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.notifyCb = cb
+}
+
+func (l *Link) GetHardwareAddr() (net.HardwareAddr, error) {
+	return l.HardwareAddr, nil
+}
+
+func (l *Link) NetScan() ([]netlink.ScanResult, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]netlink.ScanResult{}, l.Networks...), nil
+}
+
+func (l *Link) GetLinkStatus() (netlink.LinkStatus, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.up {
+		return netlink.LinkStatus{}, netlink.ErrNotConnected
+	}
+	return l.Status, nil
+}
+
+// Up returns whether the link is up
+func (l *Link) Up() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.up
+}
+
+// LinkUp brings the link up, notifying EventDHCPBound unless a static IP
+// address is configured, then EventNetUp
+func (l *Link) LinkUp() {
+	l.mu.Lock()
+	wasUp := l.up
+	l.up = true
+	dhcp := l.params == nil || !l.params.Addr.IsValid()
+	l.mu.Unlock()
+
+	if !wasUp {
+		if dhcp {
+			l.notify(netlink.EventDHCPBound)
+		}
+		l.notify(netlink.EventNetUp)
+	}
+}
+
+// LinkDown brings the link down, notifying EventNetDown
+func (l *Link) LinkDown() {
+	l.mu.Lock()
+	wasUp := l.up
+	l.up = false
+	l.mu.Unlock()
+
+	if wasUp {
+		l.notify(netlink.EventNetDown)
+	}
+}
+
+func (l *Link) notify(event netlink.Event) {
+	l.mu.Lock()
+	cb := l.notifyCb
+	l.mu.Unlock()
+
+	if cb != nil {
+		cb(event)
+	}
+}
@@ -0,0 +1,511 @@
+// Package netdevtest provides in-memory fakes of the netdev.Netdever and
+// netlink.Netlinker interfaces, to test network code with plain "go test".
+//
+// Netdevs attached to the same Network reach each other's listening and bound
+// sockets.  With Bridge set, connections to addresses without an in-memory
+// socket are made with the host's real sockets.  The standard library "net"
+// package doesn't use a Netdever on the host: Dial and Listen return a
+// net.Conn and a net.Listener over the sockets of a Netdever instead, for
+// code taking these interfaces, such as an http.Server or http.Transport.
+package netdevtest
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"tinygo.org/x/drivers/netdev"
+)
+
+var (
+	ErrConnRefused  = errors.New("Connection refused")
+	ErrAddrInUse    = errors.New("Address already in use")
+	ErrNotConnected = errors.New("Socket not connected")
+	ErrSocketClosed = errors.New("Socket closed")
+	ErrNotListening = errors.New("Socket not listening")
+	ErrBacklogFull  = errors.New("Listen backlog full")
+)
+
+const firstEphemeralPort = 49152
+
+// Network connects Netdevs together
+type Network struct {
+	mu        sync.Mutex
+	listeners map[netip.AddrPort]*socket
+	bound     map[netip.AddrPort]*socket // UDP sockets
+	hosts     map[string]netip.Addr
+}
+
+// NewNetwork returns an empty network
+func NewNetwork() *Network {
+	return &Network{
+		listeners: make(map[netip.AddrPort]*socket),
+		bound:     make(map[netip.AddrPort]*socket),
+		hosts:     make(map[string]netip.Addr),
+	}
+}
+
+// AddHost registers a host name resolved by GetHostByName
+func (n *Network) AddHost(name string, addr netip.Addr) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.hosts[name] = addr
+}
+
+// Netdev is an in-memory netdev.Netdever
+type Netdev struct {
+	// Bridge enables the host's real sockets for connections to
+	// addresses, and names, unknown to the network
+	Bridge bool
+
+	network  *Network
+	addr     netip.Addr
+	mu       sync.Mutex
+	sockets  map[int]*socket
+	nextFd   int
+	nextPort uint16
+}
+
+// NewNetdev returns a Netdev with the given IP address on the network
+func NewNetdev(network *Network, addr netip.Addr) *Netdev {
+	return &Netdev{
+		network:  network,
+		addr:     addr,
+		sockets:  make(map[int]*socket),
+		nextPort: firstEphemeralPort,
+	}
+}
+
+type socket struct {
+	stype    int
+	protocol int
+	laddr    netip.AddrPort
+	raddr    netip.AddrPort
+
+	// In-memory connection
+	rx   *buffer
+	peer *socket
+
+	// Listening socket
+	backlog chan *socket
+
+	// Bridged connection
+	conn net.Conn
+}
+
+// buffer holds the data received by a socket until read
+type buffer struct {
+	mu     sync.Mutex
+	chunks [][]byte
+	closed bool
+	ready  chan struct{}
+}
+
+func newBuffer() *buffer {
+	return &buffer{ready: make(chan struct{}, 1)}
+}
+
+func (b *buffer) signal() {
+	select {
+	case b.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (b *buffer) write(data []byte) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return false
+	}
+	b.chunks = append(b.chunks, append([]byte{}, data...))
+	b.signal()
+	return true
+}
+
+func (b *buffer) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.signal()
+}
+
+// read waits for data until the deadline.  Datagrams are returned whole,
+// truncated to len(p), while stream data fills p.
+func (b *buffer) read(p []byte, datagram bool, deadline time.Time) (int, error) {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		b.mu.Lock()
+		if len(b.chunks) > 0 {
+			n := 0
+			for len(b.chunks) > 0 && n < len(p) {
+				c := copy(p[n:], b.chunks[0])
+				n += c
+				if datagram || c == len(b.chunks[0]) {
+					b.chunks = b.chunks[1:]
+				} else {
+					b.chunks[0] = b.chunks[0][c:]
+				}
+				if datagram {
+					break
+				}
+			}
+			if len(b.chunks) > 0 || b.closed {
+				b.signal()
+			}
+			b.mu.Unlock()
+			return n, nil
+		}
+		closed := b.closed
+		b.mu.Unlock()
+
+		if closed {
+			return -1, io.EOF
+		}
+		select {
+		case <-b.ready:
+		case <-timeout:
+			return -1, netdev.ErrTimeout
+		}
+	}
+}
+
+func (d *Netdev) GetHostByName(name string) (netip.Addr, error) {
+	if ip, err := netip.ParseAddr(name); err == nil {
+		return ip, nil
+	}
+
+	d.network.mu.Lock()
+	ip, ok := d.network.hosts[name]
+	d.network.mu.Unlock()
+	if ok {
+		return ip, nil
+	}
+
+	if !d.Bridge {
+		return netip.Addr{}, netdev.ErrHostUnknown
+	}
+	addrs, err := net.LookupHost(name)
+	if err != nil {
+		return netip.Addr{}, netdev.ErrHostUnknown
+	}
+	for _, a := range addrs {
+		if ip, err := netip.ParseAddr(a); err == nil && ip.Is4() {
+			return ip, nil
+		}
+	}
+	return netip.Addr{}, netdev.ErrHostUnknown
+}
+
+func (d *Netdev) Addr() (netip.Addr, error) {
+	return d.addr, nil
+}
+
+func (d *Netdev) Socket(domain int, stype int, protocol int) (int, error) {
+
+	switch domain {
+	case netdev.AF_INET:
+	default:
+		return -1, netdev.ErrFamilyNotSupported
+	}
+
+	switch {
+	case protocol == netdev.IPPROTO_TCP && stype == netdev.SOCK_STREAM:
+	case protocol == netdev.IPPROTO_TLS && stype == netdev.SOCK_STREAM:
+	case protocol == netdev.IPPROTO_UDP && stype == netdev.SOCK_DGRAM:
+	default:
+		return -1, netdev.ErrProtocolNotSupported
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	fd := d.nextFd
+	d.nextFd++
+	d.sockets[fd] = &socket{stype: stype, protocol: protocol}
+	return fd, nil
+}
+
+func (d *Netdev) socket(sockfd int) (*socket, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.sockets[sockfd]
+	if !ok {
+		return nil, netdev.ErrInvalidSocketFd
+	}
+	return s, nil
+}
+
+// localAddr returns the address the socket is bound to, picking an ephemeral
+// port if not bound
+func (d *Netdev) localAddr(s *socket) netip.AddrPort {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	addr, port := s.laddr.Addr(), s.laddr.Port()
+	if !addr.IsValid() || addr.IsUnspecified() {
+		addr = d.addr
+	}
+	if port == 0 {
+		port = d.nextPort
+		d.nextPort++
+		if d.nextPort == 0 {
+			d.nextPort = firstEphemeralPort
+		}
+	}
+	s.laddr = netip.AddrPortFrom(addr, port)
+	return s.laddr
+}
+
+// remoteAddr maps loopback addresses to the device's address
+func (d *Netdev) remoteAddr(ip netip.AddrPort) netip.AddrPort {
+	if ip.Addr().IsLoopback() {
+		return netip.AddrPortFrom(d.addr, ip.Port())
+	}
+	return ip
+}
+
+func (d *Netdev) Bind(sockfd int, ip netip.AddrPort) error {
+	s, err := d.socket(sockfd)
+	if err != nil {
+		return err
+	}
+	s.laddr = ip
+	if s.stype != netdev.SOCK_DGRAM {
+		return nil
+	}
+
+	laddr := d.localAddr(s)
+	d.network.mu.Lock()
+	defer d.network.mu.Unlock()
+	if _, ok := d.network.bound[laddr]; ok {
+		return ErrAddrInUse
+	}
+	s.rx = newBuffer()
+	d.network.bound[laddr] = s
+	return nil
+}
+
+func (d *Netdev) Connect(sockfd int, host string, ip netip.AddrPort) error {
+	s, err := d.socket(sockfd)
+	if err != nil {
+		return err
+	}
+	raddr := d.remoteAddr(ip)
+	s.raddr = raddr
+
+	if s.stype == netdev.SOCK_DGRAM {
+		if s.rx == nil {
+			if err := d.Bind(sockfd, s.laddr); err != nil {
+				return err
+			}
+		}
+		d.network.mu.Lock()
+		_, ok := d.network.bound[raddr]
+		d.network.mu.Unlock()
+		if !ok && d.Bridge {
+			return d.dial(s, host, ip)
+		}
+		return nil
+	}
+
+	laddr := d.localAddr(s)
+	d.network.mu.Lock()
+	l, ok := d.network.listeners[raddr]
+	if !ok {
+		d.network.mu.Unlock()
+		if d.Bridge {
+			return d.dial(s, host, ip)
+		}
+		return ErrConnRefused
+	}
+
+	// Connect both ends, the server end being queued for Accept.  The
+	// network lock is held until queued: Close removes the listener and
+	// closes its backlog under it.
+	server := &socket{stype: s.stype, protocol: s.protocol, laddr: raddr,
+		raddr: laddr, rx: newBuffer(), peer: s}
+	select {
+	case l.backlog <- server:
+	default:
+		d.network.mu.Unlock()
+		return ErrBacklogFull
+	}
+	s.rx = newBuffer()
+	s.peer = server
+	d.network.mu.Unlock()
+	return nil
+}
+
+// dial connects the socket using the host's real sockets
+func (d *Netdev) dial(s *socket, host string, ip netip.AddrPort) (err error) {
+	switch s.protocol {
+	case netdev.IPPROTO_TCP:
+		s.conn, err = net.Dial("tcp", ip.String())
+	case netdev.IPPROTO_UDP:
+		s.conn, err = net.Dial("udp", ip.String())
+	case netdev.IPPROTO_TLS:
+		s.conn, err = tls.Dial("tcp", ip.String(), &tls.Config{ServerName: host})
+	}
+	return err
+}
+
+func (d *Netdev) Listen(sockfd int, backlog int) error {
+	s, err := d.socket(sockfd)
+	if err != nil {
+		return err
+	}
+	if s.stype != netdev.SOCK_STREAM {
+		return netdev.ErrProtocolNotSupported
+	}
+	if backlog < 1 {
+		backlog = 1
+	}
+
+	laddr := d.localAddr(s)
+	d.network.mu.Lock()
+	defer d.network.mu.Unlock()
+	if _, ok := d.network.listeners[laddr]; ok {
+		return ErrAddrInUse
+	}
+	s.backlog = make(chan *socket, backlog)
+	d.network.listeners[laddr] = s
+	return nil
+}
+
+func (d *Netdev) Accept(sockfd int) (int, netip.AddrPort, error) {
+	s, err := d.socket(sockfd)
+	if err != nil {
+		return -1, netip.AddrPort{}, err
+	}
+	if s.backlog == nil {
+		return -1, netip.AddrPort{}, ErrNotListening
+	}
+
+	client, ok := <-s.backlog
+	if !ok {
+		return -1, netip.AddrPort{}, ErrSocketClosed
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fd := d.nextFd
+	d.nextFd++
+	d.sockets[fd] = client
+	return fd, client.raddr, nil
+}
+
+func (d *Netdev) Send(sockfd int, buf []byte, flags int, deadline time.Time) (int, error) {
+	s, err := d.socket(sockfd)
+	if err != nil {
+		return -1, err
+	}
+
+	if s.conn != nil {
+		s.conn.SetWriteDeadline(deadline)
+		n, err := s.conn.Write(buf)
+		return n, hostError(err)
+	}
+
+	if s.stype == netdev.SOCK_DGRAM {
+		d.network.mu.Lock()
+		dst, ok := d.network.bound[s.raddr]
+		d.network.mu.Unlock()
+		// Datagrams sent to nowhere are lost
+		if ok {
+			dst.rx.write(buf)
+		}
+		return len(buf), nil
+	}
+
+	if s.peer == nil {
+		return -1, ErrNotConnected
+	}
+	if !s.peer.rx.write(buf) {
+		return -1, io.EOF
+	}
+	return len(buf), nil
+}
+
+func (d *Netdev) Recv(sockfd int, buf []byte, flags int, deadline time.Time) (int, error) {
+	s, err := d.socket(sockfd)
+	if err != nil {
+		return -1, err
+	}
+
+	if s.conn != nil {
+		s.conn.SetReadDeadline(deadline)
+		n, err := s.conn.Read(buf)
+		if n == 0 && err != nil {
+			return -1, hostError(err)
+		}
+		return n, nil
+	}
+
+	if s.rx == nil {
+		return -1, ErrNotConnected
+	}
+	return s.rx.read(buf, s.stype == netdev.SOCK_DGRAM, deadline)
+}
+
+// hostError converts a host socket timeout error to netdev.ErrTimeout
+func hostError(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return netdev.ErrTimeout
+	}
+	return err
+}
+
+func (d *Netdev) Close(sockfd int) error {
+	d.mu.Lock()
+	s, ok := d.sockets[sockfd]
+	delete(d.sockets, sockfd)
+	d.mu.Unlock()
+	if !ok {
+		return netdev.ErrInvalidSocketFd
+	}
+
+	if s.conn != nil {
+		s.conn.Close()
+	}
+
+	d.network.mu.Lock()
+	defer d.network.mu.Unlock()
+
+	if s.backlog != nil {
+		delete(d.network.listeners, s.laddr)
+		close(s.backlog)
+		// Reset connections not accepted yet
+		for pending := range s.backlog {
+			pending.rx.close()
+			pending.peer.rx.close()
+		}
+	}
+	if s.stype == netdev.SOCK_DGRAM && d.network.bound[s.laddr] == s {
+		delete(d.network.bound, s.laddr)
+	}
+	if s.rx != nil {
+		s.rx.close()
+	}
+	if s.peer != nil {
+		s.peer.rx.close()
+	}
+	return nil
+}
+
+func (d *Netdev) SetSockOpt(sockfd int, level int, opt int, value interface{}) error {
+	_, err := d.socket(sockfd)
+	return err
+}
@@ -0,0 +1,184 @@
+package netdevtest
+
+import (
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"tinygo.org/x/drivers/netdev"
+	"tinygo.org/x/drivers/netlink"
+)
+
+var (
+	_ netdev.Netdever   = &Netdev{}
+	_ netlink.Netlinker = &Link{}
+)
+
+func TestTCP(t *testing.T) {
+	c := qt.New(t)
+	network := NewNetwork()
+	server := NewNetdev(network, netip.MustParseAddr("10.0.0.1"))
+	client := NewNetdev(network, netip.MustParseAddr("10.0.0.2"))
+	network.AddHost("server", netip.MustParseAddr("10.0.0.1"))
+
+	lfd, err := server.Socket(netdev.AF_INET, netdev.SOCK_STREAM, netdev.IPPROTO_TCP)
+	c.Assert(err, qt.IsNil)
+	c.Assert(server.Bind(lfd, netip.MustParseAddrPort("0.0.0.0:80")), qt.IsNil)
+	c.Assert(server.Listen(lfd, 1), qt.IsNil)
+
+	ip, err := client.GetHostByName("server")
+	c.Assert(err, qt.IsNil)
+	fd, err := client.Socket(netdev.AF_INET, netdev.SOCK_STREAM, netdev.IPPROTO_TCP)
+	c.Assert(err, qt.IsNil)
+	c.Assert(client.Connect(fd, "server", netip.AddrPortFrom(ip, 80)), qt.IsNil)
+
+	sfd, raddr, err := server.Accept(lfd)
+	c.Assert(err, qt.IsNil)
+	c.Assert(raddr.Addr(), qt.Equals, netip.MustParseAddr("10.0.0.2"))
+
+	n, err := client.Send(fd, []byte("hello, "), 0, time.Time{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(n, qt.Equals, 7)
+	client.Send(fd, []byte("world"), 0, time.Time{})
+
+	buf := make([]byte, 64)
+	n, err = server.Recv(sfd, buf, 0, time.Now().Add(time.Second))
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(buf[:n]), qt.Equals, "hello, world")
+
+	// Nothing left to read
+	_, err = server.Recv(sfd, buf, 0, time.Now().Add(10*time.Millisecond))
+	c.Assert(err, qt.Equals, netdev.ErrTimeout)
+
+	// The server reads EOF once the client closed the connection
+	c.Assert(client.Close(fd), qt.IsNil)
+	_, err = server.Recv(sfd, buf, 0, time.Time{})
+	c.Assert(err, qt.Equals, io.EOF)
+	c.Assert(server.Close(sfd), qt.IsNil)
+
+	// Nobody listening anymore
+	c.Assert(server.Close(lfd), qt.IsNil)
+	fd, _ = client.Socket(netdev.AF_INET, netdev.SOCK_STREAM, netdev.IPPROTO_TCP)
+	c.Assert(client.Connect(fd, "", netip.MustParseAddrPort("10.0.0.1:80")), qt.Equals, ErrConnRefused)
+}
+
+func TestUDP(t *testing.T) {
+	c := qt.New(t)
+	dev := NewNetdev(NewNetwork(), netip.MustParseAddr("10.0.0.1"))
+
+	rfd, _ := dev.Socket(netdev.AF_INET, netdev.SOCK_DGRAM, netdev.IPPROTO_UDP)
+	c.Assert(dev.Bind(rfd, netip.MustParseAddrPort("0.0.0.0:123")), qt.IsNil)
+
+	fd, _ := dev.Socket(netdev.AF_INET, netdev.SOCK_DGRAM, netdev.IPPROTO_UDP)
+	c.Assert(dev.Connect(fd, "", netip.MustParseAddrPort("127.0.0.1:123")), qt.IsNil)
+	dev.Send(fd, []byte("first"), 0, time.Time{})
+	dev.Send(fd, []byte("second"), 0, time.Time{})
+
+	// Datagram boundaries are kept
+	buf := make([]byte, 64)
+	n, err := dev.Recv(rfd, buf, 0, time.Time{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(buf[:n]), qt.Equals, "first")
+	n, err = dev.Recv(rfd, buf, 0, time.Time{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(buf[:n]), qt.Equals, "second")
+}
+
+func TestBridge(t *testing.T) {
+	c := qt.New(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, qt.IsNil)
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			io.Copy(conn, conn)
+			conn.Close()
+		}
+	}()
+
+	dev := NewNetdev(NewNetwork(), netip.MustParseAddr("10.0.0.1"))
+	fd, _ := dev.Socket(netdev.AF_INET, netdev.SOCK_STREAM, netdev.IPPROTO_TCP)
+	addr := netip.MustParseAddrPort(l.Addr().String())
+	c.Assert(dev.Connect(fd, "", addr), qt.Equals, ErrConnRefused)
+
+	dev.Bridge = true
+	c.Assert(dev.Connect(fd, "", addr), qt.IsNil)
+	dev.Send(fd, []byte("echo"), 0, time.Time{})
+	buf := make([]byte, 4)
+	n, err := dev.Recv(fd, buf, 0, time.Now().Add(time.Second))
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(buf[:n]), qt.Equals, "echo")
+	c.Assert(dev.Close(fd), qt.IsNil)
+}
+
+func TestConnectClosingListener(t *testing.T) {
+	c := qt.New(t)
+	network := NewNetwork()
+	server := NewNetdev(network, netip.MustParseAddr("10.0.0.1"))
+	client := NewNetdev(network, netip.MustParseAddr("10.0.0.2"))
+	addr := netip.MustParseAddrPort("10.0.0.1:80")
+
+	// Connecting while the listener closes is refused or reset, it never
+	// sends on the closed backlog
+	for i := 0; i < 1000; i++ {
+		lfd, err := server.Socket(netdev.AF_INET, netdev.SOCK_STREAM, netdev.IPPROTO_TCP)
+		c.Assert(err, qt.IsNil)
+		c.Assert(server.Bind(lfd, addr), qt.IsNil)
+		c.Assert(server.Listen(lfd, 1), qt.IsNil)
+
+		fd, err := client.Socket(netdev.AF_INET, netdev.SOCK_STREAM, netdev.IPPROTO_TCP)
+		c.Assert(err, qt.IsNil)
+		ready, done := make(chan bool), make(chan error)
+		go func() {
+			ready <- true
+			done <- client.Connect(fd, "", addr)
+		}()
+		<-ready
+		c.Assert(server.Close(lfd), qt.IsNil)
+		if err := <-done; err != nil {
+			c.Assert(err, qt.Equals, ErrConnRefused)
+		}
+		c.Assert(client.Close(fd), qt.IsNil)
+	}
+}
+
+func TestLink(t *testing.T) {
+	c := qt.New(t)
+	link := NewLink()
+	link.Networks = []netlink.ScanResult{{Ssid: "home", Rssi: -50}}
+
+	var events []netlink.Event
+	link.NetNotify(func(e netlink.Event) { events = append(events, e) })
+
+	c.Assert(link.NetConnect(&netlink.ConnectParams{Ssid: "office"}), qt.Equals, netlink.ErrConnectFailed)
+	link.ConnectErr = netlink.ErrAuthFailure
+	c.Assert(link.NetConnect(&netlink.ConnectParams{Ssid: "home"}), qt.Equals, netlink.ErrAuthFailure)
+	link.ConnectErr = nil
+	c.Assert(link.NetConnect(&netlink.ConnectParams{Ssid: "home"}), qt.IsNil)
+	c.Assert(link.Up(), qt.IsTrue)
+
+	link.LinkDown()
+	_, err := link.GetLinkStatus()
+	c.Assert(err, qt.Equals, netlink.ErrNotConnected)
+	link.LinkUp()
+	link.NetDisconnect()
+
+	c.Assert(events, qt.DeepEquals, []netlink.Event{
+		netlink.EventConnecting, netlink.EventNoAP,
+		netlink.EventConnecting, netlink.EventAuthFailure,
+		netlink.EventConnecting, netlink.EventDHCPBound, netlink.EventNetUp,
+		netlink.EventNetDown,
+		netlink.EventDHCPBound, netlink.EventNetUp,
+		netlink.EventNetDown,
+	})
+
+	// Wired links connect without SSID
+	c.Assert(link.NetConnect(&netlink.ConnectParams{}), qt.Equals, netlink.ErrMissingSSID)
+	link = NewLink()
+	link.Ethernet = true
+	c.Assert(link.NetConnect(&netlink.ConnectParams{}), qt.IsNil)
+}
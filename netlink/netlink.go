@@ -5,6 +5,7 @@ package netlink
 import (
 	"errors"
 	"net"
+	"net/netip"
 	"time"
 )
 
@@ -18,18 +19,51 @@ var (
 	ErrAuthTypeNoGood    = errors.New("Wifi authorization type not supported")
 	ErrConnectModeNoGood = errors.New("Connect mode not supported")
 	ErrNotSupported      = errors.New("Not supported")
+	ErrNotConnected      = errors.New("Not connected")
 )
 
 type Event int
 
-// Network events
+// Network events.  When the connection comes up, EventDHCPBound and
+// EventIPChanged are notified first, and EventNetUp last, once the device's
+// IP configuration is complete and the network can be used.
 const (
 	// The device's network connection is now UP
 	EventNetUp Event = iota
 	// The device's network connection is now DOWN
 	EventNetDown
+	// The device is connecting to the network
+	EventConnecting
+	// The connection failed, the network rejected the credentials
+	EventAuthFailure
+	// The connection failed, the Wifi AP was not found
+	EventNoAP
+	// The device's IP address was assigned by DHCP
+	EventDHCPBound
+	// The device's IP address changed after reconnecting
+	EventIPChanged
+	// The watchdog recovered the network connection
+	EventWatchdogRecovery
 )
 
+var eventNames = [...]string{
+	EventNetUp:            "NetUp",
+	EventNetDown:          "NetDown",
+	EventConnecting:       "Connecting",
+	EventAuthFailure:      "AuthFailure",
+	EventNoAP:             "NoAP",
+	EventDHCPBound:        "DHCPBound",
+	EventIPChanged:        "IPChanged",
+	EventWatchdogRecovery: "WatchdogRecovery",
+}
+
+func (e Event) String() string {
+	if e < 0 || int(e) >= len(eventNames) {
+		return "Unknown"
+	}
+	return eventNames[e]
+}
+
 type ConnectMode int
 
 // Connect modes
@@ -47,6 +81,7 @@ const (
 	AuthTypeOpen             // No authorization required (open)
 	AuthTypeWPA              // WPA authorization
 	AuthTypeWPA2Mixed        // WPA2/WPA mixed authorization
+	AuthTypeWEP              // WEP authorization (scan results only)
 )
 
 const DefaultConnectTimeout = 10 * time.Second
@@ -81,6 +116,59 @@ type ConnectParams struct {
 	// downed connection or hardware fault and try to recover the
 	// connection.  Set to zero to disable watchodog.
 	WatchdogTimeout time.Duration
+
+	// Static IPv4 address, netmask and gateway.  The default zero Addr
+	// means the address is assigned by DHCP.
+	Addr    netip.Addr
+	Netmask netip.Addr
+	Gateway netip.Addr
+
+	// DNS servers.  Empty means the DNS servers are assigned by DHCP.
+	DNS []netip.Addr
+
+	// Hostname of the device, sent to the DHCP server
+	Hostname string
+}
+
+// ScanResult describes a Wifi access point found by NetScan
+type ScanResult struct {
+
+	// SSID of Wifi AP
+	Ssid string
+
+	// BSSID (MAC address) of Wifi AP
+	Bssid net.HardwareAddr
+
+	// Received signal strength in dBm
+	Rssi int
+
+	// Wifi channel
+	Channel int
+
+	// Wifi authorization type
+	AuthType
+}
+
+// LinkStatus describes the device's current network connection.  Fields
+// not reported by a device are left zero.
+type LinkStatus struct {
+
+	// Received signal strength in dBm
+	Rssi int
+
+	// Wifi channel
+	Channel int
+
+	// BSSID (MAC address) of Wifi AP
+	Bssid net.HardwareAddr
+
+	// IP address, netmask and gateway
+	Addr    netip.Addr
+	Netmask netip.Addr
+	Gateway netip.Addr
+
+	// DNS servers
+	DNS []netip.Addr
 }
 
 // Netlinker is TinyGo's OSI L2 data link layer interface.  Network device
@@ -100,3 +188,21 @@ type Netlinker interface {
 	// GetHardwareAddr returns device MAC address
 	GetHardwareAddr() (net.HardwareAddr, error)
 }
+
+// Scanner is implemented by the netlinks able to scan for Wifi access
+// points.  Check for it with a type assertion on the Netlinker.
+
+type Scanner interface {
+
+	// NetScan scans for nearby Wifi access points
+	NetScan() ([]ScanResult, error)
+}
+
+// LinkStatuser is implemented by the netlinks reporting the status of their
+// network connection.  Check for it with a type assertion on the Netlinker.
+
+type LinkStatuser interface {
+
+	// GetLinkStatus returns the status of the network connection
+	GetLinkStatus() (LinkStatus, error)
+}
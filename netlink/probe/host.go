@@ -0,0 +1,25 @@
+//go:build !tinygo
+
+package probe
+
+import (
+	"net/netip"
+
+	"tinygo.org/x/drivers/netdev"
+	"tinygo.org/x/drivers/netdev/netdevtest"
+	"tinygo.org/x/drivers/netlink"
+)
+
+// Probe for programs run on the host with "go run": the in-memory fakes of
+// netdevtest, bridged to the host's real sockets.  The standard library "net"
+// package doesn't use a Netdever on the host, so only the programs using the
+// Netdever directly go through the fake.
+func Probe() (netlink.Netlinker, netdev.Netdever) {
+
+	link := netdevtest.NewLink()
+	link.Ethernet = true
+	dev := netdevtest.NewNetdev(netdevtest.NewNetwork(), netip.MustParseAddr("127.0.0.1"))
+	dev.Bridge = true
+
+	return link, dev
+}
@@ -0,0 +1,34 @@
+//go:build pico && w5500
+
+package probe
+
+import (
+	"machine"
+
+	"tinygo.org/x/drivers/netdev"
+	"tinygo.org/x/drivers/netlink"
+	"tinygo.org/x/drivers/w5500"
+)
+
+// Probe for the WIZnet W5500-EVB-Pico, a pico with a W5500 wired to SPI0
+func Probe() (netlink.Netlinker, netdev.Netdever) {
+
+	spi := machine.SPI0
+	spi.Configure(machine.SPIConfig{
+		Frequency: 33 * 1e6,
+		SDO:       machine.GP19,
+		SDI:       machine.GP16,
+		SCK:       machine.GP18,
+	})
+
+	cfg := w5500.Config{
+		Spi:   spi,
+		Cs:    machine.GP17,
+		Reset: machine.GP20,
+	}
+
+	eth := w5500.New(&cfg)
+	netdev.UseNetdev(eth)
+
+	return eth, eth
+}
@@ -13,6 +13,8 @@ type Device struct {
 	Address uint8
 }
 
+var _ drivers.RTC = (*Device)(nil)
+
 func New(i2c drivers.I2C) Device {
 	return Device{
 		bus:     i2c,
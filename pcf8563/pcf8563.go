@@ -17,6 +17,8 @@ type Device struct {
 	Address uint16
 }
 
+var _ drivers.RTC = (*Device)(nil)
+
 // New creates a new PCF8563 connection. I2C bus must be already configured.
 func New(i2c drivers.I2C) Device {
 	return Device{
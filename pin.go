@@ -0,0 +1,43 @@
+package drivers
+
+// PinMode is the mode of a GPIO pin.
+type PinMode uint8
+
+const (
+	PinOutput PinMode = iota
+	PinInput
+	PinInputPullup
+)
+
+// PinChange is the change of a GPIO pin level that triggers an interrupt.
+type PinChange uint8
+
+const (
+	PinRising PinChange = 1 << iota
+	PinFalling
+	PinToggle = PinRising | PinFalling
+)
+
+// Pin is a GPIO pin. The machine.Pin type is adapted to it by the pin.Pin
+// type, so drivers taking a Pin can be tested with the tester.Pin mock.
+type Pin interface {
+	// Configure configures the pin as an input or an output.
+	Configure(mode PinMode)
+
+	// Set sets the level of an output pin, high if true.
+	Set(high bool)
+
+	// Get returns the level of the pin, high if true.
+	Get() bool
+}
+
+// PinInterrupter is a Pin that calls a callback when the level of the pin
+// changes.
+type PinInterrupter interface {
+	Pin
+
+	// SetInterrupt sets the callback called on the given pin changes, from
+	// the interrupt handler.  A zero change or a nil callback disables the
+	// interrupt.
+	SetInterrupt(change PinChange, callback func(Pin)) error
+}
@@ -0,0 +1,32 @@
+//go:build tinygo && (rp2040 || stm32 || k210 || esp32c3 || nrf || (avr && (atmega328p || atmega328pb)))
+
+// Note: build constraints in this file list targets that define machine.PinToggle.
+
+package pin
+
+import (
+	"machine"
+
+	"tinygo.org/x/drivers"
+)
+
+// SetInterrupt implements drivers.PinInterrupter.SetInterrupt.
+func (p Pin) SetInterrupt(change drivers.PinChange, callback func(drivers.Pin)) error {
+	var c machine.PinChange
+	switch change {
+	case drivers.PinRising:
+		c = machine.PinRising
+	case drivers.PinFalling:
+		c = machine.PinFalling
+	case drivers.PinToggle:
+		c = machine.PinToggle
+	default:
+		return machine.Pin(p).SetInterrupt(0, nil)
+	}
+	if callback == nil {
+		return machine.Pin(p).SetInterrupt(0, nil)
+	}
+	return machine.Pin(p).SetInterrupt(c, func(machine.Pin) {
+		callback(p)
+	})
+}
@@ -0,0 +1,38 @@
+// Package pin adapts machine.Pin to the drivers.Pin interface, for the drivers
+// that take a drivers.Pin:
+//
+//	sensor := hcsr04.NewPins(pin.Pin(machine.D10), pin.Pin(machine.D9))
+package pin // import "tinygo.org/x/drivers/pin"
+
+import (
+	"machine"
+
+	"tinygo.org/x/drivers"
+)
+
+// Pin is a machine.Pin implementing drivers.Pin.
+type Pin machine.Pin
+
+// Configure implements drivers.Pin.Configure.
+func (p Pin) Configure(mode drivers.PinMode) {
+	var m machine.PinMode
+	switch mode {
+	case drivers.PinOutput:
+		m = machine.PinOutput
+	case drivers.PinInput:
+		m = machine.PinInput
+	case drivers.PinInputPullup:
+		m = machine.PinInputPullup
+	}
+	machine.Pin(p).Configure(machine.PinConfig{Mode: m})
+}
+
+// Set implements drivers.Pin.Set.
+func (p Pin) Set(high bool) {
+	machine.Pin(p).Set(high)
+}
+
+// Get implements drivers.Pin.Get.
+func (p Pin) Get() bool {
+	return machine.Pin(p).Get()
+}
@@ -0,0 +1,389 @@
+package rtl8720dn
+
+// Bluetooth LE through the rtl8720dn BLE host stack.  The rtl8720dn has no
+// HCI interface, instead the GAP functions are called over the same eRPC
+// link as the Wifi functions, and the rtl8720dn calls back with GAP events.
+//
+// Constants from the Realtek BLE SDK headers (gap_adv.h, gap_scan.h,
+// gap_msg.h, gap_callback_le.h):
+// https://github.com/Seeed-Studio/seeed-ambd-firmware
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// T_LE_ADV_PARAM_TYPE
+	GAP_PARAM_ADV_DATA         = 0x261
+	GAP_PARAM_SCAN_RSP_DATA    = 0x262
+	GAP_PARAM_ADV_INTERVAL_MIN = 0x268
+	GAP_PARAM_ADV_INTERVAL_MAX = 0x269
+
+	// T_LE_SCAN_PARAM_TYPE
+	GAP_PARAM_SCAN_MODE              = 0x241
+	GAP_PARAM_SCAN_INTERVAL          = 0x242
+	GAP_PARAM_SCAN_WINDOW            = 0x243
+	GAP_PARAM_SCAN_FILTER_DUPLICATES = 0x245
+
+	GAP_SCAN_MODE_ACTIVE             = 1
+	GAP_SCAN_FILTER_DUPLICATE_ENABLE = 1
+
+	GAP_PHYS_CONN_INIT_1M_BIT = 0x01
+	GAP_LOCAL_ADDR_LE_PUBLIC  = 0x00
+
+	// T_IO_MSG subtypes, passed to rpc_ble_handle_gap_msg
+	GAP_MSG_LE_CONN_STATE_CHANGE = 0x02
+
+	// T_GAP_CONN_STATE
+	GAP_CONN_STATE_DISCONNECTED = 0
+	GAP_CONN_STATE_CONNECTED    = 2
+
+	// Callback types, passed to rpc_ble_gap_callback
+	GAP_MSG_LE_SCAN_INFO = 0x30
+
+	GAP_CAUSE_SUCCESS = 0
+
+	// eRPC service of the callbacks from the rtl8720dn
+	bleCallbackService = 0x0D
+	bleHandleGapMsg    = 0x01
+	bleGapCallback     = 0x02
+
+	// Advertising and scan intervals are in 0.625ms units
+	bleIntervalUnit = 625 * time.Microsecond
+
+	bleConnectTimeout = 1000 // in 10ms units
+
+	// Maximum number of BLE events waiting for BLEPoll, the events received
+	// beyond it are dropped
+	bleMaxPending = 16
+)
+
+var (
+	ErrBLENotStarted = errors.New("rtl8720dn: BLE not started")
+	ErrBLEFailed     = errors.New("rtl8720dn: BLE operation failed")
+)
+
+// BLEAddress is a Bluetooth device address, least significant byte first as
+// sent over the air
+type BLEAddress [6]byte
+
+func (a BLEAddress) String() string {
+	return fmt.Sprintf("%02X:%02X:%02X:%02X:%02X:%02X",
+		a[5], a[4], a[3], a[2], a[1], a[0])
+}
+
+// BLEScanResult is an advertising report received while scanning
+type BLEScanResult struct {
+	Address     BLEAddress
+	AddressType uint8
+	AdvType     uint8
+	RSSI        int8
+	Data        []byte
+}
+
+// BLEConnEvent reports a change of state of a BLE connection
+type BLEConnEvent struct {
+	ConnID    uint8
+	Connected bool
+	// Disconnection reason, as a HCI error code
+	Cause uint16
+}
+
+type bleState struct {
+	started bool
+	scanCb  func(BLEScanResult)
+	connCb  func(BLEConnEvent)
+	// callbacks of the events received while holding r.mu, called by
+	// BLEPoll once released
+	pending []func()
+}
+
+func (b *bleState) queue(cb func()) {
+	if len(b.pending) < bleMaxPending {
+		b.pending = append(b.pending, cb)
+	}
+}
+
+// BLEStart starts the BLE host stack on the rtl8720dn.  If the Wifi is not
+// connected the rtl8720dn is reset first; BLE can be started before or after
+// NetConnect, but NetConnect resets the rtl8720dn so BLE must be restarted
+// after it.
+func (r *rtl8720dn) BLEStart() error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ble.started {
+		return nil
+	}
+
+	if !r.netConnected {
+		if err := r.reset(); err != nil {
+			return err
+		}
+	}
+
+	if !r.rpc_ble_init() {
+		return ErrBLEFailed
+	}
+	r.rpc_ble_start()
+
+	r.ble.started = true
+	return nil
+}
+
+// BLEStop stops the BLE host stack
+func (r *rtl8720dn) BLEStop() {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.ble.started {
+		return
+	}
+
+	r.rpc_ble_deinit()
+	r.ble = bleState{}
+}
+
+// BLEAdvertise starts advertising advData, answering scan requests with
+// scanRsp, every interval
+func (r *rtl8720dn) BLEAdvertise(advData, scanRsp []byte, interval time.Duration) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.ble.started {
+		return ErrBLENotStarted
+	}
+
+	var units [2]byte
+	binary.LittleEndian.PutUint16(units[:], uint16(interval/bleIntervalUnit))
+
+	if r.rpc_le_adv_set_param(GAP_PARAM_ADV_DATA, advData) != GAP_CAUSE_SUCCESS ||
+		r.rpc_le_adv_set_param(GAP_PARAM_SCAN_RSP_DATA, scanRsp) != GAP_CAUSE_SUCCESS ||
+		r.rpc_le_adv_set_param(GAP_PARAM_ADV_INTERVAL_MIN, units[:]) != GAP_CAUSE_SUCCESS ||
+		r.rpc_le_adv_set_param(GAP_PARAM_ADV_INTERVAL_MAX, units[:]) != GAP_CAUSE_SUCCESS {
+		return ErrBLEFailed
+	}
+
+	if r.rpc_le_adv_start() != GAP_CAUSE_SUCCESS {
+		return ErrBLEFailed
+	}
+	return nil
+}
+
+// BLEStopAdvertising stops advertising
+func (r *rtl8720dn) BLEStopAdvertising() error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.ble.started {
+		return ErrBLENotStarted
+	}
+
+	if r.rpc_le_adv_stop() != GAP_CAUSE_SUCCESS {
+		return ErrBLEFailed
+	}
+	return nil
+}
+
+// BLEScan starts an active scan, calling cb for each advertising report.
+// The reports received by any rtl8720dn call are delivered from BLEPoll.
+func (r *rtl8720dn) BLEScan(cb func(BLEScanResult)) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.ble.started {
+		return ErrBLENotStarted
+	}
+
+	mode := []byte{GAP_SCAN_MODE_ACTIVE}
+	dups := []byte{GAP_SCAN_FILTER_DUPLICATE_ENABLE}
+	if r.rpc_le_scan_set_param(GAP_PARAM_SCAN_MODE, mode) != GAP_CAUSE_SUCCESS ||
+		r.rpc_le_scan_set_param(GAP_PARAM_SCAN_FILTER_DUPLICATES, dups) != GAP_CAUSE_SUCCESS {
+		return ErrBLEFailed
+	}
+
+	r.ble.scanCb = cb
+	if r.rpc_le_scan_start() != GAP_CAUSE_SUCCESS {
+		r.ble.scanCb = nil
+		return ErrBLEFailed
+	}
+	return nil
+}
+
+// BLEStopScan stops scanning
+func (r *rtl8720dn) BLEStopScan() error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.ble.started {
+		return ErrBLENotStarted
+	}
+
+	r.ble.scanCb = nil
+	if r.rpc_le_scan_stop() != GAP_CAUSE_SUCCESS {
+		return ErrBLEFailed
+	}
+	return nil
+}
+
+// BLENotify sets the callback for BLE connection events
+func (r *rtl8720dn) BLENotify(cb func(BLEConnEvent)) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ble.connCb = cb
+}
+
+// BLEConnect starts connecting to the peripheral at addr.  The outcome is
+// reported to the BLENotify callback.
+func (r *rtl8720dn) BLEConnect(addr BLEAddress, addrType uint8) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.ble.started {
+		return ErrBLENotStarted
+	}
+
+	if r.rpc_le_connect(GAP_PHYS_CONN_INIT_1M_BIT, addr[:],
+		RPC_T_GAP_REMOTE_ADDR_TYPE(addrType), GAP_LOCAL_ADDR_LE_PUBLIC,
+		bleConnectTimeout) != GAP_CAUSE_SUCCESS {
+		return ErrBLEFailed
+	}
+	return nil
+}
+
+// BLEDisconnect disconnects the BLE connection connID
+func (r *rtl8720dn) BLEDisconnect(connID uint8) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.ble.started {
+		return ErrBLENotStarted
+	}
+
+	if r.rpc_le_disconnect(connID) != GAP_CAUSE_SUCCESS {
+		return ErrBLEFailed
+	}
+	return nil
+}
+
+// BLEPoll handles the BLE callbacks received from the rtl8720dn, and calls
+// the scan and connection callbacks of the events received since the last
+// BLEPoll.  Call it regularly while scanning or connecting.  The callbacks
+// are called without holding the rtl8720dn lock, they can call the other
+// rtl8720dn functions.
+func (r *rtl8720dn) BLEPoll() {
+
+	r.mu.Lock()
+
+	if !r.ble.started {
+		r.mu.Unlock()
+		return
+	}
+
+	for r.uart.Buffered() > 0 {
+		if r.readMessage() && r.isBLECallback() {
+			r.handleBLECallback()
+		}
+	}
+
+	pending := r.ble.pending
+	r.ble.pending = nil
+	r.mu.Unlock()
+
+	for _, cb := range pending {
+		cb()
+	}
+}
+
+// isBLECallback reports whether the message in payload is a call from the
+// rtl8720dn to one of the BLE callbacks
+func (r *rtl8720dn) isBLECallback() bool {
+	return payload[0] == 0x00 && payload[2] == bleCallbackService
+}
+
+// handleBLECallback dispatches the BLE callback in payload and replies to it
+func (r *rtl8720dn) handleBLECallback() {
+	request := payload[1]
+	seq := binary.LittleEndian.Uint32(payload[4:])
+
+	switch request {
+	case bleHandleGapMsg:
+		// gap_msg : in []byte, a T_IO_MSG
+		if l := binary.LittleEndian.Uint32(payload[8:]); 12+l <= uint32(len(payload)) {
+			r.handleGapMsg(payload[12 : 12+l])
+		}
+	case bleGapCallback:
+		// cb_type : in uint8, cb_data : in []byte
+		if l := binary.LittleEndian.Uint32(payload[9:]); 13+l <= uint32(len(payload)) {
+			r.handleGapCallback(payload[8], payload[13:13+l])
+		}
+	}
+
+	// Reply with APP_RESULT_SUCCESS
+	msg := startWriteMessage(0x02, bleCallbackService, uint32(request), seq)
+	msg = append(msg, 0, 0, 0, 0)
+	r.performRequest(msg)
+}
+
+func (r *rtl8720dn) handleGapMsg(msg []byte) {
+	// T_IO_MSG: type, subtype, and the message data in param
+	if len(msg) < 8 {
+		return
+	}
+	subtype := binary.LittleEndian.Uint16(msg[2:])
+	switch subtype {
+	case GAP_MSG_LE_CONN_STATE_CHANGE:
+		// conn_id, new_state, disc_cause
+		event := BLEConnEvent{
+			ConnID: msg[4],
+			Cause:  binary.LittleEndian.Uint16(msg[6:]),
+		}
+		switch msg[5] {
+		case GAP_CONN_STATE_CONNECTED:
+			event.Connected = true
+		case GAP_CONN_STATE_DISCONNECTED:
+		default:
+			return
+		}
+		if cb := r.ble.connCb; cb != nil {
+			r.ble.queue(func() { cb(event) })
+		}
+	}
+}
+
+func (r *rtl8720dn) handleGapCallback(cbType uint8, data []byte) {
+	switch cbType {
+	case GAP_MSG_LE_SCAN_INFO:
+		// T_LE_SCAN_INFO: bd_addr[6], remote_addr_type, adv_type, rssi,
+		// data_len, data[31]
+		if len(data) < 10 || r.ble.scanCb == nil {
+			return
+		}
+		result := BLEScanResult{
+			AddressType: data[6],
+			AdvType:     data[7],
+			RSSI:        int8(data[8]),
+		}
+		copy(result.Address[:], data[0:6])
+		l := int(data[9])
+		if l > len(data)-10 {
+			l = len(data) - 10
+		}
+		result.Data = append([]byte(nil), data[10:10+l]...)
+		cb := r.ble.scanCb
+		r.ble.queue(func() { cb(result) })
+	}
+}
@@ -65,35 +65,48 @@ func dumpHex(b []byte) {
 
 func (r *rtl8720dn) read() {
 	for {
-		n, _ := io.ReadFull(r.uart, readBuf[:4])
-		if n == 0 {
+		if !r.readMessage() {
 			continue
 		}
-
-		if r.debug {
-			fmt.Printf("rx : %2d : ", n)
-			dumpHex(readBuf[:n])
-			fmt.Printf("\r\n")
+		if r.isBLECallback() {
+			r.handleBLECallback()
+			continue
+		}
+		if payload[0] == 0x02 || payload[0] == 0x00 {
+			return
 		}
+	}
+}
 
-		length := uint16(readBuf[0]) + uint16(readBuf[1])<<8
-		crc := uint16(readBuf[2]) + uint16(readBuf[3])<<8
+// readMessage reads the next message from the rtl8720dn into payload
+func (r *rtl8720dn) readMessage() bool {
+	n, _ := io.ReadFull(r.uart, readBuf[:4])
+	if n == 0 {
+		return false
+	}
 
-		n, _ = io.ReadFull(r.uart, payload[:length])
-		if r.debug {
-			fmt.Printf("rx : %2d : ", length)
-			dumpHex(payload[0:n])
-			fmt.Printf("\r\n")
-		}
+	if r.debug {
+		fmt.Printf("rx : %2d : ", n)
+		dumpHex(readBuf[:n])
+		fmt.Printf("\r\n")
+	}
 
-		n = int(length)
+	length := uint16(readBuf[0]) + uint16(readBuf[1])<<8
+	crc := uint16(readBuf[2]) + uint16(readBuf[3])<<8
 
-		crcNew := computeCRC16(payload[:n])
-		if g, e := crcNew, crc; g != e {
-			fmt.Printf("err CRC16: got %04X want %04X\r\n", g, e)
-		}
-		if payload[0] == 0x02 || payload[0] == 0x00 {
-			return
-		}
+	n, _ = io.ReadFull(r.uart, payload[:length])
+	if r.debug {
+		fmt.Printf("rx : %2d : ", length)
+		dumpHex(payload[0:n])
+		fmt.Printf("\r\n")
 	}
+
+	n = int(length)
+
+	crcNew := computeCRC16(payload[:n])
+	if g, e := crcNew, crc; g != e {
+		fmt.Printf("err CRC16: got %04X want %04X\r\n", g, e)
+	}
+
+	return true
 }
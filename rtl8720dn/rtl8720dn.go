@@ -6,6 +6,8 @@
 package rtl8720dn // import "tinygo.org/x/drivers/rtl8720dn"
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -34,6 +36,29 @@ var (
 const (
 	O_NONBLOCK   = 1 // note: different value than syscall.O_NONBLOCK (0x800)
 	RTW_MODE_STA = 0x00000001
+
+	// wifi_ap_record_t auth modes
+	WIFI_AUTH_OPEN         = 0
+	WIFI_AUTH_WEP          = 1
+	WIFI_AUTH_WPA_PSK      = 2
+	WIFI_AUTH_WPA2_PSK     = 3
+	WIFI_AUTH_WPA_WPA2_PSK = 4
+
+	// rtw_connect_error_flag_t, as returned by rpc_wifi_get_last_error()
+	RTW_NONE_NETWORK           = 1
+	RTW_CONNECT_FAIL           = 2
+	RTW_WRONG_PASSWORD         = 3
+	RTW_4WAY_HANDSHAKE_TIMEOUT = 4
+	RTW_DHCP_FAIL              = 5
+	RTW_AUTH_FAIL              = 6
+
+	// tcpip_adapter_dns_type_t
+	TCPIP_ADAPTER_DNS_MAIN   = 0
+	TCPIP_ADAPTER_DNS_BACKUP = 1
+
+	apRecordSize   = 80 // sizeof(wifi_ap_record_t)
+	maxScanRecords = 20
+	scanTimeout    = 10 * time.Second
 )
 
 type sock int32
@@ -66,12 +91,17 @@ type rtl8720dn struct {
 
 	params *netlink.ConnectParams
 
+	// Last IP address assigned
+	ip netip.Addr
+
 	netConnected bool
 	driverShown  bool
 	deviceShown  bool
 
 	killWatchdog chan bool
 
+	ble bleState
+
 	// keyed by sock as returned by rpc_lwip_socket()
 	sockets map[sock]*socket
 }
@@ -110,6 +140,8 @@ func (r *rtl8720dn) connectToAP() error {
 		fmt.Printf("Connecting to Wifi SSID '%s'...", r.params.Ssid)
 	}
 
+	r.notify(netlink.EventConnecting)
+
 	// Start the connection process
 	securityType := uint32(0) // RTW_SECURITY_OPEN
 	if len(r.params.Passphrase) != 0 {
@@ -121,6 +153,12 @@ func (r *rtl8720dn) connectToAP() error {
 		if debugging(debugBasic) {
 			fmt.Printf("FAILED\r\n")
 		}
+		switch r.rpc_wifi_get_last_error() {
+		case RTW_NONE_NETWORK:
+			r.notify(netlink.EventNoAP)
+		case RTW_WRONG_PASSWORD, RTW_4WAY_HANDSHAKE_TIMEOUT, RTW_AUTH_FAIL:
+			r.notify(netlink.EventAuthFailure)
+		}
 		return netlink.ErrConnectFailed
 	}
 
@@ -128,11 +166,55 @@ func (r *rtl8720dn) connectToAP() error {
 		fmt.Printf("CONNECTED\r\n")
 	}
 
-	if r.notifyCb != nil {
-		r.notifyCb(netlink.EventNetUp)
+	return r.setIPConfig()
+}
+
+// setIPConfig applies the hostname and either starts the DHCP client or
+// sets the static IP configuration, followed by the DNS servers
+func (r *rtl8720dn) setIPConfig() error {
+	if r.params.Hostname != "" {
+		if result := r.rpc_tcpip_adapter_set_hostname(0, r.params.Hostname); result == -1 {
+			return errors.New("Error setting hostname")
+		}
 	}
 
-	return r.startDhcpc()
+	if r.params.Addr.IsValid() {
+		r.rpc_tcpip_adapter_dhcpc_stop(0)
+		var ip_info [12]byte
+		ip, netmask, gateway := as4(r.params.Addr), as4(r.params.Netmask), as4(r.params.Gateway)
+		copy(ip_info[0:4], ip[:])
+		copy(ip_info[4:8], netmask[:])
+		copy(ip_info[8:12], gateway[:])
+		if result := r.rpc_tcpip_adapter_set_ip_info(0, ip_info[:]); result == -1 {
+			return errors.New("Error setting IP address")
+		}
+	} else if err := r.startDhcpc(); err != nil {
+		return err
+	}
+
+	dnsTypes := []uint32{TCPIP_ADAPTER_DNS_MAIN, TCPIP_ADAPTER_DNS_BACKUP}
+	for i, addr := range r.params.DNS {
+		if i >= len(dnsTypes) {
+			break
+		}
+		// tcpip_adapter_dns_info_t, the IPv4 address comes first
+		var dns [20]byte
+		ip := as4(addr)
+		copy(dns[0:4], ip[:])
+		if result := r.rpc_tcpip_adapter_set_dns_info(0, dnsTypes[i], dns[:]); result == -1 {
+			return errors.New("Error setting DNS server")
+		}
+	}
+
+	return nil
+}
+
+// as4 returns the IPv4 address bytes, 0.0.0.0 if not set
+func as4(ip netip.Addr) (b [4]byte) {
+	if ip.Is4() {
+		b = ip.As4()
+	}
+	return
 }
 
 func (r *rtl8720dn) showDriver() {
@@ -169,7 +251,8 @@ func (r *rtl8720dn) setupUART() {
 		RX: r.cfg.Rx, BaudRate: r.cfg.Baudrate})
 }
 
-func (r *rtl8720dn) start() error {
+// reset resets the rtl8720dn, leaving it ready for RPC calls
+func (r *rtl8720dn) reset() error {
 	en := r.cfg.En
 	if en == 0 {
 		return fmt.Errorf("Must set Config.En")
@@ -179,7 +262,16 @@ func (r *rtl8720dn) start() error {
 	time.Sleep(100 * time.Millisecond)
 	en.High()
 	time.Sleep(1000 * time.Millisecond)
+	// The reset stopped BLE
+	r.ble.started, r.ble.scanCb = false, nil
 	r.setupUART()
+	return nil
+}
+
+func (r *rtl8720dn) start() error {
+	if err := r.reset(); err != nil {
+		return err
+	}
 	return r.initWifi()
 }
 
@@ -203,10 +295,14 @@ func (r *rtl8720dn) showDevice() {
 func (r *rtl8720dn) showIP() {
 	if debugging(debugBasic) {
 		ip, subnet, gateway, _ := r.getIP()
+		how := "Static"
+		if !r.params.Addr.IsValid() {
+			how = "DHCP-assigned"
+		}
 		fmt.Printf("\r\n")
-		fmt.Printf("DHCP-assigned IP         : %s\r\n", ip)
-		fmt.Printf("DHCP-assigned subnet     : %s\r\n", subnet)
-		fmt.Printf("DHCP-assigned gateway    : %s\r\n", gateway)
+		fmt.Printf("%-25s: %s\r\n", how+" IP", ip)
+		fmt.Printf("%-25s: %s\r\n", how+" subnet", subnet)
+		fmt.Printf("%-25s: %s\r\n", how+" gateway", gateway)
 		fmt.Printf("\r\n")
 	}
 }
@@ -228,10 +324,10 @@ func (r *rtl8720dn) watchdog() {
 				if debugging(debugBasic) {
 					fmt.Printf("Watchdog: Wifi NOT CONNECTED, trying again...\r\n")
 				}
-				if r.notifyCb != nil {
-					r.notifyCb(netlink.EventNetDown)
+				r.notify(netlink.EventNetDown)
+				if r.netConnect(false) == nil {
+					r.notify(netlink.EventWatchdogRecovery)
 				}
-				r.netConnect(false)
 			}
 			r.mu.Unlock()
 		}
@@ -261,6 +357,18 @@ func (r *rtl8720dn) netConnect(reset bool) error {
 	}
 
 	r.showIP()
+
+	if ip, _, _, err := r.getIP(); err == nil {
+		if !r.params.Addr.IsValid() {
+			r.notify(netlink.EventDHCPBound)
+		}
+		if r.ip.IsValid() && r.ip != ip {
+			r.notify(netlink.EventIPChanged)
+		}
+		r.ip = ip
+	}
+	r.notify(netlink.EventNetUp)
+
 	return nil
 }
 
@@ -273,6 +381,12 @@ func (r *rtl8720dn) NetConnect(params *netlink.ConnectParams) error {
 		return netlink.ErrConnected
 	}
 
+	for _, ip := range append([]netip.Addr{params.Addr, params.Netmask, params.Gateway}, params.DNS...) {
+		if ip.IsValid() && !ip.Is4() {
+			return netlink.ErrNotSupported
+		}
+	}
+
 	r.params = params
 
 	r.showDriver()
@@ -315,15 +429,40 @@ func (r *rtl8720dn) NetDisconnect() {
 		fmt.Printf("\r\nDisconnected from Wifi SSID '%s'\r\n\r\n", r.params.Ssid)
 	}
 
-	if r.notifyCb != nil {
-		r.notifyCb(netlink.EventNetDown)
-	}
+	r.notify(netlink.EventNetDown)
 }
 
 func (r *rtl8720dn) NetNotify(cb func(netlink.Event)) {
 	r.notifyCb = cb
 }
 
+func (r *rtl8720dn) notify(event netlink.Event) {
+	if r.notifyCb != nil {
+		r.notifyCb(event)
+	}
+}
+
+func (r *rtl8720dn) NetScan() ([]netlink.ScanResult, error) {
+
+	if debugging(debugNetdev) {
+		fmt.Printf("[NetScan]\r\n")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Bring up the device to scan if not connected
+	if !r.netConnected {
+		r.showDriver()
+		if err := r.start(); err != nil {
+			return nil, err
+		}
+		defer r.stop()
+	}
+
+	return r.scan()
+}
+
 func (r *rtl8720dn) GetHostByName(name string) (netip.Addr, error) {
 
 	if debugging(debugNetdev) {
@@ -362,6 +501,50 @@ func (r *rtl8720dn) GetHardwareAddr() (net.HardwareAddr, error) {
 	return net.HardwareAddr(addr), err
 }
 
+func (r *rtl8720dn) GetLinkStatus() (netlink.LinkStatus, error) {
+
+	if debugging(debugNetdev) {
+		fmt.Printf("[GetLinkStatus]\r\n")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.netConnected || r.networkDown() {
+		return netlink.LinkStatus{}, netlink.ErrNotConnected
+	}
+
+	var status netlink.LinkStatus
+	var err error
+
+	var rssi, channel int32
+	r.rpc_wifi_get_rssi(&rssi)
+	r.rpc_wifi_get_channel(&channel)
+	status.Rssi, status.Channel = int(rssi), int(channel)
+
+	var bssid [6]byte
+	r.rpc_wifi_get_ap_bssid(bssid[:])
+	status.Bssid = net.HardwareAddr(bssid[:])
+
+	status.Addr, status.Netmask, status.Gateway, err = r.getIP()
+	if err != nil {
+		return netlink.LinkStatus{}, err
+	}
+
+	for _, dnsType := range []uint32{TCPIP_ADAPTER_DNS_MAIN, TCPIP_ADAPTER_DNS_BACKUP} {
+		// tcpip_adapter_dns_info_t, the IPv4 address comes first
+		var dns [20]byte
+		if result := r.rpc_tcpip_adapter_get_dns_info(0, dnsType, dns[:]); result == -1 {
+			continue
+		}
+		if addr, _ := netip.AddrFromSlice(dns[0:4]); !addr.IsUnspecified() {
+			status.DNS = append(status.DNS, addr)
+		}
+	}
+
+	return status, nil
+}
+
 func (r *rtl8720dn) Addr() (netip.Addr, error) {
 
 	if debugging(debugNetdev) {
@@ -781,6 +964,103 @@ func (r *rtl8720dn) disconnect() error {
 	return nil
 }
 
+// scan starts a network scan, waits for it to complete and returns the
+// access point records found
+func (r *rtl8720dn) scan() ([]netlink.ScanResult, error) {
+	if result := r.rpc_wifi_scan_start(); result == -1 {
+		return nil, fmt.Errorf("Wifi scan failed")
+	}
+
+	start := time.Now()
+	for r.rpc_wifi_is_scaning() {
+		if time.Since(start) > scanTimeout {
+			return nil, fmt.Errorf("Wifi scan timed out")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	num := r.rpc_wifi_scan_get_ap_num()
+	if num > maxScanRecords {
+		num = maxScanRecords
+	}
+	if num == 0 {
+		return []netlink.ScanResult{}, nil
+	}
+
+	var records [maxScanRecords * apRecordSize]byte
+	if result := r.rpc_wifi_scan_get_ap_records(num, records[:]); result == -1 {
+		return nil, fmt.Errorf("Get Wifi scan records failed")
+	}
+
+	results := make([]netlink.ScanResult, 0, num)
+	for i := 0; i < int(num); i++ {
+		if result, ok := parseAPRecord(records[i*apRecordSize:]); ok {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// Layout of the wifi_ap_record_t scan records returned by the RTL8720DN
+// firmware, which keeps the ESP-IDF esp_wifi_types.h definition:
+//
+//	typedef struct {
+//	    uint8_t bssid[6];                    // 0
+//	    uint8_t ssid[33];                    // 6
+//	    uint8_t primary;                     // 39
+//	    wifi_second_chan_t second;           // 40, enum
+//	    int8_t  rssi;                        // 44
+//	    wifi_auth_mode_t authmode;           // 48, enum
+//	    wifi_cipher_type_t pairwise_cipher;  // 52
+//	    wifi_cipher_type_t group_cipher;     // 56
+//	    wifi_ant_t ant;                      // 60
+//	    uint32_t phy_11b:1, ... reserved:27; // 64
+//	    wifi_country_t country;              // 68, 12 bytes
+//	} wifi_ap_record_t;                      // 80 bytes
+const (
+	apRecordBssid    = 0
+	apRecordSsid     = 6
+	apRecordSsidLen  = 33
+	apRecordPrimary  = 39
+	apRecordRssi     = 44
+	apRecordAuthmode = 48
+)
+
+// parseAPRecord decodes a wifi_ap_record_t scan record, returning false if
+// the record is too short
+func parseAPRecord(rec []byte) (netlink.ScanResult, bool) {
+	if len(rec) < apRecordSize {
+		return netlink.ScanResult{}, false
+	}
+
+	ssid := rec[apRecordSsid : apRecordSsid+apRecordSsidLen]
+	if n := bytes.IndexByte(ssid, 0); n >= 0 {
+		ssid = ssid[:n]
+	}
+
+	var authType netlink.AuthType
+	switch binary.LittleEndian.Uint32(rec[apRecordAuthmode : apRecordAuthmode+4]) {
+	case WIFI_AUTH_OPEN:
+		authType = netlink.AuthTypeOpen
+	case WIFI_AUTH_WEP:
+		authType = netlink.AuthTypeWEP
+	case WIFI_AUTH_WPA_PSK:
+		authType = netlink.AuthTypeWPA
+	case WIFI_AUTH_WPA_WPA2_PSK:
+		authType = netlink.AuthTypeWPA2Mixed
+	default:
+		authType = netlink.AuthTypeWPA2
+	}
+
+	return netlink.ScanResult{
+		Ssid:     string(ssid),
+		Bssid:    append(net.HardwareAddr{}, rec[apRecordBssid:apRecordBssid+6]...),
+		Rssi:     int(int8(rec[apRecordRssi])),
+		Channel:  int(rec[apRecordPrimary]),
+		AuthType: authType,
+	}, true
+}
+
 func (r *rtl8720dn) getFwVersion() string {
 	return r.rpc_system_version()
 }
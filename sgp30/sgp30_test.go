@@ -0,0 +1,81 @@
+package sgp30
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"tinygo.org/x/drivers"
+	"tinygo.org/x/drivers/tester"
+)
+
+func TestUpdate(t *testing.T) {
+	c := qt.New(t)
+	bus := tester.NewI2CBus(c)
+	fdev := tester.NewI2CDeviceCmd(c, Address)
+	fdev.Commands = defaultCommands()
+	bus.AddDevice(fdev)
+
+	dev := New(bus)
+	c.Assert(dev.Configure(Config{}), qt.IsNil)
+	c.Assert(dev.Update(drivers.Concentration), qt.IsNil)
+	c.Assert(dev.CO2(), qt.Equals, uint32(400))
+	c.Assert(dev.TVOC(), qt.Equals, uint32(0))
+}
+
+func TestUpdateInvalidCRC(t *testing.T) {
+	c := qt.New(t)
+	bus := tester.NewI2CBus(c)
+	fdev := tester.NewI2CDeviceCmd(c, Address)
+	fdev.Commands = defaultCommands()
+	bus.AddDevice(fdev)
+
+	dev := New(bus)
+	c.Assert(dev.Configure(Config{}), qt.IsNil)
+
+	// Flip a bit of the TVOC word read
+	bus.Inject(tester.Fault{Tx: 2, Flip: []byte{0, 0, 0, 0, 0x04}})
+	c.Assert(dev.Update(drivers.Concentration), qt.Equals, errInvalidCRC)
+
+	c.Assert(dev.Update(drivers.Concentration), qt.IsNil)
+	c.Assert(dev.CO2(), qt.Equals, uint32(400))
+}
+
+func TestNack(t *testing.T) {
+	c := qt.New(t)
+	bus := tester.NewI2CBus(c)
+	fdev := tester.NewI2CDeviceCmd(c, Address)
+	fdev.Commands = defaultCommands()
+	bus.AddDevice(fdev)
+
+	dev := New(bus)
+	c.Assert(dev.Configure(Config{}), qt.IsNil)
+
+	bus.Inject(tester.Fault{Tx: 1, Addr: Address, Err: drivers.ErrNack})
+	c.Assert(dev.Update(drivers.Concentration), qt.Equals, drivers.ErrNack)
+}
+
+func TestNotConnected(t *testing.T) {
+	c := qt.New(t)
+	bus := tester.NewI2CBus(c)
+	bus.Inject(tester.Fault{Addr: Address, Err: drivers.ErrNack})
+
+	dev := New(bus)
+	c.Assert(dev.Connected(), qt.IsFalse)
+}
+
+func defaultCommands() map[uint8]*tester.Cmd {
+	return map[uint8]*tester.Cmd{
+		// sgp30_iaq_init
+		0: {
+			Command:  []byte{0x20, 0x03},
+			Mask:     []byte{0xff, 0xff},
+			Response: []byte{},
+		},
+		// sgp30_measure_iaq: 400 ppm CO₂eq and 0 ppb TVOC
+		1: {
+			Command:  []byte{0x20, 0x08},
+			Mask:     []byte{0xff, 0xff},
+			Response: []byte{0x01, 0x90, 0x4c, 0x00, 0x00, 0x81},
+		},
+	}
+}
@@ -0,0 +1,39 @@
+// Package sharedbus shares an I2C or SPI bus between the drivers of several
+// devices, called from several goroutines.
+//
+// I2C transactions are addressed, so sharing the bus only takes serializing
+// the transactions:
+//
+//	bus := sharedbus.NewI2C(machine.I2C0)
+//	sensor := bme280.New(bus)
+//	rtc := ds3231.New(bus)
+//
+// SPI devices are selected with their chip select pin, and may use different
+// clock settings: see SPI.
+package sharedbus // import "tinygo.org/x/drivers/sharedbus"
+
+import (
+	"sync"
+
+	"tinygo.org/x/drivers"
+)
+
+// I2C is an I2C bus serializing the transactions on the shared bus.
+type I2C struct {
+	mu  sync.Mutex
+	bus drivers.I2C
+}
+
+// NewI2C returns an I2C bus sharing bus.
+func NewI2C(bus drivers.I2C) *I2C {
+	return &I2C{
+		bus: bus,
+	}
+}
+
+// Tx implements drivers.I2C.Tx.
+func (i2c *I2C) Tx(addr uint16, w, r []byte) error {
+	i2c.mu.Lock()
+	defer i2c.mu.Unlock()
+	return i2c.bus.Tx(addr, w, r)
+}
@@ -0,0 +1,116 @@
+package sharedbus
+
+import (
+	"sync"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"tinygo.org/x/drivers"
+	"tinygo.org/x/drivers/tester"
+)
+
+func TestI2C(t *testing.T) {
+	c := qt.New(t)
+	mock := tester.NewI2CBus(c)
+	d1 := tester.NewI2CDevice8(c, 8)
+	d2 := tester.NewI2CDevice8(c, 9)
+	mock.AddDevice(d1)
+	mock.AddDevice(d2)
+	bus := NewI2C(mock)
+
+	var wg sync.WaitGroup
+	for _, addr := range []uint16{8, 9} {
+		wg.Add(1)
+		go func(addr uint16) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				bus.Tx(addr, []byte{byte(i), byte(addr)}, nil)
+			}
+		}(addr)
+	}
+	wg.Wait()
+	c.Assert(d1.Registers[99], qt.Equals, uint8(8))
+	c.Assert(d2.Registers[99], qt.Equals, uint8(9))
+}
+
+// newDevice returns a device on bus, selected on mock by its chip select pin.
+func newDevice(c *qt.C, bus *SPI, mock *tester.SPIBus, config SPIConfig) (*SPIDevice, *tester.SPIDevice8) {
+	dev := tester.NewSPIDevice8(c)
+	mock.AddDevice(dev)
+	cs := tester.NewPin(c)
+	d := bus.NewDevice(cs, config)
+	c.Assert(cs.Levels(), qt.DeepEquals, []bool{true})
+	cs.SetInterrupt(drivers.PinToggle, func(p drivers.Pin) {
+		if p.Get() {
+			mock.Deselect()
+		} else {
+			mock.Select(dev)
+		}
+	})
+	return d, dev
+}
+
+func TestSPI(t *testing.T) {
+	c := qt.New(t)
+	mock := tester.NewSPIBus(c)
+	var configs []SPIConfig
+	bus := NewSPI(mock, func(config SPIConfig) error {
+		configs = append(configs, config)
+		return nil
+	})
+	fast := SPIConfig{Frequency: 8e6}
+	slow := SPIConfig{Frequency: 1e6, Mode: 3}
+	d1, dev1 := newDevice(c, bus, mock, fast)
+	d2, dev2 := newDevice(c, bus, mock, slow)
+	dev1.Registers[3] = 0x12
+	dev1.Registers[4] = 0x34
+
+	// Transaction of a single call
+	c.Assert(d2.Tx([]byte{0x05, 0xaa}, nil), qt.IsNil)
+	c.Assert(dev2.Registers[5], qt.Equals, uint8(0xaa))
+
+	// Transaction of several calls
+	c.Assert(d1.Begin(), qt.IsNil)
+	_, err := d1.Transfer(0x83)
+	c.Assert(err, qt.IsNil)
+	buf := make([]byte, 2)
+	c.Assert(d1.Tx(nil, buf), qt.IsNil)
+	d1.End()
+	c.Assert(buf, qt.DeepEquals, []byte{0x12, 0x34})
+
+	// Same device, no configuration
+	c.Assert(d1.Tx([]byte{0x06, 0x55}, nil), qt.IsNil)
+
+	c.Assert(configs, qt.DeepEquals, []SPIConfig{slow, fast})
+	c.Assert(mock.Log, qt.DeepEquals, []tester.SPITransaction{
+		{W: []byte{0x05, 0xaa}, R: []byte{0, 0}},
+		{W: []byte{0x83, 0, 0}, R: []byte{0, 0x12, 0x34}},
+		{W: []byte{0x06, 0x55}, R: []byte{0, 0}},
+	})
+}
+
+func TestSPIConcurrent(t *testing.T) {
+	c := qt.New(t)
+	mock := tester.NewSPIBus(c)
+	bus := NewSPI(mock, nil)
+	d1, dev1 := newDevice(c, bus, mock, SPIConfig{})
+	d2, dev2 := newDevice(c, bus, mock, SPIConfig{})
+
+	var wg sync.WaitGroup
+	for _, d := range []*SPIDevice{d1, d2} {
+		wg.Add(1)
+		go func(d *SPIDevice) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				d.Begin()
+				d.Transfer(byte(i))
+				d.Transfer(byte(i))
+				d.End()
+			}
+		}(d)
+	}
+	wg.Wait()
+	c.Assert(dev1.Registers[99], qt.Equals, uint8(99))
+	c.Assert(dev2.Registers[99], qt.Equals, uint8(99))
+	c.Assert(mock.Log, qt.HasLen, 200)
+}
@@ -0,0 +1,139 @@
+package sharedbus
+
+import (
+	"sync"
+
+	"tinygo.org/x/drivers"
+)
+
+// SPIConfig is the clock configuration of an SPI device.
+type SPIConfig struct {
+	Frequency uint32
+	LSBFirst  bool
+	Mode      uint8
+}
+
+// SPI is an SPI bus shared by SPI devices, each with a chip select pin and a
+// clock configuration:
+//
+//	spi := machine.SPI0
+//	bus := sharedbus.NewSPI(spi, func(cfg sharedbus.SPIConfig) error {
+//		return spi.Configure(machine.SPIConfig{
+//			Frequency: cfg.Frequency,
+//			LSBFirst:  cfg.LSBFirst,
+//			Mode:      cfg.Mode,
+//			SCK:       machine.SPI0_SCK_PIN,
+//			SDO:       machine.SPI0_SDO_PIN,
+//			SDI:       machine.SPI0_SDI_PIN,
+//		})
+//	})
+//	can := bus.NewDevice(pin.Pin(machine.D5), sharedbus.SPIConfig{Frequency: 10e6})
+//	flash := bus.NewDevice(pin.Pin(machine.D6), sharedbus.SPIConfig{Frequency: 40e6, Mode: 3})
+type SPI struct {
+	mu        sync.Mutex
+	bus       drivers.SPI
+	configure func(SPIConfig) error
+
+	// config is the configuration of the bus, if configured.
+	config     SPIConfig
+	configured bool
+}
+
+// NewSPI returns an SPI bus sharing bus, calling configure to change the
+// clock configuration of bus for a device.  A nil configure leaves the bus
+// configuration as is.
+func NewSPI(bus drivers.SPI, configure func(SPIConfig) error) *SPI {
+	return &SPI{
+		bus:       bus,
+		configure: configure,
+	}
+}
+
+// SPIDevice is an SPI device on a shared SPI bus, implementing drivers.SPI.
+//
+// Each Tx or Transfer call is a transaction: the device locks the bus,
+// configures the clock for the device, and selects the device with its chip
+// select pin for the call.  Enclose the calls in Begin and End for a
+// transaction of several calls.
+//
+// Drivers setting the chip select pin themselves take the device without a
+// chip select pin: enclose the driver calls in Begin and End so that other
+// devices don't use the bus meanwhile.
+//
+// Like the driver using it, a device is used by one goroutine at a time.
+type SPIDevice struct {
+	spi    *SPI
+	cs     drivers.Pin
+	config SPIConfig
+
+	// active is set between Begin and End, while the device holds the bus.
+	active bool
+}
+
+// NewDevice returns a device on the shared bus, selected with the chip
+// select pin cs, active low, and using the clock configuration config.  A
+// nil cs leaves the chip select pin to the driver.
+func (spi *SPI) NewDevice(cs drivers.Pin, config SPIConfig) *SPIDevice {
+	if cs != nil {
+		cs.Configure(drivers.PinOutput)
+		cs.Set(true)
+	}
+	return &SPIDevice{
+		spi:    spi,
+		cs:     cs,
+		config: config,
+	}
+}
+
+// Begin begins a transaction: it locks the bus, configures the clock and
+// selects the device, until End.
+func (d *SPIDevice) Begin() error {
+	spi := d.spi
+	spi.mu.Lock()
+	if spi.configure != nil && (!spi.configured || spi.config != d.config) {
+		if err := spi.configure(d.config); err != nil {
+			spi.configured = false
+			spi.mu.Unlock()
+			return err
+		}
+		spi.config = d.config
+		spi.configured = true
+	}
+	if d.cs != nil {
+		d.cs.Set(false)
+	}
+	d.active = true
+	return nil
+}
+
+// End ends the transaction begun with Begin, deselecting the device and
+// unlocking the bus.
+func (d *SPIDevice) End() {
+	if d.cs != nil {
+		d.cs.Set(true)
+	}
+	d.active = false
+	d.spi.mu.Unlock()
+}
+
+// Tx implements drivers.SPI.Tx.
+func (d *SPIDevice) Tx(w, r []byte) error {
+	if !d.active {
+		if err := d.Begin(); err != nil {
+			return err
+		}
+		defer d.End()
+	}
+	return d.spi.bus.Tx(w, r)
+}
+
+// Transfer implements drivers.SPI.Transfer.
+func (d *SPIDevice) Transfer(b byte) (byte, error) {
+	if !d.active {
+		if err := d.Begin(); err != nil {
+			return 0, err
+		}
+		defer d.End()
+	}
+	return d.spi.bus.Transfer(b)
+}
@@ -2,7 +2,7 @@
 package shiftregister
 
 import (
-	"machine"
+	"tinygo.org/x/drivers"
 )
 
 type NumberBit int8
@@ -16,7 +16,7 @@ const (
 
 // Device holds pin number
 type Device struct {
-	latch, clock, out machine.Pin // IC wiring
+	latch, clock, out drivers.Pin // IC wiring
 	bits              NumberBit   // Pin number
 	mask              uint32      // keep all pins state
 }
@@ -28,8 +28,8 @@ type ShiftPin struct {
 	d    *Device // Reference to the register
 }
 
-// New returns a new shift output register device
-func New(Bits NumberBit, Latch, Clock, Out machine.Pin) *Device {
+// NewPins returns a new shift output register device
+func NewPins(Bits NumberBit, Latch, Clock, Out drivers.Pin) *Device {
 	return &Device{
 		latch: Latch,
 		clock: Clock,
@@ -40,24 +40,24 @@ func New(Bits NumberBit, Latch, Clock, Out machine.Pin) *Device {
 
 // Configure set hardware configuration
 func (d *Device) Configure() {
-	d.latch.Configure(machine.PinConfig{Mode: machine.PinOutput})
-	d.clock.Configure(machine.PinConfig{Mode: machine.PinOutput})
-	d.out.Configure(machine.PinConfig{Mode: machine.PinOutput})
-	d.latch.High()
+	d.latch.Configure(drivers.PinOutput)
+	d.clock.Configure(drivers.PinOutput)
+	d.out.Configure(drivers.PinOutput)
+	d.latch.Set(true)
 }
 
 // WriteMask applies mask's bits to register's outputs pin
 // mask's MSB set Q1, LSB set Q8 (for 8 bits mask)
 func (d *Device) WriteMask(mask uint32) {
 	d.mask = mask // Keep the mask for individual addressing
-	d.latch.Low()
+	d.latch.Set(false)
 	for i := 0; i < int(d.bits); i++ {
-		d.clock.Low()
+		d.clock.Set(false)
 		d.out.Set(mask&1 != 0)
 		mask = mask >> 1
-		d.clock.High()
+		d.clock.Set(true)
 	}
-	d.latch.High()
+	d.latch.Set(true)
 }
 
 // GetShiftPin return an individually addressable pin
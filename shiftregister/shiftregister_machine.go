@@ -0,0 +1,14 @@
+//go:build tinygo
+
+package shiftregister
+
+import (
+	"machine"
+
+	"tinygo.org/x/drivers/pin"
+)
+
+// New returns a new shift output register device
+func New(Bits NumberBit, Latch, Clock, Out machine.Pin) *Device {
+	return NewPins(Bits, pin.Pin(Latch), pin.Pin(Clock), pin.Pin(Out))
+}
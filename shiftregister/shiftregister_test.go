@@ -0,0 +1,33 @@
+package shiftregister
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"tinygo.org/x/drivers"
+	"tinygo.org/x/drivers/tester"
+)
+
+func TestWriteMask(t *testing.T) {
+	c := qt.New(t)
+	latch := tester.NewPin(c)
+	clock := tester.NewPin(c)
+	out := tester.NewPin(c)
+	d := NewPins(EIGHT_BITS, latch, clock, out)
+	d.Configure()
+
+	// Shift in the output level on the clock rising edges
+	var shifted []bool
+	clock.SetInterrupt(drivers.PinRising, func(drivers.Pin) {
+		shifted = append(shifted, out.Get())
+	})
+	latch.Log = nil
+
+	d.WriteMask(0b1000_1101)
+	c.Assert(shifted, qt.DeepEquals, []bool{true, false, true, true, false, false, false, true})
+	c.Assert(latch.Levels(), qt.DeepEquals, []bool{false, true})
+
+	shifted = nil
+	d.GetShiftPin(1).Set(true)
+	c.Assert(shifted, qt.DeepEquals, []bool{true, true, true, true, false, false, false, true})
+}
@@ -137,6 +137,7 @@ tinygo build -size short -o ./build/test.hex -target=pyportal -stack-size 8kb ./
 tinygo build -size short -o ./build/test.hex -target=arduino-nano33 -stack-size 8kb ./examples/net/tcpclient/
 tinygo build -size short -o ./build/test.hex -target=nano-rp2040 -stack-size 8kb ./examples/net/websocket/dial/
 tinygo build -size short -o ./build/test.hex -target=metro-m4-airlift -stack-size 8kb ./examples/net/socket/
+tinygo build -size short -o ./build/test.hex -target=wioterminal -stack-size 8kb ./examples/net/scan/
 tinygo build -size short -o ./build/test.hex -target=matrixportal-m4 -stack-size 8kb ./examples/net/webstatic/
 tinygo build -size short -o ./build/test.hex -target=arduino-mkrwifi1010 -stack-size 8kb ./examples/net/tlsclient/
 tinygo build -size short -o ./build/test.hex -target=nano-rp2040 -stack-size 8kb ./examples/net/mqttclient/natiu/
@@ -144,3 +145,6 @@ tinygo build -size short -o ./build/test.hex -target=nano-rp2040 -stack-size 8kb
 tinygo build -size short -o ./build/test.hex -target=wioterminal -stack-size 8kb ./examples/net/webclient/
 tinygo build -size short -o ./build/test.hex -target=wioterminal -stack-size 8kb ./examples/net/webserver/
 tinygo build -size short -o ./build/test.hex -target=wioterminal -stack-size 8kb ./examples/net/mqttclient/paho/
+# network examples (w5500)
+tinygo build -size short -o ./build/test.hex -target=pico -tags w5500 -stack-size 8kb ./examples/net/tcpclient/
+tinygo build -size short -o ./build/test.hex -target=pico -tags w5500 -stack-size 8kb ./examples/net/webserver/
@@ -0,0 +1,204 @@
+// Package sntp implements a Simple Network Time Protocol (SNTPv4) client on
+// top of any netdev.Netdever, to keep a real time clock disciplined over the
+// network.
+//
+// RFC 4330:
+// https://datatracker.ietf.org/doc/html/rfc4330
+package sntp // import "tinygo.org/x/drivers/sntp"
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"tinygo.org/x/drivers"
+	"tinygo.org/x/drivers/netdev"
+)
+
+const (
+	DefaultServer  = "pool.ntp.org:123"
+	DefaultTimeout = 5 * time.Second
+
+	packetSize = 48
+
+	version    = 4
+	modeClient = 3
+	modeServer = 4
+
+	leapUnsynchronized = 3
+
+	// Seconds from the NTP epoch, 1900, to the Unix epoch
+	unixEpoch = 2208988800
+)
+
+var (
+	ErrServer      = errors.New("sntp: invalid server address")
+	ErrResponse    = errors.New("sntp: invalid response")
+	ErrKissOfDeath = errors.New("sntp: server refused the request")
+	ErrNotSynced   = errors.New("sntp: server clock not synchronized")
+)
+
+// Response is the result of a time query
+type Response struct {
+	// Time is the server's time when the response was received
+	Time time.Time
+	// ClockOffset is the local clock's error: add it to time.Now() to get
+	// the server's time
+	ClockOffset time.Duration
+	// RTT is the round-trip delay to the server, less the server's
+	// processing time
+	RTT time.Duration
+	// Stratum of the server, 1 for primary servers
+	Stratum uint8
+}
+
+// Client queries an NTP server using a Netdever's UDP sockets
+type Client struct {
+	// Server is the NTP server, as host:port
+	Server string
+	// Timeout is the time to wait for the response
+	Timeout time.Duration
+
+	dev netdev.Netdever
+}
+
+// NewClient returns a client for the default server
+func NewClient(dev netdev.Netdever) *Client {
+	return &Client{
+		Server:  DefaultServer,
+		Timeout: DefaultTimeout,
+		dev:     dev,
+	}
+}
+
+// Query requests the time from the server, and computes the local clock
+// offset and the round-trip delay
+func (c *Client) Query() (Response, error) {
+	addr, err := c.resolve()
+	if err != nil {
+		return Response{}, err
+	}
+
+	fd, err := c.dev.Socket(netdev.AF_INET, netdev.SOCK_DGRAM, netdev.IPPROTO_UDP)
+	if err != nil {
+		return Response{}, err
+	}
+	defer c.dev.Close(fd)
+
+	host, _, _ := net.SplitHostPort(c.Server)
+	if err := c.dev.Connect(fd, host, addr); err != nil {
+		return Response{}, err
+	}
+
+	var req, rsp [packetSize]byte
+	req[0] = version<<3 | modeClient
+
+	deadline := time.Now().Add(c.Timeout)
+
+	// The transmit timestamp is echoed by the server in the originate
+	// timestamp, matching the response to the request
+	t1 := time.Now()
+	putTimestamp(req[40:], t1)
+	if _, err := c.dev.Send(fd, req[:], 0, deadline); err != nil {
+		return Response{}, err
+	}
+
+	for {
+		n, err := c.dev.Recv(fd, rsp[:], 0, deadline)
+		if err != nil {
+			return Response{}, err
+		}
+		t4 := time.Now()
+
+		if n < packetSize || binary.BigEndian.Uint64(rsp[24:]) != binary.BigEndian.Uint64(req[40:]) {
+			// Not the response to our request
+			continue
+		}
+
+		return parse(rsp[:], t1, t4)
+	}
+}
+
+func (c *Client) resolve() (netip.AddrPort, error) {
+	host, port, err := net.SplitHostPort(c.Server)
+	if err != nil {
+		return netip.AddrPort{}, ErrServer
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, ErrServer
+	}
+	ip, err := c.dev.GetHostByName(host)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	return netip.AddrPortFrom(ip, uint16(p)), nil
+}
+
+// parse checks the response received at t4 to a request sent at t1
+func parse(rsp []byte, t1, t4 time.Time) (Response, error) {
+	leap := rsp[0] >> 6
+	mode := rsp[0] & 0x07
+	stratum := rsp[1]
+
+	if mode != modeServer {
+		return Response{}, ErrResponse
+	}
+	if stratum == 0 {
+		return Response{}, ErrKissOfDeath
+	}
+	if leap == leapUnsynchronized || stratum > 15 {
+		return Response{}, ErrNotSynced
+	}
+	if binary.BigEndian.Uint64(rsp[40:]) == 0 {
+		return Response{}, ErrResponse
+	}
+
+	t2 := timestamp(rsp[32:])
+	t3 := timestamp(rsp[40:])
+
+	offset := (t2.Sub(t1) + t3.Sub(t4)) / 2
+	rtt := t4.Sub(t1) - t3.Sub(t2)
+	if rtt < 0 {
+		rtt = 0
+	}
+
+	return Response{
+		Time:        t4.Add(offset),
+		ClockOffset: offset,
+		RTT:         rtt,
+		Stratum:     stratum,
+	}, nil
+}
+
+// SetRTC queries the server and sets the real time clock to the server's
+// time
+func (c *Client) SetRTC(rtc drivers.RTC) (Response, error) {
+	rsp, err := c.Query()
+	if err != nil {
+		return rsp, err
+	}
+	return rsp, rtc.SetTime(time.Now().Add(rsp.ClockOffset))
+}
+
+// timestamp converts a 64-bit NTP timestamp.  Times with the seconds' high
+// bit clear are taken to be in NTP era 1, starting in 2036.
+func timestamp(b []byte) time.Time {
+	secs := int64(binary.BigEndian.Uint32(b[0:]))
+	frac := int64(binary.BigEndian.Uint32(b[4:]))
+	if secs&0x80000000 == 0 {
+		secs += 1 << 32
+	}
+	return time.Unix(secs-unixEpoch, (frac*1e9)>>32)
+}
+
+// putTimestamp writes t as a 64-bit NTP timestamp
+func putTimestamp(b []byte, t time.Time) {
+	secs := uint32(t.Unix() + unixEpoch)
+	frac := uint32((int64(t.Nanosecond()) << 32) / 1e9)
+	binary.BigEndian.PutUint32(b[0:], secs)
+	binary.BigEndian.PutUint32(b[4:], frac)
+}
@@ -0,0 +1,100 @@
+package sntp
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"tinygo.org/x/drivers/netdev/netdevtest"
+)
+
+// serve answers one request on conn, with the server's clock ahead by skew
+func serve(conn net.PacketConn, skew time.Duration, stratum uint8) {
+	var buf [packetSize]byte
+	n, addr, err := conn.ReadFrom(buf[:])
+	if err != nil || n != packetSize {
+		return
+	}
+	var rsp [packetSize]byte
+	rsp[0] = version<<3 | modeServer
+	rsp[1] = stratum
+	copy(rsp[24:32], buf[40:48])
+	putTimestamp(rsp[32:], time.Now().Add(skew))
+	time.Sleep(10 * time.Millisecond)
+	putTimestamp(rsp[40:], time.Now().Add(skew))
+	conn.WriteTo(rsp[:], addr)
+}
+
+func newClient(c *qt.C, skew time.Duration, stratum uint8) *Client {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, qt.IsNil)
+	c.Cleanup(func() { conn.Close() })
+	go serve(conn, skew, stratum)
+
+	dev := netdevtest.NewNetdev(netdevtest.NewNetwork(), netip.MustParseAddr("10.0.0.1"))
+	dev.Bridge = true
+	client := NewClient(dev)
+	client.Server = conn.LocalAddr().String()
+	client.Timeout = time.Second
+	return client
+}
+
+type rtc struct {
+	t time.Time
+}
+
+func (r *rtc) ReadTime() (time.Time, error) { return r.t, nil }
+func (r *rtc) SetTime(t time.Time) error    { r.t = t; return nil }
+
+func TestQuery(t *testing.T) {
+	c := qt.New(t)
+	client := newClient(c, time.Hour, 2)
+
+	rsp, err := client.Query()
+	c.Assert(err, qt.IsNil)
+	c.Assert(rsp.Stratum, qt.Equals, uint8(2))
+	c.Assert(rsp.ClockOffset > time.Hour-50*time.Millisecond, qt.IsTrue)
+	c.Assert(rsp.ClockOffset < time.Hour+50*time.Millisecond, qt.IsTrue)
+	// The server's processing time isn't part of the round-trip delay
+	c.Assert(rsp.RTT < 10*time.Millisecond, qt.IsTrue)
+	c.Assert(time.Until(rsp.Time) > 59*time.Minute, qt.IsTrue)
+}
+
+func TestSetRTC(t *testing.T) {
+	c := qt.New(t)
+	client := newClient(c, -24*time.Hour, 1)
+
+	clock := &rtc{}
+	_, err := client.SetRTC(clock)
+	c.Assert(err, qt.IsNil)
+	c.Assert(time.Since(clock.t) > 23*time.Hour, qt.IsTrue)
+	c.Assert(time.Since(clock.t) < 25*time.Hour, qt.IsTrue)
+}
+
+func TestKissOfDeath(t *testing.T) {
+	c := qt.New(t)
+	client := newClient(c, 0, 0)
+
+	_, err := client.Query()
+	c.Assert(err, qt.Equals, ErrKissOfDeath)
+}
+
+func TestTimestamp(t *testing.T) {
+	c := qt.New(t)
+	var b [8]byte
+
+	now := time.Date(2024, 2, 29, 12, 0, 0, 500000000, time.UTC)
+	putTimestamp(b[:], now)
+	c.Assert(binary.BigEndian.Uint32(b[:]), qt.Equals, uint32(3918196800))
+	d := timestamp(b[:]).Sub(now)
+	c.Assert(d > -time.Microsecond && d < time.Microsecond, qt.IsTrue)
+
+	// NTP era 1 starts in 2036
+	later := time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC)
+	putTimestamp(b[:], later)
+	c.Assert(timestamp(b[:]).Equal(later), qt.IsTrue)
+}
@@ -0,0 +1,200 @@
+package sx126x
+
+import (
+	"tinygo.org/x/drivers/lora"
+)
+
+// FSK_MAX_PAYLOAD_LENGTH is the largest (G)FSK payload, its length being sent
+// in a byte
+const FSK_MAX_PAYLOAD_LENGTH = 255
+
+// gfskRxBandwidths lists the supported GFSK receiver bandwidths (13.4.5.1)
+var gfskRxBandwidths = []struct {
+	hz   uint32
+	code uint8
+}{
+	{4800, SX126X_GFSK_RX_BW_4_8},
+	{5800, SX126X_GFSK_RX_BW_5_8},
+	{7300, SX126X_GFSK_RX_BW_7_3},
+	{9700, SX126X_GFSK_RX_BW_9_7},
+	{11700, SX126X_GFSK_RX_BW_11_7},
+	{14600, SX126X_GFSK_RX_BW_14_6},
+	{19500, SX126X_GFSK_RX_BW_19_5},
+	{23400, SX126X_GFSK_RX_BW_23_4},
+	{29300, SX126X_GFSK_RX_BW_29_3},
+	{39000, SX126X_GFSK_RX_BW_39_0},
+	{46900, SX126X_GFSK_RX_BW_46_9},
+	{58600, SX126X_GFSK_RX_BW_58_6},
+	{78200, SX126X_GFSK_RX_BW_78_2},
+	{93800, SX126X_GFSK_RX_BW_93_8},
+	{117300, SX126X_GFSK_RX_BW_117_3},
+	{156200, SX126X_GFSK_RX_BW_156_2},
+	{187200, SX126X_GFSK_RX_BW_187_2},
+	{234300, SX126X_GFSK_RX_BW_234_3},
+	{312000, SX126X_GFSK_RX_BW_312_0},
+	{373600, SX126X_GFSK_RX_BW_373_6},
+	{467000, SX126X_GFSK_RX_BW_467_0},
+}
+
+// FSKConfig defines the (G)FSK configuration used by TxFSK and RxFSK
+func (d *Device) FSKConfig(cnf lora.FSKConfig) error {
+	if err := cnf.Validate(); err != nil {
+		return err
+	}
+	d.fskConf = cnf
+	return nil
+}
+
+// SetModulationParamsFSK sets the GFSK bit rate, pulse shape, receiver
+// bandwidth and frequency deviation (13.4.5.1)
+func (d *Device) SetModulationParamsFSK(bitRate uint32, pulseShape, bandwidth uint8, freqDeviation uint32) {
+	var p [8]uint8
+	br := uint32(32 * 32000000 / uint64(bitRate))
+	p[0] = uint8((br >> 16) & 0xFF)
+	p[1] = uint8((br >> 8) & 0xFF)
+	p[2] = uint8(br & 0xFF)
+	p[3] = pulseShape
+	p[4] = bandwidth
+	fdev := uint32((uint64(freqDeviation) << 25) / 32000000)
+	p[5] = uint8((fdev >> 16) & 0xFF)
+	p[6] = uint8((fdev >> 8) & 0xFF)
+	p[7] = uint8(fdev & 0xFF)
+	d.ExecSetCommand(SX126X_CMD_SET_MODULATION_PARAMS, p[:])
+}
+
+// SetPacketParamFSK sets the GFSK packet parameters, the preamble and sync
+// word lengths being expressed in bits (13.4.6.1)
+func (d *Device) SetPacketParamFSK(preambleLength uint16, preambleDetect, syncWordLength, addrComp, packetType, payloadLength, crcType, whitening uint8) {
+	var p [9]uint8
+	p[0] = uint8((preambleLength >> 8) & 0xFF)
+	p[1] = uint8(preambleLength & 0xFF)
+	p[2] = preambleDetect
+	p[3] = syncWordLength
+	p[4] = addrComp
+	p[5] = packetType
+	p[6] = payloadLength
+	p[7] = crcType
+	p[8] = whitening
+	d.ExecSetCommand(SX126X_CMD_SET_PACKET_PARAMS, p[:])
+}
+
+// TxFSK sends a (G)FSK packet, (with timeout)
+func (d *Device) TxFSK(pkt []uint8, timeoutMs uint32) error {
+	if d.fskConf.Freq == 0 {
+		return lora.ErrInvalidFSKConf
+	}
+	if len(pkt) > FSK_MAX_PAYLOAD_LENGTH {
+		return errFSKPacketTooLarge
+	}
+
+	if d.controller != nil {
+		err := d.controller.SetRfSwitchMode(RFSWITCH_TX_HP)
+		if err != nil {
+			return err
+		}
+	}
+
+	d.ClearIrqStatus(SX126X_IRQ_ALL)
+	irqVal := uint16(SX126X_IRQ_TX_DONE | SX126X_IRQ_TIMEOUT)
+	d.prepareFSK(uint8(len(pkt)))
+	d.SetTxParams(d.fskConf.TxPowerDBm, SX126X_PA_RAMP_200U)
+	d.WriteBuffer(pkt)
+	d.SetDioIrqParams(irqVal, irqVal, SX126X_IRQ_NONE, SX126X_IRQ_NONE)
+	d.SetTx(timeoutMsToRtcSteps(timeoutMs))
+
+	msg := <-d.GetRadioEventChan()
+	if msg.EventType != lora.RadioEventTxDone {
+		return errUnexpectedTxRadioEvent
+	}
+	return nil
+}
+
+// RxFSK tries to receive a (G)FSK packet (with timeout in milliseconds)
+func (d *Device) RxFSK(timeoutMs uint32) ([]uint8, error) {
+	if d.fskConf.Freq == 0 {
+		return nil, lora.ErrInvalidFSKConf
+	}
+
+	if d.controller != nil {
+		err := d.controller.SetRfSwitchMode(RFSWITCH_RX)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.ClearIrqStatus(SX126X_IRQ_ALL)
+	irqVal := uint16(SX126X_IRQ_RX_DONE | SX126X_IRQ_TIMEOUT | SX126X_IRQ_CRC_ERR)
+	payloadLength := d.fskConf.FixedLength
+	if payloadLength == 0 {
+		payloadLength = 0xFF
+	}
+	d.prepareFSK(payloadLength)
+	d.SetDioIrqParams(irqVal, irqVal, SX126X_IRQ_NONE, SX126X_IRQ_NONE)
+	d.SetRx(timeoutMsToRtcSteps(timeoutMs))
+
+	msg := <-d.GetRadioEventChan()
+	if msg.EventType == lora.RadioEventTimeout {
+		return nil, nil
+	} else if msg.EventType != lora.RadioEventRxDone {
+		return nil, errUnexpectedRxRadioEvent
+	}
+
+	return d.ReadRxPacket(), nil
+}
+
+// prepareFSK configures the radio for a (G)FSK operation
+func (d *Device) prepareFSK(payloadLength uint8) {
+	cnf := d.fskConf
+	d.SetStandby()
+	d.SetPacketType(SX126X_PACKET_TYPE_GFSK)
+	d.SetRfFrequency(cnf.Freq)
+	d.SetBufferBaseAddress(0, 0)
+
+	bandwidth := gfskRxBandwidths[len(gfskRxBandwidths)-1].code
+	for _, bw := range gfskRxBandwidths {
+		if bw.hz >= cnf.RxBandwidth {
+			bandwidth = bw.code
+			break
+		}
+	}
+	d.SetModulationParamsFSK(cnf.BitRate, gfskShaping(cnf.Shaping), bandwidth, cnf.FreqDeviation)
+
+	packetType := uint8(SX126X_GFSK_PACKET_VARIABLE)
+	if cnf.FixedLength != 0 {
+		packetType = SX126X_GFSK_PACKET_FIXED
+	}
+	crcType := uint8(SX126X_GFSK_CRC_OFF)
+	switch cnf.Crc {
+	case lora.FSKCrcCCITT:
+		crcType = SX126X_GFSK_CRC_2_BYTE_INV
+		d.WriteRegister(SX126X_REG_CRC_INITIAL_MSB, []uint8{0x1D, 0x0F})
+		d.WriteRegister(SX126X_REG_CRC_POLYNOMIAL_MSB, []uint8{0x10, 0x21})
+	case lora.FSKCrcIBM:
+		crcType = SX126X_GFSK_CRC_2_BYTE
+		d.WriteRegister(SX126X_REG_CRC_INITIAL_MSB, []uint8{0xFF, 0xFF})
+		d.WriteRegister(SX126X_REG_CRC_POLYNOMIAL_MSB, []uint8{0x80, 0x05})
+	}
+	whitening := uint8(SX126X_GFSK_WHITENING_OFF)
+	if cnf.Whitening {
+		whitening = SX126X_GFSK_WHITENING_ON
+	}
+	d.SetPacketParamFSK(cnf.Preamble*8, SX126X_GFSK_PREAMBLE_DETECT_16, uint8(len(cnf.SyncWord)*8),
+		SX126X_GFSK_ADDRESS_FILT_OFF, packetType, payloadLength, crcType, whitening)
+	if len(cnf.SyncWord) > 0 {
+		d.WriteRegister(SX126X_REG_SYNC_WORD_0, cnf.SyncWord)
+	}
+}
+
+// gfskShaping returns the pulse shape matching a lora.FSKShaping* constant
+func gfskShaping(shaping uint8) uint8 {
+	switch shaping {
+	case lora.FSKShapingBT0_3:
+		return SX126X_GFSK_FILTER_GAUSS_0_3
+	case lora.FSKShapingBT0_5:
+		return SX126X_GFSK_FILTER_GAUSS_0_5
+	case lora.FSKShapingBT1_0:
+		return SX126X_GFSK_FILTER_GAUSS_1
+	default:
+		return SX126X_GFSK_FILTER_NONE
+	}
+}
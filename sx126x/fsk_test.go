@@ -0,0 +1,126 @@
+package sx126x
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"tinygo.org/x/drivers/lora"
+	"tinygo.org/x/drivers/tester"
+)
+
+// testController frames the commands on the mock SPI bus with the NSS line
+type testController struct {
+	bus *tester.SPIBus
+	dev tester.SPIDevice
+}
+
+func (rc *testController) Init() error                          { return nil }
+func (rc *testController) SetRfSwitchMode(mode int) error       { return nil }
+func (rc *testController) WaitWhileBusy() error                 { return nil }
+func (rc *testController) SetupInterrupts(handler func()) error { return nil }
+
+func (rc *testController) SetNss(state bool) error {
+	if state {
+		rc.bus.Deselect()
+	} else {
+		rc.bus.Select(rc.dev)
+	}
+	return nil
+}
+
+// newTestDevice returns a device on a mock SPI bus accepting any command
+func newTestDevice(c *qt.C) (*Device, *tester.SPIBus) {
+	bus := tester.NewSPIBus(c)
+	dev := tester.NewSPIDeviceCmd(c)
+	dev.Commands = map[uint8]*tester.Cmd{
+		0: {Command: []byte{0}, Mask: []byte{0}},
+	}
+	bus.AddDevice(dev)
+	d := New(bus)
+	c.Assert(d.SetRadioController(&testController{bus: bus, dev: dev}), qt.IsNil)
+	return d, bus
+}
+
+// lastCommand returns the bytes of the last command cmd sent on the bus
+func lastCommand(c *qt.C, bus *tester.SPIBus, cmd ...uint8) []byte {
+	for i := len(bus.Log) - 1; i >= 0; i-- {
+		w := bus.Log[i].W
+		if len(w) >= len(cmd) && string(w[:len(cmd)]) == string(cmd) {
+			return w[len(cmd):]
+		}
+	}
+	c.Fatalf("command %#x not sent", cmd)
+	return nil
+}
+
+var testFSKConfig = lora.FSKConfig{
+	Freq:          868800000,
+	BitRate:       50000,
+	FreqDeviation: 25000,
+	RxBandwidth:   100000,
+	Shaping:       lora.FSKShapingBT1_0,
+	Preamble:      5,
+	SyncWord:      []uint8{0xC1, 0x94, 0xC1},
+	Whitening:     true,
+	Crc:           lora.FSKCrcCCITT,
+	TxPowerDBm:    14,
+}
+
+func TestTxFSK(t *testing.T) {
+	c := qt.New(t)
+	d, bus := newTestDevice(c)
+	c.Assert(d.TxFSK([]uint8("hello"), 100), qt.Equals, lora.ErrInvalidFSKConf)
+	c.Assert(d.FSKConfig(testFSKConfig), qt.IsNil)
+
+	d.radioEventChan <- lora.NewRadioEvent(lora.RadioEventTxDone, 0, nil)
+	c.Assert(d.TxFSK([]uint8("hello"), 100), qt.IsNil)
+
+	c.Assert(lastCommand(c, bus, SX126X_CMD_SET_PACKET_TYPE), qt.DeepEquals, []byte{SX126X_PACKET_TYPE_GFSK})
+	// 868.8 MHz
+	c.Assert(lastCommand(c, bus, SX126X_CMD_SET_RF_FREQUENCY), qt.DeepEquals, []byte{0x36, 0x4C, 0xCC, 0xCC})
+	// 50 kbps, BT 1.0, 117.3 kHz receiver bandwidth, 25 kHz deviation
+	c.Assert(lastCommand(c, bus, SX126X_CMD_SET_MODULATION_PARAMS), qt.DeepEquals, []byte{
+		0x00, 0x50, 0x00, SX126X_GFSK_FILTER_GAUSS_1, SX126X_GFSK_RX_BW_117_3, 0x00, 0x66, 0x66,
+	})
+	// 40 bits preamble, 24 bits sync word, 5 bytes variable length packet,
+	// inverted CRC and whitening
+	c.Assert(lastCommand(c, bus, SX126X_CMD_SET_PACKET_PARAMS), qt.DeepEquals, []byte{
+		0x00, 0x28, SX126X_GFSK_PREAMBLE_DETECT_16, 0x18, SX126X_GFSK_ADDRESS_FILT_OFF,
+		SX126X_GFSK_PACKET_VARIABLE, 0x05, SX126X_GFSK_CRC_2_BYTE_INV, SX126X_GFSK_WHITENING_ON,
+	})
+	c.Assert(lastCommand(c, bus, SX126X_CMD_WRITE_REGISTER, 0x06, 0xC0), qt.DeepEquals, []byte{0xC1, 0x94, 0xC1})
+	// CRC-16-CCITT
+	c.Assert(lastCommand(c, bus, SX126X_CMD_WRITE_REGISTER, 0x06, 0xBC), qt.DeepEquals, []byte{0x1D, 0x0F})
+	c.Assert(lastCommand(c, bus, SX126X_CMD_WRITE_REGISTER, 0x06, 0xBE), qt.DeepEquals, []byte{0x10, 0x21})
+	c.Assert(lastCommand(c, bus, SX126X_CMD_WRITE_BUFFER), qt.DeepEquals, []byte("\x00hello"))
+}
+
+func TestTxFSKTooLarge(t *testing.T) {
+	c := qt.New(t)
+	d, bus := newTestDevice(c)
+	c.Assert(d.FSKConfig(testFSKConfig), qt.IsNil)
+
+	// The length of the packet does not fit in the packet parameters
+	c.Assert(d.TxFSK(make([]uint8, FSK_MAX_PAYLOAD_LENGTH+1), 100), qt.Equals, errFSKPacketTooLarge)
+	c.Assert(bus.Log, qt.HasLen, 0)
+}
+
+func TestRxFSKFixedLength(t *testing.T) {
+	c := qt.New(t)
+	d, bus := newTestDevice(c)
+	cnf := testFSKConfig
+	cnf.FixedLength = 16
+	cnf.Crc = lora.FSKCrcOff
+	cnf.Whitening = false
+	c.Assert(d.FSKConfig(cnf), qt.IsNil)
+
+	d.radioEventChan <- lora.NewRadioEvent(lora.RadioEventTimeout, 0, nil)
+	pkt, err := d.RxFSK(100)
+	c.Assert(err, qt.IsNil)
+	c.Assert(pkt, qt.IsNil)
+
+	c.Assert(lastCommand(c, bus, SX126X_CMD_SET_PACKET_PARAMS), qt.DeepEquals, []byte{
+		0x00, 0x28, SX126X_GFSK_PREAMBLE_DETECT_16, 0x18, SX126X_GFSK_ADDRESS_FILT_OFF,
+		SX126X_GFSK_PACKET_FIXED, 0x10, SX126X_GFSK_CRC_OFF, SX126X_GFSK_WHITENING_OFF,
+	})
+}
@@ -1,4 +1,4 @@
-//go:build !stm32wlx
+//go:build tinygo && !stm32wlx
 
 package sx126x
 
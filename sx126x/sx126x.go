@@ -7,8 +7,6 @@ import (
 	"errors"
 	"time"
 
-	"machine"
-
 	"tinygo.org/x/drivers"
 	"tinygo.org/x/drivers/lora"
 )
@@ -19,6 +17,8 @@ var (
 	errRadioNotFound          = errors.New("LoRa radio not found")
 	errUnexpectedRxRadioEvent = errors.New("Unexpected Radio Event during RX")
 	errUnexpectedTxRadioEvent = errors.New("Unexpected Radio Event during TX")
+	errCadTimeout             = errors.New("CAD Timeout")
+	errFSKPacketTooLarge      = errors.New("FSK packet too large")
 )
 
 const (
@@ -37,20 +37,22 @@ const (
 	PERIOD_PER_SEC      = (uint32)(1000000 / 15.625) // SX1261 DS 13.1.4
 	SPI_BUFFER_SIZE     = 256
 	RADIOEVENTCHAN_SIZE = 1
+	LBT_CAD_TIMEOUT_MS  = 100
 )
 
 // Device wraps an SPI connection to a SX126x device.
 type Device struct {
-	spi            drivers.SPI          // SPI bus for module communication
-	rstPin         machine.Pin          // GPIO for reset pin
-	radioEventChan chan lora.RadioEvent // Channel for Receiving events
-	loraConf       lora.Config          // Current Lora configuration
-	controller     RadioController      // to manage interactions with the radio
-	deepSleep      bool                 // Internal Sleep state
-	deviceType     int                  // sx1261,sx1262,sx1268 (defaults sx1261)
-	spiTxBuf       []byte               // global Tx buffer to avoid heap allocations in interrupt
-	spiRxBuf       []byte               // global Rx buffer to avoid heap allocations in interrupt
-
+	spi            drivers.SPI           // SPI bus for module communication
+	rstPin         drivers.Pin           // GPIO for reset pin, optional
+	radioEventChan chan lora.RadioEvent  // Channel for Receiving events
+	loraConf       lora.Config           // Current Lora configuration
+	controller     RadioController       // to manage interactions with the radio
+	deepSleep      bool                  // Internal Sleep state
+	deviceType     int                   // sx1261,sx1262,sx1268 (defaults sx1261)
+	spiTxBuf       []byte                // global Tx buffer to avoid heap allocations in interrupt
+	spiRxBuf       []byte                // global Rx buffer to avoid heap allocations in interrupt
+	lbt            lora.ListenBeforeTalk // Carrier sensing before Tx
+	fskConf        lora.FSKConfig        // Current (G)FSK configuration
 }
 
 // New creates a new SX126x connection.
@@ -108,9 +110,12 @@ func (d *Device) SetRadioController(rc RadioController) error {
 // --------------------------------------------------
 
 func (d *Device) Reset() {
-	d.rstPin.Low()
+	if d.rstPin == nil {
+		return
+	}
+	d.rstPin.Set(false)
 	time.Sleep(100 * time.Millisecond)
-	d.rstPin.High()
+	d.rstPin.Set(true)
 	time.Sleep(100 * time.Millisecond)
 }
 
@@ -185,6 +190,25 @@ func (d *Device) SetRx(timeoutRtcStep uint32) {
 	d.ExecSetCommand(SX126X_CMD_SET_RX, p[:])
 }
 
+// SetCadParams defines the number of symbols on which CAD operates, the
+// detection thresholds, and the mode to go to after CAD (13.4.7)
+func (d *Device) SetCadParams(symbolNum, detPeak, detMin, exitMode uint8, timeoutRtcStep uint32) {
+	var p [7]uint8
+	p[0] = symbolNum
+	p[1] = detPeak
+	p[2] = detMin
+	p[3] = exitMode
+	p[4] = uint8((timeoutRtcStep >> 16) & 0xFF)
+	p[5] = uint8((timeoutRtcStep >> 8) & 0xFF)
+	p[6] = uint8((timeoutRtcStep >> 0) & 0xFF)
+	d.ExecSetCommand(SX126X_CMD_SET_CAD_PARAMS, p[:])
+}
+
+// SetCad starts a Channel Activity Detection (13.1.12)
+func (d *Device) SetCad() {
+	d.ExecSetCommand(SX126X_CMD_SET_CAD, nil)
+}
+
 // StopTimerOnPreamble allows the user to select if the timer is stopped upon preamble detection of SyncWord / header detection.
 func (d *Device) StopTimerOnPreamble(enable bool) {
 	var p [1]uint8
@@ -341,6 +365,19 @@ func (d *Device) GetRxBufferStatus() (payloadLengthRx uint8, rxStartBufferPointe
 	return r[0], r[1]
 }
 
+// GetRssiInst returns the instantaneous RSSI in dBm, while in RX (13.5.4)
+func (d *Device) GetRssiInst() int16 {
+	r := d.ExecGetCommand(SX126X_CMD_GET_RSSI_INST, 1)
+	return -int16(r[0]) / 2
+}
+
+// GetLoraPacketStatus returns the RSSI in dBm and SNR in dB of the last Lora
+// packet received (13.5.3)
+func (d *Device) GetLoraPacketStatus() (rssiPkt int16, snrPkt int8) {
+	r := d.ExecGetCommand(SX126X_CMD_GET_PACKET_STATUS, 3)
+	return -int16(r[0]) / 2, int8(r[1]) / 4
+}
+
 // GetPackeType returns current Packet Type (13.4.3)
 func (d *Device) GetPacketType() (packetType uint8) {
 	r := d.ExecGetCommand(SX126X_CMD_GET_PACKET_TYPE, 1)
@@ -350,7 +387,7 @@ func (d *Device) GetPacketType() (packetType uint8) {
 // GetDeviceErrors returns current Device Errors
 func (d *Device) GetDeviceErrors() uint16 {
 	r := d.ExecGetCommand(SX126X_CMD_GET_DEVICE_ERRORS, 2)
-	ret := uint16(r[0]<<8 + r[1])
+	ret := uint16(r[0])<<8 + uint16(r[1])
 	return ret
 }
 
@@ -364,7 +401,7 @@ func (d *Device) ClearDeviceErrors() {
 // Lora: NbPktReceived, NbPktCrcError, NbPktHeaderErr
 func (d *Device) GetLoraStats() (nbPktReceived, nbPktCrcError, nbPktHeaderErr uint16) {
 	r := d.ExecGetCommand(SX126X_CMD_GET_STATS, 6)
-	return uint16(r[0]<<8 | r[1]), uint16(r[2]<<8 | r[3]), uint16(r[4]<<8 | r[5])
+	return uint16(r[0])<<8 | uint16(r[1]), uint16(r[2])<<8 | uint16(r[3]), uint16(r[4])<<8 | uint16(r[5])
 }
 
 // ---------------------------------------
@@ -629,6 +666,10 @@ func (d *Device) Tx(pkt []uint8, timeoutMs uint32) error {
 		return lora.ErrUndefinedLoraConf
 	}
 
+	if err := d.lbt.Wait(d.channelBusy); err != nil {
+		return err
+	}
+
 	if d.controller != nil {
 		err := d.controller.SetRfSwitchMode(RFSWITCH_TX_HP)
 		if err != nil {
@@ -659,41 +700,154 @@ func (d *Device) Tx(pkt []uint8, timeoutMs uint32) error {
 
 // LoraRx tries to receive a Lora packet (with timeout in milliseconds)
 func (d *Device) Rx(timeoutMs uint32) ([]uint8, error) {
+	err := d.prepareRx()
+	if err != nil {
+		return nil, err
+	}
+	d.SetRx(timeoutMsToRtcSteps(timeoutMs))
+
+	msg := <-d.GetRadioEventChan()
+
+	if msg.EventType == lora.RadioEventTimeout {
+		return nil, nil
+	} else if msg.EventType != lora.RadioEventRxDone {
+		return nil, errUnexpectedRxRadioEvent
+	}
+
+	return d.ReadRxPacket(), nil
+}
+
+// StartRxContinuous sets the radio in continuous receive mode and returns
+// immediately. Received packets are signaled on the radio event channel.
+func (d *Device) StartRxContinuous() error {
+	err := d.prepareRx()
+	if err != nil {
+		return err
+	}
+	d.SetRx(SX126X_RX_TIMEOUT_INF)
+	return nil
+}
+
+// StopRxContinuous leaves continuous receive mode
+func (d *Device) StopRxContinuous() {
+	d.SetStandby()
+}
+
+// ReadRxPacket returns the last packet received
+func (d *Device) ReadRxPacket() []uint8 {
+	pLen, pStart := d.GetRxBufferStatus()
+	d.SetBufferBaseAddress(0, pStart+1)
+	pkt := d.ReadBuffer(pLen + 1)
+	return pkt[1:]
+}
+
+// Cad runs a Channel Activity Detection on the current channel, and returns
+// true if a Lora preamble was detected
+func (d *Device) Cad(timeoutMs uint32) (bool, error) {
+	err := d.prepareRx()
+	if err != nil {
+		return false, err
+	}
+	irqVal := uint16(SX126X_IRQ_CAD_DONE | SX126X_IRQ_CAD_DETECTED)
+	d.SetDioIrqParams(irqVal, irqVal, SX126X_IRQ_NONE, SX126X_IRQ_NONE)
+	detPeak, symbolNum := cadParams(d.loraConf.Sf)
+	d.SetCadParams(symbolNum, detPeak, 10, SX126X_CAD_GOTO_STDBY, 0)
+	d.SetCad()
+
+	select {
+	case msg := <-d.radioEventChan:
+		switch msg.EventType {
+		case lora.RadioEventCadDetected:
+			return true, nil
+		case lora.RadioEventCadDone:
+			return false, nil
+		}
+		return false, errUnexpectedRxRadioEvent
+	case <-time.After(time.Millisecond * time.Duration(timeoutMs)):
+		d.SetStandby()
+		return false, errCadTimeout
+	}
+}
+
+// LastPacketRSSI returns the RSSI of the last packet received in dBm
+func (d *Device) LastPacketRSSI() int16 {
+	rssi, _ := d.GetLoraPacketStatus()
+	return rssi
+}
+
+// LastPacketSNR returns the SNR of the last packet received in dB
+func (d *Device) LastPacketSNR() int8 {
+	_, snr := d.GetLoraPacketStatus()
+	return snr
+}
+
+// SetListenBeforeTalk configures carrier sensing before each Tx
+func (d *Device) SetListenBeforeTalk(lbt lora.ListenBeforeTalk) {
+	d.lbt = lbt
+}
+
+// channelBusy senses the current channel according to the Listen Before Talk
+// configuration
+func (d *Device) channelBusy() (bool, error) {
+	if d.lbt.UseCAD {
+		return d.Cad(LBT_CAD_TIMEOUT_MS)
+	}
+
+	err := d.prepareRx()
+	if err != nil {
+		return false, err
+	}
+	d.SetRx(SX126X_RX_TIMEOUT_INF)
+	defer d.SetStandby()
+
+	busy := false
+	deadline := time.Now().Add(time.Duration(d.lbt.SenseTimeMs) * time.Millisecond)
+	for !busy && time.Now().Before(deadline) {
+		busy = d.GetRssiInst() > d.lbt.RSSIThresholdDBm
+	}
+	return busy, nil
+}
+
+// cadParams returns the CAD peak detection threshold and number of symbols
+// recommended for a spreading factor (AN1200.48)
+func cadParams(sf uint8) (detPeak uint8, symbolNum uint8) {
+	switch sf {
+	case lora.SpreadingFactor5, lora.SpreadingFactor6, lora.SpreadingFactor7, lora.SpreadingFactor8:
+		return 22, SX126X_CAD_ON_2_SYMB
+	case lora.SpreadingFactor9:
+		return 23, SX126X_CAD_ON_4_SYMB
+	case lora.SpreadingFactor10:
+		return 24, SX126X_CAD_ON_4_SYMB
+	case lora.SpreadingFactor11:
+		return 25, SX126X_CAD_ON_4_SYMB
+	default:
+		return 28, SX126X_CAD_ON_4_SYMB
+	}
+}
+
+// prepareRx configures the radio for Lora reception
+func (d *Device) prepareRx() error {
 	if d.loraConf.Freq == 0 {
-		return nil, lora.ErrUndefinedLoraConf
+		return lora.ErrUndefinedLoraConf
 	}
 
 	if d.controller != nil {
 		err := d.controller.SetRfSwitchMode(RFSWITCH_RX)
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
 	d.ClearIrqStatus(SX126X_IRQ_ALL)
 	irqVal := uint16(SX126X_IRQ_RX_DONE | SX126X_IRQ_TIMEOUT | SX126X_IRQ_CRC_ERR)
 	d.SetStandby()
+	d.SetPacketType(SX126X_PACKET_TYPE_LORA)
 	d.SetBufferBaseAddress(0, 0)
 	d.SetRfFrequency(d.loraConf.Freq)
 	d.SetModulationParams(d.loraConf.Sf, bandwidth(d.loraConf.Bw), d.loraConf.Cr, d.loraConf.Ldr)
 	d.SetPacketParam(d.loraConf.Preamble, d.loraConf.HeaderType, d.loraConf.Crc, 0xFF, d.loraConf.Iq)
 	d.SetDioIrqParams(irqVal, irqVal, SX126X_IRQ_NONE, SX126X_IRQ_NONE)
-	d.SetRx(timeoutMsToRtcSteps(timeoutMs))
-
-	msg := <-d.GetRadioEventChan()
-
-	if msg.EventType == lora.RadioEventTimeout {
-		return nil, nil
-	} else if msg.EventType != lora.RadioEventRxDone {
-		return nil, errUnexpectedRxRadioEvent
-	}
-
-	pLen, pStart := d.GetRxBufferStatus()
-	d.SetBufferBaseAddress(0, pStart+1)
-	pkt := d.ReadBuffer(pLen + 1)
-	pkt = pkt[1:]
-
-	return pkt, nil
+	return nil
 }
 
 // HandleInterrupt must be called by main code on DIO state change.
@@ -703,21 +857,21 @@ func (d *Device) HandleInterrupt() {
 
 	if (st & SX126X_IRQ_RX_DONE) > 0 {
 		select {
-		case d.radioEventChan <- lora.RadioEvent{lora.RadioEventRxDone, uint16(st), nil}:
+		case d.radioEventChan <- lora.NewRadioEvent(lora.RadioEventRxDone, uint16(st), nil):
 		default:
 		}
 	}
 
 	if (st & SX126X_IRQ_TX_DONE) > 0 {
 		select {
-		case d.radioEventChan <- lora.RadioEvent{lora.RadioEventTxDone, uint16(st), nil}:
+		case d.radioEventChan <- lora.NewRadioEvent(lora.RadioEventTxDone, uint16(st), nil):
 		default:
 		}
 	}
 
 	if (st & SX126X_IRQ_TIMEOUT) > 0 {
 		select {
-		case d.radioEventChan <- lora.RadioEvent{lora.RadioEventTimeout, uint16(st), nil}:
+		case d.radioEventChan <- lora.NewRadioEvent(lora.RadioEventTimeout, uint16(st), nil):
 		default:
 		}
 
@@ -725,8 +879,19 @@ func (d *Device) HandleInterrupt() {
 
 	if (st & SX126X_IRQ_CRC_ERR) > 0 {
 		select {
-		case d.radioEventChan <- lora.RadioEvent{lora.RadioEventCrcError, uint16(st), nil}:
+		case d.radioEventChan <- lora.NewRadioEvent(lora.RadioEventCrcError, uint16(st), nil):
+
+		default:
+		}
+	}
 
+	if (st & SX126X_IRQ_CAD_DONE) > 0 {
+		eventType := lora.RadioEventCadDone
+		if (st & SX126X_IRQ_CAD_DETECTED) > 0 {
+			eventType = lora.RadioEventCadDetected
+		}
+		select {
+		case d.radioEventChan <- lora.NewRadioEvent(eventType, uint16(st), nil):
 		default:
 		}
 	}
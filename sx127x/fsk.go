@@ -0,0 +1,220 @@
+package sx127x
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"tinygo.org/x/drivers/lora"
+)
+
+const (
+	FSK_FIFO_SIZE = 64
+	FXOSC         = 32000000
+)
+
+var (
+	errFSKPacketTooLarge = errors.New("FSK packet too large")
+)
+
+// FSKConfig defines the (G)FSK configuration used by TxFSK and RxFSK
+func (d *Device) FSKConfig(cnf lora.FSKConfig) error {
+	if err := cnf.Validate(); err != nil {
+		return err
+	}
+	d.fskConf = cnf
+	return nil
+}
+
+// SetOpModeFSK switches the radio to FSK/OOK mode, leaving it in sleep mode
+func (d *Device) SetOpModeFSK() {
+	d.SetOpMode(SX127X_OPMODE_SLEEP)
+	d.WriteRegister(SX127X_REG_OP_MODE, SX127X_OPMODE_FSK|SX127X_OPMODE_SLEEP)
+	d.fskMode = true
+}
+
+// TxFSK sends a (G)FSK packet, (with timeout)
+func (d *Device) TxFSK(pkt []uint8, timeoutMs uint32) error {
+	if d.fskConf.Freq == 0 {
+		return lora.ErrInvalidFSKConf
+	}
+	if len(pkt) >= FSK_FIFO_SIZE {
+		return errFSKPacketTooLarge
+	}
+
+	d.prepareFSK()
+	defer d.SetOpMode(SX127X_OPMODE_SLEEP)
+	d.SetTxPowerWithPaBoost(d.fskConf.TxPowerDBm, true)
+	// set the IRQ mapping DIO0=PacketSent
+	d.WriteRegister(SX127X_REG_DIO_MAPPING_1, 0x00)
+	// Start transmitting as soon as the FIFO is not empty
+	d.WriteRegister(SX127X_REG_FIFO_THRESH, 0x80|(FSK_FIFO_SIZE/2-1))
+
+	// FIFO OPs cannot take place in Sleep mode !!!
+	d.SetOpMode(SX127X_OPMODE_STANDBY)
+	time.Sleep(time.Millisecond)
+	if d.fskConf.FixedLength == 0 {
+		d.WriteRegister(SX127X_REG_FIFO, uint8(len(pkt)))
+	}
+	for i := 0; i < len(pkt); i++ {
+		d.WriteRegister(SX127X_REG_FIFO, pkt[i])
+	}
+
+	d.SetOpMode(SX127X_OPMODE_TX)
+	select {
+	case msg := <-d.radioEventChan:
+		if msg.EventType != lora.RadioEventTxDone {
+			return errors.New("Unexpected Radio Event while TX " + strconv.Itoa(msg.EventType))
+		}
+	case <-time.After(time.Millisecond * time.Duration(timeoutMs)):
+		return errors.New("TX Timeout")
+	}
+	return nil
+}
+
+// RxFSK tries to receive a (G)FSK packet (with timeout in milliseconds)
+func (d *Device) RxFSK(timeoutMs uint32) ([]uint8, error) {
+	if d.fskConf.Freq == 0 {
+		return nil, lora.ErrInvalidFSKConf
+	}
+
+	d.prepareFSK()
+	defer d.SetOpMode(SX127X_OPMODE_SLEEP)
+	d.WriteRegister(SX127X_REG_LNA, SX127X_LNA_MAX_GAIN)
+	// AFC and AGC on, start receiving on preamble detection
+	d.WriteRegister(SX127X_REG_RX_CONFIG, 0x1E)
+	// set the IRQ mapping DIO0=PayloadReady
+	d.WriteRegister(SX127X_REG_DIO_MAPPING_1, 0x00)
+
+	d.SetOpMode(SX127X_OPMODE_RX)
+	select {
+	case msg := <-d.radioEventChan:
+		if msg.EventType != lora.RadioEventRxDone {
+			return nil, errors.New("Unexpected Radio Event while RX " + strconv.Itoa(msg.EventType))
+		}
+	case <-time.After(time.Millisecond * time.Duration(timeoutMs)):
+		return nil, nil
+	}
+
+	// Get the received payload, the FIFO is kept in standby mode
+	d.SetOpMode(SX127X_OPMODE_STANDBY)
+	pLen := d.fskConf.FixedLength
+	if pLen == 0 {
+		pLen = d.ReadRegister(SX127X_REG_FIFO)
+	}
+	rxData := []uint8{}
+	for i := uint8(0); i < pLen && i < FSK_FIFO_SIZE; i++ {
+		rxData = append(rxData, d.ReadRegister(SX127X_REG_FIFO))
+	}
+	return rxData, nil
+}
+
+// prepareFSK configures the radio for a (G)FSK operation
+func (d *Device) prepareFSK() {
+	cnf := d.fskConf
+	d.SetOpModeFSK()
+
+	var frf = (uint64(cnf.Freq) << 19) / FXOSC
+	d.WriteRegister(SX127X_REG_FRF_MSB, uint8(frf>>16))
+	d.WriteRegister(SX127X_REG_FRF_MID, uint8(frf>>8))
+	d.WriteRegister(SX127X_REG_FRF_LSB, uint8(frf>>0))
+
+	br := FXOSC / cnf.BitRate
+	d.WriteRegister(SX127X_REG_BITRATE_MSB, uint8(br>>8))
+	d.WriteRegister(SX127X_REG_BITRATE_LSB, uint8(br))
+	fdev := uint32((uint64(cnf.FreqDeviation) << 19) / FXOSC)
+	d.WriteRegister(SX127X_REG_FDEV_MSB, uint8(fdev>>8)&0x3F)
+	d.WriteRegister(SX127X_REG_FDEV_LSB, uint8(fdev))
+
+	rxBw := fskRxBandwidth(cnf.RxBandwidth)
+	d.WriteRegister(SX127X_REG_RX_BW, rxBw)
+	d.WriteRegister(SX127X_REG_AFC_BW, rxBw)
+
+	// Gaussian filter, PA ramp-up time 40 uSec
+	d.WriteRegister(SX127X_REG_PA_RAMP, fskShaping(cnf.Shaping)<<5|0x09)
+
+	d.WriteRegister(SX127X_REG_FSK_PREAMBLE_MSB, uint8(cnf.Preamble>>8))
+	d.WriteRegister(SX127X_REG_FSK_PREAMBLE_LSB, uint8(cnf.Preamble))
+	// Preamble detector on, 2 bytes, 10 chips tolerance
+	d.WriteRegister(SX127X_REG_PREAMBLE_DETECT, 0xAA)
+
+	// Auto restart Rx without waiting for PLL lock, 0xAA preamble
+	syncConfig := uint8(0x40)
+	if len(cnf.SyncWord) > 0 {
+		syncConfig |= 0x10 | uint8(len(cnf.SyncWord)-1)
+		for i, b := range cnf.SyncWord {
+			d.WriteRegister(SX127X_REG_SYNC_VALUE_1+uint8(i), b)
+		}
+	}
+	d.WriteRegister(SX127X_REG_SYNC_CONFIG, syncConfig)
+
+	packetConfig := uint8(0)
+	if cnf.FixedLength == 0 {
+		packetConfig |= 0x80
+	}
+	if cnf.Whitening {
+		packetConfig |= 0x40
+	}
+	switch cnf.Crc {
+	case lora.FSKCrcCCITT:
+		packetConfig |= 0x10
+	case lora.FSKCrcIBM:
+		packetConfig |= 0x11
+	}
+	d.WriteRegister(SX127X_REG_PACKET_CONFIG_1, packetConfig)
+	// Packet mode
+	d.WriteRegister(SX127X_REG_PACKET_CONFIG_2, 0x40)
+	payloadLength := cnf.FixedLength
+	if payloadLength == 0 {
+		payloadLength = FSK_FIFO_SIZE - 1
+	}
+	d.WriteRegister(SX127X_REG_FSK_PAYLOAD_LENGTH, payloadLength)
+}
+
+// fskRxBandwidth returns the RegRxBw value of the smallest receiver bandwidth
+// greater or equal to bw (section 4.2.6)
+func fskRxBandwidth(bw uint32) uint8 {
+	mantissas := [3]uint32{24, 20, 16}
+	for exp := uint8(7); exp >= 1; exp-- {
+		for i, mant := range mantissas {
+			if FXOSC/(mant<<(exp+2)) >= bw {
+				return uint8(2-i)<<3 | exp
+			}
+		}
+	}
+	return 0x01 // 250 kHz, the largest bandwidth
+}
+
+// fskShaping returns the RegPaRamp ModulationShaping matching a
+// lora.FSKShaping* constant
+func fskShaping(shaping uint8) uint8 {
+	switch shaping {
+	case lora.FSKShapingBT1_0:
+		return 0x01
+	case lora.FSKShapingBT0_5:
+		return 0x02
+	case lora.FSKShapingBT0_3:
+		return 0x03
+	default:
+		return 0x00
+	}
+}
+
+// handleFSKInterrupt signals FSK packet events
+func (d *Device) handleFSKInterrupt() {
+	st := d.ReadRegister(SX127X_REG_IRQ_FLAGS_2)
+
+	if (st & SX127X_IRQ_FSK_PAYLOAD_READY) > 0 {
+		select {
+		case d.radioEventChan <- lora.NewRadioEvent(lora.RadioEventRxDone, uint16(st), nil):
+		default:
+		}
+	}
+
+	if (st & SX127X_IRQ_FSK_PACKET_SENT) > 0 {
+		select {
+		case d.radioEventChan <- lora.NewRadioEvent(lora.RadioEventTxDone, uint16(st), nil):
+		default:
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package sx127x
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"tinygo.org/x/drivers/lora"
+	"tinygo.org/x/drivers/tester"
+)
+
+// testController frames the register accesses on the mock SPI bus with the
+// NSS line
+type testController struct {
+	bus *tester.SPIBus
+	dev tester.SPIDevice
+}
+
+func (rc *testController) Init() error                          { return nil }
+func (rc *testController) SetupInterrupts(handler func()) error { return nil }
+
+func (rc *testController) SetNss(state bool) error {
+	if state {
+		rc.bus.Deselect()
+	} else {
+		rc.bus.Select(rc.dev)
+	}
+	return nil
+}
+
+// newTestDevice returns a device on a mock SPI bus, registers being written
+// with the address bit 7 set
+func newTestDevice(c *qt.C) (*Device, *tester.SPIBus, *tester.SPIDevice8) {
+	bus := tester.NewSPIBus(c)
+	dev := tester.NewSPIDevice8(c)
+	dev.ReadBit, dev.WriteBit = 0, 0x80
+	bus.AddDevice(dev)
+	d := NewPins(bus, nil)
+	c.Assert(d.SetRadioController(&testController{bus: bus, dev: dev}), qt.IsNil)
+	return d, bus, dev
+}
+
+var testFSKConfig = lora.FSKConfig{
+	Freq:          868800000,
+	BitRate:       50000,
+	FreqDeviation: 25000,
+	RxBandwidth:   100000,
+	Shaping:       lora.FSKShapingBT1_0,
+	Preamble:      5,
+	SyncWord:      []uint8{0xC1, 0x94, 0xC1},
+	Whitening:     true,
+	Crc:           lora.FSKCrcCCITT,
+	TxPowerDBm:    14,
+}
+
+func TestTxFSK(t *testing.T) {
+	c := qt.New(t)
+	d, bus, dev := newTestDevice(c)
+	c.Assert(d.TxFSK([]uint8("hello"), 100), qt.Equals, lora.ErrInvalidFSKConf)
+	c.Assert(d.FSKConfig(testFSKConfig), qt.IsNil)
+
+	d.radioEventChan <- lora.NewRadioEvent(lora.RadioEventTxDone, 0, nil)
+	c.Assert(d.TxFSK([]uint8("hello"), 100), qt.IsNil)
+
+	regs := func(reg, n int) []uint8 {
+		return dev.Registers[reg : reg+n]
+	}
+	c.Assert(dev.Registers[SX127X_REG_OP_MODE]&SX127X_OPMODE_LORA, qt.Equals, uint8(0))
+	// 868.8 MHz
+	c.Assert(regs(SX127X_REG_FRF_MSB, 3), qt.DeepEquals, []uint8{0xD9, 0x33, 0x33})
+	// 50 kbps, 25 kHz deviation, 100 kHz receiver bandwidth
+	c.Assert(regs(SX127X_REG_BITRATE_MSB, 2), qt.DeepEquals, []uint8{0x02, 0x80})
+	c.Assert(regs(SX127X_REG_FDEV_MSB, 2), qt.DeepEquals, []uint8{0x01, 0x99})
+	c.Assert(dev.Registers[SX127X_REG_RX_BW], qt.Equals, uint8(0x0A))
+	// BT 1.0
+	c.Assert(dev.Registers[SX127X_REG_PA_RAMP]>>5, qt.Equals, uint8(0x01))
+	c.Assert(regs(SX127X_REG_FSK_PREAMBLE_MSB, 2), qt.DeepEquals, []uint8{0x00, 0x05})
+	// 3 bytes sync word
+	c.Assert(dev.Registers[SX127X_REG_SYNC_CONFIG], qt.Equals, uint8(0x52))
+	c.Assert(regs(SX127X_REG_SYNC_VALUE_1, 3), qt.DeepEquals, []uint8{0xC1, 0x94, 0xC1})
+	// Variable length, whitening, CCITT CRC
+	c.Assert(dev.Registers[SX127X_REG_PACKET_CONFIG_1], qt.Equals, uint8(0xD0))
+	c.Assert(dev.Registers[SX127X_REG_FSK_PAYLOAD_LENGTH], qt.Equals, uint8(FSK_FIFO_SIZE-1))
+
+	// The length byte, then the payload
+	fifo := []uint8{}
+	for _, tx := range bus.Log {
+		if len(tx.W) == 2 && tx.W[0] == 0x80|SX127X_REG_FIFO {
+			fifo = append(fifo, tx.W[1])
+		}
+	}
+	c.Assert(fifo, qt.DeepEquals, []uint8("\x05hello"))
+}
+
+func TestTxFSKTooLarge(t *testing.T) {
+	c := qt.New(t)
+	d, bus, _ := newTestDevice(c)
+	c.Assert(d.FSKConfig(testFSKConfig), qt.IsNil)
+
+	// The packet must fit in the FIFO with its length byte
+	c.Assert(d.TxFSK(make([]uint8, FSK_FIFO_SIZE), 100), qt.Equals, errFSKPacketTooLarge)
+	c.Assert(bus.Log, qt.HasLen, 0)
+}
+
+func TestRxFSKFixedLength(t *testing.T) {
+	c := qt.New(t)
+	d, _, dev := newTestDevice(c)
+	cnf := testFSKConfig
+	cnf.FixedLength = 16
+	cnf.Crc = lora.FSKCrcIBM
+	cnf.Whitening = false
+	c.Assert(d.FSKConfig(cnf), qt.IsNil)
+
+	d.radioEventChan <- lora.NewRadioEvent(lora.RadioEventRxDone, 0, nil)
+	dev.Registers[SX127X_REG_FIFO] = 0x42
+	pkt, err := d.RxFSK(100)
+	c.Assert(err, qt.IsNil)
+	c.Assert(pkt, qt.HasLen, 16)
+	c.Assert(pkt[0], qt.Equals, uint8(0x42))
+
+	c.Assert(dev.Registers[SX127X_REG_PACKET_CONFIG_1], qt.Equals, uint8(0x11))
+	c.Assert(dev.Registers[SX127X_REG_FSK_PAYLOAD_LENGTH], qt.Equals, uint8(16))
+}
@@ -43,6 +43,26 @@ const (
 	SX127X_REG_DIO_MAPPING_2        = 0x41
 	SX127X_REG_VERSION              = 0x42
 	SX127X_REG_PA_DAC               = 0x4d
+
+	// FSK/OOK mode registers
+	SX127X_REG_BITRATE_MSB        = 0x02
+	SX127X_REG_BITRATE_LSB        = 0x03
+	SX127X_REG_FDEV_MSB           = 0x04
+	SX127X_REG_FDEV_LSB           = 0x05
+	SX127X_REG_RX_CONFIG          = 0x0d
+	SX127X_REG_RX_BW              = 0x12
+	SX127X_REG_AFC_BW             = 0x13
+	SX127X_REG_PREAMBLE_DETECT    = 0x1f
+	SX127X_REG_FSK_PREAMBLE_MSB   = 0x25
+	SX127X_REG_FSK_PREAMBLE_LSB   = 0x26
+	SX127X_REG_SYNC_CONFIG        = 0x27
+	SX127X_REG_SYNC_VALUE_1       = 0x28
+	SX127X_REG_PACKET_CONFIG_1    = 0x30
+	SX127X_REG_PACKET_CONFIG_2    = 0x31
+	SX127X_REG_FSK_PAYLOAD_LENGTH = 0x32
+	SX127X_REG_FIFO_THRESH        = 0x35
+	SX127X_REG_IRQ_FLAGS_1        = 0x3e
+	SX127X_REG_IRQ_FLAGS_2        = 0x3f
 	// PA config
 	SX127X_PA_BOOST = 0x80
 
@@ -56,9 +76,15 @@ const (
 	SX127X_IRQ_LORA_FHSSCH_MASK = uint8(0x02)
 	SX127X_IRQ_LORA_CDDETD_MASK = uint8(0x01)
 
+	// FSK IRQ flags 2
+	SX127X_IRQ_FSK_PACKET_SENT   = uint8(0x08)
+	SX127X_IRQ_FSK_PAYLOAD_READY = uint8(0x04)
+	SX127X_IRQ_FSK_CRC_OK        = uint8(0x02)
+
 	// DIO function mappings                D0D1D2D3
 	SX127X_MAP_DIO0_LORA_RXDONE = uint8(0x00) // 00------
 	SX127X_MAP_DIO0_LORA_TXDONE = uint8(0x40) // 01------
+	SX127X_MAP_DIO0_LORA_CADONE = uint8(0x80) // 10------
 	SX127X_MAP_DIO1_LORA_RXTOUT = uint8(0x00) // --00----
 	SX127X_MAP_DIO1_LORA_NOP    = uint8(0x30) // --11----
 	SX127X_MAP_DIO2_LORA_NOP    = uint8(0xC0) // ----11--
@@ -86,6 +112,7 @@ const (
 	SX127X_AGC_AUTO_ON  = uint8(0x01)
 	// Operation modes
 	SX127X_OPMODE_LORA      = uint8(0x80)
+	SX127X_OPMODE_FSK       = uint8(0x00)
 	SX127X_OPMODE_MASK      = uint8(0x07)
 	SX127X_OPMODE_SLEEP     = uint8(0x00)
 	SX127X_OPMODE_STANDBY   = uint8(0x01)
@@ -6,7 +6,7 @@ package sx127x
 
 import (
 	"errors"
-	"machine"
+	"strconv"
 	"time"
 
 	"tinygo.org/x/drivers"
@@ -17,19 +17,25 @@ import (
 const (
 	RADIOEVENTCHAN_SIZE = 1
 	SPI_BUFFER_SIZE     = 5
+	LBT_CAD_TIMEOUT_MS  = 100
+	// RF_LF port is used below this frequency, with a different RSSI offset
+	LF_PORT_MAX_FREQUENCY = 525000000
 )
 
 // Device wraps an SPI connection to a SX127x device.
 type Device struct {
-	spi            drivers.SPI          // SPI bus for module communication
-	rstPin         machine.Pin          // GPIO for reset
-	radioEventChan chan lora.RadioEvent // Channel for Receiving events
-	loraConf       lora.Config          // Current Lora configuration
-	controller     RadioController      // to manage interactions with the radio
-	deepSleep      bool                 // Internal Sleep state
-	deviceType     int                  // sx1261,sx1262,sx1268 (defaults sx1261)
-	spiTxBuf       []byte               // global Tx buffer to avoid heap allocations in interrupt
-	spiRxBuf       []byte               // global Rx buffer to avoid heap allocations in interrupt
+	spi            drivers.SPI           // SPI bus for module communication
+	rstPin         drivers.Pin           // GPIO for reset
+	radioEventChan chan lora.RadioEvent  // Channel for Receiving events
+	loraConf       lora.Config           // Current Lora configuration
+	controller     RadioController       // to manage interactions with the radio
+	deepSleep      bool                  // Internal Sleep state
+	deviceType     int                   // sx1261,sx1262,sx1268 (defaults sx1261)
+	spiTxBuf       []byte                // global Tx buffer to avoid heap allocations in interrupt
+	spiRxBuf       []byte                // global Rx buffer to avoid heap allocations in interrupt
+	lbt            lora.ListenBeforeTalk // Carrier sensing before Tx
+	fskConf        lora.FSKConfig        // Current (G)FSK configuration
+	fskMode        bool                  // FSK/OOK mode in use instead of LoRa
 }
 
 // --------------------------------------------------
@@ -42,8 +48,9 @@ func (d *Device) GetRadioEventChan() chan lora.RadioEvent {
 	return d.radioEventChan
 }
 
-// New creates a new SX127x connection. The SPI bus must already be configured.
-func New(spi machine.SPI, rstPin machine.Pin) *Device {
+// NewPins creates a new SX127x connection. The SPI bus must already be
+// configured.
+func NewPins(spi drivers.SPI, rstPin drivers.Pin) *Device {
 	k := Device{
 		spi:            spi,
 		rstPin:         rstPin,
@@ -67,9 +74,9 @@ func (d *Device) SetRadioController(rc RadioController) error {
 
 // Reset re-initialize the sx127x device
 func (d *Device) Reset() {
-	d.rstPin.Low()
+	d.rstPin.Set(false)
 	time.Sleep(100 * time.Millisecond)
-	d.rstPin.High()
+	d.rstPin.Set(true)
 	time.Sleep(100 * time.Millisecond)
 }
 
@@ -122,6 +129,7 @@ func (d *Device) SetOpMode(mode uint8) {
 // SetOpMode changes the sx1276 mode
 func (d *Device) SetOpModeLora() {
 	d.WriteRegister(SX127X_REG_OP_MODE, SX127X_OPMODE_LORA)
+	d.fskMode = false
 }
 
 // GetVersion returns hardware version of sx1276 chipset
@@ -134,26 +142,39 @@ func (d *Device) IsTransmitting() bool {
 	return (d.ReadRegister(SX127X_REG_OP_MODE) & SX127X_OPMODE_TX) == SX127X_OPMODE_TX
 }
 
-// LastPacketRSSI gives the RSSI of the last packet received
-func (d *Device) LastPacketRSSI() uint8 {
+// LastPacketRSSI gives the RSSI of the last packet received in dBm
+func (d *Device) LastPacketRSSI() int16 {
 	// section 5.5.5
-	var adjustValue uint8 = 157
-	if d.loraConf.Freq < 868000000 {
-		adjustValue = 164
+	pktRssi := int16(d.ReadRegister(SX127X_REG_PKT_RSSI_VALUE))
+	if snr := d.LastPacketSNR(); snr < 0 {
+		return d.rssiOffset() + pktRssi + int16(snr)
 	}
-	return d.ReadRegister(SX127X_REG_PKT_RSSI_VALUE) - adjustValue
+	return d.rssiOffset() + pktRssi*16/15
 }
 
-// LastPacketSNR gives the SNR of the last packet received
-func (d *Device) LastPacketSNR() uint8 {
-	return uint8(d.ReadRegister(SX127X_REG_PKT_SNR_VALUE) / 4)
+// LastPacketSNR gives the SNR of the last packet received in dB
+func (d *Device) LastPacketSNR() int8 {
+	return int8(d.ReadRegister(SX127X_REG_PKT_SNR_VALUE)) / 4
 }
 
-// GetRSSI returns current RSSI
+// GetRSSI returns current RSSI register value
 func (d *Device) GetRSSI() uint8 {
 	return d.ReadRegister(SX127X_REG_RSSI_VALUE)
 }
 
+// CurrentRSSI returns current RSSI in dBm, while in RX
+func (d *Device) CurrentRSSI() int16 {
+	return d.rssiOffset() + int16(d.ReadRegister(SX127X_REG_RSSI_VALUE))
+}
+
+// rssiOffset returns the RSSI offset of the RF port in use (section 5.5.5)
+func (d *Device) rssiOffset() int16 {
+	if d.loraConf.Freq < LF_PORT_MAX_FREQUENCY {
+		return -164
+	}
+	return -157
+}
+
 /*
 // GetBandwidth returns the bandwidth the LoRa module is using
 func (d *Device) GetBandwidth() int32 {
@@ -367,6 +388,10 @@ func (d *Device) SetPublicNetwork(enabled bool) {
 
 // Tx sends a lora packet, (with timeout)
 func (d *Device) Tx(pkt []uint8, timeoutMs uint32) error {
+	if err := d.lbt.Wait(d.channelBusy); err != nil {
+		return err
+	}
+
 	d.SetOpModeLora()
 	d.SetOpMode(SX127X_OPMODE_SLEEP)
 
@@ -412,7 +437,7 @@ func (d *Device) Tx(pkt []uint8, timeoutMs uint32) error {
 
 	msg := <-d.GetRadioEventChan()
 	if msg.EventType != lora.RadioEventTxDone {
-		return errors.New("Unexpected Radio Event while TX " + string(0x30+msg.EventType))
+		return errors.New("Unexpected Radio Event while TX " + strconv.Itoa(msg.EventType))
 	}
 	return nil
 }
@@ -422,7 +447,117 @@ func (d *Device) Rx(timeoutMs uint32) ([]uint8, error) {
 	if d.loraConf.Freq == 0 {
 		return nil, lora.ErrUndefinedLoraConf
 	}
+	d.prepareRx()
+
+	// Single RX mode don't properly handle Timeouts on sx127x, so we use Continuous RX
+	// Go routine is a workaround to stop the Continuous RX and fire a timeout Event
+	d.SetOpMode(SX127X_OPMODE_RX)
+
+	var msg lora.RadioEvent
+	select {
+	case msg = <-d.radioEventChan:
+		if msg.EventType != lora.RadioEventRxDone {
+			return nil, errors.New("Unexpected Radio Event while RX " + strconv.Itoa(msg.EventType))
+		}
+	case <-time.After(time.Millisecond * time.Duration(timeoutMs)):
+		d.SetOpMode(SX127X_OPMODE_STANDBY)
+		return nil, nil
+	}
+
+	return d.ReadRxPacket(), nil
+}
+
+// StartRxContinuous sets the radio in continuous receive mode and returns
+// immediately. Received packets are signaled on the radio event channel.
+func (d *Device) StartRxContinuous() error {
+	if d.loraConf.Freq == 0 {
+		return lora.ErrUndefinedLoraConf
+	}
+	d.prepareRx()
+	d.SetOpMode(SX127X_OPMODE_RX)
+	return nil
+}
+
+// StopRxContinuous leaves continuous receive mode
+func (d *Device) StopRxContinuous() {
+	d.SetOpMode(SX127X_OPMODE_STANDBY)
+}
+
+// ReadRxPacket returns the last packet received
+func (d *Device) ReadRxPacket() []uint8 {
+	d.WriteRegister(SX127X_REG_FIFO_RX_BASE_ADDR, 0)
+	d.WriteRegister(SX127X_REG_FIFO_ADDR_PTR, 0)
+
+	pLen := d.ReadRegister(SX127X_REG_RX_NB_BYTES)
+	d.WriteRegister(SX127X_REG_FIFO_ADDR_PTR, d.ReadRegister(SX127X_REG_FIFO_RX_CURRENT_ADDR))
+
+	rxData := []uint8{}
+	for i := uint8(0); i < pLen; i++ {
+		rxData = append(rxData, d.ReadRegister(SX127X_REG_FIFO))
+	}
+	return rxData
+}
+
+// Cad runs a Channel Activity Detection on the current channel, and returns
+// true if a Lora preamble was detected
+func (d *Device) Cad(timeoutMs uint32) (bool, error) {
+	if d.loraConf.Freq == 0 {
+		return false, lora.ErrUndefinedLoraConf
+	}
+	d.prepareRx()
+
+	// set the IRQ mapping DIO0=CadDone DIO1=NOP
+	d.WriteRegister(SX127X_REG_DIO_MAPPING_1, SX127X_MAP_DIO0_LORA_CADONE|SX127X_MAP_DIO1_LORA_NOP)
+	// Clear all radio IRQ Flags
+	d.WriteRegister(SX127X_REG_IRQ_FLAGS, 0xFF)
+	// Mask all but CadDone and CadDetected
+	d.WriteRegister(SX127X_REG_IRQ_FLAGS_MASK, ^(SX127X_IRQ_LORA_CDDONE_MASK | SX127X_IRQ_LORA_CDDETD_MASK))
+	d.SetOpMode(SX127X_OPMODE_CAD)
 
+	select {
+	case msg := <-d.radioEventChan:
+		switch msg.EventType {
+		case lora.RadioEventCadDetected:
+			return true, nil
+		case lora.RadioEventCadDone:
+			return false, nil
+		}
+		return false, errors.New("Unexpected Radio Event while CAD " + strconv.Itoa(msg.EventType))
+	case <-time.After(time.Millisecond * time.Duration(timeoutMs)):
+		d.SetOpMode(SX127X_OPMODE_STANDBY)
+		return false, errors.New("CAD Timeout")
+	}
+}
+
+// SetListenBeforeTalk configures carrier sensing before each Tx
+func (d *Device) SetListenBeforeTalk(lbt lora.ListenBeforeTalk) {
+	d.lbt = lbt
+}
+
+// channelBusy senses the current channel according to the Listen Before Talk
+// configuration
+func (d *Device) channelBusy() (bool, error) {
+	if d.lbt.UseCAD {
+		return d.Cad(LBT_CAD_TIMEOUT_MS)
+	}
+	if d.loraConf.Freq == 0 {
+		return false, lora.ErrUndefinedLoraConf
+	}
+
+	d.prepareRx()
+	d.SetOpMode(SX127X_OPMODE_RX)
+	defer d.SetOpMode(SX127X_OPMODE_STANDBY)
+
+	busy := false
+	deadline := time.Now().Add(time.Duration(d.lbt.SenseTimeMs) * time.Millisecond)
+	for !busy && time.Now().Before(deadline) {
+		busy = d.CurrentRSSI() > d.lbt.RSSIThresholdDBm
+	}
+	return busy, nil
+}
+
+// prepareRx configures the radio for Lora reception
+func (d *Device) prepareRx() {
 	d.SetOpModeLora()
 	d.SetOpMode(SX127X_OPMODE_SLEEP)
 
@@ -449,34 +584,6 @@ func (d *Device) Rx(timeoutMs uint32) ([]uint8, error) {
 	d.WriteRegister(SX127X_REG_IRQ_FLAGS, 0xFF)
 	// Mask all but RxDone
 	d.WriteRegister(SX127X_REG_IRQ_FLAGS_MASK, ^(SX127X_IRQ_LORA_RXDONE_MASK | SX127X_IRQ_LORA_RXTOUT_MASK))
-
-	// Single RX mode don't properly handle Timeouts on sx127x, so we use Continuous RX
-	// Go routine is a workaround to stop the Continuous RX and fire a timeout Event
-	d.SetOpMode(SX127X_OPMODE_RX)
-
-	var msg lora.RadioEvent
-	select {
-	case msg = <-d.radioEventChan:
-		if msg.EventType != lora.RadioEventRxDone {
-			return nil, errors.New("Unexpected Radio Event while RX " + string(0x30+msg.EventType))
-		}
-	case <-time.After(time.Millisecond * time.Duration(timeoutMs)):
-		d.SetOpMode(SX127X_OPMODE_STANDBY)
-		return nil, nil
-	}
-
-	// Get the received payload
-	d.WriteRegister(SX127X_REG_FIFO_RX_BASE_ADDR, 0)
-	d.WriteRegister(SX127X_REG_FIFO_ADDR_PTR, 0)
-
-	pLen := d.ReadRegister(SX127X_REG_RX_NB_BYTES)
-	d.WriteRegister(SX127X_REG_FIFO_ADDR_PTR, d.ReadRegister(SX127X_REG_FIFO_RX_CURRENT_ADDR))
-
-	rxData := []uint8{}
-	for i := uint8(0); i < pLen; i++ {
-		rxData = append(rxData, d.ReadRegister(SX127X_REG_FIFO))
-	}
-	return rxData, nil
 }
 
 // SetTxContinuousMode enable Continuous Tx mode
@@ -520,6 +627,11 @@ func (d *Device) RandomU32() uint32 {
 
 // HandleInterrupt must be called by main code on DIO state change.
 func (d *Device) HandleInterrupt() {
+	// FSK IRQ flags are cleared by the radio, and RegIrqFlags is RegRxBw in FSK mode
+	if d.fskMode {
+		d.handleFSKInterrupt()
+		return
+	}
 
 	// Get IRQ and clear
 	st := d.ReadRegister(SX127X_REG_IRQ_FLAGS)
@@ -527,28 +639,39 @@ func (d *Device) HandleInterrupt() {
 
 	if (st & SX127X_IRQ_LORA_RXDONE_MASK) > 0 {
 		select {
-		case d.radioEventChan <- lora.RadioEvent{lora.RadioEventRxDone, uint16(st), nil}:
+		case d.radioEventChan <- lora.NewRadioEvent(lora.RadioEventRxDone, uint16(st), nil):
 		default:
 		}
 	}
 
 	if (st & SX127X_IRQ_LORA_TXDONE_MASK) > 0 {
 		select {
-		case d.radioEventChan <- lora.RadioEvent{lora.RadioEventTxDone, uint16(st), nil}:
+		case d.radioEventChan <- lora.NewRadioEvent(lora.RadioEventTxDone, uint16(st), nil):
 		default:
 		}
 	}
 
 	if (st & SX127X_IRQ_LORA_RXTOUT_MASK) > 0 {
 		select {
-		case d.radioEventChan <- lora.RadioEvent{lora.RadioEventTimeout, uint16(st), nil}:
+		case d.radioEventChan <- lora.NewRadioEvent(lora.RadioEventTimeout, uint16(st), nil):
 		default:
 		}
 	}
 
 	if (st & SX127X_IRQ_LORA_CRCERR_MASK) > 0 {
 		select {
-		case d.radioEventChan <- lora.RadioEvent{lora.RadioEventCrcError, uint16(st), nil}:
+		case d.radioEventChan <- lora.NewRadioEvent(lora.RadioEventCrcError, uint16(st), nil):
+		default:
+		}
+	}
+
+	if (st & SX127X_IRQ_LORA_CDDONE_MASK) > 0 {
+		eventType := lora.RadioEventCadDone
+		if (st & SX127X_IRQ_LORA_CDDETD_MASK) > 0 {
+			eventType = lora.RadioEventCadDetected
+		}
+		select {
+		case d.radioEventChan <- lora.NewRadioEvent(eventType, uint16(st), nil):
 		default:
 		}
 	}
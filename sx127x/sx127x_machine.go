@@ -0,0 +1,14 @@
+//go:build tinygo
+
+package sx127x
+
+import (
+	"machine"
+
+	"tinygo.org/x/drivers/pin"
+)
+
+// New creates a new SX127x connection. The SPI bus must already be configured.
+func New(spi machine.SPI, rstPin machine.Pin) *Device {
+	return NewPins(spi, pin.Pin(rstPin))
+}
@@ -1,6 +1,6 @@
 package tester
 
-// Cmd represents a command sent via I2C to a device.
+// Cmd represents a command sent via I2C or SPI to a device.
 //
 // A command matches when (Command & Mask) == (Data & Mask).  If
 // a command is recognized, Response bytes is returned.
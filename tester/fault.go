@@ -0,0 +1,137 @@
+package tester
+
+import "time"
+
+// Fault is a fault injected in the transactions of a mock bus, to test how a
+// driver handles bus errors and corrupted data:
+//
+//	// The device doesn't acknowledge the next transaction
+//	bus.Inject(tester.Fault{Tx: 1, Addr: 0x44, Err: drivers.ErrNack})
+//	// The device is missing
+//	bus.Inject(tester.Fault{Addr: 0x44, Err: drivers.ErrNack})
+//	// Bit 0 of the third byte read in the second transaction is flipped
+//	bus.Inject(tester.Fault{Tx: 2, Flip: []byte{0, 0, 0x01}})
+//	// The high bit of the first byte read is always dropped, stuck low
+//	bus.Inject(tester.Fault{Drop: []byte{0x80}})
+//
+// On an SPI bus, each Tx or Transfer call is a transaction.
+type Fault struct {
+	// Tx is the transaction faulted, counting from 1 the transactions
+	// following Inject.  If zero, all the transactions are faulted.
+	Tx int
+
+	// Addr is the address of the I2C device faulted.  If zero, the
+	// transactions with any device are faulted, and counted by Tx.
+	Addr uint16
+
+	// Stretch delays the transaction, like a device stretching the clock.
+	Stretch time.Duration
+
+	// Err is returned instead of doing the transaction, if non-nil.  The
+	// device doesn't see the transaction, so a missing device can be
+	// faulted.  drivers.ErrNack is what the i2csoft bus returns, the
+	// machine I2C buses return errors of their own.
+	Err error
+
+	// Flip is XORed into the bytes read, to flip the bits of the bytes
+	// set.
+	Flip []byte
+
+	// Drop clears the bits of the bytes read set, like data lines stuck
+	// low.  The bits are dropped before being flipped.
+	Drop []byte
+}
+
+// fault is an injected fault, with the count of the transactions seen.
+type fault struct {
+	Fault
+	seen int
+}
+
+// faults are the faults injected in a mock bus.
+type faults []*fault
+
+// inject adds the fault f.
+func (fs *faults) inject(f Fault) {
+	*fs = append(*fs, &fault{Fault: f})
+}
+
+// next returns the fault of the next transaction, with the device at addr,
+// combining the faults injected.  The faults of a single transaction are
+// removed once done.
+func (fs *faults) next(addr uint16) Fault {
+	var next Fault
+	kept := (*fs)[:0]
+	for _, f := range *fs {
+		if f.Addr != 0 && f.Addr != addr {
+			kept = append(kept, f)
+			continue
+		}
+		f.seen++
+		if f.Tx == 0 || f.Tx == f.seen {
+			next.Stretch += f.Stretch
+			if next.Err == nil {
+				next.Err = f.Err
+			}
+			next.Flip = xor(next.Flip, f.Flip)
+			next.Drop = or(next.Drop, f.Drop)
+		}
+		if f.Tx == 0 || f.Tx > f.seen {
+			kept = append(kept, f)
+		}
+	}
+	*fs = kept
+	return next
+}
+
+// before stretches the transaction, and returns the error of the fault.
+func (f Fault) before() error {
+	if f.Stretch > 0 {
+		time.Sleep(f.Stretch)
+	}
+	return f.Err
+}
+
+// after drops and flips the bits of the bytes read r.
+func (f Fault) after(r []byte) {
+	for i := range r {
+		r[i] = f.corrupt(i, r[i])
+	}
+}
+
+// corrupt returns the byte read i, b, with its bits dropped and flipped.
+func (f Fault) corrupt(i int, b byte) byte {
+	return b&^byteAt(f.Drop, i) ^ byteAt(f.Flip, i)
+}
+
+// byteAt returns the byte i of b, zero past its end.
+func byteAt(b []byte, i int) byte {
+	if i < len(b) {
+		return b[i]
+	}
+	return 0
+}
+
+// xor returns the bytes a XORed with the bytes b.
+func xor(a, b []byte) []byte {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	x := append([]byte(nil), a...)
+	for i := range b {
+		x[i] ^= b[i]
+	}
+	return x
+}
+
+// or returns the bytes a ORed with the bytes b.
+func or(a, b []byte) []byte {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	x := append([]byte(nil), a...)
+	for i := range b {
+		x[i] |= b[i]
+	}
+	return x
+}
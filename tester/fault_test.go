@@ -0,0 +1,74 @@
+package tester
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"tinygo.org/x/drivers"
+)
+
+func TestI2CFaults(t *testing.T) {
+	c := qt.New(t)
+	bus := NewI2CBus(c)
+	d := NewI2CDevice8(c, 8)
+	d.Registers[3] = 0x12
+	d.Registers[4] = 0x34
+	bus.AddDevice(d)
+
+	// Nack of the second transaction with the device
+	bus.Inject(Fault{Tx: 2, Addr: 8, Err: drivers.ErrNack})
+	// Missing device
+	bus.Inject(Fault{Addr: 9, Err: drivers.ErrNack})
+
+	buf := make([]byte, 2)
+	c.Assert(bus.Tx(8, []byte{3}, buf), qt.IsNil)
+	c.Assert(bus.Tx(9, []byte{3}, buf), qt.Equals, drivers.ErrNack)
+	c.Assert(bus.Tx(8, []byte{3}, buf), qt.Equals, drivers.ErrNack)
+	c.Assert(bus.Tx(8, []byte{3}, buf), qt.IsNil)
+	c.Assert(bus.Tx(9, []byte{3}, buf), qt.Equals, drivers.ErrNack)
+
+	// Bit flips in the first transaction, on top of a stretched clock
+	bus.ClearFaults()
+	bus.Inject(Fault{Tx: 1, Flip: []byte{0x01}})
+	bus.Inject(Fault{Tx: 1, Flip: []byte{0x80, 0x80}, Stretch: 5 * time.Millisecond})
+	start := time.Now()
+	c.Assert(bus.ReadRegister(8, 3, buf), qt.IsNil)
+	c.Assert(time.Since(start) >= 5*time.Millisecond, qt.IsTrue)
+	c.Assert(buf, qt.DeepEquals, []byte{0x93, 0xb4})
+	c.Assert(bus.ReadRegister(8, 3, buf), qt.IsNil)
+	c.Assert(buf, qt.DeepEquals, []byte{0x12, 0x34})
+
+	// Dropped bits, before the flips
+	bus.Inject(Fault{Drop: []byte{0x02, 0x30}})
+	bus.Inject(Fault{Tx: 1, Drop: []byte{0x10}, Flip: []byte{0x02}})
+	c.Assert(bus.Tx(8, []byte{3}, buf), qt.IsNil)
+	c.Assert(buf, qt.DeepEquals, []byte{0x02, 0x04})
+	c.Assert(bus.Tx(8, []byte{3}, buf), qt.IsNil)
+	c.Assert(buf, qt.DeepEquals, []byte{0x10, 0x04})
+}
+
+func TestSPIFaults(t *testing.T) {
+	c := qt.New(t)
+	bus := NewSPIBus(c)
+	d := NewSPIDevice8(c)
+	d.Registers[3] = 0x12
+	bus.AddDevice(d)
+
+	errBus := errors.New("spi: dma error")
+	bus.Inject(Fault{Tx: 1, Err: errBus})
+	bus.Inject(Fault{Tx: 2, Flip: []byte{0, 0x01}})
+	bus.Inject(Fault{Tx: 3, Drop: []byte{0, 0x02}})
+
+	buf := make([]byte, 2)
+	c.Assert(bus.Tx([]byte{0x83, 0}, buf), qt.Equals, errBus)
+	c.Assert(bus.Tx([]byte{0x83, 0}, buf), qt.IsNil)
+	c.Assert(buf, qt.DeepEquals, []byte{0, 0x13})
+	c.Assert(bus.Tx([]byte{0x83, 0}, buf), qt.IsNil)
+	c.Assert(buf, qt.DeepEquals, []byte{0, 0x10})
+	c.Assert(bus.Log, qt.DeepEquals, []SPITransaction{
+		{W: []byte{0x83, 0}, R: []byte{0, 0x13}},
+		{W: []byte{0x83, 0}, R: []byte{0, 0x10}},
+	})
+}
@@ -6,6 +6,7 @@ import "fmt"
 type I2CBus struct {
 	c       Failer
 	devices []I2CDevice
+	faults  faults
 }
 
 // NewI2CBus returns an I2CBus mock I2C instance that uses c to flag errors
@@ -36,19 +37,44 @@ func (bus *I2CBus) NewDevice(addr uint8) *I2CDevice8 {
 	return dev
 }
 
+// Inject injects the fault f in the next transactions.
+func (bus *I2CBus) Inject(f Fault) {
+	bus.faults.inject(f)
+}
+
+// ClearFaults removes the faults injected.
+func (bus *I2CBus) ClearFaults() {
+	bus.faults = nil
+}
+
 // ReadRegister implements I2C.ReadRegister.
 func (bus *I2CBus) ReadRegister(addr uint8, r uint8, buf []byte) error {
-	return bus.FindDevice(addr).readRegister(r, buf)
+	f := bus.faults.next(uint16(addr))
+	if err := f.before(); err != nil {
+		return err
+	}
+	err := bus.FindDevice(addr).readRegister(r, buf)
+	f.after(buf)
+	return err
 }
 
 // WriteRegister implements I2C.WriteRegister.
 func (bus *I2CBus) WriteRegister(addr uint8, r uint8, buf []byte) error {
+	if err := bus.faults.next(uint16(addr)).before(); err != nil {
+		return err
+	}
 	return bus.FindDevice(addr).writeRegister(r, buf)
 }
 
 // Tx implements I2C.Tx.
 func (bus *I2CBus) Tx(addr uint16, w, r []byte) error {
-	return bus.FindDevice(uint8(addr)).Tx(w, r)
+	f := bus.faults.next(addr)
+	if err := f.before(); err != nil {
+		return err
+	}
+	err := bus.FindDevice(uint8(addr)).Tx(w, r)
+	f.after(r)
+	return err
 }
 
 // FindDevice returns the device with the given address.
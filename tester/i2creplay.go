@@ -0,0 +1,94 @@
+package tester
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"tinygo.org/x/drivers"
+)
+
+// I2CReplay is a mock I2C bus replaying a transcript, as recorded by an
+// I2CRecorder.
+//
+// Each call to Tx must be the next transaction of the transcript, with the
+// same address, the same bytes written and as many bytes to read: Tx then
+// returns the bytes read and the error of the transcript.  Any other call
+// fails the test.  The messages of drivers.ErrNack and drivers.ErrTimeout
+// are replayed as these errors, for the drivers checking them with
+// errors.Is.
+type I2CReplay struct {
+	c    Failer
+	txs  []I2CTx
+	next int
+}
+
+// NewI2CReplay returns an I2CReplay mock I2C bus replaying the transcript
+// read from r, that uses c to flag errors if they happen.
+func NewI2CReplay(c Failer, r io.Reader) *I2CReplay {
+	txs, err := ParseI2CTranscript(r)
+	if err != nil {
+		c.Fatalf("i2c replay: %v", err)
+	}
+	return NewI2CReplayTx(c, txs)
+}
+
+// NewI2CReplayTx returns an I2CReplay mock I2C bus replaying the
+// transactions txs, that uses c to flag errors if they happen.
+func NewI2CReplayTx(c Failer, txs []I2CTx) *I2CReplay {
+	return &I2CReplay{
+		c:   c,
+		txs: txs,
+	}
+}
+
+// Tx implements I2C.Tx.
+func (bus *I2CReplay) Tx(addr uint16, w, r []byte) error {
+	got := I2CTx{Addr: addr, W: w}
+	if bus.next == len(bus.txs) {
+		bus.c.Fatalf("i2c replay: got %s after the end of the transcript", got)
+		return nil
+	}
+	tx := bus.txs[bus.next]
+	if addr != tx.Addr || !bytes.Equal(w, tx.W) ||
+		(tx.Err == "" && len(r) != len(tx.R)) {
+		bus.c.Fatalf("i2c replay: %s: got %s reading %d bytes, expected %s",
+			bus.position(), got, len(r), tx)
+		return nil
+	}
+	bus.next++
+
+	if tx.Err != "" {
+		return replayError(tx.Err)
+	}
+	copy(r, tx.R)
+	return nil
+}
+
+// replayError returns the bus error with the message msg
+func replayError(msg string) error {
+	for _, err := range []error{drivers.ErrNack, drivers.ErrTimeout} {
+		if msg == err.Error() {
+			return err
+		}
+	}
+	return errors.New(msg)
+}
+
+// Done checks that all the transactions of the transcript were replayed.
+func (bus *I2CReplay) Done() {
+	if left := len(bus.txs) - bus.next; left > 0 {
+		bus.c.Fatalf("i2c replay: %d transactions left, from %s",
+			left, bus.position())
+	}
+}
+
+// position returns the position of the next transaction in the transcript.
+func (bus *I2CReplay) position() string {
+	tx := bus.txs[bus.next]
+	if tx.line == 0 {
+		return fmt.Sprintf("transaction %d", bus.next+1)
+	}
+	return fmt.Sprintf("line %d", tx.line)
+}
@@ -0,0 +1,168 @@
+package tester
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"tinygo.org/x/drivers"
+)
+
+// I2CTx is an I2C transaction of a transcript, a call to Tx.
+//
+// A transcript is a text file with a transaction per line, in the format:
+//
+//	<addr> [w <hex>] [r <hex>] [+<delay>] [err <message>]
+//
+// such as:
+//
+//	# Read the BME280 chip id
+//	0x77 w d0 r 60 +2ms
+//
+// with the address, the bytes written, the bytes read, the delay since the
+// previous transaction, and the error returned.  Blank lines and lines
+// starting with # are ignored.
+type I2CTx struct {
+	Addr uint16
+	W    []byte
+	R    []byte
+
+	// Delay is the time since the end of the previous transaction, if
+	// recorded.  It documents the timing of the driver, the replay doesn't
+	// check it.
+	Delay time.Duration
+
+	// Err is the error returned by Tx, if any.
+	Err string
+
+	// line is the line of the transaction in the transcript.
+	line int
+}
+
+// String returns the transaction in the transcript format.
+func (tx I2CTx) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "0x%02x", tx.Addr)
+	if len(tx.W) > 0 {
+		fmt.Fprintf(&b, " w %x", tx.W)
+	}
+	if len(tx.R) > 0 {
+		fmt.Fprintf(&b, " r %x", tx.R)
+	}
+	if tx.Delay > 0 {
+		fmt.Fprintf(&b, " +%v", tx.Delay)
+	}
+	if tx.Err != "" {
+		fmt.Fprintf(&b, " err %s", tx.Err)
+	}
+	return b.String()
+}
+
+// ParseI2CTranscript parses the transactions of a transcript.
+func ParseI2CTranscript(r io.Reader) ([]I2CTx, error) {
+	var txs []I2CTx
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		tx, err := parseI2CTx(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		tx.line = line
+		txs = append(txs, tx)
+	}
+	return txs, scanner.Err()
+}
+
+func parseI2CTx(text string) (tx I2CTx, err error) {
+	fields := strings.Fields(text)
+	addr, err := strconv.ParseUint(fields[0], 0, 16)
+	if err != nil {
+		return tx, fmt.Errorf("bad address %q", fields[0])
+	}
+	tx.Addr = uint16(addr)
+
+	for i := 1; i < len(fields); i++ {
+		switch f := fields[i]; {
+		case f == "w" || f == "r":
+			if i+1 == len(fields) {
+				return tx, fmt.Errorf("missing %s bytes", f)
+			}
+			i++
+			b, err := hex.DecodeString(fields[i])
+			if err != nil {
+				return tx, fmt.Errorf("bad %s bytes %q", f, fields[i])
+			}
+			if f == "w" {
+				tx.W = b
+			} else {
+				tx.R = b
+			}
+		case f[0] == '+':
+			tx.Delay, err = time.ParseDuration(f[1:])
+			if err != nil {
+				return tx, fmt.Errorf("bad delay %q", f)
+			}
+		case f == "err":
+			tx.Err = strings.Join(fields[i+1:], " ")
+			if tx.Err == "" {
+				return tx, fmt.Errorf("missing error message")
+			}
+			return tx, nil
+		default:
+			return tx, fmt.Errorf("unexpected %q", f)
+		}
+	}
+	return tx, nil
+}
+
+// I2CRecorder is an I2C bus recording the transactions on another bus in a
+// transcript, such as a driver talking to a real device.
+//
+// The transcript is written to an io.Writer, such as the serial console, to
+// be replayed by an I2CReplay bus in tests.
+type I2CRecorder struct {
+	bus drivers.I2C
+	w   io.Writer
+
+	// Timing records the delay since the previous transaction.
+	Timing bool
+
+	last time.Time
+}
+
+// NewI2CRecorder returns an I2CRecorder bus recording the transactions on
+// bus to w.
+func NewI2CRecorder(bus drivers.I2C, w io.Writer) *I2CRecorder {
+	return &I2CRecorder{
+		bus: bus,
+		w:   w,
+	}
+}
+
+// Tx implements I2C.Tx.
+func (rec *I2CRecorder) Tx(addr uint16, w, r []byte) error {
+	start := time.Now()
+	err := rec.bus.Tx(addr, w, r)
+
+	tx := I2CTx{Addr: addr, W: w}
+	if err != nil {
+		tx.Err = err.Error()
+	} else {
+		tx.R = r
+	}
+	if rec.Timing && !rec.last.IsZero() {
+		tx.Delay = start.Sub(rec.last)
+	}
+	rec.last = time.Now()
+
+	fmt.Fprintln(rec.w, tx)
+	return err
+}
@@ -0,0 +1,90 @@
+package tester
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"tinygo.org/x/drivers"
+)
+
+const transcript = `
+# Read, write and a failed read
+0x40 w 03 r 1234
+0x40 w 09bead +1.5ms
+0x41 w 00 err i2c: no acknowledge
+`
+
+func TestParseI2CTranscript(t *testing.T) {
+	c := qt.New(t)
+	txs, err := ParseI2CTranscript(strings.NewReader(transcript))
+	c.Assert(err, qt.IsNil)
+	c.Assert(txs, qt.HasLen, 3)
+	c.Assert(txs[0].Addr, qt.Equals, uint16(0x40))
+	c.Assert(txs[0].W, qt.DeepEquals, []byte{0x03})
+	c.Assert(txs[0].R, qt.DeepEquals, []byte{0x12, 0x34})
+	c.Assert(txs[1].Delay, qt.Equals, 1500*time.Microsecond)
+	c.Assert(txs[2].Err, qt.Equals, "i2c: no acknowledge")
+	c.Assert(txs[1].String(), qt.Equals, "0x40 w 09bead +1.5ms")
+
+	_, err = ParseI2CTranscript(strings.NewReader("0x40 w 0"))
+	c.Assert(err, qt.ErrorMatches, `line 1: bad w bytes "0"`)
+}
+
+func TestI2CRecordReplay(t *testing.T) {
+	c := qt.New(t)
+	bus := NewI2CBus(c)
+	d := NewI2CDevice8(c, 0x40)
+	d.Registers[3] = 0x12
+	d.Registers[4] = 0x34
+	bus.AddDevice(d)
+
+	// Record from the mock device
+	var b strings.Builder
+	rec := NewI2CRecorder(bus, &b)
+	buf := make([]byte, 2)
+	c.Assert(rec.Tx(0x40, []byte{0x03}, buf), qt.IsNil)
+	c.Assert(rec.Tx(0x40, []byte{0x09, 0xbe, 0xad}, nil), qt.IsNil)
+	d.Err = drivers.ErrNack
+	c.Assert(rec.Tx(0x40, []byte{0x00}, buf), qt.Equals, drivers.ErrNack)
+	d.Err = errors.New("i2c: arbitration lost")
+	c.Assert(rec.Tx(0x40, []byte{0x00}, buf), qt.ErrorMatches, "i2c: arbitration lost")
+	c.Assert(b.String(), qt.Equals,
+		"0x40 w 03 r 1234\n0x40 w 09bead\n0x40 w 00 err i2c: no acknowledge\n"+
+			"0x40 w 00 err i2c: arbitration lost\n")
+
+	// Replay
+	replay := NewI2CReplay(c, strings.NewReader(b.String()))
+	buf = make([]byte, 2)
+	c.Assert(replay.Tx(0x40, []byte{0x03}, buf), qt.IsNil)
+	c.Assert(buf, qt.DeepEquals, []byte{0x12, 0x34})
+	c.Assert(replay.Tx(0x40, []byte{0x09, 0xbe, 0xad}, nil), qt.IsNil)
+	// The bus errors are replayed as such, the others by their message
+	c.Assert(replay.Tx(0x40, []byte{0x00}, buf), qt.Equals, drivers.ErrNack)
+	c.Assert(replay.Tx(0x40, []byte{0x00}, buf), qt.ErrorMatches, "i2c: arbitration lost")
+	replay.Done()
+}
+
+func TestI2CReplayDivergence(t *testing.T) {
+	c := qt.New(t)
+	f := &failer{}
+	replay := NewI2CReplay(f, strings.NewReader(transcript))
+	replay.Tx(0x40, []byte{0x04}, make([]byte, 2))
+	c.Assert(f.msg, qt.Equals,
+		"i2c replay: line 3: got 0x40 w 04 reading 2 bytes, expected 0x40 w 03 r 1234")
+
+	replay.Done()
+	c.Assert(f.msg, qt.Equals, "i2c replay: 3 transactions left, from line 3")
+}
+
+// failer records the failure message.
+type failer struct {
+	msg string
+}
+
+func (f *failer) Fatalf(format string, a ...interface{}) {
+	f.msg = fmt.Sprintf(format, a...)
+}
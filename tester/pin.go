@@ -0,0 +1,203 @@
+package tester
+
+import (
+	"sync"
+	"time"
+
+	"tinygo.org/x/drivers"
+)
+
+// PinLevel is a change of the output level of a mock pin.
+type PinLevel struct {
+	Time time.Time
+	High bool
+}
+
+// Pulse is a step of a waveform replayed by a mock pin: the pin is at the
+// level High for Duration.
+type Pulse struct {
+	High     bool
+	Duration time.Duration
+}
+
+// Pin is a mock GPIO pin, implementing drivers.Pin and
+// drivers.PinInterrupter.
+//
+// As an output, the pin records the level changes in Log.  As an input, the
+// pin replays the waveform passed to Play.
+type Pin struct {
+	c Failer
+
+	// Log records the changes of the output level, with the time of the
+	// change.  It can be reset as desired for testing.
+	Log []PinLevel
+
+	mu       sync.Mutex
+	mode     drivers.PinMode
+	level    bool
+	wave     []Pulse
+	start    time.Time
+	stop     chan struct{}
+	change   drivers.PinChange
+	callback func(drivers.Pin)
+}
+
+// NewPin returns a new mock pin, an output at the low level.
+func NewPin(c Failer) *Pin {
+	return &Pin{
+		c: c,
+	}
+}
+
+// Configure implements drivers.Pin.Configure.
+func (p *Pin) Configure(mode drivers.PinMode) {
+	p.mu.Lock()
+	p.mode = mode
+	p.mu.Unlock()
+}
+
+// Set implements drivers.Pin.Set.
+//
+// The interrupt callback is called on the changes of the output level, for
+// tests to watch the pins set by a driver.
+func (p *Pin) Set(high bool) {
+	p.mu.Lock()
+	if p.mode != drivers.PinOutput {
+		p.mu.Unlock()
+		p.c.Fatalf("pin mock: set of an input pin")
+		return
+	}
+	if high == p.level {
+		p.mu.Unlock()
+		return
+	}
+	p.level = high
+	p.Log = append(p.Log, PinLevel{Time: time.Now(), High: high})
+	callback := p.interrupt(high)
+	p.mu.Unlock()
+
+	if callback != nil {
+		callback(p)
+	}
+}
+
+// Get implements drivers.Pin.Get.
+func (p *Pin) Get() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.mode == drivers.PinOutput {
+		return p.level
+	}
+	return p.input(time.Now())
+}
+
+// SetInterrupt implements drivers.PinInterrupter.SetInterrupt.
+func (p *Pin) SetInterrupt(change drivers.PinChange, callback func(drivers.Pin)) error {
+	p.mu.Lock()
+	p.change = change
+	p.callback = callback
+	p.mu.Unlock()
+	return nil
+}
+
+// Levels returns the output levels recorded in Log.
+func (p *Pin) Levels() []bool {
+	levels := make([]bool, len(p.Log))
+	for i, l := range p.Log {
+		levels[i] = l.High
+	}
+	return levels
+}
+
+// Play replays the waveform on the input pin, starting now.  After the
+// waveform, the pin stays at the level of the last pulse.  The interrupt
+// callback is called on the level changes, from another goroutine.
+func (p *Pin) Play(wave ...Pulse) {
+	p.mu.Lock()
+	if p.stop != nil {
+		close(p.stop)
+	}
+	stop := make(chan struct{})
+	p.stop = stop
+	p.wave = wave
+	p.start = time.Now()
+	start := p.start
+	p.mu.Unlock()
+
+	go p.play(start, wave, stop)
+}
+
+// Stop stops the replay of the waveform, and the calls to the interrupt
+// callback.  The pin stays at the level of the waveform when stopped.
+func (p *Pin) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stop == nil {
+		return
+	}
+	close(p.stop)
+	p.stop = nil
+
+	high := p.input(time.Now())
+	p.wave = []Pulse{{High: high}}
+}
+
+// play calls the interrupt callback on the level changes of the waveform.
+func (p *Pin) play(start time.Time, wave []Pulse, stop chan struct{}) {
+	at := start
+	for i := 1; i < len(wave); i++ {
+		at = at.Add(wave[i-1].Duration)
+		if wave[i].High == wave[i-1].High {
+			continue
+		}
+
+		t := time.NewTimer(time.Until(at))
+		select {
+		case <-t.C:
+		case <-stop:
+			t.Stop()
+			return
+		}
+
+		p.mu.Lock()
+		var callback func(drivers.Pin)
+		if p.mode != drivers.PinOutput {
+			callback = p.interrupt(wave[i].High)
+		}
+		p.mu.Unlock()
+
+		if callback != nil {
+			callback(p)
+		}
+	}
+}
+
+// input returns the level of the input pin at the time now.  Without a
+// waveform, the pin is high with a pull-up, else low.
+func (p *Pin) input(now time.Time) bool {
+	if len(p.wave) == 0 {
+		return p.mode == drivers.PinInputPullup
+	}
+	elapsed := now.Sub(p.start)
+	for _, pulse := range p.wave {
+		if elapsed < pulse.Duration {
+			return pulse.High
+		}
+		elapsed -= pulse.Duration
+	}
+	return p.wave[len(p.wave)-1].High
+}
+
+// interrupt returns the interrupt callback to call on a change to the level
+// high, if any.
+func (p *Pin) interrupt(high bool) func(drivers.Pin) {
+	if high && p.change&drivers.PinRising == 0 {
+		return nil
+	}
+	if !high && p.change&drivers.PinFalling == 0 {
+		return nil
+	}
+	return p.callback
+}
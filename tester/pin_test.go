@@ -0,0 +1,45 @@
+package tester
+
+import (
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"tinygo.org/x/drivers"
+)
+
+func TestPinOutput(t *testing.T) {
+	c := qt.New(t)
+	p := NewPin(c)
+	p.Configure(drivers.PinOutput)
+
+	p.Set(false)
+	p.Set(true)
+	p.Set(true)
+	p.Set(false)
+	c.Assert(p.Get(), qt.IsFalse)
+	c.Assert(p.Levels(), qt.DeepEquals, []bool{true, false})
+	c.Assert(p.Log[0].Time.After(p.Log[1].Time), qt.IsFalse)
+}
+
+func TestPinPlay(t *testing.T) {
+	c := qt.New(t)
+	p := NewPin(c)
+	p.Configure(drivers.PinInputPullup)
+	c.Assert(p.Get(), qt.IsTrue)
+
+	edges := make(chan bool, 4)
+	p.SetInterrupt(drivers.PinToggle, func(pin drivers.Pin) {
+		edges <- pin.Get()
+	})
+	p.Play(
+		Pulse{High: true, Duration: 5 * time.Millisecond},
+		Pulse{High: false, Duration: 5 * time.Millisecond},
+		Pulse{High: true},
+	)
+	c.Assert(p.Get(), qt.IsTrue)
+	c.Assert(<-edges, qt.IsFalse)
+	c.Assert(<-edges, qt.IsTrue)
+	c.Assert(p.Get(), qt.IsTrue)
+	p.Stop()
+}
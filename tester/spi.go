@@ -0,0 +1,169 @@
+package tester
+
+import "fmt"
+
+// SPIDevice is a mock device on a mock SPI bus.  While selected, the device
+// exchanges bytes with the bus, in a transaction.
+type SPIDevice interface {
+	// Begin starts a transaction, the device is selected.
+	Begin()
+
+	// Transfer receives the byte w, and returns the byte sent at the same
+	// time.
+	Transfer(w byte) (byte, error)
+
+	// End ends the transaction, the device is deselected.
+	End()
+}
+
+// SPITransaction is a transaction on the mock SPI bus, with the bytes written
+// to the device and the bytes read from it.  Both have the same length.
+type SPITransaction struct {
+	W []byte
+	R []byte
+}
+
+// SPIBus implements the SPI interface in memory for testing.
+//
+// SPI doesn't address devices: the chip select signals select them.  Call
+// Select and Deselect to frame the transactions, the way a driver sets the
+// chip select pin of the device.  On a bus with a single device, each Tx or
+// Transfer call is otherwise a transaction of its own.
+type SPIBus struct {
+	c        Failer
+	devices  []SPIDevice
+	selected SPIDevice
+	faults   faults
+
+	// Log records the transactions, for tests to check what was
+	// exchanged.  It can be reset as desired for testing.
+	Log []SPITransaction
+}
+
+// NewSPIBus returns an SPIBus mock SPI instance that uses c to flag errors
+// if they happen. After creating an SPI instance, add devices to it with
+// AddDevice before using it.
+func NewSPIBus(c Failer) *SPIBus {
+	return &SPIBus{
+		c: c,
+	}
+}
+
+// AddDevice adds a new mock device to the mock SPI bus.
+// It panics if the same device is added more than once.
+func (bus *SPIBus) AddDevice(d SPIDevice) {
+	for _, dev := range bus.devices {
+		if dev == d {
+			panic(fmt.Errorf("device already added: %T", d))
+		}
+	}
+	bus.devices = append(bus.devices, d)
+}
+
+// Inject injects the fault f in the next transactions.
+func (bus *SPIBus) Inject(f Fault) {
+	bus.faults.inject(f)
+}
+
+// ClearFaults removes the faults injected.
+func (bus *SPIBus) ClearFaults() {
+	bus.faults = nil
+}
+
+// Select selects the device, starting a transaction.
+func (bus *SPIBus) Select(d SPIDevice) {
+	if bus.selected != nil {
+		bus.c.Fatalf("spi mock: select while a device is selected")
+	}
+	found := false
+	for _, dev := range bus.devices {
+		found = found || dev == d
+	}
+	if !found {
+		bus.c.Fatalf("spi mock: select of a device not on the bus")
+	}
+	bus.selected = d
+	bus.Log = append(bus.Log, SPITransaction{W: []byte{}, R: []byte{}})
+	d.Begin()
+}
+
+// Deselect deselects the device selected, ending the transaction.
+func (bus *SPIBus) Deselect() {
+	if bus.selected == nil {
+		bus.c.Fatalf("spi mock: deselect while no device is selected")
+	}
+	bus.selected.End()
+	bus.selected = nil
+}
+
+// Tx implements SPI.Tx.
+func (bus *SPIBus) Tx(w, r []byte) error {
+	if w != nil && r != nil && len(w) != len(r) {
+		bus.c.Fatalf("spi mock: different lengths in Tx(%d, %d)", len(w), len(r))
+	}
+	n := len(w)
+	if w == nil {
+		n = len(r)
+	}
+
+	f := bus.faults.next(0)
+	if err := f.before(); err != nil {
+		return err
+	}
+
+	if bus.selected == nil {
+		bus.Select(bus.single())
+		defer bus.Deselect()
+	}
+
+	for i := 0; i < n; i++ {
+		var b byte
+		if w != nil {
+			b = w[i]
+		}
+		rb, err := bus.transfer(b, f, i)
+		if err != nil {
+			return err
+		}
+		if r != nil {
+			r[i] = rb
+		}
+	}
+	return nil
+}
+
+// Transfer implements SPI.Transfer.
+func (bus *SPIBus) Transfer(b byte) (byte, error) {
+	f := bus.faults.next(0)
+	if err := f.before(); err != nil {
+		return 0, err
+	}
+
+	if bus.selected == nil {
+		bus.Select(bus.single())
+		defer bus.Deselect()
+	}
+	return bus.transfer(b, f, 0)
+}
+
+// transfer exchanges the byte i of the transaction with the device
+// selected, corrupting the byte read as faulted by f.
+func (bus *SPIBus) transfer(w byte, f Fault, i int) (byte, error) {
+	r, err := bus.selected.Transfer(w)
+	if err != nil {
+		return 0, err
+	}
+	r = f.corrupt(i, r)
+	tx := &bus.Log[len(bus.Log)-1]
+	tx.W = append(tx.W, w)
+	tx.R = append(tx.R, r)
+	return r, nil
+}
+
+// single returns the device of a bus with a single device.
+func (bus *SPIBus) single() SPIDevice {
+	if len(bus.devices) != 1 {
+		bus.c.Fatalf("spi mock: no device selected, with %d devices on the bus", len(bus.devices))
+	}
+	return bus.devices[0]
+}
@@ -0,0 +1,98 @@
+package tester
+
+// SPIDevice8 represents a mock SPI device with 8-bit registers.
+//
+// The first byte of a transaction addresses the register, with the read or
+// write bit set.  The following bytes read or write the register and the
+// subsequent registers.
+type SPIDevice8 struct {
+	c Failer
+
+	// Registers holds the device registers. It can be inspected
+	// or changed as desired for testing.
+	Registers [MaxRegisters]uint8
+
+	// ReadBit is set in the address byte to read registers, as with most
+	// devices.  If zero, the registers are read when WriteBit is clear.
+	ReadBit uint8
+
+	// WriteBit is set in the address byte to write registers.  If zero,
+	// the registers are written when ReadBit is clear.
+	WriteBit uint8
+
+	// AddrMask selects the register address in the address byte.  If
+	// zero, the register address is the address byte without ReadBit and
+	// WriteBit.
+	AddrMask uint8
+
+	// If Err is non-nil, it will be returned as the error from the
+	// SPI methods.
+	Err error
+
+	// started is set once the address byte of the transaction is received.
+	started bool
+	write   bool
+	reg     int
+}
+
+// NewSPIDevice8 returns a new mock SPI device, that reads the registers
+// with the address bit 7 set, and writes them with the bit clear.
+func NewSPIDevice8(c Failer) *SPIDevice8 {
+	return &SPIDevice8{
+		c:       c,
+		ReadBit: 0x80,
+	}
+}
+
+// Begin implements SPIDevice.Begin.
+func (d *SPIDevice8) Begin() {
+	d.started = false
+}
+
+// Transfer implements SPIDevice.Transfer.
+func (d *SPIDevice8) Transfer(w byte) (byte, error) {
+	if d.Err != nil {
+		return 0, d.Err
+	}
+
+	if !d.started {
+		d.started = true
+		d.write = d.isWrite(w)
+		mask := d.AddrMask
+		if mask == 0 {
+			mask = ^(d.ReadBit | d.WriteBit)
+		}
+		d.reg = int(w & mask)
+		return 0, nil
+	}
+
+	if d.reg >= len(d.Registers) {
+		d.c.Fatalf("register read/write %#x out of range", d.reg)
+		return 0, nil
+	}
+	r := d.reg
+	d.reg++
+	if d.write {
+		d.Registers[r] = w
+		return 0, nil
+	}
+	return d.Registers[r], nil
+}
+
+// End implements SPIDevice.End.
+func (d *SPIDevice8) End() {
+	d.started = false
+}
+
+// isWrite returns whether the address byte a writes registers.
+func (d *SPIDevice8) isWrite(a byte) bool {
+	switch {
+	case d.ReadBit != 0:
+		return a&d.ReadBit == 0
+	case d.WriteBit != 0:
+		return a&d.WriteBit != 0
+	default:
+		d.c.Fatalf("spi mock: neither ReadBit nor WriteBit set")
+		return false
+	}
+}
@@ -0,0 +1,100 @@
+package tester
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestSPIRead8(t *testing.T) {
+	c := qt.New(t)
+	bus := NewSPIBus(c)
+	d := NewSPIDevice8(c)
+	bus.AddDevice(d)
+
+	// Setup a random register
+	d.Registers[3] = 0x12
+	d.Registers[4] = 0x34
+
+	buf := []byte{0, 0, 0}
+	err := bus.Tx([]byte{0x83, 0, 0}, buf)
+	c.Assert(err, qt.IsNil)
+	c.Assert(buf, qt.DeepEquals, []byte{0, 0x12, 0x34})
+	c.Assert(bus.Log, qt.DeepEquals, []SPITransaction{
+		{W: []byte{0x83, 0, 0}, R: []byte{0, 0x12, 0x34}},
+	})
+}
+
+func TestSPIWrite8(t *testing.T) {
+	c := qt.New(t)
+	bus := NewSPIBus(c)
+	d := NewSPIDevice8(c)
+	bus.AddDevice(d)
+
+	err := bus.Tx([]byte{0x09, 0xbe, 0xad}, nil)
+	c.Assert(err, qt.IsNil)
+	c.Assert(d.Registers[9], qt.Equals, byte(0xbe))
+	c.Assert(d.Registers[10], qt.Equals, byte(0xad))
+}
+
+func TestSPIWriteBit8(t *testing.T) {
+	c := qt.New(t)
+	bus := NewSPIBus(c)
+	d := NewSPIDevice8(c)
+	d.ReadBit = 0
+	d.WriteBit = 0x80
+	bus.AddDevice(d)
+
+	err := bus.Tx([]byte{0x81, 0x42}, nil)
+	c.Assert(err, qt.IsNil)
+	c.Assert(d.Registers[1], qt.Equals, byte(0x42))
+
+	r, err := bus.Transfer(0x01)
+	c.Assert(err, qt.IsNil)
+	c.Assert(r, qt.Equals, byte(0))
+
+	buf := make([]byte, 2)
+	err = bus.Tx([]byte{0x01, 0}, buf)
+	c.Assert(err, qt.IsNil)
+	c.Assert(buf, qt.DeepEquals, []byte{0, 0x42})
+}
+
+func TestSPISelect8(t *testing.T) {
+	c := qt.New(t)
+	bus := NewSPIBus(c)
+	d1 := NewSPIDevice8(c)
+	d2 := NewSPIDevice8(c)
+	// Auto-increment in bit 6, as on the LIS3DH
+	d2.AddrMask = 0x3f
+	bus.AddDevice(d1)
+	bus.AddDevice(d2)
+
+	d1.Registers[5] = 0x11
+	d2.Registers[5] = 0x22
+	d2.Registers[6] = 0x33
+
+	// A transaction split over calls, as when a driver sets the
+	// chip select pin around them.
+	bus.Select(d2)
+	err := bus.Tx([]byte{0xc5}, nil)
+	c.Assert(err, qt.IsNil)
+	buf := make([]byte, 2)
+	err = bus.Tx(nil, buf)
+	c.Assert(err, qt.IsNil)
+	bus.Deselect()
+	c.Assert(buf, qt.DeepEquals, []byte{0x22, 0x33})
+
+	bus.Select(d1)
+	r, err := bus.Transfer(0x85)
+	c.Assert(err, qt.IsNil)
+	c.Assert(r, qt.Equals, byte(0))
+	r, err = bus.Transfer(0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(r, qt.Equals, byte(0x11))
+	bus.Deselect()
+
+	c.Assert(bus.Log, qt.DeepEquals, []SPITransaction{
+		{W: []byte{0xc5, 0, 0}, R: []byte{0, 0x22, 0x33}},
+		{W: []byte{0x85, 0}, R: []byte{0, 0x11}},
+	})
+}
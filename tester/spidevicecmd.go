@@ -0,0 +1,102 @@
+package tester
+
+// SPIDeviceCmd represents a mock SPI device that does not
+// have 'registers', but has a command/response model.
+//
+// Commands and canned responses are pre-loaded into the
+// Commands member.  A transaction starts with a command: once
+// the mock receives the command bytes, it returns the
+// corresponding canned response in the following bytes, and
+// zeros after the response.  The bytes written after the
+// command, such as data to program, can be checked in the
+// transaction log of the bus.
+type SPIDeviceCmd struct {
+	c Failer
+
+	// Commands are the commands the device recognizes and responds to.
+	// A nil Mask matches the Command bytes exactly.
+	Commands map[uint8]*Cmd
+
+	// If Err is non-nil, it will be returned as the error from the
+	// SPI methods.
+	Err error
+
+	// command holds the bytes received until a command is found.
+	command []byte
+	cmd     *Cmd
+	// response is the rest of the response to send.
+	response []byte
+}
+
+// NewSPIDeviceCmd returns a new mock SPI device.
+func NewSPIDeviceCmd(c Failer) *SPIDeviceCmd {
+	return &SPIDeviceCmd{
+		c: c,
+	}
+}
+
+// Begin implements SPIDevice.Begin.
+func (d *SPIDeviceCmd) Begin() {
+	d.command = d.command[:0]
+	d.cmd = nil
+	d.response = nil
+}
+
+// Transfer implements SPIDevice.Transfer.
+func (d *SPIDeviceCmd) Transfer(w byte) (byte, error) {
+	if d.Err != nil {
+		return 0, d.Err
+	}
+
+	if d.cmd != nil {
+		if len(d.response) == 0 {
+			return 0, nil
+		}
+		r := d.response[0]
+		d.response = d.response[1:]
+		return r, nil
+	}
+
+	d.command = append(d.command, w)
+	prefix := false
+	for _, c := range d.Commands {
+		if !c.matches(d.command) {
+			continue
+		}
+		if len(c.Command) == len(d.command) {
+			c.Invocations++
+			d.cmd = c
+			d.response = c.Response
+			return 0, nil
+		}
+		prefix = true
+	}
+	if !prefix {
+		d.c.Fatalf("command [%#x] not identified", d.command)
+	}
+	return 0, nil
+}
+
+// End implements SPIDevice.End.
+func (d *SPIDeviceCmd) End() {
+	if d.cmd == nil && len(d.command) > 0 {
+		d.c.Fatalf("command [%#x] incomplete", d.command)
+	}
+}
+
+// matches returns whether the bytes b are the start of the command.
+func (c *Cmd) matches(b []byte) bool {
+	if len(b) > len(c.Command) {
+		return false
+	}
+	for i := range b {
+		mask := byte(0xff)
+		if c.Mask != nil {
+			mask = c.Mask[i]
+		}
+		if (c.Command[i] & mask) != (b[i] & mask) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package tester
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestSPICmd(t *testing.T) {
+	c := qt.New(t)
+	bus := NewSPIBus(c)
+	d := NewSPIDeviceCmd(c)
+	d.Commands = map[uint8]*Cmd{
+		// JEDEC ID
+		0: {Command: []byte{0x9f}, Response: []byte{0xef, 0x40, 0x18}},
+		// Read data at any address
+		1: {
+			Command:  []byte{0x03, 0, 0, 0},
+			Mask:     []byte{0xff, 0, 0, 0},
+			Response: []byte{0xde, 0xad},
+		},
+		// Page program
+		2: {Command: []byte{0x02, 0x00, 0x01, 0x00}},
+	}
+	bus.AddDevice(d)
+
+	buf := make([]byte, 4)
+	err := bus.Tx([]byte{0x9f, 0, 0, 0}, buf)
+	c.Assert(err, qt.IsNil)
+	c.Assert(buf, qt.DeepEquals, []byte{0, 0xef, 0x40, 0x18})
+
+	buf = make([]byte, 7)
+	err = bus.Tx([]byte{0x03, 0x12, 0x34, 0x56, 0, 0, 0}, buf)
+	c.Assert(err, qt.IsNil)
+	c.Assert(buf, qt.DeepEquals, []byte{0, 0, 0, 0, 0xde, 0xad, 0})
+	c.Assert(d.Commands[1].Invocations, qt.Equals, 1)
+
+	err = bus.Tx([]byte{0x02, 0x00, 0x01, 0x00, 0xca, 0xfe}, nil)
+	c.Assert(err, qt.IsNil)
+	c.Assert(d.Commands[2].Invocations, qt.Equals, 1)
+	c.Assert(bus.Log[2], qt.DeepEquals, SPITransaction{
+		W: []byte{0x02, 0x00, 0x01, 0x00, 0xca, 0xfe},
+		R: []byte{0, 0, 0, 0, 0, 0},
+	})
+}
@@ -0,0 +1,16 @@
+package w5500
+
+type debug uint8
+
+const (
+	debugBasic  debug = 1 << iota // show chip version, mac addr, etc
+	debugNetdev                   // show netdev entry points
+	debugDHCP                     // show DHCP and DNS exchanges
+
+	debugOff = 0
+	debugAll = debugBasic | debugNetdev | debugDHCP
+)
+
+func debugging(want debug) bool {
+	return (_debug & want) != 0
+}
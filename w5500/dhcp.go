@@ -0,0 +1,363 @@
+package w5500
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"tinygo.org/x/drivers/netdev"
+)
+
+// DHCP client, RFC 2131:
+// https://datatracker.ietf.org/doc/html/rfc2131
+
+const (
+	dhcpServerPort = 67
+	dhcpClientPort = 68
+
+	// Time to wait for the server's reply before sending again
+	dhcpResend = 2 * time.Second
+	// Time to wait before renewing again after failing to
+	dhcpRenewRetry = time.Minute
+
+	bootRequest = 1
+	bootReply   = 2
+
+	dhcpMagicCookie = 0x63825363
+	dhcpFlagBcast   = 0x8000
+
+	// Fixed part of the message, with the magic cookie
+	dhcpHeaderLen = 240
+	dhcpMaxLen    = 576
+
+	dhcpDiscover = 1
+	dhcpOffer    = 2
+	dhcpRequest  = 3
+	dhcpAck      = 5
+	dhcpNak      = 6
+
+	optPad         = 0
+	optSubnetMask  = 1
+	optRouter      = 3
+	optDNS         = 6
+	optHostname    = 12
+	optRequestedIP = 50
+	optLeaseTime   = 51
+	optMessageType = 53
+	optServerID    = 54
+	optParamList   = 55
+	optRenewalTime = 58
+	optClientID    = 61
+	optEnd         = 255
+)
+
+var (
+	dhcpBroadcast  = netip.AddrPortFrom(netip.AddrFrom4([4]byte{255, 255, 255, 255}), dhcpServerPort)
+	defaultNetmask = netip.AddrFrom4([4]byte{255, 255, 255, 0})
+)
+
+type dhcpLease struct {
+	server   netip.Addr
+	renewAt  time.Time
+	expireAt time.Time
+}
+
+func (l *dhcpLease) renewDue() bool {
+	return !l.renewAt.IsZero() && time.Now().After(l.renewAt)
+}
+
+func (l *dhcpLease) expired() bool {
+	return !l.expireAt.IsZero() && time.Now().After(l.expireAt)
+}
+
+// dhcpReply is what the client uses from the server's replies
+type dhcpReply struct {
+	msgType uint8
+	yiaddr  netip.Addr
+	server  netip.Addr
+	netmask netip.Addr
+	router  netip.Addr
+	dns     []netip.Addr
+	lease   time.Duration
+	renewal time.Duration
+}
+
+// dhcp gets an IP address from a DHCP server, by broadcasting a discover,
+// and requesting the address offered
+func (w *w5500) dhcp(timeout time.Duration) error {
+	s, err := w.dhcpSocket()
+	if err != nil {
+		return err
+	}
+	defer w.freeSocket(s)
+
+	// The client doesn't have an address until bound
+	w.setIP(netip.Addr{}, netip.Addr{}, netip.Addr{})
+
+	if timeout < dhcpResend {
+		timeout = dhcpResend
+	}
+	deadline := time.Now().Add(timeout)
+	xid := w.xid()
+
+	for {
+		if debugging(debugDHCP) {
+			fmt.Printf("[DHCP] discover\r\n")
+		}
+		offer, err := w.dhcpExchange(s, dhcpBroadcast, dhcpDiscover, xid, netip.Addr{},
+			netip.Addr{}, netip.Addr{}, deadline)
+		if err == nil && offer.msgType == dhcpOffer {
+			if debugging(debugDHCP) {
+				fmt.Printf("[DHCP] offer %s from %s\r\n", offer.yiaddr, offer.server)
+			}
+			ack, err := w.dhcpExchange(s, dhcpBroadcast, dhcpRequest, xid, netip.Addr{},
+				offer.yiaddr, offer.server, deadline)
+			if err == nil && ack.msgType == dhcpAck {
+				w.dhcpBind(&ack)
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return ErrDHCPTimeout
+		}
+		xid++
+	}
+}
+
+// renew extends the lease with the server which granted it
+func (w *w5500) renew() error {
+	s, err := w.dhcpSocket()
+	if err != nil {
+		return err
+	}
+	defer w.freeSocket(s)
+
+	if debugging(debugDHCP) {
+		fmt.Printf("[DHCP] renew %s with %s\r\n", w.ip, w.lease.server)
+	}
+
+	server := netip.AddrPortFrom(w.lease.server, dhcpServerPort)
+	ack, err := w.dhcpExchange(s, server, dhcpRequest, w.xid(), w.ip,
+		netip.Addr{}, netip.Addr{}, time.Now().Add(dhcpResend))
+	if err != nil {
+		return err
+	}
+	if ack.msgType != dhcpAck || ack.yiaddr != w.ip {
+		// The lease can't be extended, get a new one
+		w.lease.expireAt = time.Now()
+		return ErrDHCPTimeout
+	}
+
+	w.dhcpBind(&ack)
+	return nil
+}
+
+func (w *w5500) dhcpSocket() (sock, error) {
+	s := w.getSocket()
+	if s == noSock {
+		return noSock, netdev.ErrNoMoreSockets
+	}
+	if err := w.open(s, modeUDP, dhcpClientPort); err != nil {
+		w.inUse[s] = false
+		return noSock, err
+	}
+	return s, nil
+}
+
+// xid returns a transaction ID for the client
+func (w *w5500) xid() uint32 {
+	return uint32(time.Now().UnixNano()) ^ binary.BigEndian.Uint32(w.mac[2:])
+}
+
+func (w *w5500) dhcpBind(ack *dhcpReply) {
+	netmask := ack.netmask
+	if !netmask.IsValid() {
+		netmask = defaultNetmask
+	}
+	w.setIP(ack.yiaddr, netmask, ack.router)
+
+	w.dns = ack.dns
+	if len(w.params.DNS) > 0 {
+		w.dns = w.params.DNS
+	}
+
+	// No lease time is an infinite lease
+	now := time.Now()
+	w.lease = dhcpLease{server: ack.server}
+	if ack.lease > 0 {
+		renewal := ack.renewal
+		if renewal == 0 || renewal > ack.lease {
+			renewal = ack.lease / 2
+		}
+		w.lease.renewAt = now.Add(renewal)
+		w.lease.expireAt = now.Add(ack.lease)
+	}
+
+	if debugging(debugDHCP) {
+		fmt.Printf("[DHCP] bound %s, lease %s\r\n", w.ip, ack.lease)
+	}
+}
+
+// dhcpExchange sends a message, and waits for the reply to it, resending it
+// after a while
+func (w *w5500) dhcpExchange(s sock, to netip.AddrPort, msgType uint8, xid uint32,
+	ciaddr, requested, server netip.Addr, deadline time.Time) (dhcpReply, error) {
+
+	var buf [dhcpMaxLen]byte
+
+	for {
+		n := w.dhcpMessage(buf[:], msgType, xid, ciaddr, requested, server)
+		w.setDest(s, to)
+		w.startSend(s, buf[:n])
+		if err := w.waitSentLocal(s, deadline); err != nil {
+			return dhcpReply{}, err
+		}
+
+		resend := time.Now().Add(dhcpResend)
+		for time.Now().Before(resend) {
+			n, _, ok := w.recvFrom(s, buf[:])
+			if !ok {
+				if time.Now().After(deadline) {
+					return dhcpReply{}, ErrDHCPTimeout
+				}
+				w.wait()
+				continue
+			}
+			reply, ok := parseDHCP(buf[:n], xid, w.mac)
+			if !ok {
+				continue
+			}
+			// Offers reply to discovers, acks and naks to requests
+			if (msgType == dhcpDiscover) == (reply.msgType == dhcpOffer) {
+				return reply, nil
+			}
+		}
+	}
+}
+
+// waitSentLocal waits for the chip to be done sending on a socket used by
+// the driver itself
+func (w *w5500) waitSentLocal(s sock, deadline time.Time) error {
+	for {
+		done, err := w.sendDone(s)
+		if done || err != nil {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return netdev.ErrTimeout
+		}
+		w.wait()
+	}
+}
+
+func (w *w5500) dhcpMessage(b []byte, msgType uint8, xid uint32,
+	ciaddr, requested, server netip.Addr) int {
+
+	for i := range b[:dhcpHeaderLen] {
+		b[i] = 0
+	}
+	b[0] = bootRequest
+	b[1] = 1 // Ethernet
+	b[2] = 6 // MAC address length
+	binary.BigEndian.PutUint32(b[4:], xid)
+	if ciaddr.IsValid() {
+		ip := ciaddr.As4()
+		copy(b[12:], ip[:])
+	} else {
+		// Replies must be broadcast until the client has an address
+		binary.BigEndian.PutUint16(b[10:], dhcpFlagBcast)
+	}
+	copy(b[28:], w.mac)
+	binary.BigEndian.PutUint32(b[236:], dhcpMagicCookie)
+
+	o := b[:dhcpHeaderLen]
+	o = append(o, optMessageType, 1, msgType)
+	o = append(o, optClientID, 7, 1)
+	o = append(o, w.mac...)
+	if requested.IsValid() {
+		ip := requested.As4()
+		o = append(o, optRequestedIP, 4)
+		o = append(o, ip[:]...)
+	}
+	if server.IsValid() {
+		ip := server.As4()
+		o = append(o, optServerID, 4)
+		o = append(o, ip[:]...)
+	}
+	if name := w.params.Hostname; name != "" && len(name) < 64 {
+		o = append(o, optHostname, byte(len(name)))
+		o = append(o, name...)
+	}
+	o = append(o, optParamList, 5, optSubnetMask, optRouter, optDNS,
+		optLeaseTime, optRenewalTime)
+	o = append(o, optEnd)
+
+	// Some servers drop messages shorter than a BOOTP message
+	for len(o) < 300 {
+		o = append(o, optPad)
+	}
+	return len(o)
+}
+
+// parseDHCP parses the server's reply to the client's transaction
+func parseDHCP(b []byte, xid uint32, mac []byte) (dhcpReply, bool) {
+	var r dhcpReply
+
+	if len(b) < dhcpHeaderLen || b[0] != bootReply ||
+		binary.BigEndian.Uint32(b[4:]) != xid ||
+		!bytes.Equal(b[28:34], mac) ||
+		binary.BigEndian.Uint32(b[236:]) != dhcpMagicCookie {
+		return r, false
+	}
+
+	r.yiaddr = netip.AddrFrom4([4]byte{b[16], b[17], b[18], b[19]})
+
+	for i := dhcpHeaderLen; i < len(b); {
+		code := b[i]
+		if code == optEnd {
+			break
+		}
+		if code == optPad {
+			i++
+			continue
+		}
+		if i+2 > len(b) || i+2+int(b[i+1]) > len(b) {
+			return r, false
+		}
+		v := b[i+2 : i+2+int(b[i+1])]
+		i += 2 + len(v)
+
+		switch code {
+		case optMessageType:
+			if len(v) == 1 {
+				r.msgType = v[0]
+			}
+		case optServerID:
+			r.server, _ = netip.AddrFromSlice(v)
+		case optSubnetMask:
+			r.netmask, _ = netip.AddrFromSlice(v)
+		case optRouter:
+			// The first router is preferred
+			if len(v) >= 4 {
+				r.router, _ = netip.AddrFromSlice(v[:4])
+			}
+		case optDNS:
+			for ; len(v) >= 4; v = v[4:] {
+				ip, _ := netip.AddrFromSlice(v[:4])
+				r.dns = append(r.dns, ip)
+			}
+		case optLeaseTime:
+			if len(v) == 4 {
+				r.lease = time.Duration(binary.BigEndian.Uint32(v)) * time.Second
+			}
+		case optRenewalTime:
+			if len(v) == 4 {
+				r.renewal = time.Duration(binary.BigEndian.Uint32(v)) * time.Second
+			}
+		}
+	}
+
+	return r, r.msgType != 0
+}
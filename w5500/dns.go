@@ -0,0 +1,188 @@
+package w5500
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"tinygo.org/x/drivers/netdev"
+)
+
+// DNS resolver, RFC 1035:
+// https://datatracker.ietf.org/doc/html/rfc1035
+
+const (
+	dnsPort = 53
+
+	// Time to wait for a server's answer, each server is tried twice
+	dnsTimeout = 2 * time.Second
+	dnsTries   = 2
+
+	dnsMaxLen    = 512
+	dnsHeaderLen = 12
+
+	dnsFlagResponse  = 0x8000
+	dnsFlagRecursion = 0x0100
+	dnsRcodeMask     = 0x000F
+	dnsRcodeNXDomain = 3
+
+	dnsTypeA   = 1
+	dnsClassIN = 1
+)
+
+// lookup resolves the host name's IPv4 address with the DNS servers
+func (w *w5500) lookup(name string) (netip.Addr, error) {
+	if len(w.dns) == 0 {
+		return netip.Addr{}, netdev.ErrHostUnknown
+	}
+
+	var buf [dnsMaxLen]byte
+
+	id := uint16(w.xid())
+	query, err := dnsQuery(buf[:], id, name)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	s := w.getSocket()
+	if s == noSock {
+		return netip.Addr{}, netdev.ErrNoMoreSockets
+	}
+	defer w.freeSocket(s)
+	if err := w.open(s, modeUDP, 0); err != nil {
+		return netip.Addr{}, err
+	}
+
+	for try := 0; try < dnsTries; try++ {
+		for _, server := range w.dns {
+			if debugging(debugDHCP) {
+				fmt.Printf("[DNS] query %s to %s\r\n", name, server)
+			}
+
+			deadline := time.Now().Add(dnsTimeout)
+
+			// The query is overwritten by the answers received
+			query, _ = dnsQuery(buf[:], id, name)
+			w.setDest(s, netip.AddrPortFrom(server, dnsPort))
+			w.startSend(s, query)
+			if err := w.waitSentLocal(s, deadline); err != nil {
+				continue
+			}
+
+			for time.Now().Before(deadline) {
+				n, raddr, ok := w.recvFrom(s, buf[:])
+				if !ok {
+					w.wait()
+					continue
+				}
+				if raddr.Addr() != server {
+					continue
+				}
+				ip, err := dnsAnswer(buf[:n], id)
+				switch err {
+				case nil:
+					return ip, nil
+				case netdev.ErrHostUnknown:
+					return netip.Addr{}, err
+				}
+			}
+		}
+	}
+
+	return netip.Addr{}, netdev.ErrHostUnknown
+}
+
+// dnsQuery writes the query for the name's A record
+func dnsQuery(b []byte, id uint16, name string) ([]byte, error) {
+	if len(name) == 0 || len(name) > 253 {
+		return nil, netdev.ErrMalAddr
+	}
+
+	binary.BigEndian.PutUint16(b[0:], id)
+	binary.BigEndian.PutUint16(b[2:], dnsFlagRecursion)
+	binary.BigEndian.PutUint16(b[4:], 1) // Questions
+	binary.BigEndian.PutUint16(b[6:], 0)
+	binary.BigEndian.PutUint16(b[8:], 0)
+	binary.BigEndian.PutUint16(b[10:], 0)
+
+	q := b[:dnsHeaderLen]
+	for len(name) > 0 {
+		label := name
+		rest := ""
+		for i := 0; i < len(name); i++ {
+			if name[i] == '.' {
+				label, rest = name[:i], name[i+1:]
+				break
+			}
+		}
+		if len(label) == 0 || len(label) > 63 {
+			return nil, netdev.ErrMalAddr
+		}
+		q = append(q, byte(len(label)))
+		q = append(q, label...)
+		name = rest
+	}
+	q = append(q, 0)
+	q = append(q, 0, dnsTypeA, 0, dnsClassIN)
+
+	return q, nil
+}
+
+// dnsAnswer returns the first IPv4 address in the answer to the query
+func dnsAnswer(b []byte, id uint16) (netip.Addr, error) {
+	if len(b) < dnsHeaderLen || binary.BigEndian.Uint16(b[0:]) != id {
+		return netip.Addr{}, netdev.ErrMalAddr
+	}
+	flags := binary.BigEndian.Uint16(b[2:])
+	if flags&dnsFlagResponse == 0 {
+		return netip.Addr{}, netdev.ErrMalAddr
+	}
+	if flags&dnsRcodeMask == dnsRcodeNXDomain {
+		return netip.Addr{}, netdev.ErrHostUnknown
+	}
+	questions := int(binary.BigEndian.Uint16(b[4:]))
+	answers := int(binary.BigEndian.Uint16(b[6:]))
+
+	i := dnsHeaderLen
+	for ; questions > 0; questions-- {
+		i = skipName(b, i) + 4
+	}
+
+	// Answers may be CNAME records before the A record
+	for ; answers > 0; answers-- {
+		i = skipName(b, i)
+		if i+10 > len(b) {
+			break
+		}
+		rtype := binary.BigEndian.Uint16(b[i:])
+		class := binary.BigEndian.Uint16(b[i+2:])
+		size := int(binary.BigEndian.Uint16(b[i+8:]))
+		i += 10
+		if i+size > len(b) {
+			break
+		}
+		if rtype == dnsTypeA && class == dnsClassIN && size == 4 {
+			return netip.AddrFrom4([4]byte{b[i], b[i+1], b[i+2], b[i+3]}), nil
+		}
+		i += size
+	}
+
+	return netip.Addr{}, netdev.ErrHostUnknown
+}
+
+// skipName returns the offset past the, possibly compressed, name at i
+func skipName(b []byte, i int) int {
+	for i < len(b) {
+		l := int(b[i])
+		switch {
+		case l == 0:
+			return i + 1
+		case l&0xC0 == 0xC0:
+			// Pointer to the rest of the name
+			return i + 2
+		}
+		i += 1 + l
+	}
+	return len(b)
+}
@@ -0,0 +1,508 @@
+package w5500
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"time"
+
+	"tinygo.org/x/drivers/netdev"
+)
+
+type socket struct {
+	protocol  int
+	laddr     netip.AddrPort // Set in Bind()
+	raddr     netip.AddrPort // Set in Connect()
+	listening bool
+	sock      // Hardware socket, noSock until bound or connected
+}
+
+func (w *w5500) GetHostByName(name string) (netip.Addr, error) {
+
+	if debugging(debugNetdev) {
+		fmt.Printf("[GetHostByName] name: %s\r\n", name)
+	}
+
+	// If it's already in dotted-decimal notation, return a copy
+	// per gethostbyname(3).
+	if ip, err := netip.ParseAddr(name); err == nil {
+		return ip, nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.lookup(name)
+}
+
+func (w *w5500) Addr() (netip.Addr, error) {
+
+	if debugging(debugNetdev) {
+		fmt.Printf("[GetIPAddr]\r\n")
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.ip, nil
+}
+
+// newSockfd returns the next available sockfd, or -1 if none available
+func (w *w5500) newSockfd() int {
+	if len(w.sockets) >= maxSockets {
+		return -1
+	}
+	// Search for the next available sockfd starting at 0
+	for sockfd := 0; ; sockfd++ {
+		if _, ok := w.sockets[sockfd]; !ok {
+			return sockfd
+		}
+	}
+}
+
+// block waits for a socket to make progress, returning an error if the
+// deadline passed, or if the socket was closed meanwhile
+func (w *w5500) block(sockfd int, socket *socket, deadline time.Time) error {
+	if !deadline.IsZero() && time.Now().After(deadline) {
+		return netdev.ErrTimeout
+	}
+	w.wait()
+	if w.sockets[sockfd] != socket || socket.sock == noSock {
+		return io.EOF
+	}
+	return nil
+}
+
+// See man socket(2) for standard Berkely sockets for Socket, Bind, etc.
+// The driver strives to meet the function and semantics of socket(2).
+
+func (w *w5500) Socket(domain int, stype int, protocol int) (int, error) {
+
+	if debugging(debugNetdev) {
+		fmt.Printf("[Socket] domain: %d, type: %d, protocol: %d\r\n",
+			domain, stype, protocol)
+	}
+
+	switch domain {
+	case netdev.AF_INET:
+	default:
+		return -1, netdev.ErrFamilyNotSupported
+	}
+
+	switch {
+	case protocol == netdev.IPPROTO_TCP && stype == netdev.SOCK_STREAM:
+	case protocol == netdev.IPPROTO_UDP && stype == netdev.SOCK_DGRAM:
+	default:
+		return -1, netdev.ErrProtocolNotSupported
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	sockfd := w.newSockfd()
+	if sockfd == -1 {
+		return -1, netdev.ErrNoMoreSockets
+	}
+
+	w.sockets[sockfd] = &socket{
+		protocol: protocol,
+		sock:     noSock,
+	}
+
+	if debugging(debugNetdev) {
+		fmt.Printf("[Socket] <-- sockfd %d\r\n", sockfd)
+	}
+
+	return sockfd, nil
+}
+
+// openSocket allocates and opens the hardware socket on the local port
+func (w *w5500) openSocket(socket *socket, mode uint8) error {
+	s := w.getSocket()
+	if s == noSock {
+		return netdev.ErrNoMoreSockets
+	}
+	if err := w.open(s, mode, socket.laddr.Port()); err != nil {
+		w.inUse[s] = false
+		return err
+	}
+	socket.sock = s
+	return nil
+}
+
+func (w *w5500) Bind(sockfd int, ip netip.AddrPort) error {
+
+	if debugging(debugNetdev) {
+		fmt.Printf("[Bind] sockfd: %d, addr: %s:%d\r\n", sockfd, ip.Addr(), ip.Port())
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	socket, ok := w.sockets[sockfd]
+	if !ok {
+		return netdev.ErrInvalidSocketFd
+	}
+
+	socket.laddr = ip
+
+	if socket.protocol == netdev.IPPROTO_UDP && socket.sock == noSock {
+		return w.openSocket(socket, modeUDP)
+	}
+
+	return nil
+}
+
+func (w *w5500) Connect(sockfd int, host string, ip netip.AddrPort) error {
+
+	if debugging(debugNetdev) {
+		if host == "" {
+			fmt.Printf("[Connect] sockfd: %d, addr: %s\r\n", sockfd, ip)
+		} else {
+			fmt.Printf("[Connect] sockfd: %d, host: %s:%d\r\n", sockfd, host, ip.Port())
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	socket, ok := w.sockets[sockfd]
+	if !ok {
+		return netdev.ErrInvalidSocketFd
+	}
+
+	switch socket.protocol {
+
+	case netdev.IPPROTO_TCP:
+		if socket.sock != noSock {
+			return ErrConnected
+		}
+		if err := w.openSocket(socket, modeTCP); err != nil {
+			return err
+		}
+		w.setDest(socket.sock, ip)
+		if err := w.command(socket.sock, cmdConnect); err != nil {
+			w.freeSocket(socket.sock)
+			socket.sock = noSock
+			return err
+		}
+
+		// The chip gives up after its retransmission timeout
+		for {
+			switch w.status(socket.sock) {
+			case statusEstablished:
+				socket.raddr = ip
+				return nil
+			case statusClosed:
+				w.freeSocket(socket.sock)
+				socket.sock = noSock
+				if host == "" {
+					return fmt.Errorf("Connect to %s failed", ip)
+				}
+				return fmt.Errorf("Connect to %s:%d failed", host, ip.Port())
+			}
+			if err := w.block(sockfd, socket, time.Time{}); err != nil {
+				return err
+			}
+		}
+
+	case netdev.IPPROTO_UDP:
+		if socket.sock == noSock {
+			if err := w.openSocket(socket, modeUDP); err != nil {
+				return err
+			}
+		}
+		socket.raddr = ip
+	}
+
+	return nil
+}
+
+// listen puts a hardware socket listening on the socket's local port
+func (w *w5500) listen(socket *socket) error {
+	if err := w.openSocket(socket, modeTCP); err != nil {
+		return err
+	}
+	if err := w.command(socket.sock, cmdListen); err != nil {
+		w.freeSocket(socket.sock)
+		socket.sock = noSock
+		return err
+	}
+	if w.status(socket.sock) != statusListen {
+		w.freeSocket(socket.sock)
+		socket.sock = noSock
+		return netdev.ErrNoMoreSockets
+	}
+	return nil
+}
+
+func (w *w5500) Listen(sockfd int, backlog int) error {
+
+	if debugging(debugNetdev) {
+		fmt.Printf("[Listen] sockfd: %d\r\n", sockfd)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	socket, ok := w.sockets[sockfd]
+	if !ok {
+		return netdev.ErrInvalidSocketFd
+	}
+
+	switch socket.protocol {
+	case netdev.IPPROTO_TCP:
+		if socket.sock != noSock {
+			return ErrConnected
+		}
+		socket.listening = true
+		return w.listen(socket)
+	case netdev.IPPROTO_UDP:
+	default:
+		return netdev.ErrProtocolNotSupported
+	}
+
+	return nil
+}
+
+// Accept hands the connection established on the listening hardware socket
+// over to a new socket, and listens again on another hardware socket.  Other
+// clients are refused while one is waiting to be accepted.
+func (w *w5500) Accept(sockfd int) (int, netip.AddrPort, error) {
+
+	if debugging(debugNetdev) {
+		fmt.Printf("[Accept] sockfd: %d\r\n", sockfd)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	listener, ok := w.sockets[sockfd]
+	if !ok {
+		return -1, netip.AddrPort{}, netdev.ErrInvalidSocketFd
+	}
+
+	if listener.protocol != netdev.IPPROTO_TCP || !listener.listening {
+		return -1, netip.AddrPort{}, netdev.ErrProtocolNotSupported
+	}
+
+	for {
+		if listener.sock == noSock {
+			// All hardware sockets were busy after the last Accept
+			w.listen(listener)
+		} else {
+			switch w.status(listener.sock) {
+			case statusEstablished, statusCloseWait:
+				clientfd := w.newSockfd()
+				if clientfd == -1 {
+					return -1, netip.AddrPort{}, netdev.ErrNoMoreSockets
+				}
+				client := &socket{
+					protocol: netdev.IPPROTO_TCP,
+					sock:     listener.sock,
+				}
+				client.raddr = w.remoteAddr(client.sock)
+				w.sockets[clientfd] = client
+
+				listener.sock = noSock
+				w.listen(listener)
+
+				return clientfd, client.raddr, nil
+
+			case statusClosed:
+				// The client went away before being accepted
+				w.freeSocket(listener.sock)
+				listener.sock = noSock
+				w.listen(listener)
+			}
+		}
+
+		// Unlock while we sleep, so others can make progress
+		w.mu.Unlock()
+		time.Sleep(100 * time.Millisecond)
+		w.mu.Lock()
+
+		if w.sockets[sockfd] != listener {
+			return -1, netip.AddrPort{}, netdev.ErrInvalidSocketFd
+		}
+	}
+}
+
+func (w *w5500) Send(sockfd int, buf []byte, flags int,
+	deadline time.Time) (int, error) {
+
+	if debugging(debugNetdev) {
+		fmt.Printf("[Send] sockfd: %d, len(buf): %d, flags: %d\r\n",
+			sockfd, len(buf), flags)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	socket, ok := w.sockets[sockfd]
+	if !ok {
+		return -1, netdev.ErrInvalidSocketFd
+	}
+
+	if socket.sock == noSock {
+		return -1, io.EOF
+	}
+
+	if socket.protocol == netdev.IPPROTO_UDP {
+		return w.sendUDP(sockfd, socket, buf, deadline)
+	}
+
+	// Send in chunks fitting the free space of the TX buffer
+	for sent := 0; sent < len(buf); {
+		if !w.connected(socket.sock) {
+			return -1, io.EOF
+		}
+
+		n := w.txFree(socket.sock)
+		if n == 0 {
+			if err := w.block(sockfd, socket, deadline); err != nil {
+				return -1, err
+			}
+			continue
+		}
+		if n > len(buf)-sent {
+			n = len(buf) - sent
+		}
+
+		w.startSend(socket.sock, buf[sent:sent+n])
+		if err := w.waitSent(sockfd, socket, deadline); err != nil {
+			return -1, err
+		}
+		sent += n
+	}
+
+	return len(buf), nil
+}
+
+func (w *w5500) sendUDP(sockfd int, socket *socket, buf []byte, deadline time.Time) (int, error) {
+	if !socket.raddr.IsValid() {
+		return -1, fmt.Errorf("Must Connect before sending")
+	}
+	if len(buf) > maxUDPPayload {
+		return -1, fmt.Errorf("UDP datagram too large, len(buf)=%d", len(buf))
+	}
+
+	w.setDest(socket.sock, socket.raddr)
+	w.startSend(socket.sock, buf)
+	if err := w.waitSent(sockfd, socket, deadline); err != nil {
+		return -1, err
+	}
+
+	return len(buf), nil
+}
+
+// waitSent waits for the chip to be done sending, it takes one send at a
+// time
+func (w *w5500) waitSent(sockfd int, socket *socket, deadline time.Time) error {
+	for {
+		done, err := w.sendDone(socket.sock)
+		if done || err != nil {
+			return err
+		}
+		if err := w.block(sockfd, socket, deadline); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *w5500) Recv(sockfd int, buf []byte, flags int,
+	deadline time.Time) (int, error) {
+
+	if debugging(debugNetdev) {
+		fmt.Printf("[Recv] sockfd: %d, len(buf): %d, flags: %d\r\n",
+			sockfd, len(buf), flags)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	socket, ok := w.sockets[sockfd]
+	if !ok {
+		return -1, netdev.ErrInvalidSocketFd
+	}
+
+	if socket.sock == noSock {
+		return -1, io.EOF
+	}
+
+	for {
+		// Recv() doesn't return unless there is data, even a single
+		// byte, or on error such as timeout or EOF.
+
+		switch socket.protocol {
+		case netdev.IPPROTO_TCP:
+			// The data received before the peer closed is read first
+			status := w.status(socket.sock)
+			if n := w.recvTCP(socket.sock, buf); n > 0 {
+				return n, nil
+			}
+			if status != statusEstablished {
+				return -1, io.EOF
+			}
+
+		case netdev.IPPROTO_UDP:
+			n, raddr, ok := w.recvFrom(socket.sock, buf)
+			// Connected UDP sockets only get datagrams from the peer
+			if ok && (!socket.raddr.IsValid() || raddr == socket.raddr) {
+				return n, nil
+			}
+			if ok {
+				continue
+			}
+		}
+
+		if err := w.block(sockfd, socket, deadline); err != nil {
+			return -1, err
+		}
+	}
+}
+
+func (w *w5500) Close(sockfd int) error {
+
+	if debugging(debugNetdev) {
+		fmt.Printf("[Close] sockfd: %d\r\n", sockfd)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	socket, ok := w.sockets[sockfd]
+	if !ok {
+		return netdev.ErrInvalidSocketFd
+	}
+
+	delete(w.sockets, sockfd)
+
+	if socket.sock == noSock {
+		return nil
+	}
+
+	s := socket.sock
+	socket.sock = noSock
+
+	// Let the chip close the TCP connection gracefully, for a while
+	if socket.protocol == netdev.IPPROTO_TCP && w.connected(s) {
+		w.command(s, cmdDiscon)
+		for i := 0; i < 100 && w.status(s) != statusClosed; i++ {
+			w.wait()
+		}
+	}
+
+	w.freeSocket(s)
+
+	return nil
+}
+
+func (w *w5500) SetSockOpt(sockfd int, level int, opt int, value interface{}) error {
+
+	if debugging(debugNetdev) {
+		fmt.Printf("[SetSockOpt] sockfd: %d\r\n", sockfd)
+	}
+
+	return netdev.ErrNotSupported
+}
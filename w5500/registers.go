@@ -0,0 +1,107 @@
+package w5500
+
+// Block select bits of the SPI control phase
+const (
+	blockCommon = 0x00
+)
+
+func blockSocket(s sock) uint8   { return uint8(s)<<2 | 0x01 }
+func blockTxBuffer(s sock) uint8 { return uint8(s)<<2 | 0x02 }
+func blockRxBuffer(s sock) uint8 { return uint8(s)<<2 | 0x03 }
+
+const (
+	controlRead  = 0x00
+	controlWrite = 0x04
+)
+
+// Common registers
+const (
+	regMode      = 0x0000
+	regGateway   = 0x0001
+	regSubnet    = 0x0005
+	regMAC       = 0x0009
+	regIP        = 0x000F
+	regRetryTime = 0x0019
+	regRetryCnt  = 0x001B
+	regPhyConfig = 0x002E
+	regVersion   = 0x0039
+
+	modeReset = 0x80
+
+	phyLink   = 0x01
+	phySpeed  = 0x02 // 100Mbps
+	phyDuplex = 0x04 // Full duplex
+
+	chipVersion = 0x04
+)
+
+// Socket registers
+const (
+	regSnMode       = 0x0000
+	regSnCommand    = 0x0001
+	regSnInterrupt  = 0x0002
+	regSnStatus     = 0x0003
+	regSnPort       = 0x0004
+	regSnDestIP     = 0x000C
+	regSnDestPort   = 0x0010
+	regSnRxBufSize  = 0x001E
+	regSnTxBufSize  = 0x001F
+	regSnTxFree     = 0x0020
+	regSnTxWrite    = 0x0024
+	regSnRxReceived = 0x0026
+	regSnRxRead     = 0x0028
+)
+
+// Socket modes
+const (
+	modeClosed = 0x00
+	modeTCP    = 0x01
+	modeUDP    = 0x02
+)
+
+// Socket commands
+const (
+	cmdOpen    = 0x01
+	cmdListen  = 0x02
+	cmdConnect = 0x04
+	cmdDiscon  = 0x08
+	cmdClose   = 0x10
+	cmdSend    = 0x20
+	cmdRecv    = 0x40
+)
+
+// Socket interrupts
+const (
+	intConnected    = 0x01
+	intDisconnected = 0x02
+	intReceived     = 0x04
+	intTimeout      = 0x08
+	intSendOK       = 0x10
+)
+
+// Socket status
+const (
+	statusClosed      = 0x00
+	statusInit        = 0x13
+	statusListen      = 0x14
+	statusSynSent     = 0x15
+	statusSynRecv     = 0x16
+	statusEstablished = 0x17
+	statusFinWait     = 0x18
+	statusClosing     = 0x1A
+	statusTimeWait    = 0x1B
+	statusCloseWait   = 0x1C
+	statusLastAck     = 0x1D
+	statusUDP         = 0x22
+)
+
+const (
+	maxSockets = 8
+
+	// Each socket gets the default 2KB of the 16KB TX and RX memories
+	bufferSize = 2048
+
+	// UDP packets in the RX buffer start with the peer's address and the
+	// data length
+	udpHeaderLen = 8
+)
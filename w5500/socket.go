@@ -0,0 +1,192 @@
+package w5500
+
+import (
+	"io"
+	"net/netip"
+	"time"
+
+	"tinygo.org/x/drivers/netdev"
+)
+
+// sock is a hardware socket number
+type sock uint8
+
+const (
+	noSock sock = 0xFF
+
+	// Local ports for clients are picked from the dynamic ports range
+	ephemeralPorts = 49152
+
+	// Largest UDP payload in a non-fragmented Ethernet frame
+	maxUDPPayload = 1472
+
+	// The chip takes a command within a few microseconds, or is not there
+	// anymore
+	commandTimeout = 10 * time.Millisecond
+)
+
+// getSocket allocates a hardware socket, noSock if none available
+func (w *w5500) getSocket() sock {
+	for s := range w.inUse {
+		if !w.inUse[s] {
+			w.inUse[s] = true
+			return sock(s)
+		}
+	}
+	return noSock
+}
+
+// freeSocket closes the hardware socket, and makes it available again
+func (w *w5500) freeSocket(s sock) {
+	w.command(s, cmdClose)
+	w.write8(regSnInterrupt, blockSocket(s), 0xFF)
+	w.inUse[s] = false
+}
+
+func (w *w5500) nextPort() uint16 {
+	w.port++
+	if w.port < ephemeralPorts {
+		w.port = ephemeralPorts
+	}
+	return w.port
+}
+
+// command issues a socket command, waiting for the chip to take it
+func (w *w5500) command(s sock, cmd uint8) error {
+	w.write8(regSnCommand, blockSocket(s), cmd)
+	deadline := time.Now().Add(commandTimeout)
+	for w.read8(regSnCommand, blockSocket(s)) != 0 {
+		if time.Now().After(deadline) {
+			return ErrCommandTimeout
+		}
+	}
+	return nil
+}
+
+func (w *w5500) status(s sock) uint8 {
+	return w.read8(regSnStatus, blockSocket(s))
+}
+
+// open opens the hardware socket in TCP or UDP mode on the local port
+func (w *w5500) open(s sock, mode uint8, port uint16) error {
+	if port == 0 {
+		port = w.nextPort()
+	}
+
+	w.write8(regSnMode, blockSocket(s), mode)
+	w.write16(regSnPort, blockSocket(s), port)
+	w.write8(regSnInterrupt, blockSocket(s), 0xFF)
+	if err := w.command(s, cmdOpen); err != nil {
+		return err
+	}
+
+	want := uint8(statusInit)
+	if mode == modeUDP {
+		want = statusUDP
+	}
+	if w.status(s) != want {
+		w.command(s, cmdClose)
+		return netdev.ErrNoMoreSockets
+	}
+	return nil
+}
+
+func (w *w5500) setDest(s sock, raddr netip.AddrPort) {
+	ip := ip4(raddr.Addr())
+	w.write(regSnDestIP, blockSocket(s), ip[:])
+	w.write16(regSnDestPort, blockSocket(s), raddr.Port())
+}
+
+// remoteAddr returns the address of the peer of a TCP connection
+func (w *w5500) remoteAddr(s sock) netip.AddrPort {
+	var ip [4]byte
+	w.read(regSnDestIP, blockSocket(s), ip[:])
+	port := w.read16(regSnDestPort, blockSocket(s))
+	return netip.AddrPortFrom(netip.AddrFrom4(ip), port)
+}
+
+// connected reports whether data can be sent on the TCP connection, which
+// the peer might have half-closed
+func (w *w5500) connected(s sock) bool {
+	switch w.status(s) {
+	case statusEstablished, statusCloseWait:
+		return true
+	}
+	return false
+}
+
+func (w *w5500) txFree(s sock) int {
+	return int(w.readStable16(regSnTxFree, blockSocket(s)))
+}
+
+// startSend copies the data in the TX buffer and sends it, the data must
+// fit in the free space
+func (w *w5500) startSend(s sock, p []byte) {
+	ptr := w.read16(regSnTxWrite, blockSocket(s))
+	// The chip wraps the offset around the buffer
+	w.write(ptr, blockTxBuffer(s), p)
+	w.write16(regSnTxWrite, blockSocket(s), ptr+uint16(len(p)))
+	w.command(s, cmdSend)
+}
+
+// sendDone checks if the data sent by startSend is out.  For UDP, a time out
+// is a failed ARP request for the destination.
+func (w *w5500) sendDone(s sock) (bool, error) {
+	ir := w.read8(regSnInterrupt, blockSocket(s))
+	switch {
+	case ir&intSendOK != 0:
+		w.write8(regSnInterrupt, blockSocket(s), intSendOK)
+		return true, nil
+	case ir&intTimeout != 0:
+		w.write8(regSnInterrupt, blockSocket(s), intTimeout)
+		return false, netdev.ErrTimeout
+	case ir&intDisconnected != 0:
+		return false, io.EOF
+	}
+	return false, nil
+}
+
+func (w *w5500) rxReceived(s sock) int {
+	return int(w.readStable16(regSnRxReceived, blockSocket(s)))
+}
+
+// recvTCP reads the data received, if any
+func (w *w5500) recvTCP(s sock, p []byte) int {
+	n := w.rxReceived(s)
+	if n == 0 {
+		return 0
+	}
+	if n > len(p) {
+		n = len(p)
+	}
+	ptr := w.read16(regSnRxRead, blockSocket(s))
+	w.read(ptr, blockRxBuffer(s), p[:n])
+	w.write16(regSnRxRead, blockSocket(s), ptr+uint16(n))
+	w.command(s, cmdRecv)
+	return n
+}
+
+// recvFrom reads the next UDP datagram received, if any.  Datagrams larger
+// than p are truncated.
+func (w *w5500) recvFrom(s sock, p []byte) (int, netip.AddrPort, bool) {
+	if w.rxReceived(s) < udpHeaderLen {
+		return 0, netip.AddrPort{}, false
+	}
+
+	var hdr [udpHeaderLen]byte
+	ptr := w.read16(regSnRxRead, blockSocket(s))
+	w.read(ptr, blockRxBuffer(s), hdr[:])
+	raddr := netip.AddrPortFrom(netip.AddrFrom4([4]byte{hdr[0], hdr[1], hdr[2], hdr[3]}),
+		uint16(hdr[4])<<8|uint16(hdr[5]))
+	size := uint16(hdr[6])<<8 | uint16(hdr[7])
+
+	n := int(size)
+	if n > len(p) {
+		n = len(p)
+	}
+	w.read(ptr+udpHeaderLen, blockRxBuffer(s), p[:n])
+	w.write16(regSnRxRead, blockSocket(s), ptr+udpHeaderLen+size)
+	w.command(s, cmdRecv)
+
+	return n, raddr, true
+}
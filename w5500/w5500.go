@@ -0,0 +1,534 @@
+// Package w5500 implements wired Ethernet communication over SPI with a
+// WIZnet W5500 controller, which has a hardwired TCP/IP stack.
+//
+// The W5500's 8 hardware sockets back the netdev sockets.  The W5500 doesn't
+// do DHCP nor DNS: the driver runs a DHCP client and a DNS resolver over one
+// of the hardware sockets, which must be available when connecting, renewing
+// the DHCP lease, and resolving host names.
+//
+// Datasheet:
+// https://docs.wiznet.io/img/products/w5500/W5500_ds_v110e.pdf
+
+package w5500 // import "tinygo.org/x/drivers/w5500"
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"machine"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"tinygo.org/x/drivers"
+	"tinygo.org/x/drivers/netlink"
+)
+
+var _debug debug = debugBasic
+
+//var _debug debug = debugBasic | debugNetdev
+//var _debug debug = debugBasic | debugNetdev | debugDHCP
+
+var (
+	driverName = "Tinygo WIZnet W5500 Ethernet network device driver (w5500)"
+)
+
+var (
+	ErrNotFound       = errors.New("W5500 not found")
+	ErrDHCPTimeout    = errors.New("DHCP timed out")
+	ErrCommandTimeout = errors.New("W5500 command timed out")
+	ErrConnected      = errors.New("Socket already connected")
+)
+
+const (
+	// Ethernet link check period, once connected
+	linkPollInterval = time.Second
+
+	// Socket status check period while waiting
+	pollInterval = 10 * time.Millisecond
+)
+
+type Config struct {
+	// SPI bus, configured for up to 33MHz, mode 0
+	Spi drivers.SPI
+
+	// Device pins
+	Cs machine.Pin
+	// Reset is the active low hardware reset.  Set to machine.NoPin if not
+	// wired, to only reset the chip by software.
+	Reset machine.Pin
+
+	// MAC address.  The W5500 doesn't have one: if not set, a random
+	// locally administered address is used.
+	MAC net.HardwareAddr
+}
+
+type w5500 struct {
+	cfg      *Config
+	notifyCb func(netlink.Event)
+	mu       sync.Mutex
+
+	spi   drivers.SPI
+	cs    machine.Pin
+	reset machine.Pin
+	hdr   [3]byte
+	buf   [8]byte
+
+	mac    net.HardwareAddr
+	params *netlink.ConnectParams
+
+	// Current IP configuration
+	ip      netip.Addr
+	netmask netip.Addr
+	gateway netip.Addr
+	dns     []netip.Addr
+	lease   dhcpLease
+
+	netConnected bool
+	linkUp       bool
+	driverShown  bool
+
+	killMonitor chan bool
+
+	sockets map[int]*socket // keyed by sockfd
+	inUse   [maxSockets]bool
+	port    uint16 // Last ephemeral port
+}
+
+func New(cfg *Config) *w5500 {
+	w := w5500{
+		cfg:     cfg,
+		sockets: make(map[int]*socket),
+		spi:     cfg.Spi,
+		cs:      cfg.Cs,
+		reset:   cfg.Reset,
+		mac:     cfg.MAC,
+		port:    ephemeralPorts,
+	}
+
+	if len(w.mac) != 6 {
+		w.mac = make(net.HardwareAddr, 6)
+		if _, err := rand.Read(w.mac); err != nil {
+			copy(w.mac, []byte{0x02, 0x08, 0xDC, 0x00, 0x00, 0x01})
+		}
+		// Locally administered, unicast
+		w.mac[0] = w.mac[0]&^0x01 | 0x02
+	}
+
+	return &w
+}
+
+func (w *w5500) notify(event netlink.Event) {
+	if w.notifyCb != nil {
+		w.notifyCb(event)
+	}
+}
+
+func (w *w5500) showDriver() {
+	if w.driverShown {
+		return
+	}
+	if debugging(debugBasic) {
+		fmt.Printf("\r\n")
+		fmt.Printf("%s\r\n\r\n", driverName)
+		fmt.Printf("Driver version           : %s\r\n", drivers.Version)
+		fmt.Printf("MAC address              : %s\r\n", w.mac.String())
+		fmt.Printf("\r\n")
+	}
+	w.driverShown = true
+}
+
+func (w *w5500) showLink() {
+	if debugging(debugBasic) {
+		phy := w.read8(regPhyConfig, blockCommon)
+		speed, duplex := 10, "half"
+		if phy&phySpeed != 0 {
+			speed = 100
+		}
+		if phy&phyDuplex != 0 {
+			duplex = "full"
+		}
+		fmt.Printf("Ethernet link UP         : %dMbps %s duplex\r\n", speed, duplex)
+	}
+}
+
+func (w *w5500) showIP() {
+	if debugging(debugBasic) {
+		how := "Static"
+		if !w.params.Addr.IsValid() {
+			how = "DHCP-assigned"
+		}
+		fmt.Printf("\r\n")
+		fmt.Printf("%-25s: %s\r\n", how+" IP", w.ip)
+		fmt.Printf("%-25s: %s\r\n", how+" subnet", w.netmask)
+		fmt.Printf("%-25s: %s\r\n", how+" gateway", w.gateway)
+		fmt.Printf("\r\n")
+	}
+}
+
+// start resets the chip
+func (w *w5500) start() error {
+	w.cs.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	w.cs.High()
+
+	if w.reset != machine.NoPin {
+		w.reset.Configure(machine.PinConfig{Mode: machine.PinOutput})
+		w.reset.Low()
+		time.Sleep(time.Millisecond)
+		w.reset.High()
+		// Wait for the PLL to lock
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	w.write8(regMode, blockCommon, modeReset)
+	for i := 0; w.read8(regMode, blockCommon)&modeReset != 0; i++ {
+		if i == 100 {
+			return ErrNotFound
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if w.read8(regVersion, blockCommon) != chipVersion {
+		return ErrNotFound
+	}
+
+	w.write(regMAC, blockCommon, w.mac)
+	w.setIP(netip.Addr{}, netip.Addr{}, netip.Addr{})
+
+	return nil
+}
+
+// stop closes all hardware sockets, the sockets left open get EOF
+func (w *w5500) stop() {
+	for _, socket := range w.sockets {
+		socket.sock = noSock
+	}
+	for s := range w.inUse {
+		if w.inUse[s] {
+			w.freeSocket(sock(s))
+		}
+	}
+	w.setIP(netip.Addr{}, netip.Addr{}, netip.Addr{})
+	w.lease = dhcpLease{}
+}
+
+func (w *w5500) linkStatus() bool {
+	return w.read8(regPhyConfig, blockCommon)&phyLink != 0
+}
+
+func (w *w5500) setIP(ip, netmask, gateway netip.Addr) {
+	w.ip, w.netmask, w.gateway = ip, netmask, gateway
+	b := ip4(ip)
+	w.write(regIP, blockCommon, b[:])
+	b = ip4(netmask)
+	w.write(regSubnet, blockCommon, b[:])
+	b = ip4(gateway)
+	w.write(regGateway, blockCommon, b[:])
+}
+
+// configureIP sets the static IP configuration, or gets one by DHCP
+func (w *w5500) configureIP(timeout time.Duration) error {
+	if w.params.Addr.IsValid() {
+		netmask := w.params.Netmask
+		if !netmask.IsValid() {
+			netmask = defaultNetmask
+		}
+		w.setIP(w.params.Addr, netmask, w.params.Gateway)
+		w.dns = w.params.DNS
+		return nil
+	}
+
+	ip := w.ip
+	if err := w.dhcp(timeout); err != nil {
+		return err
+	}
+	w.notify(netlink.EventDHCPBound)
+	if ip.IsValid() && ip != w.ip {
+		w.notify(netlink.EventIPChanged)
+	}
+	return nil
+}
+
+// netConnect waits for the Ethernet link to come up, and configures the IP
+// address
+func (w *w5500) netConnect() error {
+
+	timeout := w.params.ConnectTimeout
+	if timeout == 0 {
+		timeout = netlink.DefaultConnectTimeout
+	}
+
+	if debugging(debugBasic) {
+		fmt.Printf("Connecting to Ethernet...")
+	}
+
+	w.notify(netlink.EventConnecting)
+
+	start := time.Now()
+	for !w.linkStatus() {
+		if time.Since(start) > timeout {
+			if debugging(debugBasic) {
+				fmt.Printf("FAILED (no link)\r\n")
+			}
+			return netlink.ErrConnectTimeout
+		}
+		w.wait()
+	}
+
+	if err := w.configureIP(timeout - time.Since(start)); err != nil {
+		if debugging(debugBasic) {
+			fmt.Printf("FAILED (%s)\r\n", err)
+		}
+		return err
+	}
+
+	if debugging(debugBasic) {
+		fmt.Printf("CONNECTED\r\n")
+	}
+	w.showLink()
+	w.showIP()
+
+	w.linkUp = true
+	w.notify(netlink.EventNetUp)
+
+	return nil
+}
+
+// monitor follows the Ethernet link status and renews the DHCP lease,
+// until killed
+func (w *w5500) monitor(kill chan bool) {
+	ticker := time.NewTicker(linkPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-kill:
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			select {
+			case <-kill:
+				// Disconnected while waiting for the lock
+			default:
+				w.checkLink()
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+func (w *w5500) checkLink() {
+	link := w.linkStatus()
+
+	switch {
+	case w.linkUp && !link:
+		if debugging(debugBasic) {
+			fmt.Printf("Ethernet link DOWN\r\n")
+		}
+		w.linkUp = false
+		w.notify(netlink.EventNetDown)
+
+	case !w.linkUp && link:
+		// The cable might now be plugged into another network, get a
+		// new lease.  Try again on the next tick if it fails.
+		if err := w.configureIP(linkPollInterval * 5); err != nil {
+			return
+		}
+		w.showLink()
+		w.showIP()
+		w.linkUp = true
+		w.notify(netlink.EventNetUp)
+
+	case w.linkUp && w.lease.renewDue():
+		if err := w.renew(); err == nil {
+			return
+		}
+		if !w.lease.expired() {
+			w.lease.renewAt = time.Now().Add(dhcpRenewRetry)
+			return
+		}
+		if debugging(debugBasic) {
+			fmt.Printf("DHCP lease expired\r\n")
+		}
+		w.setIP(netip.Addr{}, netip.Addr{}, netip.Addr{})
+		w.lease = dhcpLease{}
+		w.linkUp = false
+		w.notify(netlink.EventNetDown)
+	}
+}
+
+func (w *w5500) NetConnect(params *netlink.ConnectParams) error {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.netConnected {
+		return netlink.ErrConnected
+	}
+
+	if params.ConnectMode != netlink.ConnectModeSTA {
+		return netlink.ErrConnectModeNoGood
+	}
+
+	if !validIPConfig(params) {
+		return netlink.ErrNotSupported
+	}
+
+	w.params = params
+
+	w.showDriver()
+
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	for i := 0; w.params.Retries == 0 || i < w.params.Retries; i++ {
+		err := w.netConnect()
+		if err == nil {
+			w.netConnected = true
+			w.killMonitor = make(chan bool)
+			go w.monitor(w.killMonitor)
+			return nil
+		}
+		switch err {
+		case netlink.ErrConnectTimeout, ErrDHCPTimeout:
+			continue
+		}
+		return err
+	}
+
+	return netlink.ErrConnectFailed
+}
+
+func (w *w5500) NetDisconnect() {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.netConnected {
+		return
+	}
+
+	close(w.killMonitor)
+
+	w.stop()
+
+	w.netConnected = false
+	w.linkUp = false
+
+	if debugging(debugBasic) {
+		fmt.Printf("\r\nDisconnected from Ethernet\r\n\r\n")
+	}
+
+	w.notify(netlink.EventNetDown)
+}
+
+func (w *w5500) NetNotify(cb func(netlink.Event)) {
+	w.notifyCb = cb
+}
+
+func (w *w5500) GetHardwareAddr() (net.HardwareAddr, error) {
+
+	if debugging(debugNetdev) {
+		fmt.Printf("[GetHardwareAddr]\r\n")
+	}
+
+	return append(net.HardwareAddr{}, w.mac...), nil
+}
+
+func (w *w5500) GetLinkStatus() (netlink.LinkStatus, error) {
+
+	if debugging(debugNetdev) {
+		fmt.Printf("[GetLinkStatus]\r\n")
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.netConnected || !w.linkUp {
+		return netlink.LinkStatus{}, netlink.ErrNotConnected
+	}
+
+	return netlink.LinkStatus{
+		Addr:    w.ip,
+		Netmask: w.netmask,
+		Gateway: w.gateway,
+		DNS:     w.dns,
+	}, nil
+}
+
+// validIPConfig checks the static IP configuration is IPv4
+func validIPConfig(params *netlink.ConnectParams) bool {
+	for _, ip := range append([]netip.Addr{params.Addr, params.Netmask, params.Gateway}, params.DNS...) {
+		if ip.IsValid() && !ip.Is4() {
+			return false
+		}
+	}
+	return true
+}
+
+// ip4 returns the IPv4 address bytes, zero if the address isn't set
+func ip4(ip netip.Addr) [4]byte {
+	if !ip.Is4() {
+		return [4]byte{}
+	}
+	return ip.As4()
+}
+
+// wait sleeps a bit, unlocked so others can make progress
+func (w *w5500) wait() {
+	w.mu.Unlock()
+	time.Sleep(pollInterval)
+	w.mu.Lock()
+}
+
+// SPI frames are a 16-bit address, a control byte with the block selected,
+// and the data
+
+func (w *w5500) read(addr uint16, block uint8, p []byte) {
+	w.cs.Low()
+	w.hdr = [3]byte{byte(addr >> 8), byte(addr), block<<3 | controlRead}
+	w.spi.Tx(w.hdr[:], nil)
+	w.spi.Tx(nil, p)
+	w.cs.High()
+}
+
+func (w *w5500) write(addr uint16, block uint8, p []byte) {
+	w.cs.Low()
+	w.hdr = [3]byte{byte(addr >> 8), byte(addr), block<<3 | controlWrite}
+	w.spi.Tx(w.hdr[:], nil)
+	w.spi.Tx(p, nil)
+	w.cs.High()
+}
+
+func (w *w5500) read8(addr uint16, block uint8) uint8 {
+	w.read(addr, block, w.buf[:1])
+	return w.buf[0]
+}
+
+func (w *w5500) write8(addr uint16, block uint8, v uint8) {
+	w.buf[0] = v
+	w.write(addr, block, w.buf[:1])
+}
+
+func (w *w5500) read16(addr uint16, block uint8) uint16 {
+	w.read(addr, block, w.buf[:2])
+	return uint16(w.buf[0])<<8 | uint16(w.buf[1])
+}
+
+func (w *w5500) write16(addr uint16, block uint8, v uint16) {
+	w.buf[0], w.buf[1] = byte(v>>8), byte(v)
+	w.write(addr, block, w.buf[:2])
+}
+
+// readStable16 reads a register the chip may update while being read,
+// until it reads the same twice, as recommended by the datasheet
+func (w *w5500) readStable16(addr uint16, block uint8) uint16 {
+	v := w.read16(addr, block)
+	for {
+		v2 := w.read16(addr, block)
+		if v2 == v {
+			return v
+		}
+		v = v2
+	}
+}
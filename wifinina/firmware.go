@@ -0,0 +1,101 @@
+package wifinina
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// MinFirmwareVersion is the oldest nina-fw release implementing all the
+// commands used by this driver
+var MinFirmwareVersion = FirmwareVersion{Major: 1, Minor: 4, Patch: 8}
+
+var (
+	ErrFirmwareVersion  = errors.New("wifinina: invalid firmware version")
+	ErrFirmwareTooOld   = errors.New("wifinina: firmware too old, please update nina-fw")
+	ErrFirmwareNotReady = errors.New("wifinina: firmware not responding")
+)
+
+// FirmwareVersion is a nina-fw release version
+type FirmwareVersion struct {
+	Major, Minor, Patch int
+}
+
+// ParseFirmwareVersion parses a version string such as "1.4.8", as returned
+// by the firmware
+func ParseFirmwareVersion(s string) (FirmwareVersion, error) {
+	var v FirmwareVersion
+	parts := strings.Split(strings.TrimSpace(s), ".")
+	if len(parts) != 3 {
+		return v, ErrFirmwareVersion
+	}
+	for i, p := range [...]*int{&v.Major, &v.Minor, &v.Patch} {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil || n < 0 {
+			return FirmwareVersion{}, ErrFirmwareVersion
+		}
+		*p = n
+	}
+	return v, nil
+}
+
+func (v FirmwareVersion) String() string {
+	return strconv.Itoa(v.Major) + "." + strconv.Itoa(v.Minor) + "." + strconv.Itoa(v.Patch)
+}
+
+// Compare returns -1, 0 or 1 if v is older, the same or newer than other
+func (v FirmwareVersion) Compare(other FirmwareVersion) int {
+	for _, d := range [...]int{v.Major - other.Major, v.Minor - other.Minor, v.Patch - other.Patch} {
+		switch {
+		case d < 0:
+			return -1
+		case d > 0:
+			return 1
+		}
+	}
+	return 0
+}
+
+// Compatible reports whether the firmware version implements the protocol
+// used by this driver
+func (v FirmwareVersion) Compatible() bool {
+	return v.Compare(MinFirmwareVersion) >= 0
+}
+
+// FirmwareVersion reads the version of the nina-fw firmware running on the
+// ESP32.  The ESP32 is reset first unless the network is connected.
+func (w *wifinina) FirmwareVersion() (FirmwareVersion, error) {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.netConnected {
+		w.setupSPI()
+		w.start()
+	}
+
+	s := w.getFwVersion()
+	fault := w.fault
+	if !w.netConnected {
+		// Nobody else will recover from the fault
+		w.fault = nil
+	}
+	if fault != nil || s == "" {
+		return FirmwareVersion{}, ErrFirmwareNotReady
+	}
+
+	return ParseFirmwareVersion(s)
+}
+
+// CheckFirmware returns ErrFirmwareTooOld if the firmware running on the
+// ESP32 is older than MinFirmwareVersion
+func (w *wifinina) CheckFirmware() error {
+	v, err := w.FirmwareVersion()
+	if err != nil {
+		return err
+	}
+	if !v.Compatible() {
+		return ErrFirmwareTooOld
+	}
+	return nil
+}
@@ -0,0 +1,418 @@
+package wifinina
+
+// Firmware update of the ESP32 over its UART, using the ESP ROM bootloader
+// serial protocol, as esptool does.
+//
+// Protocol reference:
+// https://docs.espressif.com/projects/esptool/en/latest/esp32/advanced-topics/serial-protocol.html
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"machine"
+	"runtime"
+	"time"
+
+	"tinygo.org/x/drivers"
+)
+
+const (
+	romCmdFlashBegin     = 0x02
+	romCmdFlashData      = 0x03
+	romCmdFlashEnd       = 0x04
+	romCmdSync           = 0x08
+	romCmdSpiSetParams   = 0x0B
+	romCmdSpiAttach      = 0x0D
+	romCmdSpiFlashMD5    = 0x13
+	romDirRequest        = 0x00
+	romDirResponse       = 0x01
+	romChecksumSeed      = 0xEF
+	romStatusLen         = 4 // ESP32 ROM status bytes at the end of a response
+	romFlashBlockSize    = 0x400
+	romFlashSectorSize   = 0x1000
+	romTimeout           = 3 * time.Second
+	romSyncTimeout       = 100 * time.Millisecond
+	romSyncRetries       = 10
+	romEraseTimeoutPerMB = 30 * time.Second
+	romMD5TimeoutPerMB   = 8 * time.Second
+
+	// NINA-W102 modules have 2MB of flash
+	ninaFlashSize = 2 << 20
+
+	slipEnd    = 0xC0
+	slipEsc    = 0xDB
+	slipEscEnd = 0xDC
+	slipEscEsc = 0xDD
+)
+
+var (
+	ErrFlashTimeout = errors.New("wifinina: flasher timeout waiting for ESP32 bootloader")
+	ErrFlashSync    = errors.New("wifinina: flasher could not sync with ESP32 bootloader")
+	ErrFlashSize    = errors.New("wifinina: firmware image does not fit in flash")
+	ErrFlashVerify  = errors.New("wifinina: firmware image verification failed")
+)
+
+// Flasher writes firmware images to the ESP32 flash over its UART.  The
+// ESP32 GPIO0 and RESETN pins are used to start the ESP32 ROM bootloader, so
+// the wifinina driver must not be used while flashing.
+type Flasher struct {
+	uart        drivers.UART
+	gpio0       machine.Pin
+	resetn      machine.Pin
+	resetIsHigh bool
+
+	// SLIP encoded request frame
+	out []byte
+	// last response frame received, SLIP decoded
+	rsp []byte
+}
+
+// NewFlasher returns a Flasher for the ESP32 wired as described by cfg, with
+// the ESP32 UART0 connected to uart.  The UART must be configured for
+// 115200 baud.
+func NewFlasher(cfg *Config, uart drivers.UART) *Flasher {
+	return &Flasher{
+		uart:        uart,
+		gpio0:       cfg.Gpio0,
+		resetn:      cfg.Resetn,
+		resetIsHigh: cfg.ResetIsHigh,
+	}
+}
+
+// reset resets the ESP32, holding GPIO0 low to start the ROM bootloader
+// rather than the firmware
+func (f *Flasher) reset(bootloader bool) {
+	f.gpio0.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	f.resetn.Configure(machine.PinConfig{Mode: machine.PinOutput})
+
+	f.gpio0.Set(!bootloader)
+	f.resetn.Set(f.resetIsHigh)
+	time.Sleep(100 * time.Millisecond)
+	f.resetn.Set(!f.resetIsHigh)
+	time.Sleep(50 * time.Millisecond)
+
+	f.gpio0.High()
+	f.gpio0.Configure(machine.PinConfig{Mode: machine.PinInput})
+}
+
+// Passthrough starts the ESP32 ROM bootloader and then forwards bytes
+// between host and the ESP32 UART, so a PC running esptool connected to
+// host can flash the ESP32.  Passthrough never returns.
+func (f *Flasher) Passthrough(host drivers.UART) {
+	f.reset(true)
+
+	var buf [64]byte
+	for {
+		forward(host, f.uart, buf[:])
+		forward(f.uart, host, buf[:])
+		runtime.Gosched()
+	}
+}
+
+func forward(from, to drivers.UART, buf []byte) {
+	for from.Buffered() > 0 {
+		n, _ := from.Read(buf)
+		if n == 0 {
+			return
+		}
+		to.Write(buf[:n])
+	}
+}
+
+// Begin starts the ESP32 ROM bootloader and syncs with it.  Begin must be
+// called before Flash.
+func (f *Flasher) Begin() error {
+	f.reset(true)
+
+	if err := f.sync(); err != nil {
+		return err
+	}
+
+	// The ESP32 ROM needs the SPI flash attached and its parameters set
+	// before writing
+	var attach [8]byte
+	if _, err := f.command(romCmdSpiAttach, attach[:], 0, romTimeout); err != nil {
+		return err
+	}
+
+	var params [24]byte
+	binary.LittleEndian.PutUint32(params[0:], 0)             // flash id
+	binary.LittleEndian.PutUint32(params[4:], ninaFlashSize) // total size
+	binary.LittleEndian.PutUint32(params[8:], 64*1024)       // block size
+	binary.LittleEndian.PutUint32(params[12:], romFlashSectorSize)
+	binary.LittleEndian.PutUint32(params[16:], 256)    // page size
+	binary.LittleEndian.PutUint32(params[20:], 0xFFFF) // status mask
+	_, err := f.command(romCmdSpiSetParams, params[:], 0, romTimeout)
+	return err
+}
+
+func (f *Flasher) sync() error {
+	var payload [36]byte
+	copy(payload[:], []byte{0x07, 0x07, 0x12, 0x20})
+	for i := 4; i < len(payload); i++ {
+		payload[i] = 0x55
+	}
+
+	for i := 0; i < romSyncRetries; i++ {
+		if _, err := f.command(romCmdSync, payload[:], 0, romSyncTimeout); err != nil {
+			continue
+		}
+		// The ROM answers a sync several times; drop the extra responses
+		for f.readFrame(time.Now().Add(romSyncTimeout)) == nil {
+		}
+		return nil
+	}
+
+	return ErrFlashSync
+}
+
+// Flash erases size bytes of the ESP32 flash at offset and writes the
+// firmware image read from r there, then checks the MD5 of the written
+// image.  The image can be streamed from anywhere, such as the
+// microcontroller flash or a file on an SD card.
+func (f *Flasher) Flash(offset uint32, r io.Reader, size int) error {
+	if size <= 0 || int(offset)+size > ninaFlashSize {
+		return ErrFlashSize
+	}
+
+	blocks := (size + romFlashBlockSize - 1) / romFlashBlockSize
+
+	var begin [16]byte
+	binary.LittleEndian.PutUint32(begin[0:], uint32(size))
+	binary.LittleEndian.PutUint32(begin[4:], uint32(blocks))
+	binary.LittleEndian.PutUint32(begin[8:], romFlashBlockSize)
+	binary.LittleEndian.PutUint32(begin[12:], offset)
+	if _, err := f.command(romCmdFlashBegin, begin[:], 0,
+		timeoutPerMB(romEraseTimeoutPerMB, size)); err != nil {
+		return err
+	}
+
+	sum := md5.New()
+	data := make([]byte, 16+romFlashBlockSize)
+	remaining := size
+
+	for seq := 0; seq < blocks; seq++ {
+		block := data[16:]
+		n := romFlashBlockSize
+		if remaining < n {
+			n = remaining
+		}
+		if _, err := io.ReadFull(r, block[:n]); err != nil {
+			return err
+		}
+		sum.Write(block[:n])
+		remaining -= n
+
+		// The last block is padded with erased flash bytes
+		for i := n; i < len(block); i++ {
+			block[i] = 0xFF
+		}
+
+		binary.LittleEndian.PutUint32(data[0:], romFlashBlockSize)
+		binary.LittleEndian.PutUint32(data[4:], uint32(seq))
+		binary.LittleEndian.PutUint32(data[8:], 0)
+		binary.LittleEndian.PutUint32(data[12:], 0)
+
+		if _, err := f.command(romCmdFlashData, data, checksum(block), romTimeout); err != nil {
+			return err
+		}
+
+		if debugging(debugBasic) {
+			fmt.Printf("\rFlashing ESP32: %d%%", (seq+1)*100/blocks)
+		}
+	}
+
+	if debugging(debugBasic) {
+		fmt.Printf("\r\n")
+	}
+
+	return f.verify(offset, size, sum.Sum(nil))
+}
+
+func (f *Flasher) verify(offset uint32, size int, want []byte) error {
+	var req [16]byte
+	binary.LittleEndian.PutUint32(req[0:], offset)
+	binary.LittleEndian.PutUint32(req[4:], uint32(size))
+
+	body, err := f.command(romCmdSpiFlashMD5, req[:], 0,
+		timeoutPerMB(romMD5TimeoutPerMB, size))
+	if err != nil {
+		return err
+	}
+
+	// The ROM returns the MD5 as 32 hex digits
+	if len(body) < 32 || hex.EncodeToString(want) != string(body[:32]) {
+		return ErrFlashVerify
+	}
+
+	return nil
+}
+
+// End finishes flashing.  If reboot, the ESP32 is reset to run the new
+// firmware.
+func (f *Flasher) End(reboot bool) error {
+	// Ask the ROM to stay in the bootloader, we reset the ESP32 ourselves
+	var end [4]byte
+	binary.LittleEndian.PutUint32(end[:], 1)
+	if _, err := f.command(romCmdFlashEnd, end[:], 0, romTimeout); err != nil {
+		return err
+	}
+
+	if reboot {
+		f.reset(false)
+	}
+
+	return nil
+}
+
+func timeoutPerMB(perMB time.Duration, size int) time.Duration {
+	t := time.Duration(int64(perMB) * int64(size) / (1 << 20))
+	if t < romTimeout {
+		return romTimeout
+	}
+	return t
+}
+
+func checksum(data []byte) uint32 {
+	sum := uint8(romChecksumSeed)
+	for _, b := range data {
+		sum ^= b
+	}
+	return uint32(sum)
+}
+
+// command sends a request to the ROM bootloader and waits for the matching
+// response, returning the response data less the status bytes
+func (f *Flasher) command(op uint8, data []byte, sum uint32, timeout time.Duration) ([]byte, error) {
+	f.writeFrame(op, data, sum)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		if err := f.readFrame(deadline); err != nil {
+			return nil, err
+		}
+
+		rsp := f.rsp
+		if len(rsp) < 8 || rsp[0] != romDirResponse || rsp[1] != op {
+			// Not ours, maybe a late sync response
+			continue
+		}
+
+		size := int(binary.LittleEndian.Uint16(rsp[2:]))
+		body := rsp[8:]
+		if size > len(body) || size < romStatusLen {
+			return nil, fmt.Errorf("wifinina: flasher cmd %02X: short response", op)
+		}
+
+		body = body[:size]
+		status := body[size-romStatusLen:]
+		if status[0] != 0 {
+			return nil, fmt.Errorf("wifinina: flasher cmd %02X failed: error %02X", op, status[1])
+		}
+
+		return body[:size-romStatusLen], nil
+	}
+}
+
+func (f *Flasher) writeFrame(op uint8, data []byte, sum uint32) {
+	f.out = append(f.out[:0], slipEnd)
+	var hdr [8]byte
+	hdr[0] = romDirRequest
+	hdr[1] = op
+	binary.LittleEndian.PutUint16(hdr[2:], uint16(len(data)))
+	binary.LittleEndian.PutUint32(hdr[4:], sum)
+	f.out = slipEncode(f.out, hdr[:])
+	f.out = slipEncode(f.out, data)
+	f.out = append(f.out, slipEnd)
+
+	if debugging(debugDetail) {
+		fmt.Printf("        flasher: cmd %02X, len %d\r\n", op, len(data))
+	}
+
+	f.uart.Write(f.out)
+}
+
+func slipEncode(out, data []byte) []byte {
+	for _, b := range data {
+		switch b {
+		case slipEnd:
+			out = append(out, slipEsc, slipEscEnd)
+		case slipEsc:
+			out = append(out, slipEsc, slipEscEsc)
+		default:
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// readFrame reads the next non-empty SLIP frame into f.rsp
+func (f *Flasher) readFrame(deadline time.Time) error {
+	// Skip anything before the start of the frame, such as the ROM boot
+	// messages
+	for {
+		b, err := f.readByte(deadline)
+		if err != nil {
+			return err
+		}
+		if b == slipEnd {
+			break
+		}
+	}
+
+	f.rsp = f.rsp[:0]
+	escaped := false
+	for {
+		b, err := f.readByte(deadline)
+		if err != nil {
+			return err
+		}
+		switch {
+		case escaped:
+			escaped = false
+			switch b {
+			case slipEscEnd:
+				b = slipEnd
+			case slipEscEsc:
+				b = slipEsc
+			}
+			f.rsp = append(f.rsp, b)
+		case b == slipEsc:
+			escaped = true
+		case b == slipEnd:
+			if len(f.rsp) > 0 {
+				return nil
+			}
+			// Back-to-back frame markers
+		default:
+			f.rsp = append(f.rsp, b)
+		}
+	}
+}
+
+func (f *Flasher) readByte(deadline time.Time) (byte, error) {
+	if b, ok := readByteUntil(f.uart, deadline); ok {
+		return b, nil
+	}
+	return 0, ErrFlashTimeout
+}
+
+// readByteUntil reads a byte from uart, waiting for it until deadline
+func readByteUntil(uart drivers.UART, deadline time.Time) (byte, bool) {
+	var b [1]byte
+	for {
+		if uart.Buffered() > 0 {
+			if n, _ := uart.Read(b[:]); n == 1 {
+				return b[0], true
+			}
+		}
+		if time.Now().After(deadline) {
+			return 0, false
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
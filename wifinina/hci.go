@@ -0,0 +1,234 @@
+package wifinina
+
+// Bluetooth LE HCI transport.  When its SPI chip select is held low at
+// reset, nina-fw starts the ESP32 BLE controller and exposes it as an HCI
+// UART (H4) interface on the ESP32 UART, for a BLE host stack on the
+// microcontroller.  The Wifi functions are not available in BLE mode.
+
+import (
+	"encoding/binary"
+	"errors"
+	"machine"
+	"time"
+
+	"tinygo.org/x/drivers"
+)
+
+const (
+	// H4 packet indicators
+	HCIPacketCommand = 0x01
+	HCIPacketACLData = 0x02
+	HCIPacketEvent   = 0x04
+
+	hciEventCommandComplete = 0x0E
+	hciEventCommandStatus   = 0x0F
+
+	hciOpcodeReset = 0x0C03
+
+	hciTimeout = time.Second
+)
+
+var (
+	ErrHCITimeout = errors.New("wifinina: HCI timeout")
+	ErrHCIPacket  = errors.New("wifinina: invalid HCI packet")
+	ErrHCIStatus  = errors.New("wifinina: HCI command failed")
+)
+
+// HCI is the HCI transport to the NINA BLE controller.  It implements the
+// io.Reader, io.Writer and io.ByteReader interfaces used by BLE host stacks
+// reading and writing raw H4 packets, and helpers to do it a packet at a
+// time.
+type HCI struct {
+	uart        drivers.UART
+	cs          machine.Pin
+	gpio0       machine.Pin
+	resetn      machine.Pin
+	resetIsHigh bool
+
+	// last packet read, the largest being ACL data
+	buf [4 + 1024]byte
+}
+
+// NewHCI returns the HCI transport for the ESP32 wired as described by cfg,
+// with the ESP32 UART connected to uart.  The UART must be configured with
+// the baud rate used by nina-fw for HCI, 115200 baud (912600 baud on the
+// Arduino Nano 33 IoT and MKR WiFi 1010), with RTS/CTS flow control if the
+// board has it.
+func NewHCI(cfg *Config, uart drivers.UART) *HCI {
+	return &HCI{
+		uart:        uart,
+		cs:          cfg.Cs,
+		gpio0:       cfg.Gpio0,
+		resetn:      cfg.Resetn,
+		resetIsHigh: cfg.ResetIsHigh,
+	}
+}
+
+// Start resets the ESP32 into BLE mode, then resets the BLE controller
+func (h *HCI) Start() error {
+	h.cs.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	h.resetn.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	h.gpio0.Configure(machine.PinConfig{Mode: machine.PinOutput})
+
+	// GPIO0 high for the ESP32 to boot nina-fw, not its ROM bootloader
+	h.gpio0.High()
+	h.cs.Low()
+	h.resetn.Set(h.resetIsHigh)
+	time.Sleep(100 * time.Millisecond)
+	h.resetn.Set(!h.resetIsHigh)
+	time.Sleep(750 * time.Millisecond)
+
+	h.gpio0.Low()
+	h.gpio0.Configure(machine.PinConfig{Mode: machine.PinInput})
+
+	// Drop the boot messages
+	var buf [64]byte
+	for h.uart.Buffered() > 0 {
+		if n, _ := h.uart.Read(buf[:]); n == 0 {
+			break
+		}
+	}
+
+	_, err := h.Command(hciOpcodeReset, nil)
+	return err
+}
+
+// Stop holds the ESP32 in reset
+func (h *HCI) Stop() {
+	h.resetn.Set(h.resetIsHigh)
+	h.cs.High()
+}
+
+func (h *HCI) Buffered() int {
+	return h.uart.Buffered()
+}
+
+func (h *HCI) Read(b []byte) (int, error) {
+	return h.uart.Read(b)
+}
+
+func (h *HCI) ReadByte() (byte, error) {
+	return h.readByte(time.Now().Add(hciTimeout))
+}
+
+func (h *HCI) Write(b []byte) (int, error) {
+	return h.uart.Write(b)
+}
+
+// WritePacket writes an H4 packet of type typ, such as HCIPacketCommand,
+// with the HCI packet in data
+func (h *HCI) WritePacket(typ uint8, data []byte) error {
+	if _, err := h.uart.Write([]byte{typ}); err != nil {
+		return err
+	}
+	_, err := h.uart.Write(data)
+	return err
+}
+
+// ReadPacket reads the next H4 packet, returning its type and the HCI packet,
+// valid until the next read
+func (h *HCI) ReadPacket(timeout time.Duration) (uint8, []byte, error) {
+	deadline := time.Now().Add(timeout)
+
+	typ, err := h.readByte(deadline)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var hdr int
+	switch typ {
+	case HCIPacketEvent:
+		// event code, length
+		hdr = 2
+	case HCIPacketACLData:
+		// handle and flags, length
+		hdr = 4
+	default:
+		return 0, nil, ErrHCIPacket
+	}
+
+	if err := h.readFull(h.buf[:hdr], deadline); err != nil {
+		return 0, nil, err
+	}
+
+	var l int
+	if typ == HCIPacketEvent {
+		l = int(h.buf[1])
+	} else {
+		l = int(binary.LittleEndian.Uint16(h.buf[2:]))
+	}
+	if hdr+l > len(h.buf) {
+		return 0, nil, ErrHCIPacket
+	}
+
+	if err := h.readFull(h.buf[hdr:hdr+l], deadline); err != nil {
+		return 0, nil, err
+	}
+
+	return typ, h.buf[:hdr+l], nil
+}
+
+// Command sends the HCI command opcode with params, and waits for the
+// controller to complete it.  The return parameters of the Command Complete
+// event are returned, less the status.  Events other than the command's
+// completion are dropped, so Command is meant for setting up the
+// controller, before the host stack takes over.
+func (h *HCI) Command(opcode uint16, params []byte) ([]byte, error) {
+	var hdr [3]byte
+	binary.LittleEndian.PutUint16(hdr[:], opcode)
+	hdr[2] = uint8(len(params))
+	if err := h.WritePacket(HCIPacketCommand, append(hdr[:], params...)); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(hciTimeout)
+	for time.Now().Before(deadline) {
+		typ, pkt, err := h.ReadPacket(time.Until(deadline))
+		if err != nil {
+			return nil, err
+		}
+		if typ != HCIPacketEvent {
+			continue
+		}
+		switch pkt[0] {
+		case hciEventCommandComplete:
+			// num packets, opcode, status, return parameters
+			if len(pkt) < 6 || binary.LittleEndian.Uint16(pkt[3:]) != opcode {
+				continue
+			}
+			if pkt[5] != 0 {
+				return nil, ErrHCIStatus
+			}
+			return pkt[6:], nil
+		case hciEventCommandStatus:
+			// status, num packets, opcode
+			if len(pkt) < 6 || binary.LittleEndian.Uint16(pkt[4:]) != opcode {
+				continue
+			}
+			if pkt[2] != 0 {
+				return nil, ErrHCIStatus
+			}
+			return nil, nil
+		}
+	}
+
+	return nil, ErrHCITimeout
+}
+
+func (h *HCI) readFull(b []byte, deadline time.Time) error {
+	for i := range b {
+		c, err := h.readByte(deadline)
+		if err != nil {
+			return err
+		}
+		b[i] = c
+	}
+	return nil
+}
+
+func (h *HCI) readByte(deadline time.Time) (byte, error) {
+	if b, ok := readByteUntil(h.uart, deadline); ok {
+		return b, nil
+	}
+	return 0, ErrHCITimeout
+}
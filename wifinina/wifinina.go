@@ -39,6 +39,9 @@ var (
 const (
 	maxNetworks = 10
 
+	reasonNoAPFound  = 201
+	reasonAuthFailed = 202
+
 	statusNoShield       connectionStatus = 255
 	statusIdle           connectionStatus = 0
 	statusNoSSIDAvail    connectionStatus = 1
@@ -206,6 +209,9 @@ type wifinina struct {
 
 	params *netlink.ConnectParams
 
+	// Last IP address assigned
+	ip netip.Addr
+
 	netConnected bool
 	driverShown  bool
 	deviceShown  bool
@@ -235,19 +241,24 @@ func (err hwerr) Error() string {
 	return "[wifinina] error: 0x" + hex.EncodeToString([]byte{uint8(err)})
 }
 
-func (w *wifinina) reason() string {
-	reason := w.getReasonCode()
+func reasonString(reason uint8) string {
 	switch reason {
 	case 0:
 		return "unknown failure"
-	case 201:
+	case reasonNoAPFound:
 		return "no AP found"
-	case 202:
+	case reasonAuthFailed:
 		return "auth failed"
 	}
 	return fmt.Sprintf("%d", reason)
 }
 
+func (w *wifinina) notify(event netlink.Event) {
+	if w.notifyCb != nil {
+		w.notifyCb(event)
+	}
+}
+
 func (w *wifinina) connectToAP() error {
 
 	timeout := w.params.ConnectTimeout
@@ -263,6 +274,10 @@ func (w *wifinina) connectToAP() error {
 		fmt.Printf("Connecting to Wifi SSID '%s'...", w.params.Ssid)
 	}
 
+	w.notify(netlink.EventConnecting)
+
+	w.setIPConfig()
+
 	start := time.Now()
 
 	// Start the connection process
@@ -276,13 +291,17 @@ func (w *wifinina) connectToAP() error {
 			if debugging(debugBasic) {
 				fmt.Printf("CONNECTED\r\n")
 			}
-			if w.notifyCb != nil {
-				w.notifyCb(netlink.EventNetUp)
-			}
 			return nil
 		case statusConnectFailed:
+			reason := w.getReasonCode()
 			if debugging(debugBasic) {
-				fmt.Printf("FAILED (%s)\r\n", w.reason())
+				fmt.Printf("FAILED (%s)\r\n", reasonString(reason))
+			}
+			switch reason {
+			case reasonNoAPFound:
+				w.notify(netlink.EventNoAP)
+			case reasonAuthFailed:
+				w.notify(netlink.EventAuthFailure)
 			}
 			return netlink.ErrConnectFailed
 		}
@@ -299,6 +318,53 @@ func (w *wifinina) connectToAP() error {
 	return netlink.ErrConnectTimeout
 }
 
+// setIPConfig applies the static IP, DNS and hostname configuration, which
+// must be set before connecting
+func (w *wifinina) setIPConfig() {
+	if w.params.Hostname != "" {
+		w.setHostname(w.params.Hostname)
+	}
+
+	if w.params.Addr.IsValid() {
+		which := uint8(1)
+		if w.params.Gateway.IsValid() {
+			which = 2
+		}
+		if w.params.Netmask.IsValid() {
+			which = 3
+		}
+		w.setIPAddr(which, ipToUint32(w.params.Addr),
+			ipToUint32(w.params.Gateway), ipToUint32(w.params.Netmask))
+	}
+
+	// The firmware takes up to 2 DNS servers
+	switch len(w.params.DNS) {
+	case 0:
+	case 1:
+		w.setDNS(1, ipToUint32(w.params.DNS[0]), 0)
+	default:
+		w.setDNS(2, ipToUint32(w.params.DNS[0]), ipToUint32(w.params.DNS[1]))
+	}
+}
+
+// validIPConfig checks the static IP configuration is IPv4
+func validIPConfig(params *netlink.ConnectParams) bool {
+	for _, ip := range append([]netip.Addr{params.Addr, params.Netmask, params.Gateway}, params.DNS...) {
+		if ip.IsValid() && !ip.Is4() {
+			return false
+		}
+	}
+	return true
+}
+
+func ipToUint32(ip netip.Addr) uint32 {
+	if !ip.Is4() {
+		return 0
+	}
+	b := ip.As4()
+	return binary.BigEndian.Uint32(b[:])
+}
+
 func (w *wifinina) netDisconnect() {
 	w.disconnect()
 }
@@ -371,10 +437,14 @@ func (w *wifinina) showDevice() {
 func (w *wifinina) showIP() {
 	if debugging(debugBasic) {
 		ip, subnet, gateway := w.getIP()
+		how := "Static"
+		if !w.params.Addr.IsValid() {
+			how = "DHCP-assigned"
+		}
 		fmt.Printf("\r\n")
-		fmt.Printf("DHCP-assigned IP         : %s\r\n", ip)
-		fmt.Printf("DHCP-assigned subnet     : %s\r\n", subnet)
-		fmt.Printf("DHCP-assigned gateway    : %s\r\n", gateway)
+		fmt.Printf("%-25s: %s\r\n", how+" IP", ip)
+		fmt.Printf("%-25s: %s\r\n", how+" subnet", subnet)
+		fmt.Printf("%-25s: %s\r\n", how+" gateway", gateway)
 		fmt.Printf("\r\n")
 	}
 }
@@ -396,16 +466,19 @@ func (w *wifinina) watchdog() {
 					fmt.Printf("Watchdog: FAULT: %s\r\n", w.fault)
 				}
 				w.netDisconnect()
-				w.netConnect(true)
+				err := w.netConnect(true)
 				w.fault = nil
+				if err == nil {
+					w.notify(netlink.EventWatchdogRecovery)
+				}
 			} else if w.networkDown() {
 				if debugging(debugBasic) {
 					fmt.Printf("Watchdog: Wifi NOT CONNECTED, trying again...\r\n")
 				}
-				if w.notifyCb != nil {
-					w.notifyCb(netlink.EventNetDown)
+				w.notify(netlink.EventNetDown)
+				if w.netConnect(false) == nil {
+					w.notify(netlink.EventWatchdogRecovery)
 				}
-				w.netConnect(false)
 			}
 			w.mu.Unlock()
 		}
@@ -434,6 +507,18 @@ func (w *wifinina) netConnect(reset bool) error {
 	}
 
 	w.showIP()
+
+	// The firmware runs DHCP once connected
+	ip, _, _ := w.getIP()
+	if !w.params.Addr.IsValid() {
+		w.notify(netlink.EventDHCPBound)
+	}
+	if w.ip.IsValid() && w.ip != ip {
+		w.notify(netlink.EventIPChanged)
+	}
+	w.ip = ip
+	w.notify(netlink.EventNetUp)
+
 	return nil
 }
 
@@ -446,6 +531,10 @@ func (w *wifinina) NetConnect(params *netlink.ConnectParams) error {
 		return netlink.ErrConnected
 	}
 
+	if !validIPConfig(params) {
+		return netlink.ErrNotSupported
+	}
+
 	w.params = params
 
 	w.showDriver()
@@ -486,15 +575,52 @@ func (w *wifinina) NetDisconnect() {
 		fmt.Printf("\r\nDisconnected from Wifi SSID '%s'\r\n\r\n", w.params.Ssid)
 	}
 
-	if w.notifyCb != nil {
-		w.notifyCb(netlink.EventNetDown)
-	}
+	w.notify(netlink.EventNetDown)
 }
 
 func (w *wifinina) NetNotify(cb func(netlink.Event)) {
 	w.notifyCb = cb
 }
 
+func (w *wifinina) NetScan() ([]netlink.ScanResult, error) {
+
+	if debugging(debugNetdev) {
+		fmt.Printf("[NetScan]\r\n")
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Bring up the device to scan if not connected
+	if !w.netConnected {
+		w.showDriver()
+		w.setupSPI()
+		w.start()
+		defer w.stop()
+	}
+
+	num := w.scan()
+	if w.fault != nil {
+		err := w.fault
+		w.fault = nil
+		return nil, err
+	}
+
+	results := make([]netlink.ScanResult, 0, num)
+	for i := 0; i < int(num) && i < maxNetworks; i++ {
+		bssid := w.getNetworkBSSID(i)
+		results = append(results, netlink.ScanResult{
+			Ssid:     w.getNetworkSSID(i),
+			Bssid:    append(net.HardwareAddr{}, bssid...),
+			Rssi:     int(w.getNetworkRSSI(i)),
+			Channel:  int(w.getNetworkChannel(i)),
+			AuthType: toAuthType(w.getNetworkEncrType(i)),
+		})
+	}
+
+	return results, nil
+}
+
 func (w *wifinina) GetHostByName(name string) (netip.Addr, error) {
 
 	if debugging(debugNetdev) {
@@ -535,6 +661,30 @@ func (w *wifinina) GetHardwareAddr() (net.HardwareAddr, error) {
 	return w.getMACAddr(), nil
 }
 
+func (w *wifinina) GetLinkStatus() (netlink.LinkStatus, error) {
+
+	if debugging(debugNetdev) {
+		fmt.Printf("[GetLinkStatus]\r\n")
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.netConnected || w.networkDown() {
+		return netlink.LinkStatus{}, netlink.ErrNotConnected
+	}
+
+	// The firmware doesn't report the channel and DNS servers, only the
+	// configured DNS servers are known
+	var status netlink.LinkStatus
+	status.DNS = w.params.DNS
+	status.Rssi = int(w.getCurrentRSSI())
+	status.Bssid = append(net.HardwareAddr{}, w.getCurrentBSSID()...)
+	status.Addr, status.Netmask, status.Gateway = w.getIP()
+
+	return status, w.fault
+}
+
 func (w *wifinina) Addr() (netip.Addr, error) {
 
 	if debugging(debugNetdev) {
@@ -1400,6 +1550,20 @@ func (w *wifinina) setPassphraseForAP(ssid string, passphrase string) {
 	w.reqStr2(cmdSetAPPassphrase, ssid, passphrase)
 }
 
+func (w *wifinina) setIPAddr(which uint8, ip uint32, gateway uint32, subnet uint32) {
+	w.waitForChipReady()
+	w.spiChipSelect()
+	w.sendCmd(cmdSetIPConfig, 4)
+	w.sendParam8(which, false)
+	w.sendParam32(ip, false)
+	w.sendParam32(gateway, false)
+	w.sendParam32(subnet, true)
+	w.padTo4(21)
+	w.spiChipDeselect()
+
+	w.waitRspCmd1(cmdSetIPConfig)
+}
+
 func (w *wifinina) setDNS(which uint8, dns1 uint32, dns2 uint32) {
 	w.waitForChipReady()
 	w.spiChipSelect()
@@ -1416,7 +1580,7 @@ func (w *wifinina) setDNS(which uint8, dns1 uint32, dns2 uint32) {
 func (w *wifinina) setHostname(hostname string) {
 	w.waitForChipReady()
 	w.spiChipSelect()
-	w.sendCmd(cmdSetHostname, 3)
+	w.sendCmd(cmdSetHostname, 1)
 	w.sendParamStr(hostname, true)
 	w.padTo4(5 + len(hostname))
 	w.spiChipDeselect()
@@ -1436,6 +1600,36 @@ func (w *wifinina) startScanNetworks() uint8 {
 	return w.getUint8(w.req0(cmdStartScanNetworks))
 }
 
+// scan starts a network scan and waits for the scan results, returning the
+// number of networks found
+func (w *wifinina) scan() (num uint8) {
+	w.startScanNetworks()
+	for i := 0; i < 10 && num == 0; i++ {
+		time.Sleep(1 * time.Second)
+		// No network found yet is not a fault
+		fault := w.fault
+		num = w.scanNetworks()
+		if num == 0 {
+			w.fault = fault
+		}
+	}
+	return
+}
+
+func toAuthType(enctype encryptionType) netlink.AuthType {
+	switch enctype {
+	case encTypeNone:
+		return netlink.AuthTypeOpen
+	case encTypeWEP:
+		return netlink.AuthTypeWEP
+	case encTypeTKIP:
+		return netlink.AuthTypeWPA
+	case encTypeAuto:
+		return netlink.AuthTypeWPA2Mixed
+	}
+	return netlink.AuthTypeWPA2
+}
+
 func (w *wifinina) PinMode(pin uint8, mode uint8) {
 	if debugging(debugCmd) {
 		fmt.Printf("    [cmdSetPinMode] pin: %d, mode: %d\r\n", pin, mode)